@@ -0,0 +1,63 @@
+package forma
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// DefaultChangeBatchSize is the number of change log entries ConsumeChanges leases when
+// ChangeFeedOptions.BatchSize is not set.
+const DefaultChangeBatchSize = 100
+
+// ChangeFeedOptions controls ConsumeChanges.
+type ChangeFeedOptions struct {
+	// SchemaName limits the feed to one schema. Empty consumes changes of every schema.
+	SchemaName string `json:"schema_name,omitempty"`
+	// BatchSize caps the number of changes leased per call.
+	BatchSize int `json:"batch_size,omitempty"`
+}
+
+// ChangeOperation names the kind of write reported by a ChangeEvent.
+type ChangeOperation string
+
+const (
+	ChangeOperationCreated ChangeOperation = "created"
+	ChangeOperationUpdated ChangeOperation = "updated"
+	ChangeOperationDeleted ChangeOperation = "deleted"
+)
+
+// ChangeEvent reports a write to an entity. Record holds the entity as it is when the event is
+// delivered, so several writes to the same entity may arrive as one event. Events read back from
+// the change log report entities still at their first revision as created and others as updated.
+type ChangeEvent struct {
+	SchemaName string          `json:"schema_name"`
+	RowID      uuid.UUID       `json:"row_id"`
+	Operation  ChangeOperation `json:"operation"`
+	ChangedAt  int64           `json:"changed_at"` // unix milliseconds
+	Deleted    bool            `json:"deleted"`
+	Record     *DataRecord     `json:"record,omitempty"` // nil for tombstones
+}
+
+// ChangeHandler processes a batch of leased changes. The batch is marked flushed only when the
+// handler returns nil; otherwise it is released and delivered again, so handlers must be idempotent.
+type ChangeHandler func(ctx context.Context, changes []*ChangeEvent) error
+
+// WatchOptions controls WatchChanges.
+type WatchOptions struct {
+	// SchemaName selects the schema to watch and is required.
+	SchemaName string `json:"schema_name"`
+	// Condition limits created and updated events to entities matching it. Deleted events are
+	// always delivered because a removed entity can no longer be matched.
+	Condition Condition `json:"-"`
+	// Since (unix milliseconds) replays the changes logged at or after it before live events,
+	// so a reconnecting client can resume from the ChangedAt of the last event it saw.
+	Since *int64 `json:"since,omitempty"`
+	// SinceRowID, together with Since, names the last event the client saw. Changes are replayed
+	// in (ChangedAt, RowID) order strictly after it, so changes logged in the same millisecond are
+	// neither repeated nor skipped.
+	SinceRowID uuid.UUID `json:"since_row_id,omitempty"`
+}
+
+// ChangeListener receives the events of WatchChanges one at a time. Returning an error stops the watch.
+type ChangeListener func(ctx context.Context, change *ChangeEvent) error
@@ -238,6 +238,145 @@ func (i *CSVImporter) processBatch(ctx context.Context, batch []forma.EntityOper
 	return len(batchResult.Successful), errors
 }
 
+// BulkImportFromFile imports CSV data from a file using the COPY-based bulk load path.
+func (i *CSVImporter) BulkImportFromFile(ctx context.Context, filePath string) (*ImportResult, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CSV file: %w", err)
+	}
+	defer file.Close()
+
+	return i.BulkImportFromReader(ctx, file)
+}
+
+// BulkImportFromReader imports CSV data through EntityManager.BulkLoad, streaming mapped rows instead
+// of batching them through BatchCreate. Errors are reported per CSV row as in ImportFromReader.
+func (i *CSVImporter) BulkImportFromReader(ctx context.Context, reader io.Reader) (*ImportResult, error) {
+	startTime := time.Now()
+
+	csvReader := csv.NewReader(reader)
+	csvReader.TrimLeadingSpace = true
+
+	header, err := csvReader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	result := &ImportResult{
+		Errors: make([]*ImportError, 0),
+	}
+
+	iterator := &csvEntityIterator{
+		reader: csvReader,
+		header: header,
+		mapper: i.mapper,
+		logger: i.logger,
+		result: result,
+		rowNum: 1, // Header is row 1
+	}
+
+	loadResult, loadErr := i.entityManager.BulkLoad(ctx, i.mapper.SchemaName(), iterator)
+	if loadResult == nil {
+		return nil, fmt.Errorf("bulk load failed: %w", loadErr)
+	}
+
+	result.SuccessCount = loadResult.Loaded
+	result.FailedCount += len(loadResult.Failed)
+	for _, failed := range loadResult.Failed {
+		importErr := &ImportError{
+			RowNumber: iterator.rowNumbers[failed.Index],
+			Reason:    failed.Error,
+		}
+		i.logger.Error(importErr.Error())
+		result.Errors = append(result.Errors, importErr)
+	}
+
+	result.Duration = time.Since(startTime)
+	i.logger.Infof("%s", result.Summary())
+
+	// A cancelled or failed load still reports the rows it got through.
+	if loadErr != nil {
+		return result, fmt.Errorf("bulk load failed: %w", loadErr)
+	}
+	return result, nil
+}
+
+// csvEntityIterator adapts CSV rows to forma.EntityIterator. Rows that fail to parse or map are
+// recorded in result and skipped, so BulkLoad only sees mappable rows.
+type csvEntityIterator struct {
+	reader     *csv.Reader
+	header     []string
+	mapper     CSVToSchemaMapper
+	logger     *zap.SugaredLogger
+	result     *ImportResult
+	rowNum     int
+	rowNumbers []int // CSV row number of each yielded entity, indexed by iterator position
+	current    map[string]any
+	err        error
+}
+
+func (it *csvEntityIterator) Next() bool {
+	for {
+		it.rowNum++
+		record, err := it.reader.Read()
+		if err == io.EOF {
+			return false
+		}
+		if err != nil {
+			if _, ok := err.(*csv.ParseError); !ok {
+				it.err = err
+				return false
+			}
+			it.logger.Errorf("row %d: CSV parsing error: %v", it.rowNum, err)
+			it.result.FailedCount++
+			it.result.Errors = append(it.result.Errors, &ImportError{
+				RowNumber: it.rowNum,
+				Reason:    fmt.Sprintf("CSV parsing error: %v", err),
+			})
+			continue
+		}
+
+		it.result.TotalRows++
+
+		csvRecord := make(map[string]string)
+		for idx, col := range it.header {
+			if idx < len(record) {
+				csvRecord[col] = record[idx]
+			}
+		}
+
+		attributes, err := it.mapper.MapRecord(csvRecord)
+		if err != nil {
+			importErr := &ImportError{
+				RowNumber: it.rowNum,
+				Reason:    err.Error(),
+			}
+			if mappingErr, ok := err.(*MappingError); ok {
+				importErr.CSVColumn = mappingErr.CSVColumn
+				importErr.SchemaPath = mappingErr.SchemaPath
+				importErr.RawValue = mappingErr.RawValue
+				importErr.Reason = mappingErr.Reason
+			}
+			it.logger.Error(importErr.Error())
+			it.result.Errors = append(it.result.Errors, importErr)
+			it.result.FailedCount++
+			continue
+		}
+
+		it.current = attributes
+		it.rowNumbers = append(it.rowNumbers, it.rowNum)
+		return true
+	}
+}
+
+func (it *csvEntityIterator) Data() map[string]any {
+	return it.current
+}
+
+func (it *csvEntityIterator) Err() error {
+	return it.err
+}
+
 // ImportOptions provides additional configuration for import operations.
 type ImportOptions struct {
 	// SkipHeader indicates whether to skip the first row (default: false, first row is header)
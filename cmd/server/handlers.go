@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/lychee-technology/forma"
@@ -16,12 +19,23 @@ func (s *Server) handleCreate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	schemaName, _, err := parsePath(r.URL.Path)
+	schemaName, rowIDStr, err := parsePath(r.URL.Path)
 	if err != nil {
 		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid path: %v", err))
 		return
 	}
-	zap.S().Infow("create request received", "schema", schemaName)
+
+	// POST /api/v1/{schema_name}/{row_id} creates a single entity under a caller-supplied row ID
+	var rowID uuid.UUID
+	if rowIDStr != "" {
+		rowID, err = parseUUID(rowIDStr)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid row_id: %v", err))
+			return
+		}
+	}
+	idempotencyKey := r.Header.Get("Idempotency-Key")
+	zap.S().Infow("create request received", "schema", schemaName, "rowID", rowIDStr, "idempotencyKey", idempotencyKey)
 
 	// Try to read as single object or array
 	var rawBody any
@@ -50,18 +64,35 @@ func (s *Server) handleCreate(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "empty array not allowed")
 		return
 	}
+
+	if rowID != uuid.Nil && !isSingleObject {
+		writeError(w, http.StatusBadRequest, "row_id in path requires a single object body")
+		return
+	}
 	zap.S().Debugw("create payload parsed", "schema", schemaName, "records", len(jsonObjects))
 
 	// Build batch operation
 	operations := make([]forma.EntityOperation, len(jsonObjects))
 	for i, obj := range jsonObjects {
+		data, ok := obj.(map[string]any)
+		if !ok {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("item %d must be an object", i))
+			return
+		}
 		operations[i] = forma.EntityOperation{
 			Type: forma.OperationCreate,
 			EntityIdentifier: forma.EntityIdentifier{
 				SchemaName: schemaName,
-				RowID:      uuid.New(),
+				RowID:      rowID,
 			},
-			Data: obj.(map[string]any),
+			Data: data,
+		}
+		if idempotencyKey != "" {
+			// Each array item gets its own key so a replayed array maps item by item
+			operations[i].IdempotencyKey = idempotencyKey
+			if !isSingleObject {
+				operations[i].IdempotencyKey = fmt.Sprintf("%s/%d", idempotencyKey, i)
+			}
 		}
 	}
 
@@ -83,11 +114,27 @@ func (s *Server) handleCreate(w http.ResponseWriter, r *http.Request) {
 			"row_id":      result.Successful[0].RowID.String(),
 			"schema_name": result.Successful[0].SchemaName,
 			"attributes":  result.Successful[0].Attributes,
+			"meta":        result.Successful[0].Meta,
 		}
 		writeSuccess(w, http.StatusCreated, singleResult)
 		return
 	}
 
+	if isSingleObject && len(result.Failed) > 0 {
+		switch result.Failed[0].Code {
+		case forma.OperationCodeAlreadyExists:
+			writeError(w, http.StatusConflict, result.Failed[0].Error)
+			return
+		case forma.OperationCodeIdempotencyKeyReused, forma.ReferenceCodeDangling:
+			writeError(w, http.StatusUnprocessableEntity, result.Failed[0].Error)
+			return
+		case forma.LimitCodeEntityTooLarge, forma.LimitCodeTooManyAttributes,
+			forma.LimitCodeArrayTooLong, forma.LimitCodeNestingTooDeep:
+			writeError(w, http.StatusRequestEntityTooLarge, result.Failed[0].Error)
+			return
+		}
+	}
+
 	// Return batch result
 	writeSuccess(w, http.StatusCreated, result)
 }
@@ -120,14 +167,35 @@ func (s *Server) handleGet(w http.ResponseWriter, r *http.Request) {
 	// Parse attrs parameter for field projection
 	queryParams := r.URL.Query()
 	attrs := parseAttrs(queryParams)
+	asOf, err := parseAsOf(queryParams)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	expand, err := parseExpand(queryParams)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	queryReq := &forma.QueryRequest{
-		SchemaName: schemaName,
-		RowID:      &rowID,
-		Attrs:      attrs,
+		SchemaName:     schemaName,
+		RowID:          &rowID,
+		Attrs:          attrs,
+		IncludeDeleted: parseIncludeDeleted(queryParams),
+		AsOf:           asOf,
+		Expand:         expand,
 	}
 
 	record, err := s.manager.Get(r.Context(), queryReq)
+	if errors.Is(err, forma.ErrHistoryDisabled) {
+		writeError(w, http.StatusNotImplemented, err.Error())
+		return
+	}
+	if errors.Is(err, forma.ErrInvalidExpand) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	if err != nil {
 		writeError(w, http.StatusNotFound, fmt.Sprintf("record not found: %v", err))
 		return
@@ -170,12 +238,25 @@ func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
 
 	// Parse attrs parameter for field projection
 	attrs := parseAttrs(queryParams)
+	asOf, err := parseAsOf(queryParams)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	expand, err := parseExpand(queryParams)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	queryReq := &forma.QueryRequest{
-		SchemaName:   schemaName,
-		Page:         page,
-		ItemsPerPage: itemsPerPage,
-		Attrs:        attrs,
+		SchemaName:     schemaName,
+		Page:           page,
+		ItemsPerPage:   itemsPerPage,
+		Attrs:          attrs,
+		IncludeDeleted: parseIncludeDeleted(queryParams),
+		AsOf:           asOf,
+		Expand:         expand,
 	}
 
 	if len(sortFields) > 0 {
@@ -185,6 +266,14 @@ func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
 	zap.S().Infow("query request received", "schema", schemaName, "page", page, "itemsPerPage", itemsPerPage, "sortBy", sortFields, "sortOrder", sortOrder, "attrs", attrs)
 
 	result, err := s.manager.Query(r.Context(), queryReq)
+	if errors.Is(err, forma.ErrUnsupportedFilter) || errors.Is(err, forma.ErrInvalidExpand) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("query failed: %v", err))
+		return
+	}
+	if errors.Is(err, forma.ErrHistoryDisabled) {
+		writeError(w, http.StatusNotImplemented, fmt.Sprintf("query failed: %v", err))
+		return
+	}
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, fmt.Sprintf("query failed: %v", err))
 		return
@@ -238,6 +327,18 @@ func (s *Server) handleUpdate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	record, err := s.manager.Update(r.Context(), operation)
+	if errors.Is(err, forma.ErrNotFound) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("update failed: %v", err))
+		return
+	}
+	if errors.Is(err, forma.ErrLimitExceeded) {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("update failed: %v", err))
+		return
+	}
+	if errors.Is(err, forma.ErrImmutableField) || errors.Is(err, forma.ErrDanglingReference) {
+		writeError(w, http.StatusUnprocessableEntity, fmt.Sprintf("update failed: %v", err))
+		return
+	}
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, fmt.Sprintf("update failed: %v", err))
 		return
@@ -267,6 +368,10 @@ func (s *Server) handleSingleDelete(w http.ResponseWriter, r *http.Request, sche
 		writeError(w, http.StatusInternalServerError, fmt.Sprintf("delete failed: %v", err))
 		return
 	}
+	if len(result.Failed) > 0 && result.Failed[0].Code == forma.OperationCodeDeleteRestricted {
+		writeError(w, http.StatusConflict, result.Failed[0].Error)
+		return
+	}
 	zap.S().Infow("delete request completed", "schema", schemaName, "rowID", rowID.String())
 
 	writeSuccess(w, http.StatusOK, result)
@@ -331,6 +436,325 @@ func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
 	writeSuccess(w, http.StatusOK, result)
 }
 
+// handleRestore handles POST /api/v1/{schema_name}/{row_id}/restore
+func (s *Server) handleRestore(w http.ResponseWriter, r *http.Request, schemaName string, rowID uuid.UUID) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	zap.S().Infow("restore request received", "schema", schemaName, "rowID", rowID.String())
+
+	record, err := s.manager.Restore(r.Context(), &forma.EntityOperation{
+		Type: forma.OperationUpdate,
+		EntityIdentifier: forma.EntityIdentifier{
+			SchemaName: schemaName,
+			RowID:      rowID,
+		},
+	})
+	if errors.Is(err, forma.ErrNotFound) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("restore failed: %v", err))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("restore failed: %v", err))
+		return
+	}
+	zap.S().Infow("restore request completed", "schema", schemaName, "rowID", rowID.String())
+
+	writeSuccess(w, http.StatusOK, record)
+}
+
+// handleHistory handles GET /api/v1/{schema_name}/{row_id}/history
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request, schemaName string, rowID uuid.UUID) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	zap.S().Infow("history request received", "schema", schemaName, "rowID", rowID.String())
+
+	history, err := s.manager.GetHistory(r.Context(), schemaName, rowID)
+	if err != nil {
+		if errors.Is(err, forma.ErrHistoryDisabled) {
+			writeError(w, http.StatusNotImplemented, err.Error())
+			return
+		}
+		writeError(w, http.StatusNotFound, fmt.Sprintf("history lookup failed: %v", err))
+		return
+	}
+
+	writeSuccess(w, http.StatusOK, history)
+}
+
+// changeStreamHeartbeat is how often an idle change stream sends a comment to keep proxies from
+// closing the connection.
+const changeStreamHeartbeat = 15 * time.Second
+
+// handleChangeStream handles GET /api/v1/{schema_name}/changes/stream, pushing the schema's changes
+// as Server-Sent Events. Event IDs combine the change time in unix milliseconds with the row ID, so a
+// client reconnecting with Last-Event-ID resumes right after the last change it saw.
+func (s *Server) handleChangeStream(w http.ResponseWriter, r *http.Request, schemaName string) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	condition, err := parseConditionParam(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	since, sinceRowID, err := parseLastEventID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	zap.S().Infow("change stream opened", "schema", schemaName, "since", since)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ctx := r.Context()
+	events := make(chan *forma.ChangeEvent)
+	done := make(chan error, 1)
+	go func() {
+		opts := forma.WatchOptions{SchemaName: schemaName, Condition: condition, Since: since, SinceRowID: sinceRowID}
+		done <- s.manager.WatchChanges(ctx, opts, func(ctx context.Context, change *forma.ChangeEvent) error {
+			select {
+			case events <- change:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+
+	heartbeat := time.NewTicker(changeStreamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case change := <-events:
+			if err := writeSSEEvent(w, changeEventID(change), string(change.Operation), change); err != nil {
+				zap.S().Warnw("failed to write change event", "schema", schemaName, "error", err)
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case err := <-done:
+			if err != nil && ctx.Err() == nil {
+				zap.S().Warnw("change stream failed", "schema", schemaName, "error", err)
+				writeSSEEvent(w, "", "error", APIResponse{Success: false, Error: err.Error()})
+				flusher.Flush()
+			}
+			zap.S().Infow("change stream closed", "schema", schemaName)
+			return
+		}
+	}
+}
+
+// revertRequest is the body of POST /api/v1/{schema_name}/{row_id}/revert
+type revertRequest struct {
+	Revision int64 `json:"revision"`
+}
+
+// handleRevert handles POST /api/v1/{schema_name}/{row_id}/revert
+func (s *Server) handleRevert(w http.ResponseWriter, r *http.Request, schemaName string, rowID uuid.UUID) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req revertRequest
+	if err := readJSONBody(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid json body: %v", err))
+		return
+	}
+	if req.Revision <= 0 {
+		writeError(w, http.StatusBadRequest, "revision must be a positive number")
+		return
+	}
+	zap.S().Infow("revert request received", "schema", schemaName, "rowID", rowID.String(), "revision", req.Revision)
+
+	record, err := s.manager.Revert(r.Context(), schemaName, rowID, req.Revision)
+	if errors.Is(err, forma.ErrHistoryDisabled) {
+		writeError(w, http.StatusNotImplemented, err.Error())
+		return
+	}
+	if errors.Is(err, forma.ErrRevisionNotFound) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("revert failed: %v", err))
+		return
+	}
+	if errors.Is(err, forma.ErrLimitExceeded) {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("revert failed: %v", err))
+		return
+	}
+	if errors.Is(err, forma.ErrImmutableField) || errors.Is(err, forma.ErrDanglingReference) {
+		writeError(w, http.StatusUnprocessableEntity, fmt.Sprintf("revert failed: %v", err))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("revert failed: %v", err))
+		return
+	}
+	zap.S().Infow("revert request completed", "schema", schemaName, "rowID", rowID.String(), "revision", req.Revision)
+
+	writeSuccess(w, http.StatusOK, record)
+}
+
+// purgeRequest is the body of POST /api/v1/purge
+type purgeRequest struct {
+	SchemaName    string `json:"schema_name"`
+	OlderThanDays int    `json:"older_than_days"`
+}
+
+// handlePurge handles POST /api/v1/purge, permanently removing soft-deleted rows older than N days
+func (s *Server) handlePurge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var payload purgeRequest
+	if err := readJSONBody(r, &payload); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid json body: %v", err))
+		return
+	}
+
+	if payload.SchemaName == "" {
+		writeError(w, http.StatusBadRequest, "schema_name is required")
+		return
+	}
+
+	if payload.OlderThanDays < 0 {
+		writeError(w, http.StatusBadRequest, "older_than_days cannot be negative")
+		return
+	}
+	zap.S().Infow("purge request received", "schema", payload.SchemaName, "olderThanDays", payload.OlderThanDays)
+
+	olderThan := time.Duration(payload.OlderThanDays) * 24 * time.Hour
+	purged, err := s.manager.Purge(r.Context(), payload.SchemaName, olderThan)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("purge failed: %v", err))
+		return
+	}
+	zap.S().Infow("purge request completed", "schema", payload.SchemaName, "purged", purged)
+
+	writeSuccess(w, http.StatusOK, map[string]any{"purged": purged})
+}
+
+// readWhereRequest decodes and validates the body shared by update_where and delete_where
+func readWhereRequest(w http.ResponseWriter, r *http.Request) (*forma.WhereRequest, bool) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return nil, false
+	}
+
+	var payload forma.WhereRequest
+	if err := readJSONBody(r, &payload); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid json body: %v", err))
+		return nil, false
+	}
+
+	if payload.SchemaName == "" {
+		writeError(w, http.StatusBadRequest, "schema_name is required")
+		return nil, false
+	}
+
+	if payload.Condition == nil {
+		writeError(w, http.StatusBadRequest, "condition is required")
+		return nil, false
+	}
+
+	return &payload, true
+}
+
+// handleUpdateWhere handles POST /api/v1/update_where, patching every entity matching a condition
+func (s *Server) handleUpdateWhere(w http.ResponseWriter, r *http.Request) {
+	payload, ok := readWhereRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if len(payload.Patch) == 0 {
+		writeError(w, http.StatusBadRequest, "patch is required")
+		return
+	}
+	zap.S().Infow("update_where request received", "schema", payload.SchemaName, "dryRun", payload.DryRun)
+
+	result, err := s.manager.UpdateWhere(r.Context(), payload.SchemaName, payload.Condition, payload.Patch, payload.WhereOptions)
+	if errors.Is(err, forma.ErrDanglingReference) {
+		writeError(w, http.StatusUnprocessableEntity, fmt.Sprintf("update by condition failed: %v", err))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("update by condition failed: %v", err))
+		return
+	}
+	zap.S().Infow("update_where request completed", "schema", payload.SchemaName, "affected", result.Affected, "dryRun", result.DryRun)
+
+	writeSuccess(w, http.StatusOK, result)
+}
+
+// handleDeleteWhere handles POST /api/v1/delete_where, deleting every entity matching a condition
+func (s *Server) handleDeleteWhere(w http.ResponseWriter, r *http.Request) {
+	payload, ok := readWhereRequest(w, r)
+	if !ok {
+		return
+	}
+	zap.S().Infow("delete_where request received", "schema", payload.SchemaName, "dryRun", payload.DryRun)
+
+	result, err := s.manager.DeleteWhere(r.Context(), payload.SchemaName, payload.Condition, payload.WhereOptions)
+	if errors.Is(err, forma.ErrDeleteRestricted) {
+		writeError(w, http.StatusConflict, fmt.Sprintf("delete by condition failed: %v", err))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("delete by condition failed: %v", err))
+		return
+	}
+	zap.S().Infow("delete_where request completed", "schema", payload.SchemaName, "affected", result.Affected, "dryRun", result.DryRun)
+
+	writeSuccess(w, http.StatusOK, result)
+}
+
+// handleBatch handles POST /api/v1/batch, running create/update/upsert/delete operations in order
+func (s *Server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var payload forma.BatchOperation
+	if err := readJSONBody(r, &payload); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid json body: %v", err))
+		return
+	}
+
+	if len(payload.Operations) == 0 {
+		writeError(w, http.StatusBadRequest, "operations cannot be empty")
+		return
+	}
+	zap.S().Infow("batch request received", "count", len(payload.Operations), "atomic", payload.Atomic)
+
+	result, err := s.manager.ExecuteBatch(r.Context(), &payload)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("batch failed: %v", err))
+		return
+	}
+	zap.S().Infow("batch request completed", "count", len(payload.Operations), "successful", len(result.Successful), "failed", len(result.Failed))
+
+	writeSuccess(w, http.StatusOK, result)
+}
+
 // handleSearch handles GET /api/v1/search?page=...&items_per_page=...&q=...&attrs=...
 func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -422,6 +846,32 @@ func (s *Server) apiHandler(w http.ResponseWriter, r *http.Request) {
 
 	zap.S().Infow("handling request", "path", path, "method", r.Method)
 
+	// Row-level actions: /api/v1/{schema_name}/{row_id}/{action}, plus the schema's change stream
+	if schemaName, rowIDStr, action, ok := parseActionPath(path); ok {
+		if rowIDStr == "changes" && action == "stream" {
+			s.handleChangeStream(w, r, schemaName)
+			return
+		}
+
+		rowID, err := parseUUID(rowIDStr)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid row_id: %v", err))
+			return
+		}
+
+		switch action {
+		case "restore":
+			s.handleRestore(w, r, schemaName, rowID)
+		case "history":
+			s.handleHistory(w, r, schemaName, rowID)
+		case "revert":
+			s.handleRevert(w, r, schemaName, rowID)
+		default:
+			writeError(w, http.StatusNotFound, fmt.Sprintf("unknown action: %s", action))
+		}
+		return
+	}
+
 	// For DELETE requests, check if path contains row_id
 	if r.Method == http.MethodDelete {
 		schemaName, rowIDStr, err := parsePath(path)
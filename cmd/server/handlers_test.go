@@ -3,10 +3,15 @@ package main
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/lychee-technology/forma"
@@ -15,6 +20,18 @@ import (
 type mockEntityManager struct {
 	advancedResult *forma.QueryResult
 	advancedErr    error
+	restoreResult  *forma.DataRecord
+	restoreErr     error
+	purgeCount     int64
+	lastPurgeAge   time.Duration
+	lastBatch      *forma.BatchOperation
+	batchResult    *forma.BatchResult
+	lastWhere      *forma.WhereRequest
+	history        []*forma.HistoryEntry
+	lastRevert     int64
+	changes        []*forma.ChangeEvent
+	lastWatch      *forma.WatchOptions
+	lastQuery      *forma.QueryRequest
 }
 
 func (m *mockEntityManager) Create(ctx context.Context, req *forma.EntityOperation) (*forma.DataRecord, error) {
@@ -34,6 +51,7 @@ func (m *mockEntityManager) Delete(ctx context.Context, req *forma.EntityOperati
 }
 
 func (m *mockEntityManager) Query(ctx context.Context, req *forma.QueryRequest) (*forma.QueryResult, error) {
+	m.lastQuery = req
 	if m.advancedResult != nil {
 		return m.advancedResult, m.advancedErr
 	}
@@ -45,6 +63,10 @@ func (m *mockEntityManager) CrossSchemaSearch(ctx context.Context, req *forma.Cr
 }
 
 func (m *mockEntityManager) BatchCreate(ctx context.Context, req *forma.BatchOperation) (*forma.BatchResult, error) {
+	m.lastBatch = req
+	if m.batchResult != nil {
+		return m.batchResult, nil
+	}
 	return nil, fmt.Errorf("not implemented")
 }
 
@@ -56,6 +78,93 @@ func (m *mockEntityManager) BatchDelete(ctx context.Context, req *forma.BatchOpe
 	return nil, fmt.Errorf("not implemented")
 }
 
+func (m *mockEntityManager) ExecuteBatch(ctx context.Context, req *forma.BatchOperation) (*forma.BatchResult, error) {
+	m.lastBatch = req
+	return &forma.BatchResult{TotalCount: len(req.Operations)}, nil
+}
+
+func (m *mockEntityManager) BulkLoad(ctx context.Context, schemaName string, iterator forma.EntityIterator) (*forma.BulkLoadResult, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (m *mockEntityManager) Restore(ctx context.Context, req *forma.EntityOperation) (*forma.DataRecord, error) {
+	if m.restoreResult != nil {
+		return m.restoreResult, nil
+	}
+	if m.restoreErr != nil {
+		return nil, m.restoreErr
+	}
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (m *mockEntityManager) Purge(ctx context.Context, schemaName string, olderThan time.Duration) (int64, error) {
+	m.lastPurgeAge = olderThan
+	return m.purgeCount, nil
+}
+
+func (m *mockEntityManager) UpdateWhere(ctx context.Context, schemaName string, condition forma.Condition, patch map[string]any, opts forma.WhereOptions) (*forma.WhereResult, error) {
+	m.lastWhere = &forma.WhereRequest{SchemaName: schemaName, Condition: condition, Patch: patch, WhereOptions: opts}
+	return &forma.WhereResult{Affected: 3, DryRun: opts.DryRun}, nil
+}
+
+func (m *mockEntityManager) DeleteWhere(ctx context.Context, schemaName string, condition forma.Condition, opts forma.WhereOptions) (*forma.WhereResult, error) {
+	m.lastWhere = &forma.WhereRequest{SchemaName: schemaName, Condition: condition, WhereOptions: opts}
+	return &forma.WhereResult{Affected: 2, DryRun: opts.DryRun}, nil
+}
+
+func (m *mockEntityManager) ConsumeChanges(ctx context.Context, opts forma.ChangeFeedOptions, fn forma.ChangeHandler) (int, error) {
+	return 0, fmt.Errorf("not implemented")
+}
+
+func (m *mockEntityManager) WatchChanges(ctx context.Context, opts forma.WatchOptions, fn forma.ChangeListener) error {
+	m.lastWatch = &opts
+	if m.changes == nil {
+		return forma.ErrNotificationsDisabled
+	}
+	for _, change := range m.changes {
+		if err := fn(ctx, change); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mockEntityManager) ProcessWebhooks(ctx context.Context) (*forma.WebhookResult, error) {
+	return nil, forma.ErrWebhooksDisabled
+}
+
+func (m *mockEntityManager) ListWebhookDeliveries(ctx context.Context, filter forma.WebhookDeliveryFilter) ([]*forma.WebhookDelivery, error) {
+	return nil, forma.ErrWebhooksDisabled
+}
+
+func (m *mockEntityManager) DispatchOutbox(ctx context.Context, sink forma.EventSink, batchSize int) (int, error) {
+	return 0, forma.ErrOutboxDisabled
+}
+
+func (m *mockEntityManager) WithTx(ctx context.Context, fn func(tx forma.EntityManager) error) error {
+	return fn(m)
+}
+
+func (m *mockEntityManager) GetHistory(ctx context.Context, schemaName string, rowID uuid.UUID) ([]*forma.HistoryEntry, error) {
+	if m.history == nil {
+		return nil, forma.ErrHistoryDisabled
+	}
+	return m.history, nil
+}
+
+func (m *mockEntityManager) Revert(ctx context.Context, schemaName string, rowID uuid.UUID, revision int64) (*forma.DataRecord, error) {
+	m.lastRevert = revision
+	if m.history == nil {
+		return nil, forma.ErrHistoryDisabled
+	}
+	for _, entry := range m.history {
+		if entry.Revision == revision && entry.Attributes != nil {
+			return &forma.DataRecord{SchemaName: schemaName, RowID: rowID, Attributes: entry.Attributes}, nil
+		}
+	}
+	return nil, forma.ErrRevisionNotFound
+}
+
 func TestHandleAdvancedQuerySuccess(t *testing.T) {
 	result := &forma.QueryResult{
 		Data: []*forma.DataRecord{
@@ -102,3 +211,374 @@ func TestHandleAdvancedQueryValidation(t *testing.T) {
 		t.Fatalf("expected status 400, got %d", rec.Code)
 	}
 }
+
+func TestHandleQueryExpand(t *testing.T) {
+	manager := &mockEntityManager{advancedResult: &forma.QueryResult{}}
+	server := NewServer(manager)
+	server.RegisterRoutes()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/lead?expand="+url.QueryEscape("visits(limit:5,sort:-scheduledStartAt)"), nil)
+	rr := httptest.NewRecorder()
+	server.mux.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	want := []forma.ExpandSpec{{Relation: "visits", Limit: 5, SortBy: []string{"-scheduledStartAt"}}}
+	if !reflect.DeepEqual(manager.lastQuery.Expand, want) {
+		t.Fatalf("unexpected expand: %+v", manager.lastQuery.Expand)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/lead?expand="+url.QueryEscape("visits(limit:0)"), nil)
+	rr = httptest.NewRecorder()
+	server.mux.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for an invalid expand, got %d", rr.Code)
+	}
+}
+
+func TestRestoreRoute(t *testing.T) {
+	rowID := uuid.New()
+	server := NewServer(&mockEntityManager{
+		restoreResult: &forma.DataRecord{SchemaName: "lead", RowID: rowID},
+	})
+	server.RegisterRoutes()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/lead/"+rowID.String()+"/restore", nil)
+	rr := httptest.NewRecorder()
+	server.mux.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/lead/"+rowID.String()+"/unknown", nil)
+	rr = httptest.NewRecorder()
+	server.mux.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404 for unknown action, got %d", rr.Code)
+	}
+
+	for _, tc := range []struct {
+		err  error
+		code int
+	}{
+		{fmt.Errorf("failed to restore persistent record: %w", forma.ErrNotFound), http.StatusNotFound},
+		{fmt.Errorf("failed to restore persistent record: connection reset"), http.StatusInternalServerError},
+	} {
+		server := NewServer(&mockEntityManager{restoreErr: tc.err})
+		server.RegisterRoutes()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/lead/"+rowID.String()+"/restore", nil)
+		rr := httptest.NewRecorder()
+		server.mux.ServeHTTP(rr, req)
+		if rr.Code != tc.code {
+			t.Fatalf("expected status %d for %v, got %d", tc.code, tc.err, rr.Code)
+		}
+	}
+}
+
+func TestHistoryRoute(t *testing.T) {
+	rowID := uuid.New()
+	manager := &mockEntityManager{
+		history: []*forma.HistoryEntry{
+			{Revision: 1, Operation: forma.HistoryOperationCreate, ChangedAt: 1000, Actor: "alice", Attributes: map[string]any{"stage": "new"}},
+			{Revision: 2, Operation: forma.HistoryOperationUpdate, ChangedAt: 2000, Actor: "bob", Attributes: map[string]any{"stage": "contacted"}},
+		},
+	}
+	server := NewServer(manager)
+	server.RegisterRoutes()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/lead/"+rowID.String()+"/history", nil)
+	rr := httptest.NewRecorder()
+	server.mux.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var history []forma.HistoryEntry
+	if err := json.Unmarshal(rr.Body.Bytes(), &history); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(history) != 2 || history[1].Actor != "bob" || history[1].Attributes["stage"] != "contacted" {
+		t.Fatalf("unexpected history: %+v", history)
+	}
+
+	server = NewServer(&mockEntityManager{})
+	server.RegisterRoutes()
+	rr = httptest.NewRecorder()
+	server.mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/lead/"+rowID.String()+"/history", nil))
+	if rr.Code != http.StatusNotImplemented {
+		t.Fatalf("expected status 501 with history disabled, got %d", rr.Code)
+	}
+}
+
+func TestRevertRoute(t *testing.T) {
+	rowID := uuid.New()
+	manager := &mockEntityManager{
+		history: []*forma.HistoryEntry{
+			{Revision: 1, Operation: forma.HistoryOperationCreate, Attributes: map[string]any{"phone": "555-0100"}},
+			{Revision: 2, Operation: forma.HistoryOperationUpdate, Attributes: map[string]any{}},
+		},
+	}
+	server := NewServer(manager)
+	server.RegisterRoutes()
+
+	revert := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/lead/"+rowID.String()+"/revert", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		server.mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := revert(`{"revision": 1}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if manager.lastRevert != 1 || !strings.Contains(rr.Body.String(), "555-0100") {
+		t.Fatalf("unexpected revert response: %s", rr.Body.String())
+	}
+
+	if rr := revert(`{"revision": 7}`); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404 for unknown revision, got %d", rr.Code)
+	}
+	if rr := revert(`{}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 without revision, got %d", rr.Code)
+	}
+}
+
+func TestChangeStreamRoute(t *testing.T) {
+	rowID := uuid.New()
+	manager := &mockEntityManager{
+		changes: []*forma.ChangeEvent{
+			{SchemaName: "lead", RowID: rowID, Operation: forma.ChangeOperationUpdated, ChangedAt: 2000, Record: &forma.DataRecord{SchemaName: "lead", RowID: rowID}},
+			{SchemaName: "lead", RowID: rowID, Operation: forma.ChangeOperationDeleted, ChangedAt: 3000, Deleted: true},
+		},
+	}
+	server := NewServer(manager)
+	server.RegisterRoutes()
+
+	condition := url.QueryEscape(`{"a":"stage","v":"equals:new"}`)
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/lead/changes/stream?condition="+condition, nil)
+	lastRowID := uuid.New()
+	req.Header.Set("Last-Event-ID", "1500-"+lastRowID.String())
+	rr := httptest.NewRecorder()
+	server.mux.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected text/event-stream, got %q", ct)
+	}
+	body := rr.Body.String()
+	if !strings.Contains(body, "id: 2000-"+rowID.String()+"\nevent: updated\ndata: {") || !strings.Contains(body, "id: 3000-"+rowID.String()+"\nevent: deleted\n") {
+		t.Fatalf("unexpected stream body: %s", body)
+	}
+	watch := manager.lastWatch
+	if watch == nil || watch.SchemaName != "lead" || watch.Since == nil || *watch.Since != 1500 || watch.SinceRowID != lastRowID || watch.Condition == nil {
+		t.Fatalf("unexpected watch options: %+v", watch)
+	}
+
+	rr = httptest.NewRecorder()
+	server.mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/lead/changes/stream?last_event_id=abc", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for an invalid last event id, got %d", rr.Code)
+	}
+
+	server = NewServer(&mockEntityManager{})
+	server.RegisterRoutes()
+	rr = httptest.NewRecorder()
+	server.mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/lead/changes/stream", nil))
+	if !strings.Contains(rr.Body.String(), "event: error\n") {
+		t.Fatalf("expected an error event with notifications disabled, got %s", rr.Body.String())
+	}
+}
+
+func TestWithActor(t *testing.T) {
+	var actor string
+	handler := withActor(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor = forma.ActorFromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/lead", nil)
+	req.Header.Set("X-Actor", " alice ")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if actor != "alice" {
+		t.Fatalf("expected actor alice, got %q", actor)
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/api/v1/lead", nil))
+	if actor != "" {
+		t.Fatalf("expected no actor without the header, got %q", actor)
+	}
+}
+
+func TestHandlePurge(t *testing.T) {
+	manager := &mockEntityManager{purgeCount: 3}
+	server := &Server{manager: manager}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/purge", bytes.NewReader([]byte(`{"schema_name": "lead", "older_than_days": 30}`)))
+	rr := httptest.NewRecorder()
+	server.handlePurge(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if manager.lastPurgeAge != 30*24*time.Hour {
+		t.Fatalf("expected purge age of 30 days, got %s", manager.lastPurgeAge)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/purge", bytes.NewReader([]byte(`{"older_than_days": 30}`)))
+	rr = httptest.NewRecorder()
+	server.handlePurge(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 without schema_name, got %d", rr.Code)
+	}
+}
+
+func TestHandleBatch(t *testing.T) {
+	manager := &mockEntityManager{}
+	server := &Server{manager: manager}
+
+	payload := []byte(`{
+		"atomic": true,
+		"operations": [
+			{"type": "create", "schemaName": "lead", "data": {"name": "Lead"}},
+			{"type": "create", "schemaName": "visit", "refs": {"leadId": "$ref:0"}},
+			{"type": "delete", "schemaName": "lead", "rowRef": "$ref:0"}
+		]
+	}`)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/batch", bytes.NewReader(payload))
+	rr := httptest.NewRecorder()
+	server.handleBatch(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if manager.lastBatch == nil || !manager.lastBatch.Atomic || len(manager.lastBatch.Operations) != 3 {
+		t.Fatalf("expected atomic batch with 3 operations, got %+v", manager.lastBatch)
+	}
+	if manager.lastBatch.Operations[1].Refs["leadId"] != "$ref:0" {
+		t.Fatalf("expected refs to be decoded, got %v", manager.lastBatch.Operations[1].Refs)
+	}
+	if manager.lastBatch.Operations[2].RowRef != "$ref:0" {
+		t.Fatalf("expected rowRef to be decoded, got %q", manager.lastBatch.Operations[2].RowRef)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/batch", bytes.NewReader([]byte(`{"operations": []}`)))
+	rr = httptest.NewRecorder()
+	server.handleBatch(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for empty batch, got %d", rr.Code)
+	}
+}
+
+func TestHandleCreateWithRowIDAndIdempotencyKey(t *testing.T) {
+	rowID := uuid.New()
+	manager := &mockEntityManager{batchResult: &forma.BatchResult{
+		Successful: []*forma.DataRecord{{SchemaName: "lead", RowID: rowID}},
+		TotalCount: 1,
+	}}
+	server := &Server{manager: manager}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/lead/"+rowID.String(), bytes.NewReader([]byte(`{"name": "Lead"}`)))
+	req.Header.Set("Idempotency-Key", "abc")
+	rr := httptest.NewRecorder()
+	server.handleCreate(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	op := manager.lastBatch.Operations[0]
+	if op.RowID != rowID || op.IdempotencyKey != "abc" {
+		t.Fatalf("expected row ID %s and key abc, got %s and %q", rowID, op.RowID, op.IdempotencyKey)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/lead", bytes.NewReader([]byte(`[{"name": "A"}, {"name": "B"}]`)))
+	req.Header.Set("Idempotency-Key", "abc")
+	rr = httptest.NewRecorder()
+	server.handleCreate(rr, req)
+
+	ops := manager.lastBatch.Operations
+	if ops[0].RowID != uuid.Nil || ops[0].IdempotencyKey != "abc/0" || ops[1].IdempotencyKey != "abc/1" {
+		t.Fatalf("expected generated row IDs and per-item keys, got %+v", ops)
+	}
+
+	manager.batchResult = &forma.BatchResult{
+		Failed:     []forma.OperationError{{Code: forma.OperationCodeAlreadyExists, Error: "entity already exists"}},
+		TotalCount: 1,
+	}
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/lead/"+rowID.String(), bytes.NewReader([]byte(`{"name": "Lead"}`)))
+	rr = httptest.NewRecorder()
+	server.handleCreate(rr, req)
+
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("expected status 409, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	manager.batchResult = &forma.BatchResult{
+		Failed:     []forma.OperationError{{Code: forma.LimitCodeArrayTooLong, Error: "ARRAY_TOO_LONG: communications is 40000, limit is 1000"}},
+		TotalCount: 1,
+	}
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/lead/"+rowID.String(), bytes.NewReader([]byte(`{"name": "Lead"}`)))
+	rr = httptest.NewRecorder()
+	server.handleCreate(rr, req)
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected status 413, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestHandleUpdateWhereAndDeleteWhere(t *testing.T) {
+	manager := &mockEntityManager{}
+	server := &Server{manager: manager}
+
+	payload := []byte(`{
+		"schema_name": "lead",
+		"condition": {"l": "and", "c": [{"a": "ownerUserId", "v": "equals:agent-1"}, {"a": "status", "v": "equals:open"}]},
+		"patch": {"ownerUserId": "agent-2"},
+		"dry_run": true
+	}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/update_where", bytes.NewReader(payload))
+	rr := httptest.NewRecorder()
+	server.handleUpdateWhere(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if manager.lastWhere == nil || !manager.lastWhere.DryRun || manager.lastWhere.Patch["ownerUserId"] != "agent-2" {
+		t.Fatalf("expected dry-run update with patch, got %+v", manager.lastWhere)
+	}
+	if _, ok := manager.lastWhere.Condition.(*forma.CompositeCondition); !ok {
+		t.Fatalf("expected composite condition, got %T", manager.lastWhere.Condition)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/update_where", bytes.NewReader([]byte(`{"schema_name": "lead", "condition": {"a": "status", "v": "open"}}`)))
+	rr = httptest.NewRecorder()
+	server.handleUpdateWhere(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 without patch, got %d", rr.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/delete_where", bytes.NewReader([]byte(`{"schema_name": "lead"}`)))
+	rr = httptest.NewRecorder()
+	server.handleDeleteWhere(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 without condition, got %d", rr.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/delete_where", bytes.NewReader([]byte(`{"schema_name": "lead", "condition": {"a": "status", "v": "lost"}}`)))
+	rr = httptest.NewRecorder()
+	server.handleDeleteWhere(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if manager.lastWhere.DryRun || manager.lastWhere.SchemaName != "lead" {
+		t.Fatalf("unexpected delete request %+v", manager.lastWhere)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/lychee-technology/forma"
 	"github.com/lychee-technology/forma/internal"
+	"github.com/lychee-technology/forma/outbox"
 	"go.uber.org/zap"
 )
 
@@ -33,13 +34,17 @@ func (s *Server) RegisterRoutes() {
 	// API routes - use custom path matching in handlers
 	s.mux.HandleFunc("/api/v1/advanced_query", s.handleAdvancedQuery)
 	s.mux.HandleFunc("/api/v1/search", s.handleSearch)
+	s.mux.HandleFunc("/api/v1/purge", s.handlePurge)
+	s.mux.HandleFunc("/api/v1/batch", s.handleBatch)
+	s.mux.HandleFunc("/api/v1/update_where", s.handleUpdateWhere)
+	s.mux.HandleFunc("/api/v1/delete_where", s.handleDeleteWhere)
 	s.mux.HandleFunc("/api/v1/", s.apiHandler)
 }
 
 // Start starts the HTTP server on the given port
 func (s *Server) Start(port string) error {
 	zap.S().Infow("starting server", "port", port)
-	return http.ListenAndServe(":"+port, s.mux)
+	return http.ListenAndServe(":"+port, withActor(s.mux))
 }
 
 func main() {
@@ -76,6 +81,15 @@ func main() {
 		EAVData:        getEnv("EAV_TABLE", "eav_data_dev"),
 		EntityMain:     getEnv("ENTITY_MAIN_TABLE", "entity_main_dev"),
 		ChangeLog:      getEnv("CHANGE_LOG_TABLE", "change_log_dev"),
+		// Required for Idempotency-Key support on create
+		IdempotencyKeys: getEnv("IDEMPOTENCY_TABLE", "idempotency_keys_dev"),
+		// Required for the entity history API
+		History: getEnv("HISTORY_TABLE", "entity_history_dev"),
+		// Required for webhooks
+		WebhookDeliveries: getEnv("WEBHOOK_DELIVERIES_TABLE", "webhook_deliveries_dev"),
+		ChangeCursors:     getEnv("CHANGE_CURSORS_TABLE", "change_cursors_dev"),
+		// Optional; writes only fill the outbox when a table is named
+		Outbox: os.Getenv("OUTBOX_TABLE"),
 	}
 
 	// Create database connection pool
@@ -100,10 +114,41 @@ func main() {
 	// Set database configuration
 	config.Database = dbConfig
 	config.Database.TableNames = tableNames
+	// Postgres channel announcing writes for the change stream
+	config.Database.NotifyChannel = getEnv("NOTIFY_CHANNEL", "forma_changes")
+
+	// Key file for x-encrypted attributes
+	config.Encryption.KeyFile = os.Getenv("ENCRYPTION_KEY_FILE")
+
+	// Webhook subscriptions; webhooks consume the change feed, so they stay off unless configured
+	if path := os.Getenv("WEBHOOKS_FILE"); path != "" {
+		subscriptions, err := loadWebhookSubscriptions(path)
+		if err != nil {
+			sugar.Fatalf("failed to load webhook subscriptions: %v", err)
+		}
+		config.Webhooks.Subscriptions = subscriptions
+	}
+	if err := config.Validate(); err != nil {
+		sugar.Fatalf("invalid configuration: %v", err)
+	}
 
 	// Initialize EntityManager
 	manager := NewEntityManager(config)
 
+	if len(config.Webhooks.Subscriptions) > 0 {
+		interval := time.Duration(getEnvInt("WEBHOOK_POLL_INTERVAL_SECONDS", 5)) * time.Second
+		go runWebhooks(context.Background(), manager, interval)
+	}
+
+	if tableNames.Outbox != "" {
+		sink, err := outbox.ParseSink(getEnv("OUTBOX_SINK", "stdout"))
+		if err != nil {
+			sugar.Fatalf("failed to create outbox sink: %v", err)
+		}
+		dispatcher := outbox.NewDispatcher(manager, sink, outbox.DispatcherOptions{})
+		go dispatcher.Run(context.Background())
+	}
+
 	server := NewServer(manager)
 	server.RegisterRoutes()
 
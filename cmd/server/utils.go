@@ -3,15 +3,30 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/lychee-technology/forma"
 )
 
+// actorHeader names the caller recorded as the actor of writes in the entity history.
+const actorHeader = "X-Actor"
+
+// withActor attributes the writes of each request to the caller named in the X-Actor header.
+func withActor(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if actor := strings.TrimSpace(r.Header.Get(actorHeader)); actor != "" {
+			r = r.WithContext(forma.WithActor(r.Context(), actor))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 // parsePath parses /api/v1/{schema_name} or /api/v1/{schema_name}/{row_id}
 func parsePath(path string) (schemaName string, rowID string, err error) {
 	path = strings.TrimPrefix(path, "/api/v1/")
@@ -33,6 +48,99 @@ func parsePath(path string) (schemaName string, rowID string, err error) {
 	}
 }
 
+// parseActionPath parses /api/v1/{schema_name}/{row_id}/{action}. ok is false when the path
+// does not have exactly three segments.
+func parseActionPath(path string) (schemaName string, rowID string, action string, ok bool) {
+	path = strings.TrimPrefix(path, "/api/v1/")
+	path = strings.Trim(path, "/")
+
+	parts := strings.Split(path, "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", "", "", false
+	}
+
+	return parts[0], parts[1], parts[2], true
+}
+
+// parseIncludeDeleted reports whether the include_deleted query parameter is set to a true value
+func parseIncludeDeleted(queryParams url.Values) bool {
+	includeDeleted, err := strconv.ParseBool(queryParams.Get("include_deleted"))
+	return err == nil && includeDeleted
+}
+
+// parseAsOf parses the as_of query parameter as an RFC 3339 timestamp. It returns nil when absent.
+func parseAsOf(queryParams url.Values) (*time.Time, error) {
+	raw := queryParams.Get("as_of")
+	if raw == "" {
+		return nil, nil
+	}
+	asOf, err := time.Parse(time.RFC3339Nano, raw)
+	if err != nil {
+		return nil, fmt.Errorf("as_of must be an RFC 3339 timestamp: %w", err)
+	}
+	return &asOf, nil
+}
+
+// parseExpand parses every expand query parameter, such as expand=visits(limit:5,sort:-scheduledStartAt).
+func parseExpand(queryParams url.Values) ([]forma.ExpandSpec, error) {
+	var specs []forma.ExpandSpec
+	for _, raw := range queryParams["expand"] {
+		parsed, err := forma.ParseExpand(raw)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, parsed...)
+	}
+	return specs, nil
+}
+
+// changeEventID returns the SSE event ID of change. IDs order events like the change log replay,
+// by change time and then row ID, so every event has a distinct position to resume from.
+func changeEventID(change *forma.ChangeEvent) string {
+	return strconv.FormatInt(change.ChangedAt, 10) + "-" + change.RowID.String()
+}
+
+// parseLastEventID returns the position a change stream resumes from, taken from the Last-Event-ID
+// header or, for clients that cannot set headers, the last_event_id query parameter. It accepts the
+// IDs written by changeEventID as well as bare change times, which resume at that millisecond and
+// return uuid.Nil. It returns nil when neither is set.
+func parseLastEventID(r *http.Request) (*int64, uuid.UUID, error) {
+	raw := r.Header.Get("Last-Event-ID")
+	if raw == "" {
+		raw = r.URL.Query().Get("last_event_id")
+	}
+	if raw == "" {
+		return nil, uuid.Nil, nil
+	}
+	rawTime, rawRowID, hasRowID := strings.Cut(raw, "-")
+	since, err := strconv.ParseInt(rawTime, 10, 64)
+	if err != nil {
+		return nil, uuid.Nil, fmt.Errorf("invalid last event id %q: %w", raw, err)
+	}
+	if !hasRowID {
+		return &since, uuid.Nil, nil
+	}
+	rowID, err := uuid.Parse(rawRowID)
+	if err != nil {
+		return nil, uuid.Nil, fmt.Errorf("invalid last event id %q: %w", raw, err)
+	}
+	return &since, rowID, nil
+}
+
+// parseConditionParam parses the condition query parameter as a JSON condition tree. It returns
+// nil when absent.
+func parseConditionParam(queryParams url.Values) (forma.Condition, error) {
+	raw := queryParams.Get("condition")
+	if raw == "" {
+		return nil, nil
+	}
+	condition, err := forma.ParseCondition([]byte(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid condition: %w", err)
+	}
+	return condition, nil
+}
+
 // parsePagination extracts page and items_per_page from query parameters
 func parsePagination(queryParams url.Values) (int, int) {
 	page := 1
@@ -124,6 +232,21 @@ func writeSuccess(w http.ResponseWriter, statusCode int, data any) error {
 	return writeJSON(w, statusCode, data)
 }
 
+// writeSSEEvent writes one Server-Sent Event whose data is the JSON encoding of data
+func writeSSEEvent(w io.Writer, id, event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	return err
+}
+
 // parseUUID parses a UUID string
 func parseUUID(s string) (uuid.UUID, error) {
 	return uuid.Parse(s)
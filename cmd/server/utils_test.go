@@ -4,6 +4,7 @@ import (
 	"net/url"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/lychee-technology/forma"
 )
@@ -79,3 +80,22 @@ func TestParseSortParams(t *testing.T) {
 		})
 	}
 }
+
+func TestParseAsOf(t *testing.T) {
+	asOf, err := parseAsOf(url.Values{})
+	if err != nil || asOf != nil {
+		t.Fatalf("expected no as_of, got %v, %v", asOf, err)
+	}
+
+	asOf, err = parseAsOf(url.Values{"as_of": {"2024-03-01T09:00:00+09:00"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC); !asOf.Equal(want) {
+		t.Fatalf("expected %v, got %v", want, asOf)
+	}
+
+	if _, err := parseAsOf(url.Values{"as_of": {"2024-03-01"}}); err == nil {
+		t.Fatalf("expected an error for a date without time")
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/lychee-technology/forma"
+	"go.uber.org/zap"
+)
+
+// loadWebhookSubscriptions reads a JSON array of webhook subscriptions from path.
+func loadWebhookSubscriptions(path string) ([]forma.WebhookSubscription, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	var subscriptions []forma.WebhookSubscription
+	if err := json.Unmarshal(data, &subscriptions); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return subscriptions, nil
+}
+
+// runWebhooks processes webhooks every interval until ctx is done. A pass that found work is
+// followed by another one straight away so backlogs drain without waiting for the ticker.
+func runWebhooks(ctx context.Context, manager forma.EntityManager, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		result, err := manager.ProcessWebhooks(ctx)
+		if err != nil {
+			zap.S().Warnw("webhook pass failed", "error", err)
+		}
+		if err == nil && result.Enqueued+result.Delivered+result.Retried+result.Dead > 0 {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
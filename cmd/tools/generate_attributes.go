@@ -15,6 +15,7 @@ type attributeSpec struct {
 	AttributeID int    `json:"attributeID"`
 	ValueType   string `json:"valueType"`
 	Required    bool   `json:"required,omitempty"`
+	Encryption  string `json:"encryption,omitempty"`
 }
 
 func runGenerateAttributes(args []string) error {
@@ -117,6 +118,7 @@ func generateAttributesJSON(schemaPath, outputPath string) error {
 			// Attribute still exists in schema: update valueType if changed
 			existingData["valueType"] = spec.ValueType
 			applyRequiredFlag(existingData, spec.Required)
+			applyEncryptionMode(existingData, spec.Encryption)
 		}
 		// Keep the attribute regardless of whether it exists in the new schema
 		result[name] = existingData
@@ -131,6 +133,7 @@ func generateAttributesJSON(schemaPath, outputPath string) error {
 				"valueType":   spec.ValueType,
 			}
 			applyRequiredFlag(result[name], spec.Required)
+			applyEncryptionMode(result[name], spec.Encryption)
 		}
 	}
 
@@ -269,17 +272,23 @@ func traverseSchema(schema map[string]any, path string, insideArray bool, attrib
 					return traverseSchema(items, path, true, attributes, false)
 				}
 			case "string", "integer", "number", "boolean":
+				encryption := getEncryptionMode(schema)
+				if encryption == "" {
+					encryption = getEncryptionMode(items)
+				}
 				attributes[path] = attributeSpec{
-					ValueType: getValueType(items),
-					Required:  pathRequired,
+					ValueType:  getValueType(items),
+					Required:   pathRequired,
+					Encryption: encryption,
 				}
 				return attributes
 			}
 		}
 	default:
 		attributes[path] = attributeSpec{
-			ValueType: getValueType(schema),
-			Required:  pathRequired,
+			ValueType:  getValueType(schema),
+			Required:   pathRequired,
+			Encryption: getEncryptionMode(schema),
 		}
 	}
 
@@ -318,6 +327,28 @@ func applyRequiredFlag(attrData map[string]any, required bool) {
 	delete(attrData, "required")
 }
 
+func applyEncryptionMode(attrData map[string]any, encryption string) {
+	if encryption != "" {
+		attrData["encryption"] = encryption
+		return
+	}
+	delete(attrData, "encryption")
+}
+
+// getEncryptionMode maps the x-encrypted marker to an encryption mode: true selects
+// "randomized", and the strings "randomized" and "deterministic" select themselves.
+func getEncryptionMode(node map[string]any) string {
+	switch marker := node["x-encrypted"].(type) {
+	case bool:
+		if marker {
+			return "randomized"
+		}
+	case string:
+		return marker
+	}
+	return ""
+}
+
 func getSchemaType(node map[string]any) string {
 	switch t := node["type"].(type) {
 	case string:
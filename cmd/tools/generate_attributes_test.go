@@ -861,6 +861,45 @@ func TestGenerateAttributesJSONMarksRequiredAttributes(t *testing.T) {
 	}
 }
 
+func TestGenerateAttributesJSONMarksEncryptedAttributes(t *testing.T) {
+	tempDir := t.TempDir()
+	schemaPath := filepath.Join(tempDir, "schema.json")
+	outputPath := filepath.Join(tempDir, "attributes.json")
+
+	schema := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"income": map[string]any{"type": "number", "x-encrypted": true},
+			"phones": map[string]any{
+				"type":        "array",
+				"items":       map[string]any{"type": "string"},
+				"x-encrypted": "deterministic",
+			},
+			"name": map[string]any{"type": "string"},
+		},
+	}
+	schemaData, _ := json.Marshal(schema)
+	os.WriteFile(schemaPath, schemaData, 0o644)
+
+	if err := generateAttributesJSON(schemaPath, outputPath); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	data, _ := os.ReadFile(outputPath)
+	var result map[string]map[string]any
+	json.Unmarshal(data, &result)
+
+	if result["income"]["encryption"] != "randomized" {
+		t.Errorf("expected randomized encryption for income, got %v", result["income"]["encryption"])
+	}
+	if result["phones"]["encryption"] != "deterministic" {
+		t.Errorf("expected deterministic encryption for phones, got %v", result["phones"]["encryption"])
+	}
+	if _, ok := result["name"]["encryption"]; ok {
+		t.Errorf("did not expect encryption for name attribute")
+	}
+}
+
 func TestGenerateAttributesJSONUpdatesRequiredFlag(t *testing.T) {
 	tempDir := t.TempDir()
 	schemaPath := filepath.Join(tempDir, "schema.json")
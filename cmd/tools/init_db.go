@@ -26,6 +26,11 @@ type initDBOptions struct {
 	eavTable    string
 	entityMain  string
 	changeLog   string
+	idempotency string
+	history     string
+	webhooks    string
+	cursors     string
+	outbox      string
 	schemaDir   string
 }
 
@@ -50,6 +55,11 @@ func runInitDB(args []string) error {
 	flags.StringVar(&opts.eavTable, "eav-table", getenvDefault("EAV_TABLE", "eav_dev"), "EAV data table name")
 	flags.StringVar(&opts.entityMain, "entity-main-table", getenvDefault("ENTITY_MAIN_TABLE", "entity_main_dev"), "Entity main table name")
 	flags.StringVar(&opts.changeLog, "change-log-table", getenvDefault("CHANGE_LOG_TABLE", "change_log_dev"), "Change log table name")
+	flags.StringVar(&opts.idempotency, "idempotency-table", getenvDefault("IDEMPOTENCY_TABLE", "idempotency_keys_dev"), "Idempotency key table name")
+	flags.StringVar(&opts.history, "history-table", getenvDefault("HISTORY_TABLE", "entity_history_dev"), "Entity history table name")
+	flags.StringVar(&opts.webhooks, "webhook-deliveries-table", getenvDefault("WEBHOOK_DELIVERIES_TABLE", "webhook_deliveries_dev"), "Webhook delivery table name")
+	flags.StringVar(&opts.cursors, "change-cursors-table", getenvDefault("CHANGE_CURSORS_TABLE", "change_cursors_dev"), "Change cursor table name")
+	flags.StringVar(&opts.outbox, "outbox-table", getenvDefault("OUTBOX_TABLE", "outbox_dev"), "Outbox table name")
 	flags.StringVar(&opts.schemaDir, "schema-dir", getenvDefault("SCHEMA_DIR", ""), "Directory containing JSON schema files to register (optional)")
 
 	if err := flags.Parse(args); err != nil {
@@ -119,6 +129,11 @@ func ensureTables(ctx context.Context, tx pgx.Tx, opts initDBOptions) error {
 	eavTable := quoteIdentifier(opts.eavTable)
 	entityMain := quoteIdentifier(opts.entityMain)
 	changeLog := quoteIdentifier(opts.changeLog)
+	idempotency := quoteIdentifier(opts.idempotency)
+	history := quoteIdentifier(opts.history)
+	webhooks := quoteIdentifier(opts.webhooks)
+	cursors := quoteIdentifier(opts.cursors)
+	outboxTable := quoteIdentifier(opts.outbox)
 
 	ddlSchema := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
 		schema_name TEXT PRIMARY KEY,
@@ -164,12 +179,19 @@ func ensureTables(ctx context.Context, tx pgx.Tx, opts initDBOptions) error {
 		ltbase_created_at  BIGINT NOT NULL,
 		ltbase_updated_at  BIGINT NOT NULL,
 		ltbase_deleted_at  BIGINT,
+		ltbase_revision    BIGINT NOT NULL DEFAULT 1,
 		PRIMARY KEY (ltbase_schema_id, ltbase_row_id)
 	)`, entityMain)
 
 	if _, err := tx.Exec(ctx, ddlMain); err != nil {
 		return fmt.Errorf("ensure entity main table: %w", err)
 	}
+
+	// Tables created before revisions were tracked lack the column
+	alterMain := fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS ltbase_revision BIGINT NOT NULL DEFAULT 1`, entityMain)
+	if _, err := tx.Exec(ctx, alterMain); err != nil {
+		return fmt.Errorf("add revision column: %w", err)
+	}
 	fmt.Printf("Created entity main table: %s", opts.entityMain)
 
 	ddlEAV := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
@@ -193,6 +215,7 @@ func ensureTables(ctx context.Context, tx pgx.Tx, opts initDBOptions) error {
 			flushed_at BIGINT   NOT NULL DEFAULT 0,
 			changed_at BIGINT   NOT NULL,
 			deleted_at BIGINT,
+			tx_id      XID8     NOT NULL DEFAULT pg_current_xact_id(),
 			primary key (schema_id, row_id, flushed_at)
 		);`, changeLog)
 
@@ -201,6 +224,128 @@ func ensureTables(ctx context.Context, tx pgx.Tx, opts initDBOptions) error {
 	}
 	fmt.Printf("Created change log table: %s\n", opts.changeLog)
 
+	addTxID := fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS tx_id XID8 NOT NULL DEFAULT pg_current_xact_id()`, changeLog)
+	if _, err := tx.Exec(ctx, addTxID); err != nil {
+		return fmt.Errorf("add change log tx_id column: %w", err)
+	}
+
+	idxPending := quoteIdentifier(makeIndexName(opts.changeLog, "pending"))
+	createIdxPending := fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s (changed_at, schema_id, row_id) WHERE flushed_at = 0`, idxPending, changeLog)
+	if _, err := tx.Exec(ctx, createIdxPending); err != nil {
+		return fmt.Errorf("create change log pending index: %w", err)
+	}
+
+	idxTx := quoteIdentifier(makeIndexName(opts.changeLog, "tx"))
+	createIdxTx := fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s (tx_id, schema_id, row_id)`, idxTx, changeLog)
+	if _, err := tx.Exec(ctx, createIdxTx); err != nil {
+		return fmt.Errorf("create change log tx index: %w", err)
+	}
+
+	ddlIdempotency := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			schema_id    SMALLINT NOT NULL,
+			idem_key     TEXT     NOT NULL,
+			request_hash TEXT     NOT NULL,
+			response     JSONB    NOT NULL,
+			created_at   BIGINT   NOT NULL,
+			expires_at   BIGINT   NOT NULL,
+			primary key (schema_id, idem_key)
+		);`, idempotency)
+
+	if _, err := tx.Exec(ctx, ddlIdempotency); err != nil {
+		return fmt.Errorf("ensure idempotency table: %w", err)
+	}
+	fmt.Printf("Created idempotency table: %s\n", opts.idempotency)
+
+	idxExpires := quoteIdentifier(makeIndexName(opts.idempotency, "expires_at"))
+	createIdxExpires := fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s (expires_at)`, idxExpires, idempotency)
+	if _, err := tx.Exec(ctx, createIdxExpires); err != nil {
+		return fmt.Errorf("create idempotency expiry index: %w", err)
+	}
+
+	ddlHistory := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			history_id BIGINT   GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+			schema_id  SMALLINT NOT NULL,
+			row_id     UUID     NOT NULL,
+			revision   BIGINT   NOT NULL,
+			operation  TEXT     NOT NULL,
+			changed_at BIGINT   NOT NULL,
+			actor      TEXT,
+			snapshot   JSONB
+		);`, history)
+
+	if _, err := tx.Exec(ctx, ddlHistory); err != nil {
+		return fmt.Errorf("ensure history table: %w", err)
+	}
+	fmt.Printf("Created history table: %s\n", opts.history)
+
+	idxHistoryRow := quoteIdentifier(makeIndexName(opts.history, "row"))
+	createIdxHistoryRow := fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s (schema_id, row_id, history_id)`, idxHistoryRow, history)
+	if _, err := tx.Exec(ctx, createIdxHistoryRow); err != nil {
+		return fmt.Errorf("create history row index: %w", err)
+	}
+
+	ddlWebhooks := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			delivery_id      BIGINT   GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+			subscription_id  TEXT     NOT NULL,
+			schema_id        SMALLINT NOT NULL,
+			row_id           UUID     NOT NULL,
+			operation        TEXT     NOT NULL,
+			payload          JSONB    NOT NULL,
+			status           TEXT     NOT NULL,
+			attempts         INTEGER  NOT NULL DEFAULT 0,
+			next_attempt_at  BIGINT   NOT NULL,
+			last_status_code INTEGER  NOT NULL DEFAULT 0,
+			last_error       TEXT     NOT NULL DEFAULT '',
+			created_at       BIGINT   NOT NULL,
+			updated_at       BIGINT   NOT NULL
+		);`, webhooks)
+
+	if _, err := tx.Exec(ctx, ddlWebhooks); err != nil {
+		return fmt.Errorf("ensure webhook delivery table: %w", err)
+	}
+	fmt.Printf("Created webhook delivery table: %s\n", opts.webhooks)
+
+	idxWebhooksDue := quoteIdentifier(makeIndexName(opts.webhooks, "due"))
+	createIdxWebhooksDue := fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s (next_attempt_at, delivery_id) WHERE status = 'pending'`, idxWebhooksDue, webhooks)
+	if _, err := tx.Exec(ctx, createIdxWebhooksDue); err != nil {
+		return fmt.Errorf("create webhook due index: %w", err)
+	}
+
+	ddlCursors := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			consumer   TEXT     PRIMARY KEY,
+			tx_id      BIGINT   NOT NULL,
+			schema_id  SMALLINT NOT NULL,
+			row_id     UUID     NOT NULL,
+			updated_at BIGINT   NOT NULL
+		);`, cursors)
+
+	if _, err := tx.Exec(ctx, ddlCursors); err != nil {
+		return fmt.Errorf("ensure change cursor table: %w", err)
+	}
+	fmt.Printf("Created change cursor table: %s\n", opts.cursors)
+
+	ddlOutbox := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			outbox_id     BIGINT   GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+			schema_id     SMALLINT NOT NULL,
+			row_id        UUID     NOT NULL,
+			operation     TEXT     NOT NULL,
+			revision      BIGINT   NOT NULL,
+			committed_at  BIGINT   NOT NULL,
+			snapshot      JSONB,
+			dispatched_at BIGINT   NOT NULL DEFAULT 0
+		);`, outboxTable)
+
+	if _, err := tx.Exec(ctx, ddlOutbox); err != nil {
+		return fmt.Errorf("ensure outbox table: %w", err)
+	}
+	fmt.Printf("Created outbox table: %s\n", opts.outbox)
+
+	idxOutboxPending := quoteIdentifier(makeIndexName(opts.outbox, "pending"))
+	createIdxOutboxPending := fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s (outbox_id) WHERE dispatched_at = 0`, idxOutboxPending, outboxTable)
+	if _, err := tx.Exec(ctx, createIdxOutboxPending); err != nil {
+		return fmt.Errorf("create outbox pending index: %w", err)
+	}
+
 	idxNumeric := quoteIdentifier(makeIndexName(opts.eavTable, "numeric"))
 	createIdxNumeric := fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s (schema_id, attr_id, value_numeric, row_id) WHERE value_numeric IS NOT NULL`, idxNumeric, eavTable)
 	if _, err := tx.Exec(ctx, createIdxNumeric); err != nil {
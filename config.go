@@ -14,7 +14,10 @@ type Config struct {
 	Logging        LoggingConfig     `json:"logging"`
 	Metrics        MetricsConfig     `json:"metrics"`
 	Reference      ReferenceConfig   `json:"reference"`
+	Encryption     EncryptionConfig  `json:"encryption"`
+	Webhooks       WebhookConfig     `json:"webhooks"`
 	SchemaRegistry SchemaRegistry    `json:"-"` // Custom schema registry implementation (optional)
+	KeyProvider    KeyProvider       `json:"-"` // Custom key provider for x-encrypted attributes (optional)
 }
 
 // DatabaseConfig contains database connection settings
@@ -31,6 +34,9 @@ type DatabaseConfig struct {
 	ConnMaxIdleTime time.Duration `json:"connMaxIdleTime"`
 	Timeout         time.Duration `json:"timeout"`
 	TableNames      TableNames    `json:"tableNames"`
+	// NotifyChannel is the Postgres channel every committed write is announced on with NOTIFY.
+	// Empty disables change notifications and WatchChanges.
+	NotifyChannel string `json:"notifyChannel,omitempty"`
 }
 
 // QueryConfig contains query execution settings
@@ -52,9 +58,42 @@ type EntityConfig struct {
 	BatchSize                 int           `json:"batchSize"`
 	CacheEnabled              bool          `json:"cacheEnabled"`
 	CacheTTL                  time.Duration `json:"cacheTTL"`
-	MaxEntitySize             int           `json:"maxEntitySize"`
+	MaxEntitySize             int           `json:"maxEntitySize"` // bytes of serialized JSON, 0 = unlimited
 	EnableVersioning          bool          `json:"enableVersioning"`
 	SchemaDirectory           string        `json:"schemaDirectory"`
+
+	// SoftDelete makes Delete tombstone rows via ltbase_deleted_at instead of removing them.
+	SoftDelete bool `json:"softDelete"`
+	// SoftDeleteOverrides enables or disables soft delete for individual schemas, keyed by schema name.
+	SoftDeleteOverrides map[string]bool `json:"softDeleteOverrides,omitempty"`
+	// IdempotencyTTL is how long create results are kept for Idempotency-Key replays, 0 = 24 hours.
+	IdempotencyTTL time.Duration `json:"idempotencyTTL"`
+	// MaxEAVRows caps the EAV rows a single entity may produce, 0 = unlimited.
+	MaxEAVRows int `json:"maxEAVRows"`
+	// MaxArrayLength caps the element count of any array in an entity, 0 = unlimited.
+	MaxArrayLength int `json:"maxArrayLength"`
+	// MaxNestingDepth caps how deeply objects and arrays may nest, 0 = unlimited.
+	MaxNestingDepth int `json:"maxNestingDepth"`
+	// ImmutableFieldPolicy decides what Update does with changes to readOnly and x-immutable fields.
+	ImmutableFieldPolicy ImmutableFieldPolicy `json:"immutableFieldPolicy"`
+}
+
+// ImmutableFieldPolicy selects how updates to write-protected fields are handled.
+type ImmutableFieldPolicy string
+
+const (
+	// ImmutableFieldPolicyReject fails the update with ErrImmutableField. It is the default.
+	ImmutableFieldPolicyReject ImmutableFieldPolicy = "reject"
+	// ImmutableFieldPolicyIgnore keeps the stored value and applies the rest of the update.
+	ImmutableFieldPolicyIgnore ImmutableFieldPolicy = "ignore"
+)
+
+// SoftDeleteEnabled reports whether deletes for the given schema should be soft deletes.
+func (c EntityConfig) SoftDeleteEnabled(schemaName string) bool {
+	if enabled, ok := c.SoftDeleteOverrides[schemaName]; ok {
+		return enabled
+	}
+	return c.SoftDelete
 }
 
 // TransactionConfig contains transaction settings
@@ -154,7 +193,10 @@ type MetricsConfig struct {
 	EnablePatternMetrics     bool              `json:"enablePatternMetrics"`
 }
 
-// ReferenceConfig contains reference management settings
+// ReferenceConfig contains reference management settings. ValidateOnCreate and ValidateOnUpdate
+// check the x-relation foreign keys of written documents when CheckIntegrity and
+// EntityConfig.EnableReferenceValidation are set too; BatchSize bounds the IDs looked up per query.
+// MaxExpandDepth bounds the number of relations in an expand path such as visit.lead.owner.
 type ReferenceConfig struct {
 	ValidateOnCreate bool                   `json:"validateOnCreate"`
 	ValidateOnUpdate bool                   `json:"validateOnUpdate"`
@@ -167,9 +209,12 @@ type ReferenceConfig struct {
 	CacheTTL         time.Duration          `json:"cacheTTL"`
 	MaxCacheSize     int                    `json:"maxCacheSize"`
 	BatchSize        int                    `json:"batchSize"`
+	MaxExpandDepth   int                    `json:"maxExpandDepth"`
 }
 
-// CascadeRule defines cascade behavior for specific schema relationships
+// CascadeRule defines cascade behavior for specific schema relationships. Deleting an entity of
+// SourceSchema restricts, nullifies or deletes the entities of TargetSchema that reference it
+// through an x-relation foreign key. MaxDepth tightens MaxCascadeDepth for this rule.
 type CascadeRule struct {
 	SourceSchema string        `json:"sourceSchema"`
 	TargetSchema string        `json:"targetSchema"`
@@ -187,6 +232,42 @@ const (
 	CascadeActionRestrict CascadeAction = "restrict"
 )
 
+// WebhookConfig contains webhook delivery settings. Deliveries are enqueued from the change log,
+// which webhooks read through their own cursor without flushing it, so they need
+// TableNames.ChangeLog, TableNames.ChangeCursors and TableNames.WebhookDeliveries and leave the
+// change feed to ConsumeChanges.
+type WebhookConfig struct {
+	Subscriptions []WebhookSubscription `json:"subscriptions,omitempty"`
+	// MaxAttempts is the number of attempts after which a failing delivery is marked dead.
+	MaxAttempts int `json:"maxAttempts"`
+	// InitialBackoff is the delay before the first retry. It doubles with every failed attempt
+	// up to MaxBackoff.
+	InitialBackoff time.Duration `json:"initialBackoff"`
+	MaxBackoff     time.Duration `json:"maxBackoff"`
+	// Timeout bounds each HTTP request.
+	Timeout time.Duration `json:"timeout"`
+	// BatchSize caps the changes read and the deliveries attempted per ProcessWebhooks pass.
+	BatchSize int `json:"batchSize"`
+}
+
+// EncryptionConfig contains field-level encryption settings
+type EncryptionConfig struct {
+	// KeyFile is a local key file used when Config.KeyProvider is not set. See factory.NewFileKeyProvider for the format.
+	KeyFile string `json:"keyFile"`
+}
+
+// KeyProvider supplies the key-encryption keys that wrap the data keys of x-encrypted attributes.
+// Providers backed by a KMS can fetch or unwrap their keys once and serve them from memory.
+type KeyProvider interface {
+	// CurrentKeyID names the key used to encrypt new values. It must not contain ':'.
+	CurrentKeyID() string
+	// Key returns the 32-byte key registered under keyID.
+	Key(keyID string) ([]byte, error)
+	// KeyIDs lists every key that can still decrypt stored values, including CurrentKeyID.
+	// Filters on deterministic attributes match the ciphertext under each of them.
+	KeyIDs() []string
+}
+
 // DefaultConfig returns a default configuration
 func DefaultConfig(schemaRegistry SchemaRegistry) *Config {
 	return &Config{
@@ -218,6 +299,12 @@ func DefaultConfig(schemaRegistry SchemaRegistry) *Config {
 			CacheTTL:                  5 * time.Minute,
 			MaxEntitySize:             1024 * 1024, // 1MB
 			EnableVersioning:          true,
+			SoftDelete:                true,
+			IdempotencyTTL:            24 * time.Hour,
+			MaxEAVRows:                10000,
+			MaxArrayLength:            1000,
+			MaxNestingDepth:           16,
+			ImmutableFieldPolicy:      ImmutableFieldPolicyReject,
 		},
 		Transaction: TransactionConfig{
 			DefaultTimeout:           30 * time.Second,
@@ -314,6 +401,14 @@ func DefaultConfig(schemaRegistry SchemaRegistry) *Config {
 			CacheTTL:         5 * time.Minute,
 			MaxCacheSize:     1000,
 			BatchSize:        100,
+			MaxExpandDepth:   3,
+		},
+		Webhooks: WebhookConfig{
+			MaxAttempts:    8,
+			InitialBackoff: 10 * time.Second,
+			MaxBackoff:     1 * time.Hour,
+			Timeout:        10 * time.Second,
+			BatchSize:      100,
 		},
 	}
 }
@@ -341,6 +436,59 @@ func (c *Config) Validate() error {
 		return &ConfigError{Field: "performance.maxBatchSize", Message: "must be greater than or equal to batchSize"}
 	}
 
+	switch c.Entity.ImmutableFieldPolicy {
+	case "", ImmutableFieldPolicyReject, ImmutableFieldPolicyIgnore:
+	default:
+		return &ConfigError{Field: "entity.immutableFieldPolicy", Message: "must be reject or ignore"}
+	}
+
+	if c.Entity.IdempotencyTTL < 0 {
+		return &ConfigError{Field: "entity.idempotencyTTL", Message: "must not be negative"}
+	}
+
+	limits := []struct {
+		field string
+		value int
+	}{
+		{"entity.maxEntitySize", c.Entity.MaxEntitySize},
+		{"entity.maxEAVRows", c.Entity.MaxEAVRows},
+		{"entity.maxArrayLength", c.Entity.MaxArrayLength},
+		{"entity.maxNestingDepth", c.Entity.MaxNestingDepth},
+	}
+	for _, limit := range limits {
+		if limit.value < 0 {
+			return &ConfigError{Field: limit.field, Message: "must not be negative"}
+		}
+	}
+
+	if c.Reference.MaxCascadeDepth < 0 {
+		return &ConfigError{Field: "reference.maxCascadeDepth", Message: "must not be negative"}
+	}
+	if c.Reference.MaxExpandDepth < 0 {
+		return &ConfigError{Field: "reference.maxExpandDepth", Message: "must not be negative"}
+	}
+	for name, rule := range c.Reference.CascadeRules {
+		if rule.SourceSchema == "" || rule.TargetSchema == "" {
+			return &ConfigError{Field: "reference.cascadeRules." + name, Message: "sourceSchema and targetSchema are required"}
+		}
+		switch rule.Action {
+		case CascadeActionDelete, CascadeActionUpdate, CascadeActionNullify, CascadeActionRestrict:
+		default:
+			return &ConfigError{Field: "reference.cascadeRules." + name, Message: "action must be delete, update, nullify or restrict"}
+		}
+	}
+
+	subscriptionIDs := make(map[string]bool, len(c.Webhooks.Subscriptions))
+	for _, sub := range c.Webhooks.Subscriptions {
+		if sub.ID == "" || sub.SchemaName == "" || sub.URL == "" {
+			return &ConfigError{Field: "webhooks.subscriptions", Message: "id, schema_name and url are required"}
+		}
+		if subscriptionIDs[sub.ID] {
+			return &ConfigError{Field: "webhooks.subscriptions", Message: "duplicate subscription id " + sub.ID}
+		}
+		subscriptionIDs[sub.ID] = true
+	}
+
 	return nil
 }
 
@@ -191,6 +191,28 @@ func TestConfigValidationDetailed(t *testing.T) {
 			expectError: true,
 			errorField:  "performance.maxBatchSize",
 		},
+		{
+			name: "negative array length limit",
+			config: &Config{
+				Database:    DatabaseConfig{MaxConnections: 25},
+				Query:       QueryConfig{DefaultPageSize: 50, MaxPageSize: 100},
+				Performance: PerformanceConfig{BatchSize: 100, MaxBatchSize: 1000},
+				Entity:      EntityConfig{MaxArrayLength: -1},
+			},
+			expectError: true,
+			errorField:  "entity.maxArrayLength",
+		},
+		{
+			name: "unknown immutable field policy",
+			config: &Config{
+				Database:    DatabaseConfig{MaxConnections: 25},
+				Query:       QueryConfig{DefaultPageSize: 50, MaxPageSize: 100},
+				Performance: PerformanceConfig{BatchSize: 100, MaxBatchSize: 1000},
+				Entity:      EntityConfig{ImmutableFieldPolicy: "overwrite"},
+			},
+			expectError: true,
+			errorField:  "entity.immutableFieldPolicy",
+		},
 	}
 
 	for _, tt := range tests {
@@ -244,6 +266,29 @@ func TestCascadeRuleValidation(t *testing.T) {
 	if err != nil {
 		t.Errorf("Expected no error with valid cascade rules, got: %v", err)
 	}
+
+	config.Reference.CascadeRules["user_profile"] = CascadeRule{SourceSchema: "user", TargetSchema: "profile", Action: "archive"}
+	if err := config.Validate(); err == nil {
+		t.Error("Expected an error for an unknown cascade action")
+	}
+
+	config = DefaultConfig(NewMockSchemaRegistry())
+	config.Reference.MaxExpandDepth = -1
+	if err := config.Validate(); err == nil {
+		t.Error("Expected an error for a negative maxExpandDepth")
+	}
+
+	config = DefaultConfig(NewMockSchemaRegistry())
+	config.Database.TableNames.IdempotencyKeys = "idempotency_keys"
+	config.Entity.IdempotencyTTL = 0
+	if err := config.Validate(); err != nil {
+		t.Errorf("Expected a zero idempotencyTTL to fall back to the default, got %v", err)
+	}
+
+	config.Entity.IdempotencyTTL = -time.Hour
+	if err := config.Validate(); err == nil {
+		t.Error("Expected an error for a negative idempotencyTTL")
+	}
 }
 
 func TestBatchConfigDefaults(t *testing.T) {
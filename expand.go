@@ -0,0 +1,94 @@
+package forma
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultExpandLimit is the number of children loaded per parent when an ExpandSpec sets no limit.
+const DefaultExpandLimit = 10
+
+// ErrInvalidExpand is returned for an ExpandSpec that names no x-relation, is deeper than
+// ReferenceConfig.MaxExpandDepth or sorts by an unusable attribute.
+var ErrInvalidExpand = errors.New("invalid expand")
+
+// ExpandSpec asks Get and Query to load the entities related to every returned entity through
+// x-relations. The related entities are returned in DataRecord.Expanded under each relation name.
+type ExpandSpec struct {
+	// Relation is a dot-separated path of relation names, such as "visit.lead.owner". Each name is
+	// either a parent, named after its schema ("lead") or its foreign key without the "Id" or "Ids"
+	// suffix, or a child schema, as is ("visit") or with an "s" suffix ("visits").
+	Relation string `json:"relation"`
+	// Limit caps the children returned per parent by the last relation of the path. Defaults to
+	// DefaultExpandLimit.
+	Limit int `json:"limit,omitempty"`
+	// SortBy orders the children of the last relation of the path by these attributes; a leading
+	// "-" sorts descending.
+	SortBy []string `json:"sort_by,omitempty"`
+}
+
+// ParseExpand parses the expand query parameter: a comma-separated list of relations, each with
+// optional options in parentheses, such as "visits(limit:5,sort:-scheduledStartAt),communications".
+// The sort option may be repeated.
+func ParseExpand(raw string) ([]ExpandSpec, error) {
+	var specs []ExpandSpec
+	for _, item := range splitTopLevel(raw) {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		spec := ExpandSpec{Relation: item}
+		if open := strings.IndexByte(item, '('); open >= 0 {
+			if !strings.HasSuffix(item, ")") {
+				return nil, fmt.Errorf("invalid expand %q: missing closing parenthesis", item)
+			}
+			spec.Relation = strings.TrimSpace(item[:open])
+			for _, option := range strings.Split(item[open+1:len(item)-1], ",") {
+				key, value, ok := strings.Cut(strings.TrimSpace(option), ":")
+				if !ok || value == "" {
+					return nil, fmt.Errorf("invalid expand option %q in %q", option, item)
+				}
+				switch key {
+				case "limit":
+					limit, err := strconv.Atoi(value)
+					if err != nil || limit < 1 {
+						return nil, fmt.Errorf("invalid expand limit %q in %q", value, item)
+					}
+					spec.Limit = limit
+				case "sort":
+					spec.SortBy = append(spec.SortBy, value)
+				default:
+					return nil, fmt.Errorf("unknown expand option %q in %q", key, item)
+				}
+			}
+		}
+		if spec.Relation == "" {
+			return nil, fmt.Errorf("invalid expand %q: relation is required", item)
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// splitTopLevel splits s on the commas that are not inside parentheses.
+func splitTopLevel(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
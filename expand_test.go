@@ -0,0 +1,23 @@
+package forma
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExpand(t *testing.T) {
+	specs, err := ParseExpand("visits(limit:5,sort:-scheduledStartAt,sort:status), communications, visit.lead.owner(limit:1)")
+	require.NoError(t, err)
+	assert.Equal(t, []ExpandSpec{
+		{Relation: "visits", Limit: 5, SortBy: []string{"-scheduledStartAt", "status"}},
+		{Relation: "communications"},
+		{Relation: "visit.lead.owner", Limit: 1},
+	}, specs)
+
+	for _, raw := range []string{"visits(limit:0)", "visits(limit:5", "visits(page:2)", "(limit:5)", "visits(sort)"} {
+		_, err := ParseExpand(raw)
+		assert.Error(t, err, raw)
+	}
+}
@@ -120,8 +120,19 @@ func NewEntityManagerWithConfig(config *forma.Config, pool *pgxpool.Pool) (forma
 	registry := config.SchemaRegistry
 	zap.S().Info("Using provided SchemaRegistry implementation")
 
+	keyProvider := config.KeyProvider
+	if keyProvider == nil && config.Encryption.KeyFile != "" {
+		keyProvider, err = internal.NewFileKeyProvider(config.Encryption.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load encryption keys: %w", err)
+		}
+	}
+
 	// Initialize transformer
-	transformer := internal.NewPersistentRecordTransformer(registry)
+	transformer := internal.NewPersistentRecordTransformerWithOptions(registry, internal.TransformerOptions{
+		Limits:      internal.DocumentLimitsFromConfig(config.Entity),
+		KeyProvider: keyProvider,
+	})
 
 	// Initialize PostgreSQL persistent repository with metadata cache
 	repository := internal.NewPostgresPersistentRecordRepository(
@@ -136,3 +147,12 @@ func NewEntityManagerWithConfig(config *forma.Config, pool *pgxpool.Pool) (forma
 func NewFileSchemaRegistry(pool *pgxpool.Pool, schemaTable string, schemaDir string) (forma.SchemaRegistry, error) {
 	return internal.NewFileSchemaRegistry(pool, schemaTable, schemaDir)
 }
+
+// NewFileKeyProvider loads a KeyProvider for x-encrypted attributes from a local JSON key file:
+//
+//	{"currentKeyId": "2026-10", "keys": {"2026-10": "<base64 of 32 random bytes>"}}
+//
+// Keep retired keys in the file so values encrypted under them remain readable.
+func NewFileKeyProvider(path string) (forma.KeyProvider, error) {
+	return internal.NewFileKeyProvider(path)
+}
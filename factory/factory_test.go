@@ -151,6 +151,7 @@ func createTempTables(t *testing.T, ctx context.Context, pool *pgxpool.Pool) (sc
 			ltbase_created_at BIGINT,
 			ltbase_updated_at BIGINT,
 			ltbase_deleted_at BIGINT,
+			ltbase_revision BIGINT NOT NULL DEFAULT 1,
 			text_01 TEXT,
 			text_02 TEXT,
 			text_03 TEXT,
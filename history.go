@@ -0,0 +1,38 @@
+package forma
+
+import "context"
+
+// HistoryOperation names the kind of write that produced a history entry.
+type HistoryOperation string
+
+const (
+	HistoryOperationCreate  HistoryOperation = "create"
+	HistoryOperationUpdate  HistoryOperation = "update"
+	HistoryOperationDelete  HistoryOperation = "delete"
+	HistoryOperationRestore HistoryOperation = "restore"
+	HistoryOperationPurge   HistoryOperation = "purge"
+)
+
+// HistoryEntry is one stored version of an entity. Attributes hold the full document as written
+// by the operation; they are nil for hard deletes and purges, which leave nothing behind.
+type HistoryEntry struct {
+	Revision   int64            `json:"revision"`
+	Operation  HistoryOperation `json:"operation"`
+	ChangedAt  int64            `json:"changed_at"` // unix milliseconds
+	Actor      string           `json:"actor,omitempty"`
+	Attributes map[string]any   `json:"attributes,omitempty"`
+	Meta       *RecordMeta      `json:"meta,omitempty"`
+}
+
+type actorContextKey struct{}
+
+// WithActor returns a context whose writes are attributed to actor in the entity history.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, actor)
+}
+
+// ActorFromContext returns the actor set by WithActor, or "" when there is none.
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorContextKey{}).(string)
+	return actor
+}
@@ -5,15 +5,27 @@ import "text/template"
 var optimizedQuerySQLTemplate = template.Must(template.New("optimizedQuery").Funcs(template.FuncMap{
 	"add": func(a, b int) int { return a + b },
 }).Parse(`
-        WITH anchor AS (
+        WITH {{ if .AsOf }}{{.AsOf}},
+        {{ end }}anchor AS (
             {{- if .UseMainTableAsAnchor }}
             SELECT m.ltbase_row_id AS row_id
             FROM {{.MainTable}} m
             WHERE m.ltbase_schema_id = {{.SchemaID}} AND {{.Anchor.Condition}}
+            {{- if not .IncludeDeleted }}
+                AND m.ltbase_deleted_at IS NULL
+            {{- end }}
             {{- else }}
             SELECT DISTINCT t.row_id
             FROM {{.EAVTable}} t
             WHERE t.schema_id = {{.SchemaID}} AND {{.Anchor.Condition}}
+            {{- if not .IncludeDeleted }}
+                AND NOT EXISTS (
+                    SELECT 1 FROM {{.MainTable}} dm
+                    WHERE dm.ltbase_schema_id = {{.SchemaID}}
+                        AND dm.ltbase_row_id = t.row_id
+                        AND dm.ltbase_deleted_at IS NOT NULL
+                )
+            {{- end }}
             {{- end }}
         ),
         keys AS (
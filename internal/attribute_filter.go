@@ -100,5 +100,6 @@ func FilterDataRecord(record *forma.DataRecord, attrs []string) *forma.DataRecor
 		SchemaName: record.SchemaName,
 		RowID:      record.RowID,
 		Attributes: FilterAttributes(record.Attributes, attrs),
+		Meta:       record.Meta,
 	}
 }
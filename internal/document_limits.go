@@ -0,0 +1,116 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/lychee-technology/forma"
+)
+
+// DocumentLimits bounds the size and shape of documents accepted by the transformer.
+// A zero field disables the corresponding check.
+type DocumentLimits struct {
+	MaxEntitySize   int // bytes of serialized JSON
+	MaxEAVRows      int
+	MaxArrayLength  int
+	MaxNestingDepth int
+}
+
+// DocumentLimitsFromConfig extracts the document limits from an EntityConfig.
+func DocumentLimitsFromConfig(cfg forma.EntityConfig) DocumentLimits {
+	return DocumentLimits{
+		MaxEntitySize:   cfg.MaxEntitySize,
+		MaxEAVRows:      cfg.MaxEAVRows,
+		MaxArrayLength:  cfg.MaxArrayLength,
+		MaxNestingDepth: cfg.MaxNestingDepth,
+	}
+}
+
+func (l DocumentLimits) enabled() bool {
+	return l.MaxEntitySize > 0 || l.MaxEAVRows > 0 || l.MaxArrayLength > 0 || l.MaxNestingDepth > 0
+}
+
+// checkDocument verifies the serialized size, array lengths and nesting depth of jsonData.
+func (l DocumentLimits) checkDocument(jsonData any) error {
+	if l.MaxEntitySize <= 0 && l.MaxArrayLength <= 0 && l.MaxNestingDepth <= 0 {
+		return nil
+	}
+
+	var raw []byte
+	switch v := jsonData.(type) {
+	case []byte:
+		raw = v
+	case string:
+		raw = []byte(v)
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON data: %w", err)
+		}
+		raw = encoded
+	}
+
+	if l.MaxEntitySize > 0 && len(raw) > l.MaxEntitySize {
+		return &forma.LimitError{Code: forma.LimitCodeEntityTooLarge, Limit: l.MaxEntitySize, Actual: len(raw)}
+	}
+
+	if l.MaxArrayLength <= 0 && l.MaxNestingDepth <= 0 {
+		return nil
+	}
+
+	document, ok := jsonData.(map[string]any)
+	if !ok {
+		if err := json.Unmarshal(raw, &document); err != nil {
+			return fmt.Errorf("failed to unmarshal JSON data: %w", err)
+		}
+	}
+	return l.checkShape(document, "", 1)
+}
+
+// checkShape walks value depth-first; the top-level object is at depth 1.
+func (l DocumentLimits) checkShape(value any, path string, depth int) error {
+	switch v := value.(type) {
+	case map[string]any:
+		if err := l.checkDepth(path, depth); err != nil {
+			return err
+		}
+		for key, child := range v {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			if err := l.checkShape(child, childPath, depth+1); err != nil {
+				return err
+			}
+		}
+	case []any:
+		if err := l.checkDepth(path, depth); err != nil {
+			return err
+		}
+		if l.MaxArrayLength > 0 && len(v) > l.MaxArrayLength {
+			return &forma.LimitError{Code: forma.LimitCodeArrayTooLong, Path: path, Limit: l.MaxArrayLength, Actual: len(v)}
+		}
+		for i, child := range v {
+			if err := l.checkShape(child, path+"["+strconv.Itoa(i)+"]", depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (l DocumentLimits) checkDepth(path string, depth int) error {
+	if l.MaxNestingDepth > 0 && depth > l.MaxNestingDepth {
+		return &forma.LimitError{Code: forma.LimitCodeNestingTooDeep, Path: path, Limit: l.MaxNestingDepth, Actual: depth}
+	}
+	return nil
+}
+
+// checkEAVRows verifies the number of EAV rows an entity produces.
+func (l DocumentLimits) checkEAVRows(count int) error {
+	if l.MaxEAVRows > 0 && count > l.MaxEAVRows {
+		return &forma.LimitError{Code: forma.LimitCodeTooManyAttributes, Limit: l.MaxEAVRows, Actual: count}
+	}
+	return nil
+}
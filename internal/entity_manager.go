@@ -5,7 +5,6 @@ import (
 	"fmt"
 
 	"github.com/lychee-technology/forma"
-	"go.uber.org/zap"
 )
 
 type entityManager struct {
@@ -23,21 +22,12 @@ func NewEntityManager(
 	registry forma.SchemaRegistry,
 	config *forma.Config,
 ) forma.EntityManager {
-	var relationIdx *RelationIndex
-	if config != nil {
-		idx, err := LoadRelationIndex(config.Entity.SchemaDirectory)
-		if err != nil {
-			zap.S().Warnw("failed to load schema relations", "error", err)
-		} else {
-			relationIdx = idx
-		}
-	}
 	return &entityManager{
 		transformer: transformer,
 		repository:  repository,
 		registry:    registry,
 		config:      config,
-		relations:   relationIdx,
+		relations:   NewRelationIndex(registry),
 	}
 }
 
@@ -55,6 +45,16 @@ func (em *entityManager) storageTables() StorageTables {
 	if em.config.Database.TableNames.ChangeLog != "" {
 		tables.ChangeLog = em.config.Database.TableNames.ChangeLog
 	}
+	if em.config.Database.TableNames.IdempotencyKeys != "" {
+		tables.IdempotencyKeys = em.config.Database.TableNames.IdempotencyKeys
+	}
+	if em.config.Entity.EnableVersioning && em.config.Database.TableNames.History != "" {
+		tables.History = em.config.Database.TableNames.History
+	}
+	tables.NotifyChannel = em.config.Database.NotifyChannel
+	tables.WebhookDeliveries = em.config.Database.TableNames.WebhookDeliveries
+	tables.ChangeCursors = em.config.Database.TableNames.ChangeCursors
+	tables.Outbox = em.config.Database.TableNames.Outbox
 	return tables
 }
 
@@ -80,5 +80,20 @@ func (em *entityManager) toDataRecord(ctx context.Context, schemaName string, re
 		SchemaName: resolvedName,
 		RowID:      record.RowID,
 		Attributes: attributes,
+		Meta:       em.recordMeta(resolvedName, record),
 	}, nil
 }
+
+// recordMeta builds the system metadata exposed for record.
+func (em *entityManager) recordMeta(schemaName string, record *PersistentRecord) *forma.RecordMeta {
+	meta := &forma.RecordMeta{
+		CreatedAt: record.CreatedAt,
+		UpdatedAt: record.UpdatedAt,
+		DeletedAt: record.DeletedAt,
+		Revision:  record.Revision,
+	}
+	if _, schema, err := em.registry.GetSchemaByName(schemaName); err == nil {
+		meta.SchemaVersion = schema.Version
+	}
+	return meta
+}
@@ -2,142 +2,327 @@ package internal
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/lychee-technology/forma"
 	"go.uber.org/zap"
 )
 
+const (
+	// batchCodeRolledBack marks operations of an atomic batch that were undone because another operation failed.
+	batchCodeRolledBack = "ROLLED_BACK"
+	// batchCodeTxFailed marks operations of an atomic batch whose transaction could not be started or committed.
+	batchCodeTxFailed = "TRANSACTION_FAILED"
+
+	// batchRefPrefix marks a value that refers to the row ID produced by an earlier batch operation.
+	batchRefPrefix = "$ref:"
+)
+
+// batchOperationFunc executes the operation at index of a batch and returns the resulting record.
+type batchOperationFunc func(ctx context.Context, index int, op *forma.EntityOperation) (*forma.DataRecord, error)
+
+// batchOperationError wraps the failure of one operation inside an atomic batch.
+type batchOperationError struct {
+	index int
+	err   error
+}
+
+func (e *batchOperationError) Error() string {
+	return fmt.Sprintf("operation %d failed: %v", e.index, e.err)
+}
+
+func (e *batchOperationError) Unwrap() error {
+	return e.err
+}
+
 // BatchCreate creates multiple entities atomically
 func (em *entityManager) BatchCreate(ctx context.Context, req *forma.BatchOperation) (*forma.BatchResult, error) {
 	if req == nil {
 		return nil, fmt.Errorf("batch operation cannot be nil")
 	}
-	zap.S().Debugw("BatchCreate called", "operationCount", len(req.Operations))
-	if len(req.Operations) == 0 {
-		return &forma.BatchResult{
-			Successful: make([]*forma.DataRecord, 0),
-			Failed:     make([]forma.OperationError, 0),
-			TotalCount: 0,
-		}, nil
-	}
+	zap.S().Debugw("BatchCreate called", "operationCount", len(req.Operations), "atomic", req.Atomic)
 
-	startTime := time.Now()
+	result := em.runBatch(ctx, req, "CREATE_FAILED", func(ctx context.Context, _ int, op *forma.EntityOperation) (*forma.DataRecord, error) {
+		return em.Create(ctx, op)
+	})
 
-	// For atomic operations, we need transaction support
-	// For now, we'll collect all results and return them
-	successful := make([]*forma.DataRecord, 0)
-	failed := make([]forma.OperationError, 0)
+	zap.S().Debugw("BatchCreate completed", "successfulCount", len(result.Successful), "failedCount", len(result.Failed), "durationMicroseconds", result.Duration)
+	return result, nil
+}
 
-	for _, op := range req.Operations {
-		record, err := em.Create(ctx, &op)
-		if err != nil {
-			zap.S().Warnw("BatchCreate operation failed", "operation", op, "error", err)
-			failed = append(failed, forma.OperationError{
-				Operation: op,
-				Error:     err.Error(),
-				Code:      "CREATE_FAILED",
-			})
-		} else {
-			successful = append(successful, record)
-		}
+// BatchUpdate updates multiple entities atomically
+func (em *entityManager) BatchUpdate(ctx context.Context, req *forma.BatchOperation) (*forma.BatchResult, error) {
+	if req == nil {
+		return nil, fmt.Errorf("batch operation cannot be nil")
 	}
 
-	duration := time.Since(startTime).Microseconds()
-	zap.S().Debugw("BatchCreate completed", "successfulCount", len(successful), "failedCount", len(failed), "durationMicroseconds", duration)
-	return &forma.BatchResult{
-		Successful: successful,
-		Failed:     failed,
-		TotalCount: len(req.Operations),
-		Duration:   duration,
-	}, nil
+	zap.S().Debugw("BatchUpdate called", "operationCount", len(req.Operations), "atomic", req.Atomic)
+
+	return em.runBatch(ctx, req, "UPDATE_FAILED", func(ctx context.Context, _ int, op *forma.EntityOperation) (*forma.DataRecord, error) {
+		return em.Update(ctx, op)
+	}), nil
 }
 
-// BatchUpdate updates multiple entities atomically
-func (em *entityManager) BatchUpdate(ctx context.Context, req *forma.BatchOperation) (*forma.BatchResult, error) {
+// BatchDelete deletes multiple entities atomically
+func (em *entityManager) BatchDelete(ctx context.Context, req *forma.BatchOperation) (*forma.BatchResult, error) {
 	if req == nil {
 		return nil, fmt.Errorf("batch operation cannot be nil")
 	}
 
-	zap.S().Debugw("BatchUpdate called", "operationCount", len(req.Operations))
-	if len(req.Operations) == 0 {
-		return &forma.BatchResult{
-			Successful: make([]*forma.DataRecord, 0),
-			Failed:     make([]forma.OperationError, 0),
-			TotalCount: 0,
-		}, nil
+	zap.S().Debugw("BatchDelete called", "operationCount", len(req.Operations), "atomic", req.Atomic)
+
+	return em.runBatch(ctx, req, "DELETE_FAILED", func(ctx context.Context, _ int, op *forma.EntityOperation) (*forma.DataRecord, error) {
+		return em.deleteRecord(ctx, op)
+	}), nil
+}
+
+// ExecuteBatch runs create, update, upsert and delete operations across schemas in request order.
+// Operations may reference the row ID produced by an earlier operation through RowRef and Refs.
+func (em *entityManager) ExecuteBatch(ctx context.Context, req *forma.BatchOperation) (*forma.BatchResult, error) {
+	if req == nil {
+		return nil, fmt.Errorf("batch operation cannot be nil")
 	}
 
-	startTime := time.Now()
+	zap.S().Debugw("ExecuteBatch called", "operationCount", len(req.Operations), "atomic", req.Atomic)
 
-	successful := make([]*forma.DataRecord, 0)
-	failed := make([]forma.OperationError, 0)
+	rowIDs := make([]uuid.UUID, len(req.Operations))
+	return em.runBatch(ctx, req, "", func(ctx context.Context, index int, op *forma.EntityOperation) (*forma.DataRecord, error) {
+		resolved, err := resolveBatchRefs(op, rowIDs[:index])
+		if err != nil {
+			return nil, err
+		}
 
-	for _, op := range req.Operations {
-		record, err := em.Update(ctx, &op)
+		var record *forma.DataRecord
+		switch resolved.Type {
+		case forma.OperationCreate:
+			record, err = em.Create(ctx, resolved)
+		case forma.OperationUpdate:
+			record, err = em.Update(ctx, resolved)
+		case forma.OperationUpsert:
+			record, err = em.upsert(ctx, resolved)
+		case forma.OperationDelete:
+			record, err = em.deleteRecord(ctx, resolved)
+		default:
+			return nil, fmt.Errorf("unsupported batch operation type: %q", resolved.Type)
+		}
 		if err != nil {
-			failed = append(failed, forma.OperationError{
-				Operation: op,
-				Error:     err.Error(),
-				Code:      "UPDATE_FAILED",
-			})
-		} else {
-			successful = append(successful, record)
+			return nil, err
 		}
-	}
 
-	duration := time.Since(startTime).Microseconds()
+		rowIDs[index] = record.RowID
+		return record, nil
+	}), nil
+}
 
-	return &forma.BatchResult{
-		Successful: successful,
-		Failed:     failed,
-		TotalCount: len(req.Operations),
-		Duration:   duration,
+func (em *entityManager) deleteRecord(ctx context.Context, op *forma.EntityOperation) (*forma.DataRecord, error) {
+	if err := em.Delete(ctx, op); err != nil {
+		return nil, err
+	}
+	return &forma.DataRecord{
+		SchemaName: op.SchemaName,
+		RowID:      op.RowID,
 	}, nil
 }
 
-// BatchDelete deletes multiple entities atomically
-func (em *entityManager) BatchDelete(ctx context.Context, req *forma.BatchOperation) (*forma.BatchResult, error) {
-	if req == nil {
-		return nil, fmt.Errorf("batch operation cannot be nil")
+// resolveBatchRefs returns a copy of op with RowRef and Refs resolved to the row IDs of earlier
+// operations. rowIDs holds the results of the operations preceding op.
+func resolveBatchRefs(op *forma.EntityOperation, rowIDs []uuid.UUID) (*forma.EntityOperation, error) {
+	resolved := *op
+
+	if op.RowRef != "" {
+		rowID, err := resolveBatchRef(op.RowRef, rowIDs)
+		if err != nil {
+			return nil, fmt.Errorf("rowRef: %w", err)
+		}
+		resolved.RowID = rowID
 	}
 
-	if len(req.Operations) == 0 {
-		return &forma.BatchResult{
-			Successful: make([]*forma.DataRecord, 0),
-			Failed:     make([]forma.OperationError, 0),
-			TotalCount: 0,
-		}, nil
+	if len(op.Refs) == 0 {
+		return &resolved, nil
 	}
 
+	target := copyMapDeep(op.Data)
+	if op.Type == forma.OperationUpdate {
+		target = copyMapDeep(op.Updates)
+	}
+	for path, ref := range op.Refs {
+		rowID, err := resolveBatchRef(ref, rowIDs)
+		if err != nil {
+			return nil, fmt.Errorf("refs %s: %w", path, err)
+		}
+		setNestedValue(target, path, rowID.String())
+	}
+	if op.Type == forma.OperationUpdate {
+		resolved.Updates = target
+	} else {
+		resolved.Data = target
+	}
+
+	return &resolved, nil
+}
+
+// resolveBatchRef resolves a "$ref:N" reference to the row ID of operation N.
+func resolveBatchRef(ref string, rowIDs []uuid.UUID) (uuid.UUID, error) {
+	indexStr, found := strings.CutPrefix(ref, batchRefPrefix)
+	if !found {
+		return uuid.Nil, fmt.Errorf("invalid batch reference %q: expected %sN", ref, batchRefPrefix)
+	}
+
+	index, err := strconv.Atoi(indexStr)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid batch reference %q: %w", ref, err)
+	}
+	if index < 0 || index >= len(rowIDs) {
+		return uuid.Nil, fmt.Errorf("batch reference %q must point to an earlier operation", ref)
+	}
+	if rowIDs[index] == uuid.Nil {
+		return uuid.Nil, fmt.Errorf("batch reference %q points to an operation that did not succeed", ref)
+	}
+
+	return rowIDs[index], nil
+}
+
+// runBatch executes every operation of req with fn. Non-atomic batches report failures per
+// operation. Atomic batches run inside a single repository transaction: the first failure stops the
+// batch, rolls back everything already written and reports the remaining operations as rolled back.
+// An empty failureCode derives the code from the operation type, e.g. CREATE_FAILED.
+func (em *entityManager) runBatch(ctx context.Context, req *forma.BatchOperation, failureCode string, fn batchOperationFunc) *forma.BatchResult {
 	startTime := time.Now()
 
 	successful := make([]*forma.DataRecord, 0)
 	failed := make([]forma.OperationError, 0)
 
-	for _, op := range req.Operations {
-		err := em.Delete(ctx, &op)
-		if err != nil {
-			failed = append(failed, forma.OperationError{
-				Operation: op,
-				Error:     err.Error(),
-				Code:      "DELETE_FAILED",
-			})
-		} else {
-			successful = append(successful, &forma.DataRecord{
-				SchemaName: op.SchemaName,
-				RowID:      op.RowID,
-			})
+	if len(req.Operations) == 0 {
+		return &forma.BatchResult{
+			Successful: successful,
+			Failed:     failed,
+			TotalCount: 0,
+		}
+	}
+
+	if !req.Atomic {
+		for i := range req.Operations {
+			op := req.Operations[i]
+			record, err := fn(ctx, i, &op)
+			if err != nil {
+				zap.S().Warnw("batch operation failed", "operation", op, "error", err)
+				failed = append(failed, forma.OperationError{
+					Operation: op,
+					Error:     err.Error(),
+					Code:      batchFailureCode(failureCode, op, err),
+					Details:   batchFailureDetails(err),
+				})
+			} else {
+				successful = append(successful, record)
+			}
+		}
+
+		return &forma.BatchResult{
+			Successful: successful,
+			Failed:     failed,
+			TotalCount: len(req.Operations),
+			Duration:   time.Since(startTime).Microseconds(),
 		}
 	}
 
-	duration := time.Since(startTime).Microseconds()
+	err := em.runInTx(ctx, func(txCtx context.Context) error {
+		for i := range req.Operations {
+			op := req.Operations[i]
+			record, err := fn(txCtx, i, &op)
+			if err != nil {
+				return &batchOperationError{index: i, err: err}
+			}
+			successful = append(successful, record)
+		}
+		return nil
+	})
+
+	if err != nil {
+		zap.S().Warnw("atomic batch rolled back", "operationCount", len(req.Operations), "error", err)
+		successful = make([]*forma.DataRecord, 0)
+
+		failedIndex := -1
+		var opErr *batchOperationError
+		if errors.As(err, &opErr) {
+			failedIndex = opErr.index
+		}
+
+		for i, op := range req.Operations {
+			switch {
+			case i == failedIndex:
+				failed = append(failed, forma.OperationError{
+					Operation: op,
+					Error:     opErr.err.Error(),
+					Code:      batchFailureCode(failureCode, op, opErr.err),
+					Details:   batchFailureDetails(opErr.err),
+				})
+			case failedIndex >= 0:
+				failed = append(failed, forma.OperationError{
+					Operation: op,
+					Error:     fmt.Sprintf("rolled back: operation %d of atomic batch failed", failedIndex),
+					Code:      batchCodeRolledBack,
+				})
+			default:
+				failed = append(failed, forma.OperationError{
+					Operation: op,
+					Error:     err.Error(),
+					Code:      batchCodeTxFailed,
+				})
+			}
+		}
+	}
 
 	return &forma.BatchResult{
 		Successful: successful,
 		Failed:     failed,
 		TotalCount: len(req.Operations),
-		Duration:   duration,
-	}, nil
+		Duration:   time.Since(startTime).Microseconds(),
+	}
+}
+
+func batchFailureCode(failureCode string, op forma.EntityOperation, err error) string {
+	if errors.Is(err, forma.ErrEntityExists) {
+		return forma.OperationCodeAlreadyExists
+	}
+	if errors.Is(err, forma.ErrIdempotencyKeyReused) {
+		return forma.OperationCodeIdempotencyKeyReused
+	}
+	if errors.Is(err, forma.ErrImmutableField) {
+		return forma.OperationCodeImmutableField
+	}
+	if errors.Is(err, forma.ErrDanglingReference) {
+		return forma.ReferenceCodeDangling
+	}
+	if errors.Is(err, forma.ErrDeleteRestricted) {
+		return forma.OperationCodeDeleteRestricted
+	}
+	var limitErr *forma.LimitError
+	if errors.As(err, &limitErr) {
+		return limitErr.Code
+	}
+	if failureCode != "" {
+		return failureCode
+	}
+	if op.Type == "" {
+		return "OPERATION_FAILED"
+	}
+	return strings.ToUpper(string(op.Type)) + "_FAILED"
+}
+
+// batchFailureDetails returns the structured details of err reported with a failed operation.
+func batchFailureDetails(err error) map[string]any {
+	var refErr *forma.ReferenceError
+	if errors.As(err, &refErr) {
+		return map[string]any{"path": refErr.Path, "targetSchema": refErr.TargetSchema, "value": refErr.Value}
+	}
+	var restrictErr *forma.RestrictError
+	if errors.As(err, &restrictErr) {
+		return map[string]any{"childSchema": restrictErr.ChildSchema, "path": restrictErr.Path, "count": restrictErr.Count}
+	}
+	return nil
 }
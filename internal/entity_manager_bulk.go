@@ -0,0 +1,174 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lychee-technology/forma"
+	"go.uber.org/zap"
+)
+
+// bulkLoadChunkSize is the number of entities written per COPY transaction.
+const bulkLoadChunkSize = 1000
+
+// BulkLoad streams new entities from iterator into storage. Entities are transformed and validated one
+// by one and written in chunks with COPY; each chunk commits on its own, so a failing chunk only fails
+// its own entities. Transform and validation failures are reported per entity without aborting the
+// load. When ctx is cancelled or the iterator fails, the result so far is returned together with the
+// error; entities read but not yet written when ctx is cancelled are reported as failed.
+func (em *entityManager) BulkLoad(ctx context.Context, schemaName string, iterator forma.EntityIterator) (*forma.BulkLoadResult, error) {
+	if schemaName == "" {
+		return nil, fmt.Errorf("schema name is required")
+	}
+
+	if iterator == nil {
+		return nil, fmt.Errorf("iterator cannot be nil")
+	}
+
+	schemaID, _, err := em.registry.GetSchemaAttributeCacheByName(schemaName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schema: %w", err)
+	}
+
+	startTime := time.Now()
+	tables := em.storageTables()
+	result := &forma.BulkLoadResult{
+		Failed: make([]forma.BulkLoadError, 0),
+	}
+
+	chunk := make([]*PersistentRecord, 0, bulkLoadChunkSize)
+	chunkIndexes := make([]int, 0, bulkLoadChunkSize)
+	chunkData := make([]map[string]any, 0, bulkLoadChunkSize)
+	flush := func() {
+		if len(chunk) == 0 {
+			return
+		}
+		defer func() {
+			chunk = chunk[:0]
+			chunkIndexes = chunkIndexes[:0]
+			chunkData = chunkData[:0]
+		}()
+		if em.referenceValidation(false) {
+			if err := em.dropDanglingReferences(ctx, schemaName, &chunk, &chunkIndexes, chunkData, result); err != nil {
+				zap.S().Warnw("bulk load reference validation failed", "schemaName", schemaName, "size", len(chunk), "error", err)
+				for _, index := range chunkIndexes {
+					result.Failed = append(result.Failed, forma.BulkLoadError{
+						Index: index,
+						Error: fmt.Sprintf("failed to validate references: %v", err),
+					})
+				}
+				return
+			}
+			if len(chunk) == 0 {
+				return
+			}
+		}
+		if err := em.repository.BulkInsertPersistentRecords(ctx, tables, chunk); err != nil {
+			zap.S().Warnw("bulk load chunk failed", "schemaName", schemaName, "size", len(chunk), "error", err)
+			for _, index := range chunkIndexes {
+				result.Failed = append(result.Failed, forma.BulkLoadError{
+					Index: index,
+					Error: fmt.Sprintf("failed to copy records: %v", err),
+				})
+			}
+		} else {
+			result.Loaded += len(chunk)
+		}
+		zap.S().Infow("bulk load progress", "schemaName", schemaName, "processed", result.TotalCount, "loaded", result.Loaded, "failed", len(result.Failed))
+	}
+
+	for iterator.Next() {
+		if err := ctx.Err(); err != nil {
+			// The buffered chunk is never written, so its entities fail with the cancellation.
+			for _, index := range chunkIndexes {
+				result.Failed = append(result.Failed, forma.BulkLoadError{
+					Index: index,
+					Error: fmt.Sprintf("bulk load cancelled: %v", err),
+				})
+			}
+			result.Duration = time.Since(startTime).Microseconds()
+			return result, err
+		}
+
+		index := result.TotalCount
+		result.TotalCount++
+
+		data := iterator.Data()
+		if data == nil {
+			result.Failed = append(result.Failed, forma.BulkLoadError{
+				Index: index,
+				Error: "data is required for create operation",
+			})
+			continue
+		}
+		data = em.applySchemaDefaults(schemaName, data)
+		if em.relations != nil {
+			data = em.relations.StripComputedFields(schemaName, data)
+		}
+
+		record, err := em.transformer.ToPersistentRecord(ctx, schemaID, uuid.Must(uuid.NewV7()), data)
+		if err != nil {
+			loadErr := forma.BulkLoadError{
+				Index: index,
+				Error: fmt.Sprintf("failed to transform data to persistent record: %v", err),
+			}
+			var limitErr *forma.LimitError
+			if errors.As(err, &limitErr) {
+				loadErr.Code = limitErr.Code
+			}
+			result.Failed = append(result.Failed, loadErr)
+			continue
+		}
+		if err := validateHotColumns(record); err != nil {
+			result.Failed = append(result.Failed, forma.BulkLoadError{
+				Index: index,
+				Error: fmt.Sprintf("invalid record: %v", err),
+			})
+			continue
+		}
+
+		chunk = append(chunk, record)
+		chunkIndexes = append(chunkIndexes, index)
+		chunkData = append(chunkData, data)
+		if len(chunk) >= bulkLoadChunkSize {
+			flush()
+		}
+	}
+	flush()
+
+	result.Duration = time.Since(startTime).Microseconds()
+	if err := iterator.Err(); err != nil {
+		return result, fmt.Errorf("iterate entities: %w", err)
+	}
+	return result, nil
+}
+
+// dropDanglingReferences validates the foreign keys of a chunk with one lookup per foreign key and
+// removes the entities with a dangling reference from chunk and indexes, reporting them as failed.
+func (em *entityManager) dropDanglingReferences(ctx context.Context, schemaName string, chunk *[]*PersistentRecord, indexes *[]int, data []map[string]any, result *forma.BulkLoadResult) error {
+	dangling, err := em.danglingReferences(ctx, schemaName, data, nil)
+	if err != nil {
+		return err
+	}
+
+	kept := 0
+	for i, refErr := range dangling {
+		if refErr != nil {
+			result.Failed = append(result.Failed, forma.BulkLoadError{
+				Index: (*indexes)[i],
+				Error: refErr.Error(),
+				Code:  forma.ReferenceCodeDangling,
+			})
+			continue
+		}
+		(*chunk)[kept] = (*chunk)[i]
+		(*indexes)[kept] = (*indexes)[i]
+		kept++
+	}
+	*chunk = (*chunk)[:kept]
+	*indexes = (*indexes)[:kept]
+	return nil
+}
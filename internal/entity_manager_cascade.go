@@ -0,0 +1,196 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/lychee-technology/forma"
+	"go.uber.org/zap"
+)
+
+// defaultMaxCascadeDepth bounds cascading deletes when Reference.MaxCascadeDepth is unset.
+const defaultMaxCascadeDepth = 5
+
+// cascadeActionOrder runs restrict rules before any child is changed, and nullify before delete.
+var cascadeActionOrder = map[forma.CascadeAction]int{
+	forma.CascadeActionRestrict: 0,
+	forma.CascadeActionNullify:  1,
+	forma.CascadeActionDelete:   2,
+}
+
+// cascadeKey identifies an entity removed by a cascading delete.
+type cascadeKey struct {
+	schemaID int16
+	rowID    uuid.UUID
+}
+
+// cascadeRules returns the delete-time cascade rules whose source is schemaName, restrict rules
+// first. Update rules only apply to key changes and are left out.
+func (em *entityManager) cascadeRules(schemaName string) []forma.CascadeRule {
+	if em.config == nil || len(em.config.Reference.CascadeRules) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(em.config.Reference.CascadeRules))
+	for name := range em.config.Reference.CascadeRules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var rules []forma.CascadeRule
+	for _, name := range names {
+		rule := em.config.Reference.CascadeRules[name]
+		if _, ok := cascadeActionOrder[rule.Action]; ok && rule.SourceSchema == schemaName {
+			rules = append(rules, rule)
+		}
+	}
+	sort.SliceStable(rules, func(i, j int) bool {
+		return cascadeActionOrder[rules[i].Action] < cascadeActionOrder[rules[j].Action]
+	})
+	return rules
+}
+
+// maxCascadeDepth returns how many levels below the deleted entity rule may recurse: the rule's
+// MaxDepth when set and tighter, otherwise Reference.MaxCascadeDepth.
+func (em *entityManager) maxCascadeDepth(rule forma.CascadeRule) int {
+	depth := em.config.Reference.MaxCascadeDepth
+	if depth <= 0 {
+		depth = defaultMaxCascadeDepth
+	}
+	if rule.MaxDepth > 0 && rule.MaxDepth < depth {
+		depth = rule.MaxDepth
+	}
+	return depth
+}
+
+// cascadeDelete applies the cascade rules of schemaName to the children of an entity, then deletes
+// it. It runs inside the delete transaction, so a restrict rule or a failure anywhere in the tree
+// rolls back the whole cascade. visited holds the entities this cascade already removes, which ends
+// cycles between schemas.
+func (em *entityManager) cascadeDelete(ctx context.Context, tables StorageTables, schemaName string, schemaID int16, rowID uuid.UUID, depth int, visited map[cascadeKey]bool) error {
+	key := cascadeKey{schemaID: schemaID, rowID: rowID}
+	if visited[key] {
+		return nil
+	}
+	visited[key] = true
+
+	if rules := em.cascadeRules(schemaName); len(rules) > 0 {
+		record, err := em.repository.GetPersistentRecord(ctx, tables, schemaID, rowID)
+		if err != nil {
+			return fmt.Errorf("failed to load %s %s: %w", schemaName, rowID, err)
+		}
+		if record != nil {
+			attrs, err := em.transformer.FromPersistentRecord(ctx, record)
+			if err != nil {
+				return fmt.Errorf("failed to transform %s %s: %w", schemaName, rowID, err)
+			}
+			for _, rule := range rules {
+				if err := em.applyCascadeRule(ctx, tables, rule, rowID, attrs, depth, visited); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return em.deleteRow(ctx, tables, schemaName, schemaID, rowID)
+}
+
+// applyCascadeRule finds the live children of the entity rowID of rule.SourceSchema through the
+// x-relation foreign keys of rule.TargetSchema and restricts, nullifies or deletes them.
+func (em *entityManager) applyCascadeRule(ctx context.Context, tables StorageTables, rule forma.CascadeRule, rowID uuid.UUID, attrs map[string]any, depth int, visited map[cascadeKey]bool) error {
+	var rels []RelationDescriptor
+	for _, rel := range em.relations.ForeignKeys(rule.TargetSchema) {
+		if rel.ParentSchema == rule.SourceSchema {
+			rels = append(rels, rel)
+		}
+	}
+	if len(rels) == 0 {
+		return fmt.Errorf("cascade rule %s -> %s: %s has no x-relation to %s", rule.SourceSchema, rule.TargetSchema, rule.TargetSchema, rule.SourceSchema)
+	}
+
+	childSchemaID, _, err := em.registry.GetSchemaAttributeCacheByName(rule.TargetSchema)
+	if err != nil {
+		return fmt.Errorf("failed to get schema %s: %w", rule.TargetSchema, err)
+	}
+
+	for _, rel := range rels {
+		parentID, ok := readStringAtPath(attrs, rel.ParentIDAttr)
+		if !ok || parentID == "" {
+			continue
+		}
+		cond, err := em.transformer.ToStorageCondition(childSchemaID, &forma.KvCondition{Attr: rel.ForeignKeyAttr, Value: "equals:" + parentID})
+		if err != nil {
+			return fmt.Errorf("failed to build cascade condition for %s.%s: %w", rule.TargetSchema, rel.ForeignKeyAttr, err)
+		}
+		matched, err := em.matchingRowIDs(ctx, tables, childSchemaID, cond)
+		if err != nil {
+			return err
+		}
+		childIDs := matched[:0]
+		for _, childID := range matched {
+			if !visited[cascadeKey{schemaID: childSchemaID, rowID: childID}] {
+				childIDs = append(childIDs, childID)
+			}
+		}
+		if len(childIDs) == 0 {
+			continue
+		}
+
+		switch rule.Action {
+		case forma.CascadeActionRestrict:
+			return &forma.RestrictError{
+				SchemaName:  rule.SourceSchema,
+				RowID:       rowID,
+				ChildSchema: rule.TargetSchema,
+				Path:        rel.ForeignKeyAttr,
+				Count:       len(childIDs),
+			}
+		case forma.CascadeActionNullify:
+			if rel.ForeignKeyRequired && !rel.multiple() {
+				return fmt.Errorf("cascade rule %s -> %s: cannot nullify required foreign key %s", rule.SourceSchema, rule.TargetSchema, rel.ForeignKeyAttr)
+			}
+			for _, childID := range childIDs {
+				if err := em.nullifyReference(ctx, tables, rule.TargetSchema, childSchemaID, childID, rel.ForeignKeyAttr, parentID); err != nil {
+					return err
+				}
+			}
+		case forma.CascadeActionDelete:
+			if depth+1 > em.maxCascadeDepth(rule) {
+				return fmt.Errorf("%w: deleting %s %s reaches %s at depth %d", forma.ErrCascadeDepthExceeded, rule.SourceSchema, rowID, rule.TargetSchema, depth+1)
+			}
+			for _, childID := range childIDs {
+				if err := em.cascadeDelete(ctx, tables, rule.TargetSchema, childSchemaID, childID, depth+1, visited); err != nil {
+					return err
+				}
+			}
+		}
+		zap.S().Debugw("applied cascade rule", "source", rule.SourceSchema, "target", rule.TargetSchema,
+			"action", rule.Action, "rowID", rowID, "children", len(childIDs))
+	}
+	return nil
+}
+
+// nullifyReference removes the reference to parentID at path of a child entity as a regular update.
+// A single foreign key is cleared; parentID is dropped from an array or nested foreign key.
+func (em *entityManager) nullifyReference(ctx context.Context, tables StorageTables, schemaName string, schemaID int16, rowID uuid.UUID, path, parentID string) error {
+	record, err := em.repository.GetPersistentRecord(ctx, tables, schemaID, rowID)
+	if err != nil {
+		return fmt.Errorf("failed to load %s %s: %w", schemaName, rowID, err)
+	}
+	if record == nil {
+		return nil
+	}
+	existing, err := em.transformer.FromPersistentRecord(ctx, record)
+	if err != nil {
+		return fmt.Errorf("failed to transform %s %s: %w", schemaName, rowID, err)
+	}
+
+	data := copyMapDeep(existing)
+	clearReference(data, path, parentID)
+	if _, err := em.replaceDocument(ctx, tables, schemaName, record, existing, data); err != nil {
+		return fmt.Errorf("failed to nullify %s of %s %s: %w", path, schemaName, rowID, err)
+	}
+	return nil
+}
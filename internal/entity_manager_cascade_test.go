@@ -0,0 +1,145 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/lychee-technology/forma"
+)
+
+// matchAttributes reports whether attrs satisfy cond, supporting the equality conditions built for
+// relation lookups. Like an EAV condition, equality matches any element of an array.
+func matchAttributes(attrs map[string]any, cond forma.Condition) bool {
+	switch c := cond.(type) {
+	case *forma.KvCondition:
+		for _, value := range referenceIDs(attrs, c.Attr) {
+			if value == strings.TrimPrefix(c.Value, "equals:") {
+				return true
+			}
+		}
+		return false
+	case *forma.CompositeCondition:
+		for _, child := range c.Conditions {
+			if matchAttributes(attrs, child) == (c.Logic == forma.LogicOr) {
+				return c.Logic == forma.LogicOr
+			}
+		}
+		return c.Logic != forma.LogicOr
+	}
+	return true
+}
+
+func TestEntityManager_DeleteCascadeRules(t *testing.T) {
+	ctx := context.Background()
+	registry, err := newFileSchemaRegistryFromDir("../cmd/server/schemas")
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+	transformer := NewPersistentRecordTransformer(registry)
+	visitSchemaID, _, err := registry.GetSchemaAttributeCacheByName("visit")
+	if err != nil {
+		t.Fatalf("failed to resolve visit schema: %v", err)
+	}
+
+	setup := func(action forma.CascadeAction) (forma.EntityManager, *mockPersistentRecordRepository, []uuid.UUID, []uuid.UUID) {
+		repo := newMockPersistentRecordRepository()
+		repo.queryFunc = func(ctx context.Context, query *PersistentRecordQuery) (*PersistentRecordPage, error) {
+			var records []*PersistentRecord
+			for _, record := range repo.records[query.SchemaID] {
+				if record.DeletedAt != nil {
+					continue
+				}
+				attrs, err := transformer.FromPersistentRecord(ctx, record)
+				if err != nil {
+					return nil, err
+				}
+				if query.Condition == nil || matchAttributes(attrs, query.Condition) {
+					records = append(records, record)
+				}
+			}
+			return &PersistentRecordPage{Records: records, TotalRecords: int64(len(records))}, nil
+		}
+		config := createTestConfig()
+		config.Reference.CascadeRules = map[string]forma.CascadeRule{
+			"lead_visits": {SourceSchema: "lead", TargetSchema: "visit", Action: action},
+		}
+		em := NewEntityManager(transformer, repo, registry, config)
+
+		var leads, visits []uuid.UUID
+		for _, leadID := range []string{"lead-1", "lead-2"} {
+			lead, err := em.Create(ctx, &forma.EntityOperation{
+				EntityIdentifier: forma.EntityIdentifier{SchemaName: "lead"},
+				Data:             leadPayload(leadID),
+			})
+			if err != nil {
+				t.Fatalf("failed to create lead: %v", err)
+			}
+			leads = append(leads, lead.RowID)
+
+			data := visitPayload("visit-of-" + leadID)
+			data["leadId"] = leadID
+			visit, err := em.Create(ctx, &forma.EntityOperation{
+				EntityIdentifier: forma.EntityIdentifier{SchemaName: "visit"},
+				Data:             data,
+			})
+			if err != nil {
+				t.Fatalf("failed to create visit: %v", err)
+			}
+			visits = append(visits, visit.RowID)
+		}
+		return em, repo, leads, visits
+	}
+	deleteLead := func(em forma.EntityManager, rowID uuid.UUID) error {
+		return em.Delete(ctx, &forma.EntityOperation{EntityIdentifier: forma.EntityIdentifier{SchemaName: "lead", RowID: rowID}})
+	}
+
+	t.Run("restrict", func(t *testing.T) {
+		em, repo, leads, _ := setup(forma.CascadeActionRestrict)
+		err := deleteLead(em, leads[0])
+		var restrictErr *forma.RestrictError
+		if !errors.As(err, &restrictErr) || !errors.Is(err, forma.ErrDeleteRestricted) {
+			t.Fatalf("expected a RestrictError, got %v", err)
+		}
+		if restrictErr.ChildSchema != "visit" || restrictErr.Path != "leadId" || restrictErr.Count != 1 {
+			t.Fatalf("unexpected restrict error: %+v", restrictErr)
+		}
+		if len(repo.records[visitSchemaID]) != 2 || repo.deleteCalls != 0 {
+			t.Fatalf("expected the restricted delete to change nothing")
+		}
+	})
+
+	t.Run("nullify required", func(t *testing.T) {
+		// visit.leadId is required, so it cannot be cleared.
+		em, repo, leads, _ := setup(forma.CascadeActionNullify)
+		if err := deleteLead(em, leads[0]); err == nil || !strings.Contains(err.Error(), "cannot nullify required foreign key leadId") {
+			t.Fatalf("expected nullifying a required foreign key to fail, got %v", err)
+		}
+		if len(repo.records[visitSchemaID]) != 2 || repo.deleteCalls != 0 {
+			t.Fatalf("expected the failed delete to change nothing")
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		em, repo, leads, visits := setup(forma.CascadeActionDelete)
+		if err := deleteLead(em, leads[0]); err != nil {
+			t.Fatalf("Delete failed: %v", err)
+		}
+		if _, ok := repo.records[visitSchemaID][visits[0]]; ok {
+			t.Fatal("expected the visit of the deleted lead to be deleted")
+		}
+		if _, ok := repo.records[visitSchemaID][visits[1]]; !ok {
+			t.Fatal("expected the visit of the other lead to remain")
+		}
+
+		result, err := em.DeleteWhere(ctx, "lead", &forma.KvCondition{Attr: "id", Value: "equals:lead-2"}, forma.WhereOptions{})
+		if err != nil {
+			t.Fatalf("DeleteWhere failed: %v", err)
+		}
+		if result.Affected != 1 || len(repo.records[visitSchemaID]) != 0 {
+			t.Fatalf("expected DeleteWhere to cascade, got %+v with %d visits left", result, len(repo.records[visitSchemaID]))
+		}
+	})
+}
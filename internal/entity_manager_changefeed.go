@@ -0,0 +1,234 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lychee-technology/forma"
+	"go.uber.org/zap"
+)
+
+// ConsumeChanges leases a batch of pending change log entries inside one transaction, hydrates them
+// into change events and marks them flushed once fn succeeds. Entries leased by a concurrent consumer
+// are skipped rather than waited for. When fn or the flush fails the transaction rolls back and the
+// entries stay pending, so every change is delivered at least once.
+func (em *entityManager) ConsumeChanges(ctx context.Context, opts forma.ChangeFeedOptions, fn forma.ChangeHandler) (int, error) {
+	if fn == nil {
+		return 0, fmt.Errorf("change handler is required")
+	}
+
+	tables := em.storageTables()
+	if tables.ChangeLog == "" {
+		return 0, fmt.Errorf("change log table is not configured")
+	}
+
+	var schemaID int16
+	if opts.SchemaName != "" {
+		id, _, err := em.registry.GetSchemaAttributeCacheByName(opts.SchemaName)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get schema: %w", err)
+		}
+		schemaID = id
+	}
+
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = forma.DefaultChangeBatchSize
+	}
+
+	var flushed int64
+	err := em.runInTx(ctx, func(txCtx context.Context) error {
+		entries, err := em.repository.LeaseChanges(txCtx, tables, schemaID, batchSize)
+		if err != nil {
+			return fmt.Errorf("failed to lease changes: %w", err)
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+
+		changes, err := em.hydrateChanges(txCtx, tables, entries)
+		if err != nil {
+			return err
+		}
+		if err := fn(txCtx, changes); err != nil {
+			return fmt.Errorf("change handler failed: %w", err)
+		}
+
+		flushed, err = em.repository.MarkChangesFlushed(txCtx, tables, entries)
+		if err != nil {
+			return fmt.Errorf("failed to flush changes: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	zap.S().Debugw("consumed changes", "schemaName", opts.SchemaName, "flushed", flushed)
+	return int(flushed), nil
+}
+
+// hydrateChanges turns change log entries into change events carrying the current entity, or
+// tombstones for entities that were deleted since the change was logged. Entities that were never
+// written after their creation are reported as created.
+func (em *entityManager) hydrateChanges(ctx context.Context, tables StorageTables, entries []*ChangeLogEntry) ([]*forma.ChangeEvent, error) {
+	schemaNames := make(map[int16]string)
+	changes := make([]*forma.ChangeEvent, 0, len(entries))
+	for _, entry := range entries {
+		schemaName, ok := schemaNames[entry.SchemaID]
+		if !ok {
+			name, _, err := em.registry.GetSchemaAttributeCacheByID(entry.SchemaID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve schema name for id %d: %w", entry.SchemaID, err)
+			}
+			schemaName = name
+			schemaNames[entry.SchemaID] = name
+		}
+
+		change := &forma.ChangeEvent{
+			SchemaName: schemaName,
+			RowID:      entry.RowID,
+			Operation:  forma.ChangeOperationDeleted,
+			ChangedAt:  entry.ChangedAt,
+			Deleted:    true,
+		}
+		if entry.DeletedAt == nil {
+			record, err := em.repository.GetPersistentRecord(ctx, tables, entry.SchemaID, entry.RowID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load changed record: %w", err)
+			}
+			if record != nil && record.DeletedAt == nil {
+				dataRecord, err := em.toDataRecord(ctx, schemaName, record)
+				if err != nil {
+					return nil, err
+				}
+				change.Operation = forma.ChangeOperationUpdated
+				if record.Revision <= 1 {
+					change.Operation = forma.ChangeOperationCreated
+				}
+				change.Deleted = false
+				change.Record = dataRecord
+			}
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// WatchChanges subscribes to the notify channel before replaying opts.Since from the change log, so
+// no change committed in between is missed; such a change may be delivered twice instead. It runs
+// until ctx is done, returning ctx.Err(), or fn fails.
+func (em *entityManager) WatchChanges(ctx context.Context, opts forma.WatchOptions, fn forma.ChangeListener) error {
+	if fn == nil {
+		return fmt.Errorf("change listener is required")
+	}
+	if opts.SchemaName == "" {
+		return fmt.Errorf("schema name is required")
+	}
+
+	tables := em.storageTables()
+	if tables.NotifyChannel == "" {
+		return forma.ErrNotificationsDisabled
+	}
+	if opts.Since != nil && tables.ChangeLog == "" {
+		return fmt.Errorf("resuming a watch requires the change log table")
+	}
+
+	schemaID, _, err := em.registry.GetSchemaAttributeCacheByName(opts.SchemaName)
+	if err != nil {
+		return fmt.Errorf("failed to get schema: %w", err)
+	}
+	condition := opts.Condition
+	if condition != nil {
+		condition, err = em.transformer.ToStorageCondition(schemaID, condition)
+		if err != nil {
+			return fmt.Errorf("invalid condition: %w", err)
+		}
+	}
+
+	subscription, err := em.repository.SubscribeChanges(ctx, tables)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to changes: %w", err)
+	}
+	defer subscription.Close()
+
+	if opts.Since != nil {
+		entries, err := em.repository.ListChangesSince(ctx, tables, schemaID, *opts.Since, opts.SinceRowID)
+		if err != nil {
+			return fmt.Errorf("failed to replay changes: %w", err)
+		}
+		for _, entry := range entries {
+			// The change log does not record the operation; deliverChange derives it from the revision.
+			notification := &ChangeNotification{
+				SchemaID:  entry.SchemaID,
+				RowID:     entry.RowID,
+				ChangedAt: entry.ChangedAt,
+			}
+			if entry.DeletedAt != nil {
+				notification.Operation = forma.ChangeOperationDeleted
+			}
+			if err := em.deliverChange(ctx, tables, opts.SchemaName, condition, notification, fn); err != nil {
+				return err
+			}
+		}
+	}
+
+	for {
+		notification, err := subscription.Next(ctx)
+		if err != nil {
+			return err
+		}
+		if notification.SchemaID != schemaID {
+			continue
+		}
+		if err := em.deliverChange(ctx, tables, opts.SchemaName, condition, notification, fn); err != nil {
+			return err
+		}
+	}
+}
+
+// deliverChange hydrates notification and passes it to fn unless the entity no longer matches
+// condition or was deleted since, in which case its deletion is delivered on its own. A notification
+// without an operation is reported as created while the entity is at its first revision and as
+// updated otherwise.
+func (em *entityManager) deliverChange(ctx context.Context, tables StorageTables, schemaName string, condition forma.Condition, notification *ChangeNotification, fn forma.ChangeListener) error {
+	change := &forma.ChangeEvent{
+		SchemaName: schemaName,
+		RowID:      notification.RowID,
+		Operation:  notification.Operation,
+		ChangedAt:  notification.ChangedAt,
+		Deleted:    notification.Operation == forma.ChangeOperationDeleted,
+	}
+
+	if !change.Deleted {
+		if condition != nil {
+			matches, err := em.repository.PersistentRecordMatches(ctx, tables, notification.SchemaID, notification.RowID, condition)
+			if err != nil {
+				return fmt.Errorf("failed to match changed record: %w", err)
+			}
+			if !matches {
+				return nil
+			}
+		}
+
+		record, err := em.repository.GetPersistentRecord(ctx, tables, notification.SchemaID, notification.RowID)
+		if err != nil {
+			return fmt.Errorf("failed to load changed record: %w", err)
+		}
+		if record == nil || record.DeletedAt != nil {
+			return nil
+		}
+		change.Record, err = em.toDataRecord(ctx, schemaName, record)
+		if err != nil {
+			return err
+		}
+		if change.Operation == "" {
+			change.Operation = forma.ChangeOperationUpdated
+			if record.Revision <= 1 {
+				change.Operation = forma.ChangeOperationCreated
+			}
+		}
+	}
+
+	return fn(ctx, change)
+}
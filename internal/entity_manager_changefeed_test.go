@@ -0,0 +1,180 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/lychee-technology/forma"
+)
+
+func TestEntityManager_ConsumeChanges(t *testing.T) {
+	ctx := context.Background()
+	registry, err := newFileSchemaRegistryFromDir("../cmd/server/schemas")
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+	schemaID, _, err := registry.GetSchemaAttributeCacheByName("lead")
+	if err != nil {
+		t.Fatalf("failed to resolve lead schema: %v", err)
+	}
+
+	repo := newMockPersistentRecordRepository()
+	config := createTestConfig()
+	config.Database.TableNames.ChangeLog = "change_log"
+	em := NewEntityManager(NewPersistentRecordTransformer(registry), repo, registry, config)
+
+	liveID := uuid.New()
+	if _, err := em.Create(ctx, &forma.EntityOperation{
+		EntityIdentifier: forma.EntityIdentifier{SchemaName: "lead", RowID: liveID},
+		Data:             leadPayload(liveID.String()),
+	}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	deletedID := uuid.New()
+	deletedAt := int64(2000)
+	repo.changes = []*ChangeLogEntry{
+		{SchemaID: schemaID, RowID: liveID, ChangedAt: 1000},
+		{SchemaID: schemaID, RowID: deletedID, ChangedAt: 2000, DeletedAt: &deletedAt},
+	}
+
+	handlerErr := errors.New("sink unavailable")
+	if _, err := em.ConsumeChanges(ctx, forma.ChangeFeedOptions{}, func(ctx context.Context, changes []*forma.ChangeEvent) error {
+		return handlerErr
+	}); !errors.Is(err, handlerErr) {
+		t.Fatalf("expected handler error, got %v", err)
+	}
+	if len(repo.changes) != 2 {
+		t.Fatalf("expected changes to stay pending after a failed handler, got %d", len(repo.changes))
+	}
+
+	var received []*forma.ChangeEvent
+	flushed, err := em.ConsumeChanges(ctx, forma.ChangeFeedOptions{SchemaName: "lead"}, func(ctx context.Context, changes []*forma.ChangeEvent) error {
+		received = changes
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ConsumeChanges failed: %v", err)
+	}
+	if flushed != 2 || len(repo.changes) != 0 {
+		t.Fatalf("expected 2 flushed changes and none pending, got %d flushed and %d pending", flushed, len(repo.changes))
+	}
+	if len(received) != 2 {
+		t.Fatalf("expected 2 change events, got %d", len(received))
+	}
+	live := received[0]
+	if live.Deleted || live.Record == nil || live.Record.RowID != liveID || live.SchemaName != "lead" {
+		t.Fatalf("unexpected live change: %+v", live)
+	}
+	if tombstone := received[1]; !tombstone.Deleted || tombstone.Record != nil || tombstone.RowID != deletedID {
+		t.Fatalf("unexpected tombstone: %+v", tombstone)
+	}
+
+	if flushed, err := em.ConsumeChanges(ctx, forma.ChangeFeedOptions{}, func(ctx context.Context, changes []*forma.ChangeEvent) error {
+		t.Fatalf("handler called without pending changes")
+		return nil
+	}); err != nil || flushed != 0 {
+		t.Fatalf("expected an empty feed, got %d, %v", flushed, err)
+	}
+}
+
+func TestEntityManager_WatchChanges(t *testing.T) {
+	ctx := context.Background()
+	registry, err := newFileSchemaRegistryFromDir("../cmd/server/schemas")
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+	schemaID, _, err := registry.GetSchemaAttributeCacheByName("lead")
+	if err != nil {
+		t.Fatalf("failed to resolve lead schema: %v", err)
+	}
+
+	repo := newMockPersistentRecordRepository()
+	config := createTestConfig()
+	config.Database.TableNames.ChangeLog = "change_log"
+	config.Database.NotifyChannel = "forma_changes"
+	em := NewEntityManager(NewPersistentRecordTransformer(registry), repo, registry, config)
+
+	create := func() uuid.UUID {
+		rowID := uuid.New()
+		if _, err := em.Create(ctx, &forma.EntityOperation{
+			EntityIdentifier: forma.EntityIdentifier{SchemaName: "lead", RowID: rowID},
+			Data:             leadPayload(rowID.String()),
+		}); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		return rowID
+	}
+	matchingID, otherID, deletedID := create(), create(), uuid.New()
+
+	// Only matchingID satisfies the watch condition.
+	repo.queryFunc = func(ctx context.Context, query *PersistentRecordQuery) (*PersistentRecordPage, error) {
+		return &PersistentRecordPage{Records: []*PersistentRecord{repo.records[schemaID][matchingID]}}, nil
+	}
+	repo.changes = []*ChangeLogEntry{
+		{SchemaID: schemaID, RowID: otherID, ChangedAt: 500},
+		{SchemaID: schemaID, RowID: matchingID, ChangedAt: 1000},
+	}
+	repo.notifications = make(chan *ChangeNotification, 4)
+	repo.notifications <- &ChangeNotification{SchemaID: schemaID, RowID: otherID, Operation: forma.ChangeOperationUpdated, ChangedAt: 2000}
+	repo.notifications <- &ChangeNotification{SchemaID: schemaID + 1, RowID: uuid.New(), Operation: forma.ChangeOperationCreated, ChangedAt: 2500}
+	repo.notifications <- &ChangeNotification{SchemaID: schemaID, RowID: deletedID, Operation: forma.ChangeOperationDeleted, ChangedAt: 3000}
+	close(repo.notifications)
+
+	since := int64(800)
+	var received []*forma.ChangeEvent
+	err = em.WatchChanges(ctx, forma.WatchOptions{
+		SchemaName: "lead",
+		Condition:  &forma.KvCondition{Attr: "stage", Value: "equals:new"},
+		Since:      &since,
+	}, func(ctx context.Context, change *forma.ChangeEvent) error {
+		received = append(received, change)
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the watch to end with the subscription, got %v", err)
+	}
+
+	if len(received) != 2 {
+		t.Fatalf("expected a replayed and a live event, got %d: %+v", len(received), received)
+	}
+	replayed := received[0]
+	if replayed.RowID != matchingID || replayed.Operation != forma.ChangeOperationCreated || replayed.Record == nil {
+		t.Fatalf("unexpected replayed event: %+v", replayed)
+	}
+	if deleted := received[1]; deleted.RowID != deletedID || !deleted.Deleted || deleted.Record != nil || deleted.ChangedAt != 3000 {
+		t.Fatalf("unexpected delete event: %+v", deleted)
+	}
+
+	// Resuming after matchingID at 1000 skips it but keeps a later change in the same millisecond.
+	laterID := uuid.MustParse("ffffffff-ffff-4fff-bfff-ffffffffffff")
+	if _, err := em.Create(ctx, &forma.EntityOperation{
+		EntityIdentifier: forma.EntityIdentifier{SchemaName: "lead", RowID: laterID},
+		Data:             leadPayload(laterID.String()),
+	}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	repo.changes = append(repo.changes, &ChangeLogEntry{SchemaID: schemaID, RowID: laterID, ChangedAt: 1000})
+	repo.notifications = make(chan *ChangeNotification)
+	close(repo.notifications)
+	received = nil
+	since = 1000
+	err = em.WatchChanges(ctx, forma.WatchOptions{SchemaName: "lead", Since: &since, SinceRowID: matchingID}, func(ctx context.Context, change *forma.ChangeEvent) error {
+		received = append(received, change)
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the watch to end with the subscription, got %v", err)
+	}
+	if len(received) != 1 || received[0].RowID != laterID {
+		t.Fatalf("expected only the later change of the same millisecond, got %+v", received)
+	}
+
+	config.Database.NotifyChannel = ""
+	if err := em.WatchChanges(ctx, forma.WatchOptions{SchemaName: "lead"}, func(ctx context.Context, change *forma.ChangeEvent) error {
+		return nil
+	}); !errors.Is(err, forma.ErrNotificationsDisabled) {
+		t.Fatalf("expected ErrNotificationsDisabled without a notify channel, got %v", err)
+	}
+}
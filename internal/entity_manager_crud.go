@@ -3,6 +3,7 @@ package internal
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/lychee-technology/forma"
@@ -23,16 +24,50 @@ func (em *entityManager) Create(ctx context.Context, req *forma.EntityOperation)
 		return nil, fmt.Errorf("data is required for create operation")
 	}
 
+	if req.IdempotencyKey != "" {
+		return em.createIdempotent(ctx, req)
+	}
+
+	return em.createOnce(ctx, req)
+}
+
+// createOnce creates req under the caller-supplied row ID, or under a new one when RowID is unset.
+// A supplied row ID that is already taken, including by a soft-deleted entity, fails with forma.ErrEntityExists.
+func (em *entityManager) createOnce(ctx context.Context, req *forma.EntityOperation) (*forma.DataRecord, error) {
+	if req.RowID == (uuid.UUID{}) {
+		return em.createWithRowID(ctx, req, uuid.Must(uuid.NewV7()))
+	}
+
+	schemaID, _, err := em.registry.GetSchemaAttributeCacheByName(req.SchemaName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schema: %w", err)
+	}
+
+	existing, err := em.repository.GetPersistentRecord(ctx, em.storageTables(), schemaID, req.RowID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load existing record: %w", err)
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("%w: %s/%s", forma.ErrEntityExists, req.SchemaName, req.RowID)
+	}
+
+	return em.createWithRowID(ctx, req, req.RowID)
+}
+
+// createWithRowID inserts req.Data as a new entity stored under rowID
+func (em *entityManager) createWithRowID(ctx context.Context, req *forma.EntityOperation, rowID uuid.UUID) (*forma.DataRecord, error) {
 	// Get schema by name to obtain schema ID
 	schemaID, _, err := em.registry.GetSchemaAttributeCacheByName(req.SchemaName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get schema: %w", err)
 	}
 
-	rowID := uuid.Must(uuid.NewV7())
-	inputData := req.Data
+	inputData := em.applySchemaDefaults(req.SchemaName, req.Data)
 	if em.relations != nil {
-		inputData = em.relations.StripComputedFields(req.SchemaName, req.Data)
+		inputData = em.relations.StripComputedFields(req.SchemaName, inputData)
+	}
+	if err := em.checkReferences(ctx, req.SchemaName, inputData, nil); err != nil {
+		return nil, fmt.Errorf("failed to validate references: %w", err)
 	}
 	zap.S().Debugw("Creating entity", "schemaName", req.SchemaName, "schemaID", schemaID, "rowID", rowID)
 	record, err := em.transformer.ToPersistentRecord(ctx, schemaID, rowID, inputData)
@@ -54,9 +89,64 @@ func (em *entityManager) Create(ctx context.Context, req *forma.EntityOperation)
 		SchemaName: req.SchemaName,
 		RowID:      rowID,
 		Attributes: attributes,
+		Meta:       em.recordMeta(req.SchemaName, record),
 	}, nil
 }
 
+// applySchemaDefaults fills in JSON Schema default values for properties absent from data
+func (em *entityManager) applySchemaDefaults(schemaName string, data map[string]any) map[string]any {
+	_, schema, err := em.registry.GetSchemaByName(schemaName)
+	if err != nil {
+		// Schemas registered without a JSON Schema document have no defaults
+		zap.S().Debugw("skipping schema defaults", "schemaName", schemaName, "error", err)
+		return data
+	}
+	return schema.ApplyDefaults(data)
+}
+
+// upsert updates the entity identified by req.RowID when it exists and creates it under that row ID
+// otherwise. Without a row ID it always creates. Updates are taken from req.Updates, falling back to req.Data.
+func (em *entityManager) upsert(ctx context.Context, req *forma.EntityOperation) (*forma.DataRecord, error) {
+	if req == nil {
+		return nil, fmt.Errorf("entity operation cannot be nil")
+	}
+
+	if req.RowID == (uuid.UUID{}) {
+		return em.Create(ctx, req)
+	}
+
+	if req.SchemaName == "" {
+		return nil, fmt.Errorf("schema name is required")
+	}
+
+	schemaID, _, err := em.registry.GetSchemaAttributeCacheByName(req.SchemaName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schema: %w", err)
+	}
+
+	existing, err := em.repository.GetPersistentRecord(ctx, em.storageTables(), schemaID, req.RowID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load existing record: %w", err)
+	}
+
+	if existing == nil {
+		if req.Data == nil {
+			return nil, fmt.Errorf("data is required for create operation")
+		}
+		return em.createWithRowID(ctx, req, req.RowID)
+	}
+
+	if existing.DeletedAt != nil {
+		return nil, fmt.Errorf("entity is deleted: %s/%s", req.SchemaName, req.RowID)
+	}
+
+	update := *req
+	if update.Updates == nil {
+		update.Updates = req.Data
+	}
+	return em.Update(ctx, &update)
+}
+
 // Get retrieves an entity by schema name and row ID
 func (em *entityManager) Get(ctx context.Context, req *forma.QueryRequest) (*forma.DataRecord, error) {
 	if req == nil {
@@ -77,11 +167,20 @@ func (em *entityManager) Get(ctx context.Context, req *forma.QueryRequest) (*for
 		return nil, fmt.Errorf("failed to get schema: %w", err)
 	}
 
-	record, err := em.repository.GetPersistentRecord(ctx, em.storageTables(), schemaID, *req.RowID)
+	tables := em.storageTables()
+	var record *PersistentRecord
+	if req.AsOf != nil {
+		if tables.History == "" {
+			return nil, forma.ErrHistoryDisabled
+		}
+		record, err = em.repository.GetPersistentRecordAsOf(ctx, tables, schemaID, *req.RowID, req.AsOf.UnixMilli())
+	} else {
+		record, err = em.repository.GetPersistentRecord(ctx, tables, schemaID, *req.RowID)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to load persistent record: %w", err)
 	}
-	if record == nil {
+	if record == nil || (record.DeletedAt != nil && !req.IncludeDeleted) {
 		return nil, fmt.Errorf("entity not found: %s/%s", req.SchemaName, req.RowID)
 	}
 
@@ -90,9 +189,13 @@ func (em *entityManager) Get(ctx context.Context, req *forma.QueryRequest) (*for
 		return nil, err
 	}
 
+	ctx = withParentCache(ctx)
 	if err := em.enrichDataRecords(ctx, req.SchemaName, req.Attrs, dataRecord); err != nil {
 		return nil, err
 	}
+	if err := em.expandDataRecords(ctx, req.SchemaName, req.Expand, dataRecord); err != nil {
+		return nil, err
+	}
 
 	applyProjection([]*forma.DataRecord{dataRecord}, req.Attrs)
 
@@ -128,8 +231,8 @@ func (em *entityManager) Update(ctx context.Context, req *forma.EntityOperation)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load existing record: %w", err)
 	}
-	if existingRecord == nil {
-		return nil, fmt.Errorf("entity not found: %s/%s", req.SchemaName, req.RowID)
+	if existingRecord == nil || existingRecord.DeletedAt != nil {
+		return nil, fmt.Errorf("%w: %s/%s", forma.ErrNotFound, req.SchemaName, req.RowID)
 	}
 
 	existingData, err := em.transformer.FromPersistentRecord(ctx, existingRecord)
@@ -138,26 +241,40 @@ func (em *entityManager) Update(ctx context.Context, req *forma.EntityOperation)
 	}
 
 	mergedData := mergeMaps(existingData, req.Updates)
+	return em.replaceDocument(ctx, tables, req.SchemaName, existingRecord, existingData, mergedData)
+}
+
+// replaceDocument stores data as the new full document of existingRecord's entity. It runs the same
+// immutable-field, validation and storage checks for every write that replaces an existing document.
+func (em *entityManager) replaceDocument(ctx context.Context, tables StorageTables, schemaName string, existingRecord *PersistentRecord, existingData, data map[string]any) (*forma.DataRecord, error) {
+	if err := em.enforceImmutableFields(schemaName, existingData, data); err != nil {
+		return nil, fmt.Errorf("failed to apply updates: %w", err)
+	}
 	if em.relations != nil {
-		mergedData = em.relations.StripComputedFields(req.SchemaName, mergedData)
+		data = em.relations.StripComputedFields(schemaName, data)
+	}
+	if err := em.checkReferences(ctx, schemaName, data, existingData); err != nil {
+		return nil, fmt.Errorf("failed to validate references: %w", err)
 	}
 
-	updatedRecord, err := em.transformer.ToPersistentRecord(ctx, schemaID, req.RowID, mergedData)
+	updatedRecord, err := em.transformer.ToPersistentRecord(ctx, existingRecord.SchemaID, existingRecord.RowID, data)
 	if err != nil {
 		return nil, fmt.Errorf("failed to transform merged data: %w", err)
 	}
 
 	updatedRecord.CreatedAt = existingRecord.CreatedAt
 	updatedRecord.DeletedAt = existingRecord.DeletedAt
+	updatedRecord.Revision = existingRecord.Revision
 
 	if err := em.repository.UpdatePersistentRecord(ctx, tables, updatedRecord); err != nil {
 		return nil, fmt.Errorf("failed to update persistent record: %w", err)
 	}
 
 	return &forma.DataRecord{
-		SchemaName: req.SchemaName,
-		RowID:      req.RowID,
-		Attributes: mergedData,
+		SchemaName: schemaName,
+		RowID:      existingRecord.RowID,
+		Attributes: data,
+		Meta:       em.recordMeta(schemaName, updatedRecord),
 	}, nil
 }
 
@@ -180,9 +297,87 @@ func (em *entityManager) Delete(ctx context.Context, req *forma.EntityOperation)
 		return fmt.Errorf("failed to get schema: %w", err)
 	}
 
-	if err := em.repository.DeletePersistentRecord(ctx, em.storageTables(), schemaID, req.RowID); err != nil {
+	tables := em.storageTables()
+	if len(em.cascadeRules(req.SchemaName)) > 0 {
+		return em.runInTx(ctx, func(txCtx context.Context) error {
+			return em.cascadeDelete(txCtx, tables, req.SchemaName, schemaID, req.RowID, 0, make(map[cascadeKey]bool))
+		})
+	}
+	return em.deleteRow(ctx, tables, req.SchemaName, schemaID, req.RowID)
+}
+
+// deleteRow deletes a single entity, honoring the schema's soft delete setting.
+func (em *entityManager) deleteRow(ctx context.Context, tables StorageTables, schemaName string, schemaID int16, rowID uuid.UUID) error {
+	if em.config.Entity.SoftDeleteEnabled(schemaName) {
+		if err := em.repository.SoftDeletePersistentRecord(ctx, tables, schemaID, rowID); err != nil {
+			return fmt.Errorf("failed to soft delete persistent record: %w", err)
+		}
+		return nil
+	}
+
+	if err := em.repository.DeletePersistentRecord(ctx, tables, schemaID, rowID); err != nil {
 		return fmt.Errorf("failed to delete persistent record: %w", err)
 	}
 
 	return nil
 }
+
+// Restore clears the tombstone of a soft-deleted entity and returns the restored record
+func (em *entityManager) Restore(ctx context.Context, req *forma.EntityOperation) (*forma.DataRecord, error) {
+	if req == nil {
+		return nil, fmt.Errorf("entity operation cannot be nil")
+	}
+
+	if req.SchemaName == "" {
+		return nil, fmt.Errorf("schema name is required")
+	}
+
+	if req.RowID == (uuid.UUID{}) {
+		return nil, fmt.Errorf("row ID is required for restore operation")
+	}
+
+	schemaID, _, err := em.registry.GetSchemaAttributeCacheByName(req.SchemaName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schema: %w", err)
+	}
+
+	tables := em.storageTables()
+	if err := em.repository.RestorePersistentRecord(ctx, tables, schemaID, req.RowID); err != nil {
+		return nil, fmt.Errorf("failed to restore persistent record: %w", err)
+	}
+
+	record, err := em.repository.GetPersistentRecord(ctx, tables, schemaID, req.RowID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load restored record: %w", err)
+	}
+	if record == nil {
+		return nil, fmt.Errorf("%w: %s/%s", forma.ErrNotFound, req.SchemaName, req.RowID)
+	}
+
+	return em.toDataRecord(ctx, req.SchemaName, record)
+}
+
+// Purge permanently removes entities of a schema that were soft-deleted more than olderThan ago
+func (em *entityManager) Purge(ctx context.Context, schemaName string, olderThan time.Duration) (int64, error) {
+	if schemaName == "" {
+		return 0, fmt.Errorf("schema name is required")
+	}
+
+	if olderThan < 0 {
+		return 0, fmt.Errorf("purge age cannot be negative")
+	}
+
+	schemaID, _, err := em.registry.GetSchemaAttributeCacheByName(schemaName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get schema: %w", err)
+	}
+
+	deletedBefore := time.Now().Add(-olderThan).UnixMilli()
+	purged, err := em.repository.PurgePersistentRecords(ctx, em.storageTables(), schemaID, deletedBefore)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge persistent records: %w", err)
+	}
+
+	zap.S().Infow("Purged soft-deleted entities", "schemaName", schemaName, "purged", purged)
+	return purged, nil
+}
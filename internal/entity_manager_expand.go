@@ -0,0 +1,333 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/lychee-technology/forma"
+)
+
+// expandPageSize is the page size used to read the children of a batch of parents.
+const expandPageSize = 500
+
+// defaultMaxExpandDepth bounds expand paths when Reference.MaxExpandDepth is unset.
+const defaultMaxExpandDepth = 3
+
+// expandNode is one relation of an expand path. Specs sharing a prefix, such as visits and
+// visits.activities, share the nodes of that prefix, so each relation is loaded once.
+type expandNode struct {
+	spec     forma.ExpandSpec
+	children []*expandNode
+}
+
+// buildExpandTree merges the dotted paths of specs into a tree. The limit and sort of a spec apply
+// to the last relation of its path.
+func buildExpandTree(specs []forma.ExpandSpec, maxDepth int) ([]*expandNode, error) {
+	var roots []*expandNode
+	for _, spec := range specs {
+		segments := strings.Split(spec.Relation, ".")
+		if len(segments) > maxDepth {
+			return nil, fmt.Errorf("%w: %s is %d relations deep, the maximum is %d", forma.ErrInvalidExpand, spec.Relation, len(segments), maxDepth)
+		}
+		level := &roots
+		for i, segment := range segments {
+			if segment == "" {
+				return nil, fmt.Errorf("%w: empty relation in %q", forma.ErrInvalidExpand, spec.Relation)
+			}
+			var node *expandNode
+			for _, candidate := range *level {
+				if candidate.spec.Relation == segment {
+					node = candidate
+					break
+				}
+			}
+			if node == nil {
+				node = &expandNode{spec: forma.ExpandSpec{Relation: segment}}
+				*level = append(*level, node)
+			}
+			if i == len(segments)-1 {
+				node.spec.Limit, node.spec.SortBy = spec.Limit, spec.SortBy
+			}
+			level = &node.children
+		}
+	}
+	return roots, nil
+}
+
+// maxExpandDepth returns the number of relations an expand path may chain.
+func (em *entityManager) maxExpandDepth() int {
+	if em.config.Reference.MaxExpandDepth > 0 {
+		return em.config.Reference.MaxExpandDepth
+	}
+	return defaultMaxExpandDepth
+}
+
+// expandDataRecords loads the relations requested by specs for all records at once. Every level of
+// an expand path is loaded for the whole page in Reference.BatchSize batches, and an entity reached
+// from several records is loaded and expanded further only once.
+func (em *entityManager) expandDataRecords(ctx context.Context, schemaName string, specs []forma.ExpandSpec, records ...*forma.DataRecord) error {
+	if len(specs) == 0 || len(records) == 0 {
+		return nil
+	}
+	nodes, err := buildExpandTree(specs, em.maxExpandDepth())
+	if err != nil {
+		return err
+	}
+	return em.expandLevel(ctx, schemaName, nodes, records)
+}
+
+// expandLevel loads each node's relation for records and recurses into the loaded entities.
+func (em *entityManager) expandLevel(ctx context.Context, schemaName string, nodes []*expandNode, records []*forma.DataRecord) error {
+	for _, node := range nodes {
+		rel, forward, err := em.expandRelation(schemaName, node.spec.Relation)
+		if err != nil {
+			return err
+		}
+
+		targetSchema := rel.ChildSchema
+		var related map[*forma.DataRecord][]*forma.DataRecord
+		var loaded []*forma.DataRecord
+		if forward {
+			targetSchema = rel.ParentSchema
+			related, loaded, err = em.loadReferenced(ctx, rel, records)
+		} else {
+			related, loaded, err = em.loadChildren(ctx, rel, node.spec, records)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to expand %s: %w", node.spec.Relation, err)
+		}
+
+		for _, record := range records {
+			if record.Expanded == nil {
+				record.Expanded = make(map[string][]*forma.DataRecord, len(nodes))
+			}
+			record.Expanded[node.spec.Relation] = related[record]
+			if record.Expanded[node.spec.Relation] == nil {
+				record.Expanded[node.spec.Relation] = []*forma.DataRecord{}
+			}
+		}
+
+		if len(node.children) > 0 && len(loaded) > 0 {
+			if err := em.expandLevel(ctx, targetSchema, node.children, loaded); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// expandRelation resolves the name of an expansion from schemaName. forward reports that the name is
+// a parent referenced by one of schemaName's foreign keys, named after the parent schema or after
+// the foreign key without its "Id" or "Ids" suffix; otherwise it names a child schema that
+// references schemaName, as is or with an "s" suffix.
+func (em *entityManager) expandRelation(schemaName, name string) (rel RelationDescriptor, forward bool, err error) {
+	var parents []RelationDescriptor
+	for _, candidate := range em.relations.ForeignKeys(schemaName) {
+		fkName := strings.TrimSuffix(strings.TrimSuffix(candidate.ForeignKeyAttr, "Ids"), "Id")
+		if candidate.ParentSchema == name || fkName == name {
+			parents = append(parents, candidate)
+		}
+	}
+	switch len(parents) {
+	case 0:
+		rel, err = em.reverseRelation(schemaName, name)
+		return rel, false, err
+	case 1:
+		if _, err := em.reverseRelation(schemaName, name); err == nil {
+			return RelationDescriptor{}, false, fmt.Errorf("%w: %s is both a parent and a child of %s", forma.ErrInvalidExpand, name, schemaName)
+		}
+		return parents[0], true, nil
+	default:
+		return RelationDescriptor{}, false, fmt.Errorf("%w: %s references %s through several foreign keys", forma.ErrInvalidExpand, schemaName, name)
+	}
+}
+
+// reverseRelation resolves the name of an expansion to the foreign key through which a child schema
+// references schemaName. The name is the child schema, optionally with an "s" suffix.
+func (em *entityManager) reverseRelation(schemaName, name string) (RelationDescriptor, error) {
+	var matches []RelationDescriptor
+	for _, rel := range em.relations.Children(schemaName) {
+		if rel.ChildSchema == name || rel.ChildSchema+"s" == name {
+			matches = append(matches, rel)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return RelationDescriptor{}, fmt.Errorf("%w: %s is neither a parent nor a child of %s through x-relation", forma.ErrInvalidExpand, name, schemaName)
+	case 1:
+		return matches[0], nil
+	default:
+		return RelationDescriptor{}, fmt.Errorf("%w: %s references %s through several foreign keys", forma.ErrInvalidExpand, matches[0].ChildSchema, schemaName)
+	}
+}
+
+// loadChildren returns up to spec.Limit children of rel for each of parents, in spec.SortBy order,
+// together with all the children loaded. A child whose array or nested foreign key references
+// several of the parents is returned for each of them.
+func (em *entityManager) loadChildren(ctx context.Context, rel RelationDescriptor, spec forma.ExpandSpec, parents []*forma.DataRecord) (map[*forma.DataRecord][]*forma.DataRecord, []*forma.DataRecord, error) {
+	limit := spec.Limit
+	if limit <= 0 {
+		limit = forma.DefaultExpandLimit
+	}
+	if em.config.Query.MaxPageSize > 0 && limit > em.config.Query.MaxPageSize {
+		limit = em.config.Query.MaxPageSize
+	}
+
+	childSchemaID, childCache, err := em.registry.GetSchemaAttributeCacheByName(rel.ChildSchema)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get schema %s: %w", rel.ChildSchema, err)
+	}
+	orders := make([]AttributeOrder, 0, len(spec.SortBy))
+	for _, sortAttr := range spec.SortBy {
+		sortOrder := forma.SortOrderAsc
+		if strings.HasPrefix(sortAttr, "-") {
+			sortAttr, sortOrder = sortAttr[1:], forma.SortOrderDesc
+		}
+		order, err := attributeOrder(rel.ChildSchema, childCache, sortAttr, sortOrder)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", forma.ErrInvalidExpand, err)
+		}
+		orders = append(orders, order)
+	}
+
+	var ids []string
+	seen := make(map[string]bool, len(parents))
+	for _, parent := range parents {
+		id, ok := readStringAtPath(parent.Attributes, rel.ParentIDAttr)
+		if ok && id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	batchSize := defaultReferenceBatchSize
+	if em.config.Reference.BatchSize > 0 {
+		batchSize = em.config.Reference.BatchSize
+	}
+
+	tables := em.storageTables()
+	children := make(map[string][]*forma.DataRecord, len(ids))
+	var loaded []*forma.DataRecord
+	for start := 0; start < len(ids); start += batchSize {
+		batch := ids[start:min(start+batchSize, len(ids))]
+
+		// Pages arrive in sort order, so a parent is complete once it has limit children. Each page
+		// is read with a condition on the parents still short of limit only, so one parent with many
+		// children is not read past its limit while another has few. scanned holds the foreign key
+		// IDs of every child read so far; those matching the pending parents are the rows the
+		// narrowed condition has already returned, which gives the offset of its next page.
+		pending := batch
+		var scanned [][]string
+		for len(pending) > 0 {
+			short := make(map[string]bool, len(pending))
+			conditions := make([]forma.Condition, 0, len(pending))
+			for _, id := range pending {
+				short[id] = true
+				conditions = append(conditions, &forma.KvCondition{Attr: rel.ForeignKeyAttr, Value: "equals:" + id})
+			}
+			cond, err := em.transformer.ToStorageCondition(childSchemaID, &forma.CompositeCondition{Logic: forma.LogicOr, Conditions: conditions})
+			if err != nil {
+				return nil, nil, fmt.Errorf("build child condition for schema %s: %w", rel.ChildSchema, err)
+			}
+			offset := 0
+			for _, parentIDs := range scanned {
+				if slices.ContainsFunc(parentIDs, func(id string) bool { return short[id] }) {
+					offset++
+				}
+			}
+
+			page, err := em.repository.QueryPersistentRecords(ctx, &PersistentRecordQuery{
+				Tables:          tables,
+				SchemaID:        childSchemaID,
+				Condition:       cond,
+				AttributeOrders: orders,
+				Limit:           expandPageSize,
+				Offset:          offset,
+			})
+			if err != nil {
+				return nil, nil, fmt.Errorf("query child records for schema %s: %w", rel.ChildSchema, err)
+			}
+			for _, record := range page.Records {
+				child, err := em.toDataRecord(ctx, rel.ChildSchema, record)
+				if err != nil {
+					return nil, nil, err
+				}
+				parentIDs := referenceIDs(child.Attributes, rel.ForeignKeyAttr)
+				scanned = append(scanned, parentIDs)
+				kept := false
+				for _, parentID := range parentIDs {
+					if !seen[parentID] || len(children[parentID]) >= limit {
+						continue
+					}
+					children[parentID] = append(children[parentID], child)
+					kept = true
+				}
+				if kept {
+					loaded = append(loaded, child)
+				}
+			}
+			if len(page.Records) < expandPageSize {
+				break
+			}
+
+			next := pending[:0:0]
+			for _, id := range pending {
+				if len(children[id]) < limit {
+					next = append(next, id)
+				}
+			}
+			pending = next
+		}
+	}
+
+	if err := em.enrichDataRecords(ctx, rel.ChildSchema, nil, loaded...); err != nil {
+		return nil, nil, err
+	}
+	related := make(map[*forma.DataRecord][]*forma.DataRecord, len(parents))
+	for _, parent := range parents {
+		id, _ := readStringAtPath(parent.Attributes, rel.ParentIDAttr)
+		related[parent] = children[id]
+	}
+	return related, loaded, nil
+}
+
+// loadReferenced returns the parents each of records references through rel, in foreign key order,
+// together with the distinct parents loaded.
+func (em *entityManager) loadReferenced(ctx context.Context, rel RelationDescriptor, records []*forma.DataRecord) (map[*forma.DataRecord][]*forma.DataRecord, []*forma.DataRecord, error) {
+	var ids []string
+	seen := make(map[string]bool, len(records))
+	for _, record := range records {
+		for _, id := range referenceIDs(record.Attributes, rel.ForeignKeyAttr) {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	parents, err := em.loadParentRecords(ctx, rel, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	loaded := make([]*forma.DataRecord, 0, len(parents))
+	for _, id := range ids {
+		if parent, ok := parents[id]; ok {
+			loaded = append(loaded, parent)
+		}
+	}
+	if err := em.enrichDataRecords(ctx, rel.ParentSchema, nil, loaded...); err != nil {
+		return nil, nil, err
+	}
+
+	related := make(map[*forma.DataRecord][]*forma.DataRecord, len(records))
+	for _, record := range records {
+		for _, id := range referenceIDs(record.Attributes, rel.ForeignKeyAttr) {
+			if parent, ok := parents[id]; ok {
+				related[record] = append(related[record], parent)
+			}
+		}
+	}
+	return related, loaded, nil
+}
@@ -0,0 +1,240 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/lychee-technology/forma"
+)
+
+func TestEntityManager_ExpandChildren(t *testing.T) {
+	ctx := context.Background()
+	registry, err := newFileSchemaRegistryFromDir("../cmd/server/schemas")
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+	transformer := NewPersistentRecordTransformer(registry)
+	visitSchemaID, _, err := registry.GetSchemaAttributeCacheByName("visit")
+	if err != nil {
+		t.Fatalf("failed to resolve visit schema: %v", err)
+	}
+
+	repo := newMockPersistentRecordRepository()
+	repo.queryFunc = func(ctx context.Context, query *PersistentRecordQuery) (*PersistentRecordPage, error) {
+		var records []*PersistentRecord
+		for _, record := range repo.records[query.SchemaID] {
+			attrs, err := transformer.FromPersistentRecord(ctx, record)
+			if err != nil {
+				return nil, err
+			}
+			if query.Condition == nil || matchAttributes(attrs, query.Condition) {
+				records = append(records, record)
+			}
+		}
+		return &PersistentRecordPage{Records: records, TotalRecords: int64(len(records))}, nil
+	}
+	em := NewEntityManager(transformer, repo, registry, createTestConfig())
+
+	for _, leadID := range []string{"lead-1", "lead-2", "lead-3"} {
+		if _, err := em.Create(ctx, &forma.EntityOperation{
+			EntityIdentifier: forma.EntityIdentifier{SchemaName: "lead"},
+			Data:             leadPayload(leadID),
+		}); err != nil {
+			t.Fatalf("failed to create lead: %v", err)
+		}
+	}
+	for i, leadID := range []string{"lead-1", "lead-1", "lead-1", "lead-2"} {
+		data := visitPayload("visit-" + string(rune('a'+i)))
+		data["leadId"] = leadID
+		if _, err := em.Create(ctx, &forma.EntityOperation{
+			EntityIdentifier: forma.EntityIdentifier{SchemaName: "visit"},
+			Data:             data,
+		}); err != nil {
+			t.Fatalf("failed to create visit: %v", err)
+		}
+	}
+
+	repo.queries = nil
+	result, err := em.Query(ctx, &forma.QueryRequest{
+		SchemaName: "lead",
+		Expand:     []forma.ExpandSpec{{Relation: "visits", Limit: 2, SortBy: []string{"-scheduledStartAt"}}},
+	})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(result.Data) != 3 {
+		t.Fatalf("expected 3 leads, got %d", len(result.Data))
+	}
+	counts := make(map[string]int)
+	for _, lead := range result.Data {
+		id, _ := readStringAtPath(lead.Attributes, "id")
+		visits, ok := lead.Expanded["visits"]
+		if !ok {
+			t.Fatalf("expected lead %s to carry expanded visits", id)
+		}
+		for _, visit := range visits {
+			if visit.SchemaName != "visit" || visit.Attributes["leadId"] != id {
+				t.Fatalf("lead %s got visit of %v", id, visit.Attributes["leadId"])
+			}
+		}
+		counts[id] = len(visits)
+	}
+	if counts["lead-1"] != 2 || counts["lead-2"] != 1 || counts["lead-3"] != 0 {
+		t.Fatalf("unexpected visit counts: %v", counts)
+	}
+
+	var visitQueries []*PersistentRecordQuery
+	for _, query := range repo.queries {
+		if query.SchemaID == visitSchemaID {
+			visitQueries = append(visitQueries, query)
+		}
+	}
+	if len(visitQueries) != 1 {
+		t.Fatalf("expected the visits of the page to be loaded in one query, got %d", len(visitQueries))
+	}
+	if orders := visitQueries[0].AttributeOrders; len(orders) != 1 || orders[0].SortOrder != forma.SortOrderDesc {
+		t.Fatalf("expected a descending child order, got %+v", orders)
+	}
+
+	_, err = em.Query(ctx, &forma.QueryRequest{SchemaName: "lead", Expand: []forma.ExpandSpec{{Relation: "owners"}}})
+	if !errors.Is(err, forma.ErrInvalidExpand) {
+		t.Fatalf("expected ErrInvalidExpand for an unknown relation, got %v", err)
+	}
+
+	// visit -> lead -> visits: the lead shared by three visits is loaded and expanded once.
+	leadSchemaID, _, err := registry.GetSchemaAttributeCacheByName("lead")
+	if err != nil {
+		t.Fatalf("failed to resolve lead schema: %v", err)
+	}
+	repo.queries = nil
+	result, err = em.Query(ctx, &forma.QueryRequest{
+		SchemaName: "visit",
+		Expand:     []forma.ExpandSpec{{Relation: "lead.visits"}},
+	})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	leadsByID := make(map[string]*forma.DataRecord)
+	for _, visit := range result.Data {
+		leads := visit.Expanded["lead"]
+		if len(leads) != 1 || leads[0].Attributes["id"] != visit.Attributes["leadId"] {
+			t.Fatalf("expected visit to expand its lead %v, got %v", visit.Attributes["leadId"], leads)
+		}
+		if previous, ok := leadsByID[leads[0].Attributes["id"].(string)]; ok && previous != leads[0] {
+			t.Fatal("expected visits of the same lead to share the expanded lead")
+		}
+		leadsByID[leads[0].Attributes["id"].(string)] = leads[0]
+	}
+	if got := len(leadsByID["lead-1"].Expanded["visits"]); got != 3 {
+		t.Fatalf("expected lead-1 to expand its 3 visits, got %d", got)
+	}
+	leadQueries := 0
+	for _, query := range repo.queries {
+		if query.SchemaID == leadSchemaID {
+			leadQueries++
+		}
+	}
+	if leadQueries != 1 {
+		t.Fatalf("expected the leads of the page to be loaded in one query, got %d", leadQueries)
+	}
+
+	_, err = em.Query(ctx, &forma.QueryRequest{SchemaName: "visit", Expand: []forma.ExpandSpec{{Relation: "lead.visits.lead.visits"}}})
+	if !errors.Is(err, forma.ErrInvalidExpand) {
+		t.Fatalf("expected ErrInvalidExpand beyond the maximum depth, got %v", err)
+	}
+}
+
+func TestEntityManager_ExpandChildren_StopsReadingFullParents(t *testing.T) {
+	ctx := context.Background()
+	registry, err := newFileSchemaRegistryFromDir("../cmd/server/schemas")
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+	transformer := NewPersistentRecordTransformer(registry)
+	visitSchemaID, _, err := registry.GetSchemaAttributeCacheByName("visit")
+	if err != nil {
+		t.Fatalf("failed to resolve visit schema: %v", err)
+	}
+
+	repo := newMockPersistentRecordRepository()
+	repo.queryFunc = func(ctx context.Context, query *PersistentRecordQuery) (*PersistentRecordPage, error) {
+		var records []*PersistentRecord
+		for _, record := range repo.records[query.SchemaID] {
+			attrs, err := transformer.FromPersistentRecord(ctx, record)
+			if err != nil {
+				return nil, err
+			}
+			if query.Condition == nil || matchAttributes(attrs, query.Condition) {
+				records = append(records, record)
+			}
+		}
+		sort.Slice(records, func(i, j int) bool { return records[i].RowID.String() < records[j].RowID.String() })
+		total := int64(len(records))
+		if query.Limit > 0 {
+			records = records[min(query.Offset, len(records)):min(query.Offset+query.Limit, len(records))]
+		}
+		return &PersistentRecordPage{Records: records, TotalRecords: total}, nil
+	}
+	em := NewEntityManager(transformer, repo, registry, createTestConfig())
+
+	for _, leadID := range []string{"busy", "sparse", "idle"} {
+		if _, err := em.Create(ctx, &forma.EntityOperation{
+			EntityIdentifier: forma.EntityIdentifier{SchemaName: "lead"},
+			Data:             leadPayload(leadID),
+		}); err != nil {
+			t.Fatalf("failed to create lead: %v", err)
+		}
+	}
+	// Three pages of visits for one lead, a few scattered among them for another and none for the third.
+	for i := 0; i < 3*expandPageSize; i++ {
+		data := visitPayload(fmt.Sprintf("visit-%d", i))
+		data["leadId"] = "busy"
+		if i%expandPageSize == 0 {
+			data["leadId"] = "sparse"
+		}
+		if _, err := em.Create(ctx, &forma.EntityOperation{
+			EntityIdentifier: forma.EntityIdentifier{SchemaName: "visit"},
+			Data:             data,
+		}); err != nil {
+			t.Fatalf("failed to create visit: %v", err)
+		}
+	}
+
+	repo.queries = nil
+	result, err := em.Query(ctx, &forma.QueryRequest{
+		SchemaName: "lead",
+		Expand:     []forma.ExpandSpec{{Relation: "visits", Limit: 5}},
+	})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	want := map[string]int{"busy": 5, "sparse": 3, "idle": 0}
+	for _, lead := range result.Data {
+		id := lead.Attributes["id"].(string)
+		visits := make(map[string]bool)
+		for _, visit := range lead.Expanded["visits"] {
+			if visit.Attributes["leadId"] != id {
+				t.Fatalf("lead %s got visit of %v", id, visit.Attributes["leadId"])
+			}
+			visits[visit.Attributes["id"].(string)] = true
+		}
+		if len(visits) != want[id] || len(lead.Expanded["visits"]) != want[id] {
+			t.Fatalf("expected %d distinct visits for lead %s, got %d", want[id], id, len(lead.Expanded["visits"]))
+		}
+	}
+
+	// The first page fills the busy lead; the second asks for the other two only and finds the rest
+	// of the sparse visits.
+	var visitQueries []*PersistentRecordQuery
+	for _, query := range repo.queries {
+		if query.SchemaID == visitSchemaID {
+			visitQueries = append(visitQueries, query)
+		}
+	}
+	if len(visitQueries) != 2 {
+		t.Fatalf("expected 2 visit pages to be read, got %d", len(visitQueries))
+	}
+}
@@ -49,6 +49,75 @@ func getValueAtPath(m map[string]any, path string) any {
 	return current
 }
 
+// referenceIDs returns the non-empty IDs found at the dotted path of m. Arrays along the path, of
+// IDs or of objects holding the rest of the path, contribute every element, in order and without
+// duplicates.
+func referenceIDs(m map[string]any, path string) []string {
+	var ids []string
+	seen := make(map[string]bool)
+	var collect func(value any, segments []string)
+	collect = func(value any, segments []string) {
+		switch v := value.(type) {
+		case []any:
+			for _, item := range v {
+				collect(item, segments)
+			}
+		case map[string]any:
+			if len(segments) > 0 {
+				collect(v[segments[0]], segments[1:])
+			}
+		case nil:
+		default:
+			if len(segments) > 0 {
+				return
+			}
+			id := fmt.Sprintf("%v", v)
+			if id != "" && !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	collect(m, strings.Split(path, "."))
+	return ids
+}
+
+// clearReference removes the reference to id at the dotted path of m: an ID equal to id is set to
+// nil and dropped from arrays of IDs, including inside arrays of objects.
+func clearReference(m map[string]any, path, id string) {
+	var remove func(value any, segments []string)
+	remove = func(value any, segments []string) {
+		switch v := value.(type) {
+		case []any:
+			for _, item := range v {
+				remove(item, segments)
+			}
+		case map[string]any:
+			key := segments[0]
+			if len(segments) > 1 {
+				remove(v[key], segments[1:])
+				return
+			}
+			switch current := v[key].(type) {
+			case []any:
+				kept := make([]any, 0, len(current))
+				for _, item := range current {
+					if fmt.Sprintf("%v", item) != id {
+						kept = append(kept, item)
+					}
+				}
+				v[key] = kept
+			case nil:
+			default:
+				if fmt.Sprintf("%v", current) == id {
+					v[key] = nil
+				}
+			}
+		}
+	}
+	remove(m, strings.Split(path, "."))
+}
+
 func setNestedValue(m map[string]any, path string, value any) {
 	if m == nil || path == "" {
 		return
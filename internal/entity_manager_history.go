@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/lychee-technology/forma"
+	"go.uber.org/zap"
+)
+
+// GetHistory returns every stored version of an entity, oldest first. Snapshots are decoded with
+// the transformer, so encrypted attributes are only readable with the configured key provider.
+func (em *entityManager) GetHistory(ctx context.Context, schemaName string, rowID uuid.UUID) ([]*forma.HistoryEntry, error) {
+	if schemaName == "" {
+		return nil, fmt.Errorf("schema name is required")
+	}
+
+	tables := em.storageTables()
+	if tables.History == "" {
+		return nil, forma.ErrHistoryDisabled
+	}
+
+	schemaID, _, err := em.registry.GetSchemaAttributeCacheByName(schemaName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schema: %w", err)
+	}
+
+	records, err := em.repository.ListHistory(ctx, tables, schemaID, rowID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load history: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("entity not found: %s/%s", schemaName, rowID)
+	}
+
+	history := make([]*forma.HistoryEntry, 0, len(records))
+	for _, record := range records {
+		entry := &forma.HistoryEntry{
+			Revision:  record.Revision,
+			Operation: record.Operation,
+			ChangedAt: record.ChangedAt,
+			Actor:     record.Actor,
+		}
+		if record.Snapshot != nil {
+			attributes, err := em.transformer.FromPersistentRecord(ctx, record.Snapshot)
+			if err != nil {
+				return nil, fmt.Errorf("failed to transform revision %d: %w", record.Revision, err)
+			}
+			entry.Attributes = attributes
+			entry.Meta = em.recordMeta(schemaName, record.Snapshot)
+		}
+		history = append(history, entry)
+	}
+
+	return history, nil
+}
+
+// Revert writes the document stored at revision back as the entity's next revision. History is only
+// appended to, never rewritten, and the reverted document goes through the same immutable-field,
+// schema validation and unique constraint checks as an Update.
+func (em *entityManager) Revert(ctx context.Context, schemaName string, rowID uuid.UUID, revision int64) (*forma.DataRecord, error) {
+	if schemaName == "" {
+		return nil, fmt.Errorf("schema name is required")
+	}
+
+	if rowID == (uuid.UUID{}) {
+		return nil, fmt.Errorf("row ID is required for revert operation")
+	}
+
+	tables := em.storageTables()
+	if tables.History == "" {
+		return nil, forma.ErrHistoryDisabled
+	}
+
+	schemaID, _, err := em.registry.GetSchemaAttributeCacheByName(schemaName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schema: %w", err)
+	}
+
+	existingRecord, err := em.repository.GetPersistentRecord(ctx, tables, schemaID, rowID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load existing record: %w", err)
+	}
+	if existingRecord == nil {
+		return nil, fmt.Errorf("entity not found: %s/%s", schemaName, rowID)
+	}
+	if existingRecord.DeletedAt != nil {
+		return nil, fmt.Errorf("entity is deleted: %s/%s", schemaName, rowID)
+	}
+
+	records, err := em.repository.ListHistory(ctx, tables, schemaID, rowID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load history: %w", err)
+	}
+
+	// A row ID created again after a hard delete restarts at revision 1, so the latest
+	// snapshot stored under the revision wins.
+	var snapshot *PersistentRecord
+	for _, record := range records {
+		if record.Revision == revision && record.Snapshot != nil {
+			snapshot = record.Snapshot
+		}
+	}
+	if snapshot == nil {
+		return nil, fmt.Errorf("%w: %s/%s@%d", forma.ErrRevisionNotFound, schemaName, rowID, revision)
+	}
+
+	revertedData, err := em.transformer.FromPersistentRecord(ctx, snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to transform revision %d: %w", revision, err)
+	}
+
+	existingData, err := em.transformer.FromPersistentRecord(ctx, existingRecord)
+	if err != nil {
+		return nil, fmt.Errorf("failed to transform existing record: %w", err)
+	}
+
+	zap.S().Debugw("Reverting entity", "schemaName", schemaName, "rowID", rowID, "revision", revision)
+	return em.replaceDocument(ctx, tables, schemaName, existingRecord, existingData, revertedData)
+}
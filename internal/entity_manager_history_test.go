@@ -0,0 +1,227 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lychee-technology/forma"
+)
+
+func TestEntityManager_GetHistory(t *testing.T) {
+	ctx := context.Background()
+	registry, err := newFileSchemaRegistryFromDir("../cmd/server/schemas")
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+	schemaID, _, err := registry.GetSchemaAttributeCacheByName("lead")
+	if err != nil {
+		t.Fatalf("failed to resolve lead schema: %v", err)
+	}
+
+	transformer := NewPersistentRecordTransformerWithOptions(registry, TransformerOptions{KeyProvider: newTestKeyProvider()})
+	rowID := uuid.New()
+	payload := leadPayload(rowID.String())
+	payload["contact"] = map[string]any{"name": "History Lead", "primaryPhone": "090-1234-5678"}
+	snapshot, err := transformer.ToPersistentRecord(ctx, schemaID, rowID, payload)
+	if err != nil {
+		t.Fatalf("ToPersistentRecord failed: %v", err)
+	}
+	snapshot.CreatedAt, snapshot.UpdatedAt, snapshot.Revision = 1000, 1000, 1
+	for _, attr := range snapshot.OtherAttributes {
+		if attr.ValueText != nil && strings.Contains(*attr.ValueText, "090-1234-5678") {
+			t.Fatalf("expected primaryPhone to be stored encrypted in the snapshot")
+		}
+	}
+
+	repo := newMockPersistentRecordRepository()
+	repo.history = map[uuid.UUID][]*HistoryRecord{
+		rowID: {
+			{Revision: 1, Operation: forma.HistoryOperationCreate, ChangedAt: 1000, Actor: "alice", Snapshot: snapshot},
+			{Revision: 2, Operation: forma.HistoryOperationDelete, ChangedAt: 2000},
+		},
+	}
+
+	config := createTestConfig()
+	config.Database.TableNames.History = "entity_history"
+	config.Entity.EnableVersioning = true
+	em := NewEntityManager(transformer, repo, registry, config)
+
+	history, err := em.GetHistory(ctx, "lead", rowID)
+	if err != nil {
+		t.Fatalf("GetHistory failed: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("expected 2 history entries, got %d", len(history))
+	}
+	created := history[0]
+	if created.Operation != forma.HistoryOperationCreate || created.Actor != "alice" || created.ChangedAt != 1000 {
+		t.Fatalf("unexpected create entry: %+v", created)
+	}
+	contact, _ := created.Attributes["contact"].(map[string]any)
+	if contact["primaryPhone"] != "090-1234-5678" {
+		t.Fatalf("expected decrypted primaryPhone, got %v", contact["primaryPhone"])
+	}
+	if created.Meta == nil || created.Meta.Revision != 1 {
+		t.Fatalf("expected revision 1 in meta, got %+v", created.Meta)
+	}
+	if deleted := history[1]; deleted.Attributes != nil || deleted.Meta != nil {
+		t.Fatalf("expected hard delete entry without a snapshot, got %+v", deleted)
+	}
+
+	if _, err := em.GetHistory(ctx, "lead", uuid.New()); err == nil {
+		t.Fatalf("expected an error for an entity without history")
+	}
+
+	config.Entity.EnableVersioning = false
+	if _, err := em.GetHistory(ctx, "lead", rowID); !errors.Is(err, forma.ErrHistoryDisabled) {
+		t.Fatalf("expected ErrHistoryDisabled with versioning off, got %v", err)
+	}
+}
+
+func TestEntityManager_AsOf(t *testing.T) {
+	ctx := context.Background()
+	registry, err := newFileSchemaRegistryFromDir("../cmd/server/schemas")
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+	schemaID, _, err := registry.GetSchemaAttributeCacheByName("lead")
+	if err != nil {
+		t.Fatalf("failed to resolve lead schema: %v", err)
+	}
+
+	transformer := NewPersistentRecordTransformer(registry)
+	rowID := uuid.New()
+	version := func(stage string, revision int64) *PersistentRecord {
+		payload := leadPayload(rowID.String())
+		payload["stage"] = stage
+		record, err := transformer.ToPersistentRecord(ctx, schemaID, rowID, payload)
+		if err != nil {
+			t.Fatalf("ToPersistentRecord failed: %v", err)
+		}
+		record.Revision = revision
+		return record
+	}
+
+	repo := newMockPersistentRecordRepository()
+	repo.history = map[uuid.UUID][]*HistoryRecord{
+		rowID: {
+			{Revision: 1, Operation: forma.HistoryOperationCreate, ChangedAt: 1000, Snapshot: version("new", 1)},
+			{Revision: 2, Operation: forma.HistoryOperationUpdate, ChangedAt: 2000, Snapshot: version("offer", 2)},
+			{Revision: 3, Operation: forma.HistoryOperationDelete, ChangedAt: 3000},
+		},
+	}
+
+	config := createTestConfig()
+	config.Database.TableNames.History = "entity_history"
+	config.Entity.EnableVersioning = true
+	em := NewEntityManager(transformer, repo, registry, config)
+
+	get := func(millis int64) (*forma.DataRecord, error) {
+		asOf := time.UnixMilli(millis)
+		return em.Get(ctx, &forma.QueryRequest{SchemaName: "lead", RowID: &rowID, AsOf: &asOf})
+	}
+	record, err := get(2500)
+	if err != nil {
+		t.Fatalf("Get as of 2500 failed: %v", err)
+	}
+	if record.Attributes["stage"] != "offer" || record.Meta.Revision != 2 {
+		t.Fatalf("expected revision 2 in stage offer, got %v (revision %d)", record.Attributes["stage"], record.Meta.Revision)
+	}
+	if record, err = get(1000); err != nil || record.Attributes["stage"] != "new" {
+		t.Fatalf("expected stage new as of 1000, got %v, %v", record, err)
+	}
+	if _, err := get(500); err == nil {
+		t.Fatalf("expected not found before the entity was created")
+	}
+	if _, err := get(3500); err == nil {
+		t.Fatalf("expected not found after the entity was deleted")
+	}
+
+	asOf := time.UnixMilli(2500)
+	if _, err := em.Query(ctx, &forma.QueryRequest{SchemaName: "lead", AsOf: &asOf}); err != nil {
+		t.Fatalf("Query as of failed: %v", err)
+	}
+	if repo.lastQuery == nil || repo.lastQuery.AsOf == nil || *repo.lastQuery.AsOf != 2500 {
+		t.Fatalf("expected AsOf to reach the repository, got %+v", repo.lastQuery)
+	}
+
+	config.Entity.EnableVersioning = false
+	if _, err := em.Query(ctx, &forma.QueryRequest{SchemaName: "lead", AsOf: &asOf}); !errors.Is(err, forma.ErrHistoryDisabled) {
+		t.Fatalf("expected ErrHistoryDisabled with versioning off, got %v", err)
+	}
+}
+
+func TestEntityManager_Revert(t *testing.T) {
+	ctx := context.Background()
+	registry, err := newFileSchemaRegistryFromDir("../cmd/server/schemas")
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+	schemaID, _, err := registry.GetSchemaAttributeCacheByName("lead")
+	if err != nil {
+		t.Fatalf("failed to resolve lead schema: %v", err)
+	}
+
+	transformer := NewPersistentRecordTransformerWithOptions(registry, TransformerOptions{KeyProvider: newTestKeyProvider()})
+	repo := newMockPersistentRecordRepository()
+	config := createTestConfig()
+	config.Database.TableNames.History = "entity_history"
+	config.Entity.EnableVersioning = true
+	em := NewEntityManager(transformer, repo, registry, config)
+
+	rowID := uuid.New()
+	payload := leadPayload(rowID.String())
+	payload["contact"] = map[string]any{"name": "Revert Lead", "primaryPhone": "090-1234-5678"}
+	if _, err := em.Create(ctx, &forma.EntityOperation{
+		EntityIdentifier: forma.EntityIdentifier{SchemaName: "lead", RowID: rowID},
+		Data:             payload,
+	}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	original, err := transformer.ToPersistentRecord(ctx, schemaID, rowID, payload)
+	if err != nil {
+		t.Fatalf("ToPersistentRecord failed: %v", err)
+	}
+
+	wiped, err := em.Update(ctx, &forma.EntityOperation{
+		EntityIdentifier: forma.EntityIdentifier{SchemaName: "lead", RowID: rowID},
+		Updates:          map[string]any{"contact": map[string]any{"name": "Revert Lead", "primaryPhone": nil}},
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	repo.history = map[uuid.UUID][]*HistoryRecord{
+		rowID: {
+			{Revision: 1, Operation: forma.HistoryOperationCreate, ChangedAt: 1000, Snapshot: original},
+			{Revision: 2, Operation: forma.HistoryOperationUpdate, ChangedAt: 2000},
+		},
+	}
+
+	reverted, err := em.Revert(ctx, "lead", rowID, 1)
+	if err != nil {
+		t.Fatalf("Revert failed: %v", err)
+	}
+	contact, _ := reverted.Attributes["contact"].(map[string]any)
+	if contact["primaryPhone"] != "090-1234-5678" {
+		t.Fatalf("expected primaryPhone to be reverted, got %v", contact["primaryPhone"])
+	}
+	if reverted.Meta == nil || reverted.Meta.Revision != wiped.Meta.Revision+1 {
+		t.Fatalf("expected revert to write revision %d, got %+v", wiped.Meta.Revision+1, reverted.Meta)
+	}
+
+	if _, err := em.Revert(ctx, "lead", rowID, 2); !errors.Is(err, forma.ErrRevisionNotFound) {
+		t.Fatalf("expected ErrRevisionNotFound for a revision without a snapshot, got %v", err)
+	}
+	if _, err := em.Revert(ctx, "lead", uuid.New(), 1); err == nil {
+		t.Fatalf("expected an error for an unknown entity")
+	}
+
+	config.Entity.EnableVersioning = false
+	if _, err := em.Revert(ctx, "lead", rowID, 1); !errors.Is(err, forma.ErrHistoryDisabled) {
+		t.Fatalf("expected ErrHistoryDisabled with versioning off, got %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lychee-technology/forma"
+	"go.uber.org/zap"
+)
+
+// defaultIdempotencyTTL keeps idempotent create results when Entity.IdempotencyTTL is unset.
+const defaultIdempotencyTTL = 24 * time.Hour
+
+// errIdempotencyRace signals that a concurrent request stored the same idempotency key first.
+var errIdempotencyRace = errors.New("idempotency key stored concurrently")
+
+// idempotencyTTL returns how long idempotent create results are kept.
+func (em *entityManager) idempotencyTTL() time.Duration {
+	if em.config.Entity.IdempotencyTTL > 0 {
+		return em.config.Entity.IdempotencyTTL
+	}
+	return defaultIdempotencyTTL
+}
+
+// createIdempotent creates req at most once per idempotency key. A replay with the same request
+// returns the stored result; a replay with a different request fails with forma.ErrIdempotencyKeyReused.
+func (em *entityManager) createIdempotent(ctx context.Context, req *forma.EntityOperation) (*forma.DataRecord, error) {
+	tables := em.storageTables()
+	if tables.IdempotencyKeys == "" {
+		return nil, fmt.Errorf("idempotency keys table is not configured")
+	}
+
+	schemaID, _, err := em.registry.GetSchemaAttributeCacheByName(req.SchemaName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schema: %w", err)
+	}
+
+	requestHash, err := idempotencyRequestHash(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if record, err := em.replayIdempotent(ctx, tables, schemaID, req.IdempotencyKey, requestHash); record != nil || err != nil {
+		return record, err
+	}
+
+	var created *forma.DataRecord
+	err = em.runInTx(ctx, func(txCtx context.Context) error {
+		record, err := em.createOnce(txCtx, req)
+		if err != nil {
+			return err
+		}
+
+		response, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("failed to encode idempotent response: %w", err)
+		}
+
+		saved, err := em.repository.SaveIdempotencyRecord(txCtx, tables, &IdempotencyRecord{
+			SchemaID:    schemaID,
+			Key:         req.IdempotencyKey,
+			RequestHash: requestHash,
+			Response:    response,
+			ExpiresAt:   time.Now().Add(em.idempotencyTTL()).UnixMilli(),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to save idempotency record: %w", err)
+		}
+		if !saved {
+			return errIdempotencyRace
+		}
+
+		created = record
+		return nil
+	})
+
+	if errors.Is(err, errIdempotencyRace) {
+		zap.S().Debugw("idempotency key stored concurrently, replaying", "schemaName", req.SchemaName, "key", req.IdempotencyKey)
+		record, err := em.replayIdempotent(ctx, tables, schemaID, req.IdempotencyKey, requestHash)
+		if err != nil {
+			return nil, err
+		}
+		if record == nil {
+			return nil, fmt.Errorf("idempotency record for key %q disappeared", req.IdempotencyKey)
+		}
+		return record, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// replayIdempotent returns the stored result for key, or nil when the key has not been used.
+func (em *entityManager) replayIdempotent(ctx context.Context, tables StorageTables, schemaID int16, key, requestHash string) (*forma.DataRecord, error) {
+	stored, err := em.repository.GetIdempotencyRecord(ctx, tables, schemaID, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load idempotency record: %w", err)
+	}
+	if stored == nil {
+		return nil, nil
+	}
+	if stored.RequestHash != requestHash {
+		return nil, fmt.Errorf("%w: %s", forma.ErrIdempotencyKeyReused, key)
+	}
+
+	var record forma.DataRecord
+	if err := json.Unmarshal(stored.Response, &record); err != nil {
+		return nil, fmt.Errorf("failed to decode idempotent response: %w", err)
+	}
+
+	zap.S().Debugw("replaying idempotent create", "schemaName", record.SchemaName, "rowID", record.RowID, "key", key)
+	return &record, nil
+}
+
+// idempotencyRequestHash fingerprints the parts of a create request that determine its result.
+func idempotencyRequestHash(req *forma.EntityOperation) (string, error) {
+	var rowID string
+	if req.RowID != (uuid.UUID{}) {
+		rowID = req.RowID.String()
+	}
+
+	payload, err := json.Marshal(struct {
+		SchemaName string         `json:"schemaName"`
+		RowID      string         `json:"rowId,omitempty"`
+		Data       map[string]any `json:"data"`
+	}{
+		SchemaName: req.SchemaName,
+		RowID:      rowID,
+		Data:       req.Data,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode request for idempotency: %w", err)
+	}
+
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:]), nil
+}
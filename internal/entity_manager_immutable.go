@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/lychee-technology/forma"
+	"go.uber.org/zap"
+)
+
+// immutablePaths returns the readOnly and x-immutable property paths of schemaName.
+func (em *entityManager) immutablePaths(schemaName string) []string {
+	_, schema, err := em.registry.GetSchemaByName(schemaName)
+	if err != nil {
+		return nil
+	}
+	return schema.ImmutablePaths()
+}
+
+// enforceImmutableFields checks merged against existing for every write-protected path of
+// schemaName. A field without a stored value may still be set once. Under the ignore policy a
+// changed field is reset to its stored value; otherwise the change fails with *forma.ImmutableFieldError.
+func (em *entityManager) enforceImmutableFields(schemaName string, existing, merged map[string]any) error {
+	ignore := em.config != nil && em.config.Entity.ImmutableFieldPolicy == forma.ImmutableFieldPolicyIgnore
+
+	for _, path := range em.immutablePaths(schemaName) {
+		stored := getValueAtPath(existing, path)
+		if stored == nil {
+			continue
+		}
+		incoming := getValueAtPath(merged, path)
+		if sameValue(stored, incoming) {
+			continue
+		}
+		if !ignore {
+			return &forma.ImmutableFieldError{Path: path}
+		}
+		zap.S().Debugw("ignoring change to immutable field", "schemaName", schemaName, "path", path)
+		setNestedValue(merged, path, stored)
+	}
+	return nil
+}
+
+// touchesImmutableField reports whether patch sets any write-protected path of schemaName.
+func (em *entityManager) touchesImmutableField(schemaName string, patch map[string]any) bool {
+	for _, path := range em.immutablePaths(schemaName) {
+		if getValueAtPath(patch, path) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// sameValue compares a stored value with an incoming one. Stored values come back typed from
+// the transformer (time.Time, uuid.UUID, int64) while updates usually carry JSON strings and
+// float64s, so numbers compare by value, timestamps by instant and other values by their text.
+func sameValue(stored, incoming any) bool {
+	if reflect.DeepEqual(stored, incoming) {
+		return true
+	}
+	if stored == nil || incoming == nil {
+		return false
+	}
+
+	storedTime, storedIsTime := asTime(stored)
+	incomingTime, incomingIsTime := asTime(incoming)
+	if storedIsTime || incomingIsTime {
+		return storedIsTime && incomingIsTime && storedTime.Equal(incomingTime)
+	}
+
+	_, storedIsText := stored.(string)
+	_, incomingIsText := incoming.(string)
+	if !storedIsText && !incomingIsText {
+		if a, err := toFloat64(stored); err == nil {
+			if b, err := toFloat64(incoming); err == nil {
+				return a == b
+			}
+		}
+	}
+
+	if storedStringer, ok := stored.(fmt.Stringer); ok && incomingIsText {
+		return storedStringer.String() == incoming
+	}
+
+	storedJSON, err := json.Marshal(stored)
+	if err != nil {
+		return false
+	}
+	incomingJSON, err := json.Marshal(incoming)
+	return err == nil && bytes.Equal(storedJSON, incomingJSON)
+}
+
+// asTime interprets value as an instant when it is a time.Time or an RFC 3339 / date-only string.
+func asTime(value any) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		for _, layout := range []string{time.RFC3339Nano, time.DateOnly} {
+			if parsed, err := time.Parse(layout, v); err == nil {
+				return parsed, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
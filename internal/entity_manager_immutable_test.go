@@ -0,0 +1,130 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lychee-technology/forma"
+)
+
+func leadPayload(id string) map[string]any {
+	return map[string]any{
+		"id":          id,
+		"tenantId":    "tenant-1",
+		"ownerUserId": "owner-1",
+		"pipeline":    "buy",
+		"stage":       "new",
+		"status":      "open",
+		"contact":     map[string]any{"name": "Immutable Lead"},
+		"createdAt":   "2024-01-01T00:00:00Z",
+		"updatedAt":   "2024-01-02T00:00:00Z",
+	}
+}
+
+func TestEntityManager_Update_ImmutableFields(t *testing.T) {
+	ctx := context.Background()
+	registry, err := newFileSchemaRegistryFromDir("../cmd/server/schemas")
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+
+	newManager := func(policy forma.ImmutableFieldPolicy) (forma.EntityManager, uuid.UUID) {
+		config := createTestConfig()
+		config.Entity.ImmutableFieldPolicy = policy
+		em := NewEntityManager(NewPersistentRecordTransformer(registry), newMockPersistentRecordRepository(), registry, config)
+		created, err := em.Create(ctx, &forma.EntityOperation{
+			EntityIdentifier: forma.EntityIdentifier{SchemaName: "lead"},
+			Type:             forma.OperationCreate,
+			Data:             leadPayload(uuid.New().String()),
+		})
+		if err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		if created.Attributes["tenantId"] != "tenant-1" {
+			t.Fatalf("expected Create to set immutable tenantId, got %v", created.Attributes["tenantId"])
+		}
+		return em, created.RowID
+	}
+	update := func(em forma.EntityManager, rowID uuid.UUID, updates map[string]any) (*forma.DataRecord, error) {
+		return em.Update(ctx, &forma.EntityOperation{
+			EntityIdentifier: forma.EntityIdentifier{SchemaName: "lead", RowID: rowID},
+			Type:             forma.OperationUpdate,
+			Updates:          updates,
+		})
+	}
+
+	t.Run("reject", func(t *testing.T) {
+		em, rowID := newManager(forma.ImmutableFieldPolicyReject)
+
+		_, err := update(em, rowID, map[string]any{"tenantId": "tenant-2", "status": "won"})
+		var immutableErr *forma.ImmutableFieldError
+		if !errors.As(err, &immutableErr) || immutableErr.Path != "tenantId" {
+			t.Fatalf("expected ImmutableFieldError for tenantId, got %v", err)
+		}
+		if !errors.Is(err, forma.ErrImmutableField) {
+			t.Fatalf("expected error to wrap ErrImmutableField, got %v", err)
+		}
+
+		got, err := em.Get(ctx, &forma.QueryRequest{SchemaName: "lead", RowID: &rowID})
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		if got.Attributes["status"] != "open" {
+			t.Fatalf("rejected update must not apply other fields, got status %v", got.Attributes["status"])
+		}
+
+		updated, err := update(em, rowID, map[string]any{"tenantId": "tenant-1", "createdAt": "2024-01-01T09:00:00+09:00", "status": "won"})
+		if err != nil {
+			t.Fatalf("resending unchanged immutable values should succeed: %v", err)
+		}
+		if updated.Attributes["status"] != "won" {
+			t.Fatalf("expected status won, got %v", updated.Attributes["status"])
+		}
+	})
+
+	t.Run("ignore", func(t *testing.T) {
+		em, rowID := newManager(forma.ImmutableFieldPolicyIgnore)
+
+		updated, err := update(em, rowID, map[string]any{"tenantId": "tenant-2", "status": "won"})
+		if err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+		if updated.Attributes["tenantId"] != "tenant-1" {
+			t.Fatalf("expected tenantId change to be ignored, got %v", updated.Attributes["tenantId"])
+		}
+		if updated.Attributes["status"] != "won" {
+			t.Fatalf("expected the rest of the update to apply, got status %v", updated.Attributes["status"])
+		}
+	})
+}
+
+func TestSameValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		stored   any
+		incoming any
+		want     bool
+	}{
+		{name: "equal strings", stored: "a", incoming: "a", want: true},
+		{name: "different strings", stored: "a", incoming: "b", want: false},
+		{name: "numeric types", stored: int64(5), incoming: 5.0, want: true},
+		{name: "number and string", stored: int64(5), incoming: "5", want: false},
+		{name: "same instant", stored: "2024-01-01T00:00:00Z", incoming: "2024-01-01T09:00:00+09:00", want: true},
+		{name: "numeric strings", stored: "123", incoming: "0123", want: false},
+		{name: "stored time", stored: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), incoming: "2024-01-01T00:00:00Z", want: true},
+		{name: "stored uuid", stored: uuid.MustParse("0191e5a2-7c1d-7000-8000-000000000001"), incoming: "0191e5a2-7c1d-7000-8000-000000000001", want: true},
+		{name: "time and text", stored: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), incoming: "soon", want: false},
+		{name: "removed", stored: "a", incoming: nil, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sameValue(tt.stored, tt.incoming); got != tt.want {
+				t.Fatalf("sameValue(%v, %v) = %v, want %v", tt.stored, tt.incoming, got, tt.want)
+			}
+		})
+	}
+}
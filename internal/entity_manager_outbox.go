@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lychee-technology/forma"
+	"go.uber.org/zap"
+)
+
+// DispatchOutbox leases a batch of undispatched outbox rows inside one transaction, publishes them to
+// sink and marks them dispatched once sink succeeds. When sink or the update fails the transaction
+// rolls back and the rows are published again by the next call.
+func (em *entityManager) DispatchOutbox(ctx context.Context, sink forma.EventSink, batchSize int) (int, error) {
+	if sink == nil {
+		return 0, fmt.Errorf("event sink is required")
+	}
+
+	tables := em.storageTables()
+	if tables.Outbox == "" {
+		return 0, forma.ErrOutboxDisabled
+	}
+	if batchSize <= 0 {
+		batchSize = forma.DefaultChangeBatchSize
+	}
+
+	var dispatched int64
+	err := em.runInTx(ctx, func(txCtx context.Context) error {
+		records, err := em.repository.LeaseOutbox(txCtx, tables, batchSize)
+		if err != nil {
+			return fmt.Errorf("failed to lease outbox: %w", err)
+		}
+		if len(records) == 0 {
+			return nil
+		}
+
+		events, err := em.hydrateOutbox(txCtx, records)
+		if err != nil {
+			return err
+		}
+		if err := sink.Publish(txCtx, events); err != nil {
+			return fmt.Errorf("event sink failed: %w", err)
+		}
+
+		ids := make([]int64, len(records))
+		for i, record := range records {
+			ids[i] = record.ID
+		}
+		dispatched, err = em.repository.MarkOutboxDispatched(txCtx, tables, ids)
+		if err != nil {
+			return fmt.Errorf("failed to mark outbox dispatched: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	zap.S().Debugw("dispatched outbox", "dispatched", dispatched)
+	return int(dispatched), nil
+}
+
+// hydrateOutbox turns outbox rows into events carrying the committed entity. Deletes carry no record.
+func (em *entityManager) hydrateOutbox(ctx context.Context, records []*OutboxRecord) ([]*forma.OutboxEvent, error) {
+	schemaNames := make(map[int16]string)
+	events := make([]*forma.OutboxEvent, 0, len(records))
+	for _, record := range records {
+		schemaName, ok := schemaNames[record.SchemaID]
+		if !ok {
+			name, _, err := em.registry.GetSchemaAttributeCacheByID(record.SchemaID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve schema name for id %d: %w", record.SchemaID, err)
+			}
+			schemaName = name
+			schemaNames[record.SchemaID] = name
+		}
+
+		event := &forma.OutboxEvent{
+			ID:          record.ID,
+			SchemaName:  schemaName,
+			RowID:       record.RowID,
+			Operation:   record.Operation,
+			Revision:    record.Revision,
+			CommittedAt: record.CommittedAt,
+		}
+		if record.Snapshot != nil && record.Operation != forma.ChangeOperationDeleted {
+			dataRecord, err := em.toDataRecord(ctx, schemaName, record.Snapshot)
+			if err != nil {
+				return nil, err
+			}
+			event.Record = dataRecord
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/lychee-technology/forma"
+)
+
+type recordingSink struct {
+	batches [][]*forma.OutboxEvent
+	err     error
+}
+
+func (s *recordingSink) Publish(ctx context.Context, events []*forma.OutboxEvent) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.batches = append(s.batches, events)
+	return nil
+}
+
+func TestEntityManager_DispatchOutbox(t *testing.T) {
+	ctx := context.Background()
+	registry, err := newFileSchemaRegistryFromDir("../cmd/server/schemas")
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+	schemaID, _, err := registry.GetSchemaAttributeCacheByName("lead")
+	if err != nil {
+		t.Fatalf("failed to resolve lead schema: %v", err)
+	}
+
+	repo := newMockPersistentRecordRepository()
+	config := createTestConfig()
+	config.Database.TableNames.Outbox = "outbox"
+	em := NewEntityManager(NewPersistentRecordTransformer(registry), repo, registry, config)
+
+	rowID := uuid.New()
+	if _, err := em.Create(ctx, &forma.EntityOperation{
+		EntityIdentifier: forma.EntityIdentifier{SchemaName: "lead", RowID: rowID},
+		Data:             leadPayload(rowID.String()),
+	}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	committed := *repo.records[schemaID][rowID]
+	repo.outbox = []*OutboxRecord{
+		{ID: 1, SchemaID: schemaID, RowID: rowID, Operation: forma.ChangeOperationCreated, Revision: 1, CommittedAt: 1000, Snapshot: &committed},
+		{ID: 2, SchemaID: schemaID, RowID: rowID, Operation: forma.ChangeOperationDeleted, Revision: 2, CommittedAt: 2000},
+	}
+
+	failing := &recordingSink{err: errors.New("bus unavailable")}
+	if _, err := em.DispatchOutbox(ctx, failing, 10); !errors.Is(err, failing.err) {
+		t.Fatalf("expected sink error, got %v", err)
+	}
+	if len(repo.outbox) != 2 {
+		t.Fatalf("expected the outbox to stay pending after a failed publish, got %d", len(repo.outbox))
+	}
+
+	sink := &recordingSink{}
+	dispatched, err := em.DispatchOutbox(ctx, sink, 10)
+	if err != nil {
+		t.Fatalf("DispatchOutbox failed: %v", err)
+	}
+	if dispatched != 2 || len(repo.outbox) != 0 || len(sink.batches) != 1 {
+		t.Fatalf("expected one batch of 2 dispatched events, got %d dispatched, %d pending, %d batches", dispatched, len(repo.outbox), len(sink.batches))
+	}
+	created, deleted := sink.batches[0][0], sink.batches[0][1]
+	if created.ID != 1 || created.SchemaName != "lead" || created.Operation != forma.ChangeOperationCreated || created.Record == nil || created.Record.RowID != rowID {
+		t.Fatalf("unexpected created event: %+v", created)
+	}
+	if deleted.ID != 2 || deleted.Operation != forma.ChangeOperationDeleted || deleted.Record != nil || deleted.Revision != 2 {
+		t.Fatalf("unexpected deleted event: %+v", deleted)
+	}
+
+	config.Database.TableNames.Outbox = ""
+	if _, err := em.DispatchOutbox(ctx, sink, 10); !errors.Is(err, forma.ErrOutboxDisabled) {
+		t.Fatalf("expected ErrOutboxDisabled without an outbox table, got %v", err)
+	}
+}
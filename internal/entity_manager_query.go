@@ -44,33 +44,34 @@ func (em *entityManager) Query(ctx context.Context, req *forma.QueryRequest) (*f
 
 	attributeOrders := make([]AttributeOrder, 0, len(req.SortBy))
 	for _, sortAttr := range req.SortBy {
-		meta, ok := schemaCache[sortAttr]
-		if !ok {
-			return nil, fmt.Errorf("cannot sort by unknown attribute '%s' in schema '%s'", sortAttr, req.SchemaName)
-		}
-		order := AttributeOrder{
-			AttrID:    meta.AttributeID,
-			ValueType: meta.ValueType,
-			SortOrder: sortOrder,
-		}
-		// Check if attribute has column_binding to main table
-		if meta.ColumnBinding != nil {
-			order.StorageLocation = forma.AttributeStorageLocationMain
-			order.ColumnName = string(meta.ColumnBinding.ColumnName)
-		} else {
-			order.StorageLocation = forma.AttributeStorageLocationEAV
+		order, err := attributeOrder(req.SchemaName, schemaCache, sortAttr, sortOrder)
+		if err != nil {
+			return nil, err
 		}
 		attributeOrders = append(attributeOrders, order)
 	}
 
+	condition, err := em.transformer.ToStorageCondition(schemaId, req.Condition)
+	if err != nil {
+		return nil, fmt.Errorf("invalid condition: %w", err)
+	}
+
 	tables := em.storageTables()
 	query := &PersistentRecordQuery{
 		Tables:          tables,
 		SchemaID:        schemaId,
-		Condition:       req.Condition,
+		Condition:       condition,
 		AttributeOrders: attributeOrders,
 		Limit:           req.ItemsPerPage,
 		Offset:          (req.Page - 1) * req.ItemsPerPage,
+		IncludeDeleted:  req.IncludeDeleted,
+	}
+	if req.AsOf != nil {
+		if tables.History == "" {
+			return nil, forma.ErrHistoryDisabled
+		}
+		asOf := req.AsOf.UnixMilli()
+		query.AsOf = &asOf
 	}
 
 	startTime := time.Now()
@@ -88,9 +89,13 @@ func (em *entityManager) Query(ctx context.Context, req *forma.QueryRequest) (*f
 		records = append(records, dataRecord)
 	}
 
+	ctx = withParentCache(ctx)
 	if err := em.enrichDataRecords(ctx, req.SchemaName, req.Attrs, records...); err != nil {
 		return nil, err
 	}
+	if err := em.expandDataRecords(ctx, req.SchemaName, req.Expand, records...); err != nil {
+		return nil, err
+	}
 
 	applyProjection(records, req.Attrs)
 
@@ -113,6 +118,30 @@ func (em *entityManager) Query(ctx context.Context, req *forma.QueryRequest) (*f
 	}, nil
 }
 
+// attributeOrder builds the storage ordering of a sortable attribute of schemaName.
+func attributeOrder(schemaName string, schemaCache forma.SchemaAttributeCache, attr string, sortOrder forma.SortOrder) (AttributeOrder, error) {
+	meta, ok := lookupAttribute(schemaCache, attr)
+	if !ok {
+		return AttributeOrder{}, fmt.Errorf("cannot sort by unknown attribute '%s' in schema '%s'", attr, schemaName)
+	}
+	if meta.IsEncrypted() {
+		return AttributeOrder{}, fmt.Errorf("%w: cannot sort by encrypted attribute '%s'", forma.ErrUnsupportedFilter, attr)
+	}
+	order := AttributeOrder{
+		AttrID:    meta.AttributeID,
+		ValueType: meta.ValueType,
+		SortOrder: sortOrder,
+	}
+	// Check if attribute has column_binding to main table
+	if meta.ColumnBinding != nil {
+		order.StorageLocation = forma.AttributeStorageLocationMain
+		order.ColumnName = string(meta.ColumnBinding.ColumnName)
+	} else {
+		order.StorageLocation = forma.AttributeStorageLocationEAV
+	}
+	return order, nil
+}
+
 // CrossSchemaSearch searches across multiple schemas using a single optimized query
 func (em *entityManager) CrossSchemaSearch(ctx context.Context, req *forma.CrossSchemaRequest) (*forma.QueryResult, error) {
 	if req == nil {
@@ -166,10 +195,14 @@ func (em *entityManager) CrossSchemaSearch(ctx context.Context, req *forma.Cross
 		if err != nil {
 			return nil, fmt.Errorf("failed to get schema %s: %w", schemaName, err)
 		}
+		condition, err := em.transformer.ToStorageCondition(schemaID, searchCondition)
+		if err != nil {
+			return nil, fmt.Errorf("invalid condition for schema %s: %w", schemaName, err)
+		}
 		schemaContexts = append(schemaContexts, schemaContext{
 			name:      schemaName,
 			id:        schemaID,
-			condition: searchCondition,
+			condition: condition,
 		})
 	}
 
@@ -0,0 +1,154 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/lychee-technology/forma"
+)
+
+// referenceTypeSchemas describes deals referencing several owners through an array of IDs and
+// several agents through the agentId of each viewing.
+var referenceTypeSchemas = map[string]string{
+	"owner.json":            `{"type":"object","required":["id","name"],"properties":{"id":{"type":"string"},"name":{"type":"string"}}}`,
+	"owner_attributes.json": `{"id":{"attributeID":1,"valueType":"text"},"name":{"attributeID":2,"valueType":"text"}}`,
+	"agent.json":            `{"type":"object","required":["id","name"],"properties":{"id":{"type":"string"},"name":{"type":"string"}}}`,
+	"agent_attributes.json": `{"id":{"attributeID":1,"valueType":"text"},"name":{"attributeID":2,"valueType":"text"}}`,
+	"deal.json": `{"type":"object","required":["id","title"],"properties":{
+		"id":{"type":"string"},
+		"title":{"type":"string"},
+		"ownerIds":{"type":"array","items":{"type":"string"}},
+		"owners":{"type":"array","items":{"$ref":"owner.json#/properties/name"},"x-relation":{"key_property":"#/properties/ownerIds"}},
+		"viewings":{"type":"array","items":{"type":"object","properties":{"agentId":{"type":"string"},"at":{"type":"string"}}}},
+		"viewingAgents":{"type":"array","items":{"$ref":"agent.json#/properties/name"},"x-relation":{"key_property":"#/properties/viewings/items/properties/agentId"}}
+	}}`,
+	"deal_attributes.json": `{"id":{"attributeID":1,"valueType":"text"},"title":{"attributeID":2,"valueType":"text"},
+		"ownerIds":{"attributeID":3,"valueType":"text"},"viewings.agentId":{"attributeID":4,"valueType":"text"},
+		"viewings.at":{"attributeID":5,"valueType":"text"}}`,
+}
+
+func TestEntityManager_ArrayAndNestedReferences(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	for name, content := range referenceTypeSchemas {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	registry, err := newFileSchemaRegistryFromDir(dir)
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+	transformer := NewPersistentRecordTransformer(registry)
+
+	repo := newMockPersistentRecordRepository()
+	repo.queryFunc = func(ctx context.Context, query *PersistentRecordQuery) (*PersistentRecordPage, error) {
+		var records []*PersistentRecord
+		for _, record := range repo.records[query.SchemaID] {
+			if record.DeletedAt != nil {
+				continue
+			}
+			attrs, err := transformer.FromPersistentRecord(ctx, record)
+			if err != nil {
+				return nil, err
+			}
+			if query.Condition == nil || matchAttributes(attrs, query.Condition) {
+				records = append(records, record)
+			}
+		}
+		return &PersistentRecordPage{Records: records, TotalRecords: int64(len(records))}, nil
+	}
+	config := createTestConfig()
+	config.Entity.EnableReferenceValidation = true
+	config.Reference.CheckIntegrity = true
+	config.Reference.ValidateOnCreate = true
+	config.Reference.CascadeRules = map[string]forma.CascadeRule{
+		"owner_deals": {SourceSchema: "owner", TargetSchema: "deal", Action: forma.CascadeActionNullify},
+	}
+	em := NewEntityManager(transformer, repo, registry, config)
+
+	types := make(map[string]forma.ReferenceType)
+	for _, rel := range em.(*entityManager).relations.ForeignKeys("deal") {
+		types[rel.ForeignKeyAttr] = rel.Type
+	}
+	if types["ownerIds"] != forma.ReferenceTypeArray || types["viewings.agentId"] != forma.ReferenceTypeNested {
+		t.Fatalf("unexpected reference types: %v", types)
+	}
+
+	create := func(schemaName string, data map[string]any) (*forma.DataRecord, error) {
+		return em.Create(ctx, &forma.EntityOperation{EntityIdentifier: forma.EntityIdentifier{SchemaName: schemaName}, Data: data})
+	}
+	owners := make(map[string]uuid.UUID)
+	for id, name := range map[string]string{"o1": "Olive", "o2": "Oscar"} {
+		owner, err := create("owner", map[string]any{"id": id, "name": name})
+		if err != nil {
+			t.Fatalf("failed to create owner: %v", err)
+		}
+		owners[id] = owner.RowID
+	}
+	if _, err := create("agent", map[string]any{"id": "a1", "name": "Ada"}); err != nil {
+		t.Fatalf("failed to create agent: %v", err)
+	}
+
+	// Every ID of an array or nested foreign key must reference a live parent.
+	var refErr *forma.ReferenceError
+	_, err = create("deal", map[string]any{"id": "d0", "title": "Dangling", "ownerIds": []any{"o1", "o9"}})
+	if !errors.As(err, &refErr) || refErr.Path != "ownerIds" || refErr.Value != "o9" {
+		t.Fatalf("expected a dangling owner reference, got %v", err)
+	}
+	_, err = create("deal", map[string]any{"id": "d0", "title": "Dangling", "viewings": []any{map[string]any{"agentId": "a9"}}})
+	if !errors.As(err, &refErr) || refErr.Path != "viewings.agentId" || refErr.Value != "a9" {
+		t.Fatalf("expected a dangling agent reference, got %v", err)
+	}
+
+	d1, err := create("deal", map[string]any{
+		"id": "d1", "title": "Harbour flat", "ownerIds": []any{"o1", "o2"},
+		"viewings": []any{map[string]any{"agentId": "a1", "at": "monday"}},
+	})
+	if err != nil {
+		t.Fatalf("failed to create deal: %v", err)
+	}
+	if _, err := create("deal", map[string]any{"id": "d2", "title": "Garden house", "ownerIds": []any{"o2"}}); err != nil {
+		t.Fatalf("failed to create deal: %v", err)
+	}
+
+	got, err := em.Get(ctx, &forma.QueryRequest{SchemaName: "deal", RowID: &d1.RowID, Expand: []forma.ExpandSpec{{Relation: "owner"}}})
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if !reflect.DeepEqual(got.Attributes["owners"], []any{"Olive", "Oscar"}) || !reflect.DeepEqual(got.Attributes["viewingAgents"], []any{"Ada"}) {
+		t.Fatalf("expected the parent fragments as lists, got %v and %v", got.Attributes["owners"], got.Attributes["viewingAgents"])
+	}
+	if len(got.Expanded["owner"]) != 2 {
+		t.Fatalf("expected both owners to be expanded, got %d", len(got.Expanded["owner"]))
+	}
+
+	result, err := em.Query(ctx, &forma.QueryRequest{SchemaName: "owner", Expand: []forma.ExpandSpec{{Relation: "deals"}}})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	deals := make(map[string]int)
+	for _, owner := range result.Data {
+		deals[owner.Attributes["id"].(string)] = len(owner.Expanded["deals"])
+	}
+	if deals["o1"] != 1 || deals["o2"] != 2 {
+		t.Fatalf("expected the deals referencing each owner, got %v", deals)
+	}
+
+	// Nullifying drops the deleted owner from the array instead of clearing it.
+	if err := em.Delete(ctx, &forma.EntityOperation{EntityIdentifier: forma.EntityIdentifier{SchemaName: "owner", RowID: owners["o2"]}}); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	got, err = em.Get(ctx, &forma.QueryRequest{SchemaName: "deal", RowID: &d1.RowID})
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if ids := referenceIDs(got.Attributes, "ownerIds"); !reflect.DeepEqual(ids, []string{"o1"}) {
+		t.Fatalf("expected only o1 to remain referenced, got %v", ids)
+	}
+}
@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lychee-technology/forma"
+)
+
+// defaultReferenceBatchSize is the number of parent IDs looked up per query when
+// Reference.BatchSize is unset.
+const defaultReferenceBatchSize = 100
+
+// referenceValidation reports whether foreign keys are checked on creates, or on updates when
+// onUpdate is set. It needs Entity.EnableReferenceValidation, Reference.CheckIntegrity and the
+// matching Reference.ValidateOnCreate or ValidateOnUpdate.
+func (em *entityManager) referenceValidation(onUpdate bool) bool {
+	if em.relations == nil || em.config == nil || !em.config.Entity.EnableReferenceValidation {
+		return false
+	}
+	ref := em.config.Reference
+	if !ref.CheckIntegrity {
+		return false
+	}
+	if onUpdate {
+		return ref.ValidateOnUpdate
+	}
+	return ref.ValidateOnCreate
+}
+
+// checkReferences returns a *forma.ReferenceError when a foreign key of data does not identify a live
+// entity. existing is the stored document on updates and nil on creates.
+func (em *entityManager) checkReferences(ctx context.Context, schemaName string, data, existing map[string]any) error {
+	if !em.referenceValidation(existing != nil) {
+		return nil
+	}
+	var existingDocs []map[string]any
+	if existing != nil {
+		existingDocs = []map[string]any{existing}
+	}
+	dangling, err := em.danglingReferences(ctx, schemaName, []map[string]any{data}, existingDocs)
+	if err != nil {
+		return err
+	}
+	if dangling[0] != nil {
+		return dangling[0]
+	}
+	return nil
+}
+
+// danglingReferences checks the foreign keys declared through x-relation key properties for every
+// document of docs, with one batched lookup per foreign key, and returns the first dangling
+// reference of each document or nil. Every ID of an array or nested foreign key is checked. Absent
+// and empty foreign keys are not. Neither are IDs already in the matching document of existing, so
+// an update does not fail on a parent deleted since the reference was stored.
+func (em *entityManager) danglingReferences(ctx context.Context, schemaName string, docs, existing []map[string]any) ([]*forma.ReferenceError, error) {
+	dangling := make([]*forma.ReferenceError, len(docs))
+	for _, rel := range em.relations.ForeignKeys(schemaName) {
+		var ids []string
+		docIndexes := make(map[string][]int)
+		for i, doc := range docs {
+			if dangling[i] != nil {
+				continue
+			}
+			stored := make(map[string]bool)
+			if i < len(existing) && existing[i] != nil {
+				for _, id := range referenceIDs(existing[i], rel.ForeignKeyAttr) {
+					stored[id] = true
+				}
+			}
+			for _, value := range referenceIDs(doc, rel.ForeignKeyAttr) {
+				if stored[value] {
+					continue
+				}
+				if _, seen := docIndexes[value]; !seen {
+					ids = append(ids, value)
+				}
+				docIndexes[value] = append(docIndexes[value], i)
+			}
+		}
+		if len(ids) == 0 {
+			continue
+		}
+
+		parents, err := em.loadParents(ctx, rel, ids)
+		if err != nil {
+			return nil, fmt.Errorf("failed to validate reference %s: %w", rel.ForeignKeyAttr, err)
+		}
+		for _, id := range ids {
+			if _, ok := parents[id]; ok {
+				continue
+			}
+			for _, i := range docIndexes[id] {
+				if dangling[i] == nil {
+					dangling[i] = &forma.ReferenceError{Path: rel.ForeignKeyAttr, TargetSchema: rel.ParentSchema, Value: id}
+				}
+			}
+		}
+	}
+	return dangling, nil
+}
@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lychee-technology/forma"
+)
+
+func TestEntityManager_ReferenceValidation(t *testing.T) {
+	ctx := context.Background()
+	registry, err := newFileSchemaRegistryFromDir("../cmd/server/schemas")
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+	leadSchemaID, _, err := registry.GetSchemaAttributeCacheByName("lead")
+	if err != nil {
+		t.Fatalf("failed to resolve lead schema: %v", err)
+	}
+
+	repo := newMockPersistentRecordRepository()
+	config := createTestConfig()
+	config.Entity.EnableReferenceValidation = true
+	config.Reference = forma.ReferenceConfig{ValidateOnCreate: true, ValidateOnUpdate: true, CheckIntegrity: true, BatchSize: 2}
+	em := NewEntityManager(NewPersistentRecordTransformer(registry), repo, registry, config)
+
+	lead, err := em.Create(ctx, &forma.EntityOperation{
+		EntityIdentifier: forma.EntityIdentifier{SchemaName: "lead"},
+		Data:             leadPayload("lead-1"),
+	})
+	if err != nil {
+		t.Fatalf("failed to create lead: %v", err)
+	}
+
+	visit := func(id, leadID string) map[string]any {
+		data := visitPayload(id)
+		data["leadId"] = leadID
+		return data
+	}
+	assertDangling := func(err error, value string) {
+		t.Helper()
+		var refErr *forma.ReferenceError
+		if !errors.As(err, &refErr) || !errors.Is(err, forma.ErrDanglingReference) {
+			t.Fatalf("expected a ReferenceError, got %v", err)
+		}
+		if refErr.Path != "leadId" || refErr.TargetSchema != "lead" || refErr.Value != value {
+			t.Fatalf("unexpected reference error: %+v", refErr)
+		}
+	}
+
+	_, err = em.Create(ctx, &forma.EntityOperation{
+		EntityIdentifier: forma.EntityIdentifier{SchemaName: "visit"},
+		Data:             visit("visit-0", "lead-missing"),
+	})
+	assertDangling(err, "lead-missing")
+
+	created, err := em.Create(ctx, &forma.EntityOperation{
+		EntityIdentifier: forma.EntityIdentifier{SchemaName: "visit"},
+		Data:             visit("visit-1", "lead-1"),
+	})
+	if err != nil {
+		t.Fatalf("expected a visit of an existing lead to be created: %v", err)
+	}
+
+	_, err = em.Update(ctx, &forma.EntityOperation{
+		EntityIdentifier: forma.EntityIdentifier{SchemaName: "visit", RowID: created.RowID},
+		Updates:          map[string]any{"leadId": "lead-gone"},
+	})
+	assertDangling(err, "lead-gone")
+
+	// An unchanged foreign key is not checked again, even once its parent is gone.
+	if err := em.Delete(ctx, &forma.EntityOperation{
+		EntityIdentifier: forma.EntityIdentifier{SchemaName: "lead", RowID: lead.RowID},
+	}); err != nil {
+		t.Fatalf("failed to delete lead: %v", err)
+	}
+	if _, err := em.Update(ctx, &forma.EntityOperation{
+		EntityIdentifier: forma.EntityIdentifier{SchemaName: "visit", RowID: created.RowID},
+		Updates:          map[string]any{"status": "completed"},
+	}); err != nil {
+		t.Fatalf("expected an update keeping the foreign key to pass: %v", err)
+	}
+
+	if _, err := em.Create(ctx, &forma.EntityOperation{
+		EntityIdentifier: forma.EntityIdentifier{SchemaName: "lead"},
+		Data:             leadPayload("lead-2"),
+	}); err != nil {
+		t.Fatalf("failed to create lead: %v", err)
+	}
+	repo.queries = nil
+	result, err := em.BulkLoad(ctx, "visit", forma.NewSliceEntityIterator([]map[string]any{
+		visit("visit-2", "lead-2"),
+		visit("visit-3", "lead-missing"),
+		visit("visit-4", "lead-2"),
+		visit("visit-5", "lead-other"),
+	}))
+	if err != nil {
+		t.Fatalf("BulkLoad failed: %v", err)
+	}
+	if result.Loaded != 2 || len(result.Failed) != 2 {
+		t.Fatalf("expected 2 loaded and 2 failed, got %+v", result)
+	}
+	for i, index := range []int{1, 3} {
+		if failed := result.Failed[i]; failed.Index != index || failed.Code != forma.ReferenceCodeDangling {
+			t.Fatalf("unexpected failure %d: %+v", i, failed)
+		}
+	}
+	leadQueries := 0
+	for _, query := range repo.queries {
+		if query.SchemaID == leadSchemaID {
+			leadQueries++
+		}
+	}
+	if leadQueries != 2 {
+		t.Fatalf("expected 3 lead IDs to be looked up in 2 batches, got %d queries", leadQueries)
+	}
+
+	config.Reference.ValidateOnCreate = false
+	if _, err := em.Create(ctx, &forma.EntityOperation{
+		EntityIdentifier: forma.EntityIdentifier{SchemaName: "visit"},
+		Data:             visit("visit-6", "lead-missing"),
+	}); err != nil {
+		t.Fatalf("expected creates to skip validation when disabled: %v", err)
+	}
+}
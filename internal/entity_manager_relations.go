@@ -40,14 +40,16 @@ func (em *entityManager) enrichDataRecords(ctx context.Context, schemaName strin
 
 		fkBuckets := make(map[string][]*forma.DataRecord)
 		for _, rec := range records {
-			fkVal, ok := readStringAtPath(rec.Attributes, rel.ForeignKeyAttr)
-			if !ok || fkVal == "" {
+			fkVals := referenceIDs(rec.Attributes, rel.ForeignKeyAttr)
+			if len(fkVals) == 0 {
 				if rel.ForeignKeyRequired {
 					zap.S().Warnw("missing required parent foreign key", "schema", schemaName, "attr", rel.ForeignKeyAttr)
 				}
 				continue
 			}
-			fkBuckets[fkVal] = append(fkBuckets[fkVal], rec)
+			for _, fkVal := range fkVals {
+				fkBuckets[fkVal] = append(fkBuckets[fkVal], rec)
+			}
 		}
 
 		if len(fkBuckets) == 0 {
@@ -59,6 +61,28 @@ func (em *entityManager) enrichDataRecords(ctx context.Context, schemaName strin
 			return err
 		}
 
+		// A child referencing several parents receives their fragments as a list, in ID order.
+		if rel.multiple() {
+			for _, rec := range records {
+				fkVals := referenceIDs(rec.Attributes, rel.ForeignKeyAttr)
+				if len(fkVals) == 0 {
+					continue
+				}
+				fragments := make([]any, 0, len(fkVals))
+				for _, fkVal := range fkVals {
+					parentAttrs, ok := parents[fkVal]
+					if !ok {
+						continue
+					}
+					if fragment := getValueAtPath(parentAttrs, rel.ParentPath); fragment != nil {
+						fragments = append(fragments, deepCopyValue(fragment))
+					}
+				}
+				setNestedValue(rec.Attributes, rel.ChildPath, fragments)
+			}
+			continue
+		}
+
 		for fk, recs := range fkBuckets {
 			parentAttrs, ok := parents[fk]
 			if !ok {
@@ -84,50 +108,120 @@ func (em *entityManager) fetchParents(ctx context.Context, rel RelationDescripto
 	for id := range fkBuckets {
 		ids = append(ids, id)
 	}
+	return em.loadParents(ctx, rel, ids)
+}
 
-	if len(ids) == 0 {
-		return map[string]map[string]any{}, nil
+// loadParents returns the attributes of the live parents of rel whose ParentIDAttr is one of ids,
+// keyed by that ID.
+func (em *entityManager) loadParents(ctx context.Context, rel RelationDescriptor, ids []string) (map[string]map[string]any, error) {
+	records, err := em.loadParentRecords(ctx, rel, ids)
+	if err != nil {
+		return nil, err
+	}
+	parents := make(map[string]map[string]any, len(records))
+	for id, record := range records {
+		parents[id] = record.Attributes
 	}
+	return parents, nil
+}
 
-	parentSchemaID, _, err := em.registry.GetSchemaByName(rel.ParentSchema)
-	if err != nil {
-		return nil, fmt.Errorf("get parent schema %s: %w", rel.ParentSchema, err)
+// parentCacheKey is the context key of the parentCache of a read.
+type parentCacheKey struct{}
+
+// parentCache remembers the parents looked up while reading one page, keyed by parent schema, ID
+// attribute and ID, so that enrichment and every level of expansion share lookups. Missing parents
+// are remembered as nil.
+type parentCache map[string]*forma.DataRecord
+
+// withParentCache returns a context whose parent lookups are cached until the read completes.
+func withParentCache(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(parentCacheKey{}).(parentCache); ok {
+		return ctx
 	}
+	return context.WithValue(ctx, parentCacheKey{}, parentCache{})
+}
 
-	var cond forma.Condition
-	if len(ids) == 1 {
-		cond = &forma.KvCondition{Attr: rel.ParentIDAttr, Value: ids[0]}
-	} else {
-		conditions := make([]forma.Condition, 0, len(ids))
+// loadParentRecords returns the live parents of rel whose ParentIDAttr is one of ids, keyed by that
+// ID. IDs are looked up Reference.BatchSize at a time, skipping those in the parentCache of ctx.
+func (em *entityManager) loadParentRecords(ctx context.Context, rel RelationDescriptor, ids []string) (map[string]*forma.DataRecord, error) {
+	cache, _ := ctx.Value(parentCacheKey{}).(parentCache)
+	cacheKey := func(id string) string {
+		return rel.ParentSchema + "\x00" + rel.ParentIDAttr + "\x00" + id
+	}
+	parents := make(map[string]*forma.DataRecord, len(ids))
+	if cache != nil {
+		missing := make([]string, 0, len(ids))
 		for _, id := range ids {
-			conditions = append(conditions, &forma.KvCondition{Attr: rel.ParentIDAttr, Value: id})
+			parent, ok := cache[cacheKey(id)]
+			switch {
+			case !ok:
+				missing = append(missing, id)
+			case parent != nil:
+				parents[id] = parent
+			}
 		}
-		cond = &forma.CompositeCondition{Logic: forma.LogicOr, Conditions: conditions}
+		ids = missing
+	}
+	if len(ids) == 0 {
+		return parents, nil
 	}
 
-	page, err := em.repository.QueryPersistentRecords(ctx, &PersistentRecordQuery{
-		Tables:    em.storageTables(),
-		SchemaID:  parentSchemaID,
-		Condition: cond,
-		Limit:     len(ids),
-		Offset:    0,
-	})
+	parentSchemaID, _, err := em.registry.GetSchemaByName(rel.ParentSchema)
 	if err != nil {
-		return nil, fmt.Errorf("query parent records for schema %s: %w", rel.ParentSchema, err)
+		return nil, fmt.Errorf("get parent schema %s: %w", rel.ParentSchema, err)
+	}
+
+	batchSize := defaultReferenceBatchSize
+	if em.config != nil && em.config.Reference.BatchSize > 0 {
+		batchSize = em.config.Reference.BatchSize
 	}
 
-	parents := make(map[string]map[string]any, len(page.Records))
-	for _, rec := range page.Records {
-		attrs, err := em.transformer.FromPersistentRecord(ctx, rec)
+	for start := 0; start < len(ids); start += batchSize {
+		batch := ids[start:min(start+batchSize, len(ids))]
+
+		var cond forma.Condition
+		if len(batch) == 1 {
+			cond = &forma.KvCondition{Attr: rel.ParentIDAttr, Value: "equals:" + batch[0]}
+		} else {
+			conditions := make([]forma.Condition, 0, len(batch))
+			for _, id := range batch {
+				conditions = append(conditions, &forma.KvCondition{Attr: rel.ParentIDAttr, Value: "equals:" + id})
+			}
+			cond = &forma.CompositeCondition{Logic: forma.LogicOr, Conditions: conditions}
+		}
+		cond, err = em.transformer.ToStorageCondition(parentSchemaID, cond)
 		if err != nil {
-			return nil, fmt.Errorf("transform parent record for schema %s: %w", rel.ParentSchema, err)
+			return nil, fmt.Errorf("build parent condition for schema %s: %w", rel.ParentSchema, err)
 		}
-		parentID, _ := readStringAtPath(attrs, rel.ParentIDAttr)
-		if parentID == "" {
-			continue
+
+		page, err := em.repository.QueryPersistentRecords(ctx, &PersistentRecordQuery{
+			Tables:    em.storageTables(),
+			SchemaID:  parentSchemaID,
+			Condition: cond,
+			Limit:     len(batch),
+			Offset:    0,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("query parent records for schema %s: %w", rel.ParentSchema, err)
+		}
+
+		for _, rec := range page.Records {
+			parent, err := em.toDataRecord(ctx, rel.ParentSchema, rec)
+			if err != nil {
+				return nil, fmt.Errorf("transform parent record for schema %s: %w", rel.ParentSchema, err)
+			}
+			parentID, _ := readStringAtPath(parent.Attributes, rel.ParentIDAttr)
+			if parentID == "" {
+				continue
+			}
+			parents[parentID] = parent
 		}
-		parents[parentID] = attrs
 	}
 
+	if cache != nil {
+		for _, id := range ids {
+			cache[cacheKey(id)] = parents[id]
+		}
+	}
 	return parents, nil
 }
@@ -1,14 +1,17 @@
 package internal
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/lychee-technology/forma"
@@ -224,6 +227,228 @@ func TestEntityManager_Create_StripsRelationFields(t *testing.T) {
 	}
 }
 
+func TestEntityManager_Create_ClientRowID(t *testing.T) {
+	ctx := context.Background()
+	registry, err := newFileSchemaRegistryFromDir("../cmd/server/schemas")
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+	mockRepo := newMockPersistentRecordRepository()
+	em := NewEntityManager(NewPersistentRecordTransformer(registry), mockRepo, registry, createTestConfig())
+
+	rowID := uuid.New()
+	req := &forma.EntityOperation{
+		EntityIdentifier: forma.EntityIdentifier{SchemaName: "visit", RowID: rowID},
+		Type:             forma.OperationCreate,
+		Data:             visitPayload("client-row-1"),
+	}
+
+	record, err := em.Create(ctx, req)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if record.RowID != rowID {
+		t.Fatalf("expected row ID %s, got %s", rowID, record.RowID)
+	}
+
+	if _, err := em.Create(ctx, req); !errors.Is(err, forma.ErrEntityExists) {
+		t.Fatalf("expected ErrEntityExists on duplicate row ID, got %v", err)
+	}
+	if len(mockRepo.insertedRecords) != 1 {
+		t.Fatalf("expected one insert, got %d", len(mockRepo.insertedRecords))
+	}
+}
+
+func TestEntityManager_Create_IdempotencyKey(t *testing.T) {
+	ctx := context.Background()
+	registry, err := newFileSchemaRegistryFromDir("../cmd/server/schemas")
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+	config := createTestConfig()
+	config.Entity.IdempotencyTTL = time.Hour
+	config.Database.TableNames.IdempotencyKeys = "idempotency_keys"
+	mockRepo := newMockPersistentRecordRepository()
+	em := NewEntityManager(NewPersistentRecordTransformer(registry), mockRepo, registry, config)
+
+	req := &forma.EntityOperation{
+		EntityIdentifier: forma.EntityIdentifier{SchemaName: "visit"},
+		Type:             forma.OperationCreate,
+		Data:             visitPayload("idem-1"),
+		IdempotencyKey:   "key-1",
+	}
+
+	first, err := em.Create(ctx, req)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	replay, err := em.Create(ctx, req)
+	if err != nil {
+		t.Fatalf("replayed Create failed: %v", err)
+	}
+	if replay.RowID != first.RowID {
+		t.Fatalf("expected replay to return row %s, got %s", first.RowID, replay.RowID)
+	}
+	if len(mockRepo.insertedRecords) != 1 {
+		t.Fatalf("expected replay not to insert again, got %d inserts", len(mockRepo.insertedRecords))
+	}
+
+	changed := *req
+	changed.Data = visitPayload("idem-2")
+	if _, err := em.Create(ctx, &changed); !errors.Is(err, forma.ErrIdempotencyKeyReused) {
+		t.Fatalf("expected ErrIdempotencyKeyReused, got %v", err)
+	}
+}
+
+func TestEntityManager_Create_IdempotencyDefaultTTL(t *testing.T) {
+	ctx := context.Background()
+	registry, err := newFileSchemaRegistryFromDir("../cmd/server/schemas")
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+	config := createTestConfig()
+	config.Entity.IdempotencyTTL = 0
+	config.Database.TableNames.IdempotencyKeys = "idempotency_keys"
+	mockRepo := newMockPersistentRecordRepository()
+	em := NewEntityManager(NewPersistentRecordTransformer(registry), mockRepo, registry, config)
+
+	if _, err := em.Create(ctx, &forma.EntityOperation{
+		EntityIdentifier: forma.EntityIdentifier{SchemaName: "visit"},
+		Type:             forma.OperationCreate,
+		Data:             visitPayload("idem-ttl"),
+		IdempotencyKey:   "key-ttl",
+	}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	for _, record := range mockRepo.idempotency {
+		if ttl := time.Until(time.UnixMilli(record.ExpiresAt)); ttl < defaultIdempotencyTTL-time.Minute {
+			t.Fatalf("expected an unset TTL to fall back to %s, got %s", defaultIdempotencyTTL, ttl)
+		}
+	}
+}
+
+func TestEntityManager_Create_IdempotencyKeyRequiresTable(t *testing.T) {
+	registry, err := newFileSchemaRegistryFromDir("../cmd/server/schemas")
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+	em := NewEntityManager(NewPersistentRecordTransformer(registry), newMockPersistentRecordRepository(), registry, createTestConfig())
+
+	_, err = em.Create(context.Background(), &forma.EntityOperation{
+		EntityIdentifier: forma.EntityIdentifier{SchemaName: "visit"},
+		Type:             forma.OperationCreate,
+		Data:             visitPayload("idem-3"),
+		IdempotencyKey:   "key-3",
+	})
+	if err == nil {
+		t.Fatal("expected error when the idempotency table is not configured")
+	}
+}
+
+func TestEntityManager_Create_AppliesSchemaDefaults(t *testing.T) {
+	ctx := context.Background()
+	registry, err := newFileSchemaRegistryFromDir("../cmd/server/schemas")
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+	em := NewEntityManager(NewPersistentRecordTransformer(registry), newMockPersistentRecordRepository(), registry, createTestConfig())
+
+	record, err := em.Create(ctx, &forma.EntityOperation{
+		EntityIdentifier: forma.EntityIdentifier{SchemaName: "lead"},
+		Type:             forma.OperationCreate,
+		Data: map[string]any{
+			"id":          uuid.New().String(),
+			"tenantId":    "tenant-1",
+			"ownerUserId": "owner-1",
+			"pipeline":    "buy",
+			"stage":       "new",
+			"status":      "open",
+			"contact":     map[string]any{"name": "Defaulted Lead"},
+			"requirement": map[string]any{"budget": map[string]any{"min": 100.0}},
+			"createdAt":   "2024-01-01T00:00:00Z",
+			"updatedAt":   "2024-01-02T00:00:00Z",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	contact, _ := record.Attributes["contact"].(map[string]any)
+	if contact["annualIncomeCurrency"] != "JPY" {
+		t.Fatalf("expected contact.annualIncomeCurrency default JPY, got %v", contact["annualIncomeCurrency"])
+	}
+	requirement, _ := record.Attributes["requirement"].(map[string]any)
+	budget, _ := requirement["budget"].(map[string]any)
+	if budget["currency"] != "JPY" {
+		t.Fatalf("expected requirement.budget.currency default JPY, got %v", budget["currency"])
+	}
+	if _, exists := requirement["size"]; exists {
+		t.Fatalf("absent requirement.size should not be created, got %v", requirement["size"])
+	}
+}
+
+func TestEntityManager_RecordMeta(t *testing.T) {
+	ctx := context.Background()
+	registry, err := newFileSchemaRegistryFromDir("../cmd/server/schemas")
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+	mockRepo := newMockPersistentRecordRepository()
+	em := NewEntityManager(NewPersistentRecordTransformer(registry), mockRepo, registry, createTestConfig())
+
+	created, err := em.Create(ctx, &forma.EntityOperation{
+		EntityIdentifier: forma.EntityIdentifier{SchemaName: "visit"},
+		Type:             forma.OperationCreate,
+		Data:             visitPayload("visit-meta-1"),
+	})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if created.Meta == nil || created.Meta.Revision != 1 || created.Meta.SchemaVersion != 1 {
+		t.Fatalf("expected revision 1 and schema version 1, got %+v", created.Meta)
+	}
+
+	updated, err := em.Update(ctx, &forma.EntityOperation{
+		EntityIdentifier: forma.EntityIdentifier{SchemaName: "visit", RowID: created.RowID},
+		Type:             forma.OperationUpdate,
+		Updates:          map[string]any{"status": "visited"},
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if updated.Meta == nil || updated.Meta.Revision != 2 {
+		t.Fatalf("expected revision 2 after update, got %+v", updated.Meta)
+	}
+
+	got, err := em.Get(ctx, &forma.QueryRequest{SchemaName: "visit", RowID: &created.RowID})
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if got.Meta == nil || got.Meta.Revision != 2 || got.Meta.DeletedAt != nil {
+		t.Fatalf("expected stored meta with revision 2, got %+v", got.Meta)
+	}
+
+	_, err = em.Query(ctx, &forma.QueryRequest{
+		SchemaName: "visit",
+		Condition:  &forma.KvCondition{Attr: forma.SystemAttrRevision, Value: "gte:1"},
+		SortBy:     []string{forma.SystemAttrUpdatedAt},
+		SortOrder:  forma.SortOrderDesc,
+	})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	var orders []AttributeOrder
+	for _, query := range mockRepo.queries {
+		if len(query.AttributeOrders) > 0 {
+			orders = query.AttributeOrders
+		}
+	}
+	if len(orders) != 1 || !orders[0].IsMainColumn() || orders[0].ColumnName != "ltbase_updated_at" {
+		t.Fatalf("expected sort on ltbase_updated_at, got %+v", orders)
+	}
+}
+
 // TestEntityManager_Get tests entity retrieval
 func TestEntityManager_Get(t *testing.T) {
 	ctx := context.Background()
@@ -289,7 +514,7 @@ func TestEntityManager_Get_EnrichesFromParent(t *testing.T) {
 	if err != nil {
 		t.Fatalf("failed to create schema registry: %v", err)
 	}
-	transformer := NewPersistentRecordTransformer(registry)
+	transformer := NewPersistentRecordTransformerWithOptions(registry, TransformerOptions{KeyProvider: newTestKeyProvider()})
 	mockRepo := newMockPersistentRecordRepository()
 
 	leadSchemaID, _, err := registry.GetSchemaByName("lead")
@@ -394,6 +619,122 @@ func TestEntityManager_Delete(t *testing.T) {
 	}
 }
 
+func TestEntityManager_SoftDeleteRestorePurge(t *testing.T) {
+	ctx := context.Background()
+	config := createTestConfig()
+	config.Entity.SoftDelete = true
+	registry, err := newFileSchemaRegistryFromDir("../cmd/server/schemas")
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+	transformer := NewPersistentRecordTransformer(registry)
+	mockRepo := newMockPersistentRecordRepository()
+	em := NewEntityManager(transformer, mockRepo, registry, config)
+
+	schemaID, _, err := registry.GetSchemaAttributeCacheByName("visit")
+	if err != nil {
+		t.Fatalf("failed to get schema: %v", err)
+	}
+	rowID := uuid.New()
+	mockRepo.storeRecord(buildPersistentRecord(t, transformer, schemaID, rowID, visitPayload("visit-soft-delete")))
+
+	op := &forma.EntityOperation{
+		EntityIdentifier: forma.EntityIdentifier{SchemaName: "visit", RowID: rowID},
+		Type:             forma.OperationDelete,
+	}
+	if err := em.Delete(ctx, op); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if mockRepo.softDeleteCalls != 1 || mockRepo.deleteCalls != 0 {
+		t.Fatalf("expected a soft delete, got soft=%d hard=%d", mockRepo.softDeleteCalls, mockRepo.deleteCalls)
+	}
+
+	if _, err := em.Get(ctx, &forma.QueryRequest{SchemaName: "visit", RowID: &rowID}); err == nil {
+		t.Fatalf("expected tombstoned entity to be hidden from Get")
+	}
+	if _, err := em.Get(ctx, &forma.QueryRequest{SchemaName: "visit", RowID: &rowID, IncludeDeleted: true}); err != nil {
+		t.Fatalf("expected tombstoned entity with include_deleted, got %v", err)
+	}
+	_, err = em.Update(ctx, &forma.EntityOperation{
+		EntityIdentifier: forma.EntityIdentifier{SchemaName: "visit", RowID: rowID},
+		Type:             forma.OperationUpdate,
+		Updates:          map[string]any{"status": "completed"},
+	})
+	if !errors.Is(err, forma.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound when updating a tombstoned entity, got %v", err)
+	}
+	if mockRepo.records[schemaID][rowID].DeletedAt == nil {
+		t.Fatalf("expected the rejected update to leave the tombstone in place")
+	}
+
+	result, err := em.Query(ctx, &forma.QueryRequest{SchemaName: "visit"})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if result.TotalRecords != 0 {
+		t.Fatalf("expected tombstoned entity to be excluded from query, got %d", result.TotalRecords)
+	}
+
+	restored, err := em.Restore(ctx, op)
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if restored.RowID != rowID {
+		t.Fatalf("expected restored row %s, got %s", rowID, restored.RowID)
+	}
+	if _, err := em.Get(ctx, &forma.QueryRequest{SchemaName: "visit", RowID: &rowID}); err != nil {
+		t.Fatalf("expected restored entity to be visible, got %v", err)
+	}
+
+	if err := em.Delete(ctx, op); err != nil {
+		t.Fatalf("second Delete failed: %v", err)
+	}
+	purged, err := em.Purge(ctx, "visit", time.Hour)
+	if err != nil {
+		t.Fatalf("Purge failed: %v", err)
+	}
+	if purged != 0 {
+		t.Fatalf("expected recent tombstone to survive purge, purged %d", purged)
+	}
+	_, err = em.Purge(ctx, "visit", -time.Hour)
+	if err == nil {
+		t.Fatalf("expected negative purge age to be rejected")
+	}
+	expired := time.Now().Add(-2 * time.Hour).UnixMilli()
+	mockRepo.records[schemaID][rowID].DeletedAt = &expired
+	purged, err = em.Purge(ctx, "visit", time.Hour)
+	if err != nil {
+		t.Fatalf("Purge failed: %v", err)
+	}
+	if purged != 1 {
+		t.Fatalf("expected 1 purged entity, got %d", purged)
+	}
+}
+
+func TestEntityManager_SoftDeleteOverride(t *testing.T) {
+	ctx := context.Background()
+	config := createTestConfig()
+	config.Entity.SoftDelete = true
+	config.Entity.SoftDeleteOverrides = map[string]bool{"visit": false}
+	registry, err := newFileSchemaRegistryFromDir("../cmd/server/schemas")
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+	mockRepo := newMockPersistentRecordRepository()
+	em := NewEntityManager(NewPersistentRecordTransformer(registry), mockRepo, registry, config)
+
+	err = em.Delete(ctx, &forma.EntityOperation{
+		EntityIdentifier: forma.EntityIdentifier{SchemaName: "visit", RowID: uuid.New()},
+		Type:             forma.OperationDelete,
+	})
+	if err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if mockRepo.deleteCalls != 1 || mockRepo.softDeleteCalls != 0 {
+		t.Fatalf("expected override to hard delete, got soft=%d hard=%d", mockRepo.softDeleteCalls, mockRepo.deleteCalls)
+	}
+}
+
 func TestEntityManager_QueryBuildsAttributeOrders(t *testing.T) {
 	ctx := context.Background()
 	config := createTestConfig()
@@ -592,9 +933,22 @@ type mockPersistentRecordRepository struct {
 	records         map[int16]map[uuid.UUID]*PersistentRecord
 	insertedRecords []*PersistentRecord
 	deleteCalls     int
+	softDeleteCalls int
+	txCalls         int
+	lastTxOptions   TxOptions
+	bulkInsertCalls int
+	bulkInsertErr   error
 	lastQuery       *PersistentRecordQuery
 	queries         []*PersistentRecordQuery
 	queryFunc       func(ctx context.Context, query *PersistentRecordQuery) (*PersistentRecordPage, error)
+	idempotency     map[string]*IdempotencyRecord
+	whereUpdates    []*PersistentRecord
+	history         map[uuid.UUID][]*HistoryRecord
+	changes         []*ChangeLogEntry
+	notifications   chan *ChangeNotification
+	webhooks        []*WebhookDeliveryRecord
+	outbox          []*OutboxRecord
+	cursors         map[string]*ChangeCursor
 }
 
 func newMockPersistentRecordRepository() *mockPersistentRecordRepository {
@@ -614,12 +968,14 @@ func (m *mockPersistentRecordRepository) storeRecord(record *PersistentRecord) {
 }
 
 func (m *mockPersistentRecordRepository) InsertPersistentRecord(ctx context.Context, tables StorageTables, record *PersistentRecord) error {
+	record.Revision = 1
 	m.insertedRecords = append(m.insertedRecords, record)
 	m.storeRecord(record)
 	return nil
 }
 
 func (m *mockPersistentRecordRepository) UpdatePersistentRecord(ctx context.Context, tables StorageTables, record *PersistentRecord) error {
+	record.Revision++
 	m.storeRecord(record)
 	return nil
 }
@@ -632,6 +988,351 @@ func (m *mockPersistentRecordRepository) DeletePersistentRecord(ctx context.Cont
 	return nil
 }
 
+func (m *mockPersistentRecordRepository) SoftDeletePersistentRecord(ctx context.Context, tables StorageTables, schemaID int16, rowID uuid.UUID) error {
+	m.softDeleteCalls++
+	record, ok := m.records[schemaID][rowID]
+	if !ok || record.DeletedAt != nil {
+		return fmt.Errorf("record not found or already deleted: %d/%s", schemaID, rowID)
+	}
+	deletedAt := time.Now().UnixMilli()
+	record.DeletedAt = &deletedAt
+	return nil
+}
+
+// matchingRecords selects the live records of schemaID through QueryPersistentRecords, so queryFunc
+// can stand in for condition evaluation.
+func (m *mockPersistentRecordRepository) matchingRecords(ctx context.Context, tables StorageTables, schemaID int16, condition forma.Condition) ([]*PersistentRecord, error) {
+	page, err := m.QueryPersistentRecords(ctx, &PersistentRecordQuery{Tables: tables, SchemaID: schemaID, Condition: condition})
+	if err != nil {
+		return nil, err
+	}
+	return page.Records, nil
+}
+
+func (m *mockPersistentRecordRepository) CountPersistentRecordsWhere(ctx context.Context, tables StorageTables, schemaID int16, condition forma.Condition) (int64, error) {
+	records, err := m.matchingRecords(ctx, tables, schemaID, condition)
+	return int64(len(records)), err
+}
+
+func (m *mockPersistentRecordRepository) UpdatePersistentRecordsWhere(ctx context.Context, tables StorageTables, schemaID int16, condition forma.Condition, patch *PersistentRecord) (int64, error) {
+	m.whereUpdates = append(m.whereUpdates, patch)
+	records, err := m.matchingRecords(ctx, tables, schemaID, condition)
+	if err != nil {
+		return 0, err
+	}
+	for _, record := range records {
+		for key, value := range patch.TextItems {
+			if record.TextItems == nil {
+				record.TextItems = make(map[string]string)
+			}
+			record.TextItems[key] = value
+		}
+		for key, value := range patch.Int64Items {
+			if record.Int64Items == nil {
+				record.Int64Items = make(map[string]int64)
+			}
+			record.Int64Items[key] = value
+		}
+	}
+	return int64(len(records)), nil
+}
+
+func (m *mockPersistentRecordRepository) DeletePersistentRecordsWhere(ctx context.Context, tables StorageTables, schemaID int16, condition forma.Condition, soft bool) (int64, error) {
+	records, err := m.matchingRecords(ctx, tables, schemaID, condition)
+	if err != nil {
+		return 0, err
+	}
+	deletedAt := time.Now().UnixMilli()
+	for _, record := range records {
+		if soft {
+			record.DeletedAt = &deletedAt
+		} else {
+			delete(m.records[schemaID], record.RowID)
+		}
+	}
+	return int64(len(records)), nil
+}
+
+func (m *mockPersistentRecordRepository) RestorePersistentRecord(ctx context.Context, tables StorageTables, schemaID int16, rowID uuid.UUID) error {
+	record, ok := m.records[schemaID][rowID]
+	if !ok || record.DeletedAt == nil {
+		return fmt.Errorf("%w: no deleted record %d/%s", forma.ErrNotFound, schemaID, rowID)
+	}
+	record.DeletedAt = nil
+	return nil
+}
+
+func (m *mockPersistentRecordRepository) PurgePersistentRecords(ctx context.Context, tables StorageTables, schemaID int16, deletedBefore int64) (int64, error) {
+	var purged int64
+	for rowID, record := range m.records[schemaID] {
+		if record.DeletedAt != nil && *record.DeletedAt < deletedBefore {
+			delete(m.records[schemaID], rowID)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (m *mockPersistentRecordRepository) RunInTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return m.RunInTxWithOptions(ctx, TxOptions{}, fn)
+}
+
+func (m *mockPersistentRecordRepository) RunInTxWithOptions(ctx context.Context, opts TxOptions, fn func(ctx context.Context) error) error {
+	m.txCalls++
+	m.lastTxOptions = opts
+	snapshot := make(map[int16]map[uuid.UUID]*PersistentRecord, len(m.records))
+	for schemaID, schemaRecords := range m.records {
+		snapshot[schemaID] = make(map[uuid.UUID]*PersistentRecord, len(schemaRecords))
+		for rowID, record := range schemaRecords {
+			copied := *record
+			snapshot[schemaID][rowID] = &copied
+		}
+	}
+	if err := fn(ctx); err != nil {
+		m.records = snapshot
+		return err
+	}
+	return nil
+}
+
+func (m *mockPersistentRecordRepository) BulkInsertPersistentRecords(ctx context.Context, tables StorageTables, records []*PersistentRecord) error {
+	m.bulkInsertCalls++
+	if m.bulkInsertErr != nil {
+		return m.bulkInsertErr
+	}
+	for _, record := range records {
+		m.insertedRecords = append(m.insertedRecords, record)
+		m.storeRecord(record)
+	}
+	return nil
+}
+
+func (m *mockPersistentRecordRepository) GetIdempotencyRecord(ctx context.Context, tables StorageTables, schemaID int16, key string) (*IdempotencyRecord, error) {
+	return m.idempotency[fmt.Sprintf("%d/%s", schemaID, key)], nil
+}
+
+func (m *mockPersistentRecordRepository) SaveIdempotencyRecord(ctx context.Context, tables StorageTables, record *IdempotencyRecord) (bool, error) {
+	if m.idempotency == nil {
+		m.idempotency = make(map[string]*IdempotencyRecord)
+	}
+	id := fmt.Sprintf("%d/%s", record.SchemaID, record.Key)
+	if _, ok := m.idempotency[id]; ok {
+		return false, nil
+	}
+	m.idempotency[id] = record
+	return true, nil
+}
+
+func (m *mockPersistentRecordRepository) ListHistory(ctx context.Context, tables StorageTables, schemaID int16, rowID uuid.UUID) ([]*HistoryRecord, error) {
+	return m.history[rowID], nil
+}
+
+func (m *mockPersistentRecordRepository) LeaseChanges(ctx context.Context, tables StorageTables, schemaID int16, limit int) ([]*ChangeLogEntry, error) {
+	var leased []*ChangeLogEntry
+	for _, entry := range m.changes {
+		if len(leased) == limit {
+			break
+		}
+		if schemaID == 0 || entry.SchemaID == schemaID {
+			leased = append(leased, entry)
+		}
+	}
+	return leased, nil
+}
+
+func (m *mockPersistentRecordRepository) MarkChangesFlushed(ctx context.Context, tables StorageTables, entries []*ChangeLogEntry) (int64, error) {
+	flushed := make(map[*ChangeLogEntry]bool, len(entries))
+	for _, entry := range entries {
+		flushed[entry] = true
+	}
+	pending := m.changes[:0]
+	for _, entry := range m.changes {
+		if !flushed[entry] {
+			pending = append(pending, entry)
+		}
+	}
+	count := int64(len(m.changes) - len(pending))
+	m.changes = pending
+	return count, nil
+}
+
+func (m *mockPersistentRecordRepository) ListChangesSince(ctx context.Context, tables StorageTables, schemaID int16, since int64, afterRowID uuid.UUID) ([]*ChangeLogEntry, error) {
+	var entries []*ChangeLogEntry
+	for _, entry := range m.changes {
+		after := entry.ChangedAt >= since
+		if afterRowID != uuid.Nil {
+			after = entry.ChangedAt > since || (entry.ChangedAt == since && bytes.Compare(entry.RowID[:], afterRowID[:]) > 0)
+		}
+		if entry.SchemaID == schemaID && after {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (m *mockPersistentRecordRepository) LockChangeCursor(ctx context.Context, tables StorageTables, consumer string) (*ChangeCursor, error) {
+	if cursor, ok := m.cursors[consumer]; ok {
+		copied := *cursor
+		return &copied, nil
+	}
+	return &ChangeCursor{}, nil
+}
+
+func (m *mockPersistentRecordRepository) SaveChangeCursor(ctx context.Context, tables StorageTables, consumer string, cursor *ChangeCursor) error {
+	if m.cursors == nil {
+		m.cursors = make(map[string]*ChangeCursor)
+	}
+	copied := *cursor
+	m.cursors[consumer] = &copied
+	return nil
+}
+
+func (m *mockPersistentRecordRepository) ListChangesAfter(ctx context.Context, tables StorageTables, cursor *ChangeCursor, limit int) ([]*ChangeLogEntry, error) {
+	var entries []*ChangeLogEntry
+	for _, entry := range m.changes {
+		if len(entries) == limit {
+			break
+		}
+		after := entry.TxID > cursor.TxID
+		if entry.TxID == cursor.TxID {
+			after = entry.SchemaID > cursor.SchemaID ||
+				(entry.SchemaID == cursor.SchemaID && bytes.Compare(entry.RowID[:], cursor.RowID[:]) > 0)
+		}
+		if after {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// mockChangeSubscription delivers the notifications sent on its channel until it is closed.
+type mockChangeSubscription struct {
+	notifications <-chan *ChangeNotification
+}
+
+func (s *mockChangeSubscription) Next(ctx context.Context) (*ChangeNotification, error) {
+	select {
+	case notification, ok := <-s.notifications:
+		if !ok {
+			return nil, context.Canceled
+		}
+		return notification, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (s *mockChangeSubscription) Close() {}
+
+func (m *mockPersistentRecordRepository) SubscribeChanges(ctx context.Context, tables StorageTables) (ChangeSubscription, error) {
+	if m.notifications == nil {
+		return nil, fmt.Errorf("notifications are not configured")
+	}
+	return &mockChangeSubscription{notifications: m.notifications}, nil
+}
+
+func (m *mockPersistentRecordRepository) PersistentRecordMatches(ctx context.Context, tables StorageTables, schemaID int16, rowID uuid.UUID, condition forma.Condition) (bool, error) {
+	records, err := m.matchingRecords(ctx, tables, schemaID, condition)
+	if err != nil {
+		return false, err
+	}
+	for _, record := range records {
+		if record.RowID == rowID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *mockPersistentRecordRepository) InsertWebhookDeliveries(ctx context.Context, tables StorageTables, deliveries []*WebhookDeliveryRecord) error {
+	now := time.Now().UnixMilli()
+	for _, delivery := range deliveries {
+		delivery.ID = int64(len(m.webhooks) + 1)
+		delivery.Status = forma.WebhookDeliveryPending
+		delivery.NextAttemptAt = now
+		delivery.CreatedAt = now
+		delivery.UpdatedAt = now
+		m.webhooks = append(m.webhooks, delivery)
+	}
+	return nil
+}
+
+func (m *mockPersistentRecordRepository) LeaseWebhookDeliveries(ctx context.Context, tables StorageTables, limit int, leaseUntil int64) ([]*WebhookDeliveryRecord, error) {
+	now := time.Now().UnixMilli()
+	var leased []*WebhookDeliveryRecord
+	for _, delivery := range m.webhooks {
+		if len(leased) == limit {
+			break
+		}
+		if delivery.Status == forma.WebhookDeliveryPending && delivery.NextAttemptAt <= now {
+			delivery.NextAttemptAt = leaseUntil
+			copied := *delivery
+			leased = append(leased, &copied)
+		}
+	}
+	return leased, nil
+}
+
+func (m *mockPersistentRecordRepository) UpdateWebhookDelivery(ctx context.Context, tables StorageTables, delivery *WebhookDeliveryRecord) error {
+	for i, stored := range m.webhooks {
+		if stored.ID == delivery.ID {
+			copied := *delivery
+			copied.UpdatedAt = time.Now().UnixMilli()
+			m.webhooks[i] = &copied
+			return nil
+		}
+	}
+	return fmt.Errorf("webhook delivery %d not found", delivery.ID)
+}
+
+func (m *mockPersistentRecordRepository) ListWebhookDeliveries(ctx context.Context, tables StorageTables, filter WebhookDeliveryQuery) ([]*WebhookDeliveryRecord, error) {
+	var deliveries []*WebhookDeliveryRecord
+	for i := len(m.webhooks) - 1; i >= 0 && len(deliveries) < filter.Limit; i-- {
+		delivery := m.webhooks[i]
+		if filter.SubscriptionID != "" && delivery.SubscriptionID != filter.SubscriptionID {
+			continue
+		}
+		if filter.Status != "" && delivery.Status != filter.Status {
+			continue
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, nil
+}
+
+func (m *mockPersistentRecordRepository) LeaseOutbox(ctx context.Context, tables StorageTables, limit int) ([]*OutboxRecord, error) {
+	if len(m.outbox) > limit {
+		return m.outbox[:limit], nil
+	}
+	return m.outbox, nil
+}
+
+func (m *mockPersistentRecordRepository) MarkOutboxDispatched(ctx context.Context, tables StorageTables, ids []int64) (int64, error) {
+	dispatched := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		dispatched[id] = true
+	}
+	pending := make([]*OutboxRecord, 0, len(m.outbox))
+	for _, record := range m.outbox {
+		if !dispatched[record.ID] {
+			pending = append(pending, record)
+		}
+	}
+	count := int64(len(m.outbox) - len(pending))
+	m.outbox = pending
+	return count, nil
+}
+
+func (m *mockPersistentRecordRepository) GetPersistentRecordAsOf(ctx context.Context, tables StorageTables, schemaID int16, rowID uuid.UUID, asOf int64) (*PersistentRecord, error) {
+	var snapshot *PersistentRecord
+	for _, entry := range m.history[rowID] {
+		if entry.ChangedAt <= asOf {
+			snapshot = entry.Snapshot
+		}
+	}
+	return snapshot, nil
+}
+
 func (m *mockPersistentRecordRepository) GetPersistentRecord(ctx context.Context, tables StorageTables, schemaID int16, rowID uuid.UUID) (*PersistentRecord, error) {
 	if schemaRecords, ok := m.records[schemaID]; ok {
 		if record, ok := schemaRecords[rowID]; ok {
@@ -652,7 +1353,10 @@ func (m *mockPersistentRecordRepository) QueryPersistentRecords(ctx context.Cont
 
 	schemaRecords := m.records[query.SchemaID]
 	rowIDs := make([]uuid.UUID, 0, len(schemaRecords))
-	for id := range schemaRecords {
+	for id, record := range schemaRecords {
+		if record.DeletedAt != nil && !query.IncludeDeleted {
+			continue
+		}
 		rowIDs = append(rowIDs, id)
 	}
 
@@ -1252,3 +1956,52 @@ func TestFileSchemaRegistry_InvalidJSON(t *testing.T) {
 		t.Error("Expected error for invalid JSON, got nil")
 	}
 }
+
+func TestEntityManager_WriteAfterReloadUsesNewAttribute(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	write("widget.json", `{"type": "object", "properties": {"name": {"type": "string"}}}`)
+	write("widget_attributes.json", `{"name": {"attributeID": 1, "valueType": "text"}}`)
+	registry, err := NewFileSchemaRegistryFromDirectory(dir)
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+
+	repo := newMockPersistentRecordRepository()
+	em := NewEntityManager(NewPersistentRecordTransformer(registry), repo, registry, createTestConfig())
+
+	// Warm the metadata caches before the schema changes.
+	if _, err := em.Create(ctx, &forma.EntityOperation{
+		EntityIdentifier: forma.EntityIdentifier{SchemaName: "widget", RowID: uuid.New()},
+		Data:             map[string]any{"name": "before"},
+	}); err != nil {
+		t.Fatalf("Create before reload failed: %v", err)
+	}
+
+	write("widget.json", `{"type": "object", "properties": {"name": {"type": "string"}, "color": {"type": "string"}}}`)
+	write("widget_attributes.json", `{"name": {"attributeID": 1, "valueType": "text"}, "color": {"attributeID": 2, "valueType": "text"}}`)
+	if err := registry.(forma.ReloadableSchemaRegistry).Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+
+	rowID := uuid.New()
+	if _, err := em.Create(ctx, &forma.EntityOperation{
+		EntityIdentifier: forma.EntityIdentifier{SchemaName: "widget", RowID: rowID},
+		Data:             map[string]any{"name": "after", "color": "red"},
+	}); err != nil {
+		t.Fatalf("Create after reload failed: %v", err)
+	}
+
+	record, err := em.Get(ctx, &forma.QueryRequest{SchemaName: "widget", RowID: &rowID})
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if record.Attributes["color"] != "red" {
+		t.Fatalf("expected the new attribute to round-trip, got %v", record.Attributes)
+	}
+}
@@ -0,0 +1,240 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lychee-technology/forma"
+)
+
+// runInTx runs fn in a repository transaction using the configured isolation level.
+func (em *entityManager) runInTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	opts := TxOptions{}
+	if em.config != nil {
+		opts.IsolationLevel = em.config.Transaction.IsolationLevel
+	}
+	return em.repository.RunInTxWithOptions(ctx, opts, fn)
+}
+
+// WithTx runs fn as a unit of work. Every call made through tx joins one transaction that is
+// committed when fn returns nil and rolled back otherwise; reads through tx see its own writes.
+// Atomic batches and WithTx calls made through tx join the same transaction, so their failures
+// should be returned from fn. tx must not be used concurrently or after fn returns.
+func (em *entityManager) WithTx(ctx context.Context, fn func(tx forma.EntityManager) error) error {
+	if fn == nil {
+		return fmt.Errorf("transaction function is required")
+	}
+
+	return em.runInTx(ctx, func(txCtx context.Context) error {
+		tx := &txEntityManager{em: em, txCtx: txCtx}
+		defer tx.closed.Store(true)
+		return fn(tx)
+	})
+}
+
+// txEntityManager is the EntityManager handed to WithTx callbacks. It binds every call to the
+// unit-of-work transaction, whatever context the caller passes in.
+type txEntityManager struct {
+	em     *entityManager
+	txCtx  context.Context
+	closed atomic.Bool
+}
+
+func (t *txEntityManager) bind(ctx context.Context) (context.Context, error) {
+	if t.closed.Load() {
+		return nil, forma.ErrTxClosed
+	}
+	if tx, ok := txFromContext(t.txCtx); ok {
+		return withTx(ctx, tx), nil
+	}
+	return ctx, nil
+}
+
+func (t *txEntityManager) Create(ctx context.Context, req *forma.EntityOperation) (*forma.DataRecord, error) {
+	ctx, err := t.bind(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return t.em.Create(ctx, req)
+}
+
+func (t *txEntityManager) Get(ctx context.Context, req *forma.QueryRequest) (*forma.DataRecord, error) {
+	ctx, err := t.bind(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return t.em.Get(ctx, req)
+}
+
+func (t *txEntityManager) Update(ctx context.Context, req *forma.EntityOperation) (*forma.DataRecord, error) {
+	ctx, err := t.bind(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return t.em.Update(ctx, req)
+}
+
+func (t *txEntityManager) Delete(ctx context.Context, req *forma.EntityOperation) error {
+	ctx, err := t.bind(ctx)
+	if err != nil {
+		return err
+	}
+	return t.em.Delete(ctx, req)
+}
+
+func (t *txEntityManager) Restore(ctx context.Context, req *forma.EntityOperation) (*forma.DataRecord, error) {
+	ctx, err := t.bind(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return t.em.Restore(ctx, req)
+}
+
+func (t *txEntityManager) Purge(ctx context.Context, schemaName string, olderThan time.Duration) (int64, error) {
+	ctx, err := t.bind(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return t.em.Purge(ctx, schemaName, olderThan)
+}
+
+func (t *txEntityManager) Query(ctx context.Context, req *forma.QueryRequest) (*forma.QueryResult, error) {
+	ctx, err := t.bind(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return t.em.Query(ctx, req)
+}
+
+func (t *txEntityManager) CrossSchemaSearch(ctx context.Context, req *forma.CrossSchemaRequest) (*forma.QueryResult, error) {
+	ctx, err := t.bind(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return t.em.CrossSchemaSearch(ctx, req)
+}
+
+func (t *txEntityManager) BatchCreate(ctx context.Context, req *forma.BatchOperation) (*forma.BatchResult, error) {
+	ctx, err := t.bind(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return t.em.BatchCreate(ctx, req)
+}
+
+func (t *txEntityManager) BatchUpdate(ctx context.Context, req *forma.BatchOperation) (*forma.BatchResult, error) {
+	ctx, err := t.bind(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return t.em.BatchUpdate(ctx, req)
+}
+
+func (t *txEntityManager) BatchDelete(ctx context.Context, req *forma.BatchOperation) (*forma.BatchResult, error) {
+	ctx, err := t.bind(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return t.em.BatchDelete(ctx, req)
+}
+
+func (t *txEntityManager) ExecuteBatch(ctx context.Context, req *forma.BatchOperation) (*forma.BatchResult, error) {
+	ctx, err := t.bind(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return t.em.ExecuteBatch(ctx, req)
+}
+
+func (t *txEntityManager) BulkLoad(ctx context.Context, schemaName string, iterator forma.EntityIterator) (*forma.BulkLoadResult, error) {
+	ctx, err := t.bind(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return t.em.BulkLoad(ctx, schemaName, iterator)
+}
+
+func (t *txEntityManager) UpdateWhere(ctx context.Context, schemaName string, condition forma.Condition, patch map[string]any, opts forma.WhereOptions) (*forma.WhereResult, error) {
+	ctx, err := t.bind(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return t.em.UpdateWhere(ctx, schemaName, condition, patch, opts)
+}
+
+func (t *txEntityManager) DeleteWhere(ctx context.Context, schemaName string, condition forma.Condition, opts forma.WhereOptions) (*forma.WhereResult, error) {
+	ctx, err := t.bind(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return t.em.DeleteWhere(ctx, schemaName, condition, opts)
+}
+
+func (t *txEntityManager) GetHistory(ctx context.Context, schemaName string, rowID uuid.UUID) ([]*forma.HistoryEntry, error) {
+	ctx, err := t.bind(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return t.em.GetHistory(ctx, schemaName, rowID)
+}
+
+func (t *txEntityManager) Revert(ctx context.Context, schemaName string, rowID uuid.UUID, revision int64) (*forma.DataRecord, error) {
+	ctx, err := t.bind(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return t.em.Revert(ctx, schemaName, rowID, revision)
+}
+
+func (t *txEntityManager) ConsumeChanges(ctx context.Context, opts forma.ChangeFeedOptions, fn forma.ChangeHandler) (int, error) {
+	ctx, err := t.bind(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return t.em.ConsumeChanges(ctx, opts, fn)
+}
+
+func (t *txEntityManager) WatchChanges(ctx context.Context, opts forma.WatchOptions, fn forma.ChangeListener) error {
+	ctx, err := t.bind(ctx)
+	if err != nil {
+		return err
+	}
+	return t.em.WatchChanges(ctx, opts, fn)
+}
+
+func (t *txEntityManager) ProcessWebhooks(ctx context.Context) (*forma.WebhookResult, error) {
+	ctx, err := t.bind(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return t.em.ProcessWebhooks(ctx)
+}
+
+func (t *txEntityManager) ListWebhookDeliveries(ctx context.Context, filter forma.WebhookDeliveryFilter) ([]*forma.WebhookDelivery, error) {
+	ctx, err := t.bind(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return t.em.ListWebhookDeliveries(ctx, filter)
+}
+
+func (t *txEntityManager) DispatchOutbox(ctx context.Context, sink forma.EventSink, batchSize int) (int, error) {
+	ctx, err := t.bind(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return t.em.DispatchOutbox(ctx, sink, batchSize)
+}
+
+func (t *txEntityManager) WithTx(ctx context.Context, fn func(tx forma.EntityManager) error) error {
+	if _, err := t.bind(ctx); err != nil {
+		return err
+	}
+	if fn == nil {
+		return fmt.Errorf("transaction function is required")
+	}
+	return fn(t)
+}
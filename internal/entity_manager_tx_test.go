@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lychee-technology/forma"
+	"github.com/pashagolub/pgxmock/v4"
+)
+
+func TestEntityManager_WithTx(t *testing.T) {
+	ctx := context.Background()
+	config := createTestConfig()
+	config.Transaction.IsolationLevel = "SERIALIZABLE"
+	registry, err := newFileSchemaRegistryFromDir("../cmd/server/schemas")
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+	transformer := NewPersistentRecordTransformer(registry)
+	mockRepo := newMockPersistentRecordRepository()
+	em := NewEntityManager(transformer, mockRepo, registry, config)
+
+	var txManager forma.EntityManager
+	err = em.WithTx(ctx, func(tx forma.EntityManager) error {
+		txManager = tx
+		created, err := tx.Create(ctx, &forma.EntityOperation{
+			EntityIdentifier: forma.EntityIdentifier{SchemaName: "visit"},
+			Type:             forma.OperationCreate,
+			Data:             visitPayload("visit-tx-1"),
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Update(ctx, &forma.EntityOperation{
+			EntityIdentifier: forma.EntityIdentifier{SchemaName: "visit", RowID: created.RowID},
+			Type:             forma.OperationUpdate,
+			Updates:          map[string]any{"status": "visited"},
+		}); err != nil {
+			return err
+		}
+
+		got, err := tx.Get(ctx, &forma.QueryRequest{SchemaName: "visit", RowID: &created.RowID})
+		if err != nil {
+			return err
+		}
+		if got.Attributes["status"] != "visited" {
+			t.Fatalf("expected the transaction to read its own update, got %v", got.Attributes["status"])
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithTx failed: %v", err)
+	}
+	if mockRepo.lastTxOptions.IsolationLevel != "SERIALIZABLE" {
+		t.Fatalf("expected configured isolation level, got %q", mockRepo.lastTxOptions.IsolationLevel)
+	}
+	if len(mockRepo.records) != 1 {
+		t.Fatalf("expected committed record, got %d schemas", len(mockRepo.records))
+	}
+
+	if _, err := txManager.Get(ctx, &forma.QueryRequest{SchemaName: "visit"}); !errors.Is(err, forma.ErrTxClosed) {
+		t.Fatalf("expected ErrTxClosed after commit, got %v", err)
+	}
+
+	failure := errors.New("contract creation failed")
+	before := len(mockRepo.insertedRecords)
+	err = em.WithTx(ctx, func(tx forma.EntityManager) error {
+		if _, err := tx.Create(ctx, &forma.EntityOperation{
+			EntityIdentifier: forma.EntityIdentifier{SchemaName: "visit"},
+			Type:             forma.OperationCreate,
+			Data:             visitPayload("visit-tx-2"),
+		}); err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("expected callback error, got %v", err)
+	}
+	schemaID, _, _ := registry.GetSchemaAttributeCacheByName("visit")
+	if len(mockRepo.records[schemaID]) != 1 {
+		t.Fatalf("expected rollback to drop the second visit, got %d records (inserted %d)", len(mockRepo.records[schemaID]), len(mockRepo.insertedRecords)-before)
+	}
+}
+
+func TestTxEntityManagerBindsTransaction(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("failed to create mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	mock.ExpectBegin()
+	tx, err := mock.Begin(ctx)
+	if err != nil {
+		t.Fatalf("begin failed: %v", err)
+	}
+
+	txManager := &txEntityManager{txCtx: withTx(ctx, tx)}
+	bound, err := txManager.bind(context.Background())
+	if err != nil {
+		t.Fatalf("bind failed: %v", err)
+	}
+	if got, ok := txFromContext(bound); !ok || got != tx {
+		t.Fatalf("expected caller context to carry the unit-of-work transaction")
+	}
+}
@@ -2,6 +2,9 @@ package internal
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/google/uuid"
@@ -35,8 +38,6 @@ func TestEntityManager_Update_MergesAndPreserves(t *testing.T) {
 	}
 	existingRecord := buildPersistentRecord(t, transformer, schemaID, rowID, existing)
 	existingRecord.CreatedAt = 111
-	deleted := int64(222)
-	existingRecord.DeletedAt = &deleted
 	mockRepo.storeRecord(existingRecord)
 
 	em := NewEntityManager(transformer, mockRepo, registry, config)
@@ -75,8 +76,8 @@ func TestEntityManager_Update_MergesAndPreserves(t *testing.T) {
 	if stored.CreatedAt != 111 {
 		t.Fatalf("expected CreatedAt preserved, got %d", stored.CreatedAt)
 	}
-	if stored.DeletedAt == nil || *stored.DeletedAt != 222 {
-		t.Fatalf("expected DeletedAt preserved, got %v", stored.DeletedAt)
+	if stored.DeletedAt != nil {
+		t.Fatalf("expected the entity to stay live, got DeletedAt %v", *stored.DeletedAt)
 	}
 }
 
@@ -123,6 +124,40 @@ func TestEntityManager_BatchCreate_CollectsErrors(t *testing.T) {
 	}
 }
 
+func TestEntityManager_BatchCreate_LimitErrorCode(t *testing.T) {
+	ctx := context.Background()
+	config := createTestConfig()
+	registry, err := newFileSchemaRegistryFromDir("../cmd/server/schemas")
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+	transformer := NewPersistentRecordTransformerWithOptions(registry, TransformerOptions{Limits: DocumentLimits{MaxEntitySize: 64}})
+	mockRepo := newMockPersistentRecordRepository()
+
+	em := NewEntityManager(transformer, mockRepo, registry, config)
+
+	req := &forma.BatchOperation{
+		Operations: []forma.EntityOperation{
+			{
+				EntityIdentifier: forma.EntityIdentifier{SchemaName: "visit"},
+				Type:             forma.OperationCreate,
+				Data:             visitPayload("visit-too-large"),
+			},
+		},
+	}
+
+	result, err := em.BatchCreate(ctx, req)
+	if err != nil {
+		t.Fatalf("BatchCreate failed: %v", err)
+	}
+	if len(result.Failed) != 1 || result.Failed[0].Code != forma.LimitCodeEntityTooLarge {
+		t.Fatalf("expected one %s failure, got %+v", forma.LimitCodeEntityTooLarge, result.Failed)
+	}
+	if len(mockRepo.records) != 0 {
+		t.Fatalf("expected nothing to be stored, got %d records", len(mockRepo.records))
+	}
+}
+
 func TestEntityManager_BatchUpdate_CollectsErrors(t *testing.T) {
 	ctx := context.Background()
 	config := createTestConfig()
@@ -238,6 +273,406 @@ func TestEntityManager_BatchDelete_CollectsErrors(t *testing.T) {
 	}
 }
 
+func TestEntityManager_BatchUpdate_AtomicRollsBack(t *testing.T) {
+	ctx := context.Background()
+	config := createTestConfig()
+	registry, err := newFileSchemaRegistryFromDir("../cmd/server/schemas")
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+	transformer := NewPersistentRecordTransformer(registry)
+	mockRepo := newMockPersistentRecordRepository()
+
+	schemaID, _, err := registry.GetSchemaAttributeCacheByName("visit")
+	if err != nil {
+		t.Fatalf("failed to get schema metadata: %v", err)
+	}
+
+	rowID := uuid.New()
+	mockRepo.storeRecord(buildPersistentRecord(t, transformer, schemaID, rowID, visitPayload("visit-batch-atomic-1")))
+
+	em := NewEntityManager(transformer, mockRepo, registry, config)
+
+	req := &forma.BatchOperation{
+		Atomic: true,
+		Operations: []forma.EntityOperation{
+			{
+				EntityIdentifier: forma.EntityIdentifier{SchemaName: "visit", RowID: rowID},
+				Type:             forma.OperationUpdate,
+				Updates:          map[string]any{"status": "visited"},
+			},
+			{
+				EntityIdentifier: forma.EntityIdentifier{SchemaName: "visit"},
+				Type:             forma.OperationUpdate,
+				Updates:          map[string]any{"status": "failed"},
+			},
+			{
+				EntityIdentifier: forma.EntityIdentifier{SchemaName: "visit", RowID: rowID},
+				Type:             forma.OperationUpdate,
+				Updates:          map[string]any{"status": "cancelled"},
+			},
+		},
+	}
+
+	result, err := em.BatchUpdate(ctx, req)
+	if err != nil {
+		t.Fatalf("BatchUpdate failed: %v", err)
+	}
+
+	if mockRepo.txCalls != 1 {
+		t.Fatalf("expected atomic batch to run in one transaction, got %d", mockRepo.txCalls)
+	}
+	if len(result.Successful) != 0 {
+		t.Fatalf("expected no successful operations, got %d", len(result.Successful))
+	}
+	if len(result.Failed) != 3 {
+		t.Fatalf("expected 3 failed operations, got %d", len(result.Failed))
+	}
+	expectedCodes := []string{batchCodeRolledBack, "UPDATE_FAILED", batchCodeRolledBack}
+	for i, code := range expectedCodes {
+		if result.Failed[i].Code != code {
+			t.Fatalf("expected code %s at index %d, got %s", code, i, result.Failed[i].Code)
+		}
+	}
+
+	data, err := transformer.FromPersistentRecord(ctx, mockRepo.records[schemaID][rowID])
+	if err != nil {
+		t.Fatalf("failed to read stored record: %v", err)
+	}
+	if data["status"] == "visited" {
+		t.Fatalf("expected update to be rolled back, got status %v", data["status"])
+	}
+}
+
+func TestEntityManager_ExecuteBatch_MixedOperationsWithRefs(t *testing.T) {
+	ctx := context.Background()
+	config := createTestConfig()
+	registry, err := newFileSchemaRegistryFromDir("../cmd/server/schemas")
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+	transformer := NewPersistentRecordTransformer(registry)
+	mockRepo := newMockPersistentRecordRepository()
+
+	schemaID, _, err := registry.GetSchemaAttributeCacheByName("visit")
+	if err != nil {
+		t.Fatalf("failed to get schema metadata: %v", err)
+	}
+
+	em := NewEntityManager(transformer, mockRepo, registry, config)
+
+	upsertRowID := uuid.New()
+	related := visitPayload("visit-mixed-2")
+
+	req := &forma.BatchOperation{
+		Atomic: true,
+		Operations: []forma.EntityOperation{
+			{
+				EntityIdentifier: forma.EntityIdentifier{SchemaName: "visit"},
+				Type:             forma.OperationCreate,
+				Data:             visitPayload("visit-mixed-1"),
+			},
+			{
+				EntityIdentifier: forma.EntityIdentifier{SchemaName: "visit"},
+				Type:             forma.OperationUpsert,
+				RowRef:           "$ref:0",
+				Data:             map[string]any{"status": "visited"},
+			},
+			{
+				EntityIdentifier: forma.EntityIdentifier{SchemaName: "visit", RowID: upsertRowID},
+				Type:             forma.OperationUpsert,
+				Data:             related,
+				Refs:             map[string]string{"propertyId": "$ref:0"},
+			},
+			{
+				EntityIdentifier: forma.EntityIdentifier{SchemaName: "visit"},
+				Type:             forma.OperationDelete,
+				RowRef:           "$ref:0",
+			},
+		},
+	}
+
+	result, err := em.ExecuteBatch(ctx, req)
+	if err != nil {
+		t.Fatalf("ExecuteBatch failed: %v", err)
+	}
+	if len(result.Failed) != 0 {
+		t.Fatalf("expected no failures, got %+v", result.Failed)
+	}
+	if len(result.Successful) != 4 {
+		t.Fatalf("expected 4 successful operations, got %d", len(result.Successful))
+	}
+
+	createdRowID := result.Successful[0].RowID
+	if result.Successful[1].RowID != createdRowID || result.Successful[3].RowID != createdRowID {
+		t.Fatalf("expected $ref:0 to resolve to %s", createdRowID)
+	}
+	if result.Successful[1].Attributes["status"] != "visited" {
+		t.Fatalf("expected upsert to update status, got %v", result.Successful[1].Attributes["status"])
+	}
+	if _, exists := mockRepo.records[schemaID][createdRowID]; exists {
+		t.Fatalf("expected referenced record to be deleted")
+	}
+
+	created, ok := mockRepo.records[schemaID][upsertRowID]
+	if !ok {
+		t.Fatalf("expected upsert to create record under the requested row ID")
+	}
+	data, err := transformer.FromPersistentRecord(ctx, created)
+	if err != nil {
+		t.Fatalf("failed to read created record: %v", err)
+	}
+	if data["propertyId"] != createdRowID.String() {
+		t.Fatalf("expected refs propertyId to resolve to %s, got %v", createdRowID, data["propertyId"])
+	}
+}
+
+func TestEntityManager_ExecuteBatch_InvalidRefs(t *testing.T) {
+	ctx := context.Background()
+	config := createTestConfig()
+	registry, err := newFileSchemaRegistryFromDir("../cmd/server/schemas")
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+	transformer := NewPersistentRecordTransformer(registry)
+	em := NewEntityManager(transformer, newMockPersistentRecordRepository(), registry, config)
+
+	req := &forma.BatchOperation{
+		Operations: []forma.EntityOperation{
+			{
+				EntityIdentifier: forma.EntityIdentifier{SchemaName: "visit"},
+				Type:             forma.OperationUpdate,
+				RowRef:           "$ref:1",
+				Updates:          map[string]any{"status": "visited"},
+			},
+			{
+				EntityIdentifier: forma.EntityIdentifier{SchemaName: "visit"},
+				Type:             forma.OperationQuery,
+			},
+		},
+	}
+
+	result, err := em.ExecuteBatch(ctx, req)
+	if err != nil {
+		t.Fatalf("ExecuteBatch failed: %v", err)
+	}
+	if len(result.Failed) != 2 {
+		t.Fatalf("expected 2 failures, got %d", len(result.Failed))
+	}
+	if result.Failed[0].Code != "UPDATE_FAILED" || result.Failed[1].Code != "QUERY_FAILED" {
+		t.Fatalf("unexpected failure codes: %s, %s", result.Failed[0].Code, result.Failed[1].Code)
+	}
+}
+
+func TestEntityManager_ExecuteBatch_LiteralRefValues(t *testing.T) {
+	ctx := context.Background()
+	config := createTestConfig()
+	registry, err := newFileSchemaRegistryFromDir("../cmd/server/schemas")
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+	transformer := NewPersistentRecordTransformer(registry)
+	mockRepo := newMockPersistentRecordRepository()
+	em := NewEntityManager(transformer, mockRepo, registry, config)
+
+	schemaID, _, err := registry.GetSchemaAttributeCacheByName("visit")
+	if err != nil {
+		t.Fatalf("failed to get schema metadata: %v", err)
+	}
+
+	payload := visitPayload("visit-literal")
+	payload["propertyId"] = "$ref:0"
+
+	req := &forma.BatchOperation{
+		Operations: []forma.EntityOperation{
+			{
+				EntityIdentifier: forma.EntityIdentifier{SchemaName: "visit"},
+				Type:             forma.OperationCreate,
+				Data:             payload,
+			},
+			{
+				EntityIdentifier: forma.EntityIdentifier{SchemaName: "visit"},
+				Type:             forma.OperationUpdate,
+				RowRef:           "$ref:0",
+				Updates:          map[string]any{"leadId": "$ref:5"},
+			},
+		},
+	}
+
+	result, err := em.ExecuteBatch(ctx, req)
+	if err != nil {
+		t.Fatalf("ExecuteBatch failed: %v", err)
+	}
+	if len(result.Failed) != 0 {
+		t.Fatalf("expected no failures, got %+v", result.Failed)
+	}
+
+	record, ok := mockRepo.records[schemaID][result.Successful[0].RowID]
+	if !ok {
+		t.Fatalf("expected created record to be stored")
+	}
+	data, err := transformer.FromPersistentRecord(ctx, record)
+	if err != nil {
+		t.Fatalf("failed to read created record: %v", err)
+	}
+	if data["propertyId"] != "$ref:0" {
+		t.Fatalf("expected literal propertyId to be stored as given, got %v", data["propertyId"])
+	}
+	if data["leadId"] != "$ref:5" {
+		t.Fatalf("expected literal leadId update to be stored as given, got %v", data["leadId"])
+	}
+}
+
+func TestEntityManager_BulkLoad(t *testing.T) {
+	ctx := context.Background()
+	config := createTestConfig()
+	registry, err := newFileSchemaRegistryFromDir("../cmd/server/schemas")
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+	transformer := NewPersistentRecordTransformer(registry)
+	mockRepo := newMockPersistentRecordRepository()
+	em := NewEntityManager(transformer, mockRepo, registry, config)
+
+	items := make([]map[string]any, 0, bulkLoadChunkSize+2)
+	for i := 0; i < bulkLoadChunkSize+1; i++ {
+		items = append(items, visitPayload(fmt.Sprintf("visit-bulk-%d", i)))
+	}
+	// Entities without data are rejected like Create does.
+	items = append(items, nil)
+
+	result, err := em.BulkLoad(ctx, "visit", forma.NewSliceEntityIterator(items))
+	if err != nil {
+		t.Fatalf("BulkLoad failed: %v", err)
+	}
+	if result.TotalCount != len(items) {
+		t.Fatalf("expected total %d, got %d", len(items), result.TotalCount)
+	}
+	if result.Loaded != bulkLoadChunkSize+1 {
+		t.Fatalf("expected %d loaded, got %d", bulkLoadChunkSize+1, result.Loaded)
+	}
+	if mockRepo.bulkInsertCalls != 2 {
+		t.Fatalf("expected 2 COPY chunks, got %d", mockRepo.bulkInsertCalls)
+	}
+	if len(result.Failed) != 1 || result.Failed[0].Index != len(items)-1 {
+		t.Fatalf("expected the last entity to fail, got %+v", result.Failed)
+	}
+}
+
+func TestEntityManager_BulkLoad_ChunkFailure(t *testing.T) {
+	ctx := context.Background()
+	config := createTestConfig()
+	registry, err := newFileSchemaRegistryFromDir("../cmd/server/schemas")
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+	transformer := NewPersistentRecordTransformer(registry)
+	mockRepo := newMockPersistentRecordRepository()
+	mockRepo.bulkInsertErr = fmt.Errorf("copy failed")
+	em := NewEntityManager(transformer, mockRepo, registry, config)
+
+	items := []map[string]any{visitPayload("visit-bulk-a"), visitPayload("visit-bulk-b")}
+	result, err := em.BulkLoad(ctx, "visit", forma.NewSliceEntityIterator(items))
+	if err != nil {
+		t.Fatalf("BulkLoad failed: %v", err)
+	}
+	if result.Loaded != 0 {
+		t.Fatalf("expected nothing loaded, got %d", result.Loaded)
+	}
+	if len(result.Failed) != 2 || result.Failed[0].Index != 0 || result.Failed[1].Index != 1 {
+		t.Fatalf("expected both entities to fail, got %+v", result.Failed)
+	}
+}
+
+// badColumnTransformer maps the entity with id badID to a hot column entity_main does not have.
+type badColumnTransformer struct {
+	PersistentRecordTransformer
+	badID string
+}
+
+func (t *badColumnTransformer) ToPersistentRecord(ctx context.Context, schemaID int16, rowID uuid.UUID, jsonData any) (*PersistentRecord, error) {
+	record, err := t.PersistentRecordTransformer.ToPersistentRecord(ctx, schemaID, rowID, jsonData)
+	if data, ok := jsonData.(map[string]any); ok && err == nil && data["id"] == t.badID {
+		record.TextItems["text_99"] = "unknown column"
+	}
+	return record, err
+}
+
+func TestEntityManager_BulkLoad_InvalidRecordFailsAlone(t *testing.T) {
+	ctx := context.Background()
+	config := createTestConfig()
+	registry, err := newFileSchemaRegistryFromDir("../cmd/server/schemas")
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+	transformer := &badColumnTransformer{PersistentRecordTransformer: NewPersistentRecordTransformer(registry), badID: "visit-bulk-b"}
+	mockRepo := newMockPersistentRecordRepository()
+	em := NewEntityManager(transformer, mockRepo, registry, config)
+
+	items := []map[string]any{visitPayload("visit-bulk-a"), visitPayload("visit-bulk-b"), visitPayload("visit-bulk-c")}
+	result, err := em.BulkLoad(ctx, "visit", forma.NewSliceEntityIterator(items))
+	if err != nil {
+		t.Fatalf("BulkLoad failed: %v", err)
+	}
+	if result.Loaded != 2 || mockRepo.bulkInsertCalls != 1 {
+		t.Fatalf("expected the valid entities to be copied in one chunk, got loaded=%d chunks=%d", result.Loaded, mockRepo.bulkInsertCalls)
+	}
+	if len(result.Failed) != 1 || result.Failed[0].Index != 1 {
+		t.Fatalf("expected only the invalid entity to fail, got %+v", result.Failed)
+	}
+}
+
+// cancellingIterator cancels its context once it has produced limit entities.
+type cancellingIterator struct {
+	forma.EntityIterator
+	cancel   context.CancelFunc
+	produced int
+	limit    int
+}
+
+func (it *cancellingIterator) Next() bool {
+	if it.produced == it.limit {
+		it.cancel()
+	}
+	it.produced++
+	return it.EntityIterator.Next()
+}
+
+func TestEntityManager_BulkLoad_CancelKeepsPartialResult(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	config := createTestConfig()
+	registry, err := newFileSchemaRegistryFromDir("../cmd/server/schemas")
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+	mockRepo := newMockPersistentRecordRepository()
+	em := NewEntityManager(NewPersistentRecordTransformer(registry), mockRepo, registry, config)
+
+	items := make([]map[string]any, 0, bulkLoadChunkSize+10)
+	for i := 0; i < bulkLoadChunkSize+10; i++ {
+		items = append(items, visitPayload(fmt.Sprintf("visit-bulk-%d", i)))
+	}
+	iterator := &cancellingIterator{EntityIterator: forma.NewSliceEntityIterator(items), cancel: cancel, limit: bulkLoadChunkSize + 5}
+
+	result, err := em.BulkLoad(ctx, "visit", iterator)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if result == nil || result.Loaded != bulkLoadChunkSize {
+		t.Fatalf("expected the committed chunk to be reported, got %+v", result)
+	}
+	if len(result.Failed) == 0 || result.Loaded+len(result.Failed) != result.TotalCount {
+		t.Fatalf("expected the buffered entities to be reported as failed, got %d loaded, %d failed of %d",
+			result.Loaded, len(result.Failed), result.TotalCount)
+	}
+	for _, failed := range result.Failed {
+		if !strings.Contains(failed.Error, context.Canceled.Error()) {
+			t.Fatalf("expected a cancellation error, got %+v", failed)
+		}
+	}
+}
+
 func visitPayload(id string) map[string]any {
 	return map[string]any{
 		"id":               id,
@@ -248,3 +683,93 @@ func visitPayload(id string) map[string]any {
 		"status":           "scheduled",
 	}
 }
+
+func TestEntityManager_UpdateWhereAndDeleteWhere(t *testing.T) {
+	ctx := context.Background()
+	config := createTestConfig()
+	config.Entity.SoftDelete = true
+	registry, err := newFileSchemaRegistryFromDir("../cmd/server/schemas")
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+	transformer := NewPersistentRecordTransformer(registry)
+	mockRepo := newMockPersistentRecordRepository()
+	em := NewEntityManager(transformer, mockRepo, registry, config)
+
+	schemaID, _, err := registry.GetSchemaAttributeCacheByName("activity")
+	if err != nil {
+		t.Fatalf("failed to get schema: %v", err)
+	}
+	rowIDs := []uuid.UUID{uuid.New(), uuid.New()}
+	for _, rowID := range rowIDs {
+		payload := activityPayload("call", map[string]any{"direction": "outbound", "userId": "user-1"})
+		delete(payload, "nextFollowUpAt")
+		mockRepo.storeRecord(buildPersistentRecord(t, transformer, schemaID, rowID, payload))
+	}
+	condition := &forma.KvCondition{Attr: "userId", Value: "equals:user-1"}
+
+	dryRun, err := em.UpdateWhere(ctx, "activity", condition, map[string]any{"userId": "user-2"}, forma.WhereOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("dry-run UpdateWhere failed: %v", err)
+	}
+	if !dryRun.DryRun || dryRun.Affected != 2 {
+		t.Fatalf("expected dry run reporting 2 rows, got %+v", dryRun)
+	}
+	if len(mockRepo.whereUpdates) != 0 || mockRepo.records[schemaID][rowIDs[0]].TextItems["text_04"] != "user-1" {
+		t.Fatal("dry run must not change anything")
+	}
+
+	// userId lives in a hot column, so the patch is applied set-based.
+	result, err := em.UpdateWhere(ctx, "activity", condition, map[string]any{"userId": "user-2"}, forma.WhereOptions{})
+	if err != nil {
+		t.Fatalf("UpdateWhere failed: %v", err)
+	}
+	if result.Affected != 2 || len(mockRepo.whereUpdates) != 1 {
+		t.Fatalf("expected one set-based update of 2 rows, got %+v with %d set-based calls", result, len(mockRepo.whereUpdates))
+	}
+	if got := mockRepo.whereUpdates[0].TextItems["text_04"]; got != "user-2" {
+		t.Fatalf("expected text_04 patch user-2, got %q", got)
+	}
+	for _, rowID := range rowIDs {
+		if got := mockRepo.records[schemaID][rowID].TextItems["text_04"]; got != "user-2" {
+			t.Fatalf("expected row %s reassigned, got %q", rowID, got)
+		}
+	}
+
+	// nextFollowUpAt is stored in EAV, so the patch is merged row by row in one transaction.
+	txCalls := mockRepo.txCalls
+	result, err = em.UpdateWhere(ctx, "activity", condition, map[string]any{"nextFollowUpAt": "2024-02-01T00:00:00Z"}, forma.WhereOptions{})
+	if err != nil {
+		t.Fatalf("UpdateWhere with EAV patch failed: %v", err)
+	}
+	if result.Affected != 2 || len(mockRepo.whereUpdates) != 1 || mockRepo.txCalls != txCalls+1 {
+		t.Fatalf("expected row-by-row update of 2 rows in one transaction, got %+v", result)
+	}
+	record, err := em.Get(ctx, &forma.QueryRequest{SchemaName: "activity", RowID: &rowIDs[1]})
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if record.Attributes["nextFollowUpAt"] == nil || record.Attributes["userId"] != "user-2" {
+		t.Fatalf("expected merged attributes, got %v", record.Attributes)
+	}
+
+	deleted, err := em.DeleteWhere(ctx, "activity", condition, forma.WhereOptions{})
+	if err != nil {
+		t.Fatalf("DeleteWhere failed: %v", err)
+	}
+	if deleted.Affected != 2 {
+		t.Fatalf("expected 2 deleted rows, got %d", deleted.Affected)
+	}
+	for _, rowID := range rowIDs {
+		if mockRepo.records[schemaID][rowID].DeletedAt == nil {
+			t.Fatalf("expected row %s to be soft deleted", rowID)
+		}
+	}
+
+	if _, err := em.DeleteWhere(ctx, "activity", nil, forma.WhereOptions{}); err == nil {
+		t.Fatal("expected error for nil condition")
+	}
+	if _, err := em.UpdateWhere(ctx, "activity", condition, nil, forma.WhereOptions{}); err == nil {
+		t.Fatal("expected error for empty patch")
+	}
+}
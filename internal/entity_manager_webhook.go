@@ -0,0 +1,329 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/lychee-technology/forma"
+	"go.uber.org/zap"
+)
+
+// Webhook settings used when WebhookConfig leaves them unset.
+const (
+	defaultWebhookMaxAttempts    = 8
+	defaultWebhookInitialBackoff = 10 * time.Second
+	defaultWebhookMaxBackoff     = time.Hour
+	defaultWebhookTimeout        = 10 * time.Second
+)
+
+// webhookCursor is the change cursor consumer name webhooks read the change log under.
+const webhookCursor = "webhooks"
+
+// maxWebhookResponseBody bounds how much of a subscriber response is read before it is discarded.
+const maxWebhookResponseBody = 64 << 10
+
+// webhookTarget is a subscription resolved against the schema registry.
+type webhookTarget struct {
+	subscription *forma.WebhookSubscription
+	schemaID     int16
+	condition    forma.Condition // storage form
+}
+
+// ProcessWebhooks enqueues deliveries for the changes committed since its last pass, then attempts
+// the deliveries that are due. Changes are read through the webhook change cursor in the order of the
+// transactions that wrote them, and the cursor is moved in the transaction that enqueues their
+// deliveries, so every change matching a subscription is delivered at least once and the change feed
+// of ConsumeChanges is left untouched. Attempts run outside any transaction.
+func (em *entityManager) ProcessWebhooks(ctx context.Context) (*forma.WebhookResult, error) {
+	tables := em.storageTables()
+	if tables.WebhookDeliveries == "" {
+		return nil, forma.ErrWebhooksDisabled
+	}
+
+	cfg := em.config.Webhooks
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = forma.DefaultChangeBatchSize
+	}
+
+	result := &forma.WebhookResult{}
+	if len(cfg.Subscriptions) > 0 {
+		if tables.ChangeLog == "" || tables.ChangeCursors == "" {
+			return nil, fmt.Errorf("webhooks require the change log and change cursor tables")
+		}
+		targets, err := em.webhookTargets(cfg.Subscriptions)
+		if err != nil {
+			return nil, err
+		}
+
+		err = em.runInTx(ctx, func(txCtx context.Context) error {
+			cursor, err := em.repository.LockChangeCursor(txCtx, tables, webhookCursor)
+			if err != nil {
+				return fmt.Errorf("failed to lock webhook change cursor: %w", err)
+			}
+			entries, err := em.repository.ListChangesAfter(txCtx, tables, cursor, batchSize)
+			if err != nil {
+				return fmt.Errorf("failed to list changes: %w", err)
+			}
+			if len(entries) == 0 {
+				return nil
+			}
+
+			changes, err := em.hydrateChanges(txCtx, tables, entries)
+			if err != nil {
+				return err
+			}
+			deliveries, err := em.buildWebhookDeliveries(txCtx, tables, targets, changes)
+			if err != nil {
+				return err
+			}
+			if err := em.repository.InsertWebhookDeliveries(txCtx, tables, deliveries); err != nil {
+				return fmt.Errorf("failed to enqueue webhook deliveries: %w", err)
+			}
+
+			last := entries[len(entries)-1]
+			next := &ChangeCursor{TxID: last.TxID, SchemaID: last.SchemaID, RowID: last.RowID}
+			if err := em.repository.SaveChangeCursor(txCtx, tables, webhookCursor, next); err != nil {
+				return fmt.Errorf("failed to save webhook change cursor: %w", err)
+			}
+			result.Enqueued = len(deliveries)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := em.attemptWebhookDeliveries(ctx, tables, cfg, batchSize, result); err != nil {
+		return nil, err
+	}
+
+	zap.S().Debugw("processed webhooks", "enqueued", result.Enqueued, "delivered", result.Delivered,
+		"retried", result.Retried, "dead", result.Dead)
+	return result, nil
+}
+
+// webhookTargets resolves the schema and storage condition of every subscription.
+func (em *entityManager) webhookTargets(subscriptions []forma.WebhookSubscription) ([]*webhookTarget, error) {
+	targets := make([]*webhookTarget, 0, len(subscriptions))
+	for i := range subscriptions {
+		sub := &subscriptions[i]
+		schemaID, _, err := em.registry.GetSchemaAttributeCacheByName(sub.SchemaName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get schema of webhook %s: %w", sub.ID, err)
+		}
+		target := &webhookTarget{subscription: sub, schemaID: schemaID}
+		if sub.Condition != nil {
+			target.condition, err = em.transformer.ToStorageCondition(schemaID, sub.Condition)
+			if err != nil {
+				return nil, fmt.Errorf("invalid condition of webhook %s: %w", sub.ID, err)
+			}
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// buildWebhookDeliveries returns one delivery per change and subscription that wants it.
+func (em *entityManager) buildWebhookDeliveries(ctx context.Context, tables StorageTables, targets []*webhookTarget, changes []*forma.ChangeEvent) ([]*WebhookDeliveryRecord, error) {
+	var deliveries []*WebhookDeliveryRecord
+	for _, change := range changes {
+		for _, target := range targets {
+			sub := target.subscription
+			if sub.SchemaName != change.SchemaName || !sub.Accepts(change.Operation) {
+				continue
+			}
+			if !change.Deleted && target.condition != nil {
+				matches, err := em.repository.PersistentRecordMatches(ctx, tables, target.schemaID, change.RowID, target.condition)
+				if err != nil {
+					return nil, fmt.Errorf("failed to match changed record: %w", err)
+				}
+				if !matches {
+					continue
+				}
+			}
+
+			payload, err := json.Marshal(&forma.WebhookPayload{SubscriptionID: sub.ID, Event: change})
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode webhook payload: %w", err)
+			}
+			deliveries = append(deliveries, &WebhookDeliveryRecord{
+				SubscriptionID: sub.ID,
+				SchemaID:       target.schemaID,
+				RowID:          change.RowID,
+				Operation:      change.Operation,
+				Payload:        payload,
+			})
+		}
+	}
+	return deliveries, nil
+}
+
+// attemptWebhookDeliveries leases up to limit due deliveries and sends them one after another. The
+// lease covers a timeout per delivery, so a worker that dies mid-batch delays its deliveries by at
+// most that long.
+func (em *entityManager) attemptWebhookDeliveries(ctx context.Context, tables StorageTables, cfg forma.WebhookConfig, limit int, result *forma.WebhookResult) error {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultWebhookTimeout
+	}
+	maxAttempts := cfg.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultWebhookMaxAttempts
+	}
+
+	leaseUntil := time.Now().Add(timeout * time.Duration(limit)).UnixMilli()
+	deliveries, err := em.repository.LeaseWebhookDeliveries(ctx, tables, limit, leaseUntil)
+	if err != nil {
+		return fmt.Errorf("failed to lease webhook deliveries: %w", err)
+	}
+
+	subscriptions := make(map[string]*forma.WebhookSubscription, len(cfg.Subscriptions))
+	for i := range cfg.Subscriptions {
+		subscriptions[cfg.Subscriptions[i].ID] = &cfg.Subscriptions[i]
+	}
+	client := &http.Client{Timeout: timeout}
+
+	for _, delivery := range deliveries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		delivery.Attempts++
+		sub, ok := subscriptions[delivery.SubscriptionID]
+		var statusCode int
+		var sendErr error
+		if ok {
+			statusCode, sendErr = sendWebhook(ctx, client, sub, delivery)
+		} else {
+			sendErr = fmt.Errorf("subscription %s is no longer configured", delivery.SubscriptionID)
+		}
+
+		delivery.LastStatusCode = statusCode
+		delivery.LastError = ""
+		switch {
+		case sendErr == nil:
+			delivery.Status = forma.WebhookDeliveryDelivered
+			result.Delivered++
+		case !ok || delivery.Attempts >= maxAttempts:
+			delivery.Status = forma.WebhookDeliveryDead
+			result.Dead++
+		default:
+			delivery.NextAttemptAt = time.Now().Add(webhookBackoff(cfg, delivery.Attempts)).UnixMilli()
+			result.Retried++
+		}
+		if sendErr != nil {
+			delivery.LastError = sendErr.Error()
+			zap.S().Warnw("webhook delivery failed", "deliveryID", delivery.ID, "subscriptionID", delivery.SubscriptionID,
+				"attempts", delivery.Attempts, "status", delivery.Status, "error", sendErr)
+		}
+
+		if err := em.repository.UpdateWebhookDelivery(ctx, tables, delivery); err != nil {
+			return fmt.Errorf("failed to record webhook delivery: %w", err)
+		}
+	}
+	return nil
+}
+
+// webhookBackoff returns the delay after the given number of failed attempts: InitialBackoff doubled
+// for every attempt after the first, capped at MaxBackoff.
+func webhookBackoff(cfg forma.WebhookConfig, attempts int) time.Duration {
+	backoff, maxBackoff := cfg.InitialBackoff, cfg.MaxBackoff
+	if backoff <= 0 {
+		backoff = defaultWebhookInitialBackoff
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = defaultWebhookMaxBackoff
+	}
+	for i := 1; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxBackoff)
+}
+
+// sendWebhook POSTs the payload of delivery to the subscriber and returns the response status.
+// Any status outside 2xx is an error.
+func sendWebhook(ctx context.Context, client *http.Client, sub *forma.WebhookSubscription, delivery *WebhookDeliveryRecord) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(forma.WebhookDeliveryHeader, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(forma.WebhookEventHeader, string(delivery.Operation))
+	req.Header.Set(forma.WebhookSignatureHeader, forma.SignWebhookPayload(sub.Secret, time.Now().Unix(), delivery.Payload))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxWebhookResponseBody))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("subscriber responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// ListWebhookDeliveries returns entries of the webhook delivery log, newest first. The limit defaults
+// to Query.DefaultPageSize and is capped at Query.MaxPageSize.
+func (em *entityManager) ListWebhookDeliveries(ctx context.Context, filter forma.WebhookDeliveryFilter) ([]*forma.WebhookDelivery, error) {
+	tables := em.storageTables()
+	if tables.WebhookDeliveries == "" {
+		return nil, forma.ErrWebhooksDisabled
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = em.config.Query.DefaultPageSize
+	}
+	if em.config.Query.MaxPageSize > 0 && limit > em.config.Query.MaxPageSize {
+		limit = em.config.Query.MaxPageSize
+	}
+
+	records, err := em.repository.ListWebhookDeliveries(ctx, tables, WebhookDeliveryQuery{
+		SubscriptionID: filter.SubscriptionID,
+		Status:         filter.Status,
+		Limit:          limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+
+	schemaNames := make(map[int16]string)
+	deliveries := make([]*forma.WebhookDelivery, 0, len(records))
+	for _, record := range records {
+		schemaName, ok := schemaNames[record.SchemaID]
+		if !ok {
+			name, _, err := em.registry.GetSchemaAttributeCacheByID(record.SchemaID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve schema name for id %d: %w", record.SchemaID, err)
+			}
+			schemaName = name
+			schemaNames[record.SchemaID] = name
+		}
+		deliveries = append(deliveries, &forma.WebhookDelivery{
+			ID:             record.ID,
+			SubscriptionID: record.SubscriptionID,
+			SchemaName:     schemaName,
+			RowID:          record.RowID,
+			Operation:      record.Operation,
+			Status:         record.Status,
+			Attempts:       record.Attempts,
+			NextAttemptAt:  record.NextAttemptAt,
+			LastStatusCode: record.LastStatusCode,
+			LastError:      record.LastError,
+			CreatedAt:      record.CreatedAt,
+			UpdatedAt:      record.UpdatedAt,
+			Payload:        json.RawMessage(record.Payload),
+		})
+	}
+	return deliveries, nil
+}
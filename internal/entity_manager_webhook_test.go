@@ -0,0 +1,199 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lychee-technology/forma"
+)
+
+func TestEntityManager_ProcessWebhooks(t *testing.T) {
+	ctx := context.Background()
+	registry, err := newFileSchemaRegistryFromDir("../cmd/server/schemas")
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+	schemaID, _, err := registry.GetSchemaAttributeCacheByName("lead")
+	if err != nil {
+		t.Fatalf("failed to resolve lead schema: %v", err)
+	}
+
+	var mu sync.Mutex
+	var received []*http.Request
+	var bodies [][]byte
+	crmCalls := 0
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, r)
+		bodies = append(bodies, body)
+		switch r.URL.Path {
+		case "/crm":
+			crmCalls++
+			if crmCalls == 1 {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer receiver.Close()
+
+	repo := newMockPersistentRecordRepository()
+	config := createTestConfig()
+	config.Database.TableNames.ChangeLog = "change_log"
+	config.Database.TableNames.WebhookDeliveries = "webhook_deliveries"
+	config.Database.TableNames.ChangeCursors = "change_cursors"
+	config.Webhooks = forma.WebhookConfig{
+		MaxAttempts: 2,
+		Subscriptions: []forma.WebhookSubscription{
+			{
+				ID:         "crm",
+				SchemaName: "lead",
+				Operations: []forma.ChangeOperation{forma.ChangeOperationCreated, forma.ChangeOperationUpdated},
+				Condition:  &forma.KvCondition{Attr: "stage", Value: "equals:new"},
+				URL:        receiver.URL + "/crm",
+				Secret:     "crm-secret",
+			},
+			{
+				ID:         "audit",
+				SchemaName: "lead",
+				Operations: []forma.ChangeOperation{forma.ChangeOperationDeleted},
+				URL:        receiver.URL + "/audit",
+				Secret:     "audit-secret",
+			},
+		},
+	}
+	em := NewEntityManager(NewPersistentRecordTransformer(registry), repo, registry, config)
+
+	create := func() uuid.UUID {
+		rowID := uuid.New()
+		if _, err := em.Create(ctx, &forma.EntityOperation{
+			EntityIdentifier: forma.EntityIdentifier{SchemaName: "lead", RowID: rowID},
+			Data:             leadPayload(rowID.String()),
+		}); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		return rowID
+	}
+	matchingID, otherID, deletedID := create(), create(), uuid.New()
+
+	// Only matchingID satisfies the crm condition.
+	repo.queryFunc = func(ctx context.Context, query *PersistentRecordQuery) (*PersistentRecordPage, error) {
+		return &PersistentRecordPage{Records: []*PersistentRecord{repo.records[schemaID][matchingID]}}, nil
+	}
+	deletedAt := int64(3000)
+	repo.changes = []*ChangeLogEntry{
+		{SchemaID: schemaID, RowID: matchingID, ChangedAt: 1000, TxID: 10},
+		{SchemaID: schemaID, RowID: otherID, ChangedAt: 2000, TxID: 11},
+		{SchemaID: schemaID, RowID: deletedID, ChangedAt: 3000, DeletedAt: &deletedAt, TxID: 12},
+	}
+
+	start := time.Now()
+	result, err := em.ProcessWebhooks(ctx)
+	if err != nil {
+		t.Fatalf("ProcessWebhooks failed: %v", err)
+	}
+	if *result != (forma.WebhookResult{Enqueued: 2, Retried: 2}) {
+		t.Fatalf("unexpected first pass result: %+v", result)
+	}
+	if len(repo.changes) != 3 {
+		t.Fatalf("expected the change feed to stay pending, got %d pending", len(repo.changes))
+	}
+	cursor := repo.cursors[webhookCursor]
+	if cursor == nil || cursor.TxID != 12 || cursor.RowID != deletedID {
+		t.Fatalf("expected the webhook cursor at the last change, got %+v", cursor)
+	}
+	for _, delivery := range repo.webhooks {
+		if delivery.Status != forma.WebhookDeliveryPending || delivery.Attempts != 1 {
+			t.Fatalf("expected a pending delivery after one attempt, got %+v", delivery)
+		}
+		if delivery.NextAttemptAt < start.Add(10*time.Second).UnixMilli() {
+			t.Fatalf("expected the retry to back off, next attempt at %d", delivery.NextAttemptAt)
+		}
+		delivery.NextAttemptAt = 0 // due now
+	}
+
+	result, err = em.ProcessWebhooks(ctx)
+	if err != nil {
+		t.Fatalf("ProcessWebhooks failed: %v", err)
+	}
+	if *result != (forma.WebhookResult{Delivered: 1, Dead: 1}) {
+		t.Fatalf("unexpected second pass result: %+v", result)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 4 {
+		t.Fatalf("expected 4 requests, got %d", len(received))
+	}
+	req, body := received[2], bodies[2]
+	if req.URL.Path != "/crm" || req.Header.Get(forma.WebhookEventHeader) != string(forma.ChangeOperationCreated) {
+		t.Fatalf("unexpected crm request: %s %v", req.URL.Path, req.Header)
+	}
+	if req.Header.Get(forma.WebhookDeliveryHeader) != received[0].Header.Get(forma.WebhookDeliveryHeader) {
+		t.Fatalf("expected retries to keep the delivery ID")
+	}
+	if _, err := forma.VerifyWebhookSignature("crm-secret", req.Header.Get(forma.WebhookSignatureHeader), body); err != nil {
+		t.Fatalf("signature did not verify: %v", err)
+	}
+	var payload forma.WebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("failed to decode payload: %v", err)
+	}
+	if payload.SubscriptionID != "crm" || payload.Event.RowID != matchingID || payload.Event.Record == nil {
+		t.Fatalf("unexpected payload: %s", body)
+	}
+
+	dead, err := em.ListWebhookDeliveries(ctx, forma.WebhookDeliveryFilter{Status: forma.WebhookDeliveryDead})
+	if err != nil {
+		t.Fatalf("ListWebhookDeliveries failed: %v", err)
+	}
+	if len(dead) != 1 {
+		t.Fatalf("expected 1 dead delivery, got %d", len(dead))
+	}
+	if d := dead[0]; d.SubscriptionID != "audit" || d.SchemaName != "lead" || d.RowID != deletedID ||
+		d.Attempts != 2 || d.LastStatusCode != http.StatusServiceUnavailable || d.LastError == "" {
+		t.Fatalf("unexpected dead delivery: %+v", d)
+	}
+
+	// Webhooks read through their own cursor, so the change feed still holds every change.
+	var consumed []uuid.UUID
+	if _, err := em.ConsumeChanges(ctx, forma.ChangeFeedOptions{}, func(ctx context.Context, changes []*forma.ChangeEvent) error {
+		for _, change := range changes {
+			consumed = append(consumed, change.RowID)
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("ConsumeChanges failed: %v", err)
+	}
+	if len(consumed) != 3 || consumed[0] != matchingID || consumed[2] != deletedID {
+		t.Fatalf("expected ConsumeChanges to see every change, got %v", consumed)
+	}
+
+	config.Database.TableNames.WebhookDeliveries = ""
+	if _, err := em.ProcessWebhooks(ctx); !errors.Is(err, forma.ErrWebhooksDisabled) {
+		t.Fatalf("expected ErrWebhooksDisabled without a delivery table, got %v", err)
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	cfg := forma.WebhookConfig{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, expected := range want {
+		if got := webhookBackoff(cfg, i+1); got != expected {
+			t.Fatalf("attempt %d: expected %v, got %v", i+1, expected, got)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/lychee-technology/forma"
+	"go.uber.org/zap"
+)
+
+// whereScanPageSize is the page size used to collect matching row IDs when a patch has to be
+// applied row by row.
+const whereScanPageSize = 500
+
+// UpdateWhere merges patch into every live entity of schemaName matching condition. Patches that
+// only set attributes stored in entity_main hot columns run as one set-based UPDATE; other patches
+// are merged row by row inside a single transaction.
+func (em *entityManager) UpdateWhere(ctx context.Context, schemaName string, condition forma.Condition, patch map[string]any, opts forma.WhereOptions) (*forma.WhereResult, error) {
+	if schemaName == "" {
+		return nil, fmt.Errorf("schema name is required")
+	}
+	if condition == nil {
+		return nil, fmt.Errorf("condition is required")
+	}
+	if len(patch) == 0 {
+		return nil, fmt.Errorf("patch is required for update operation")
+	}
+
+	schemaID, _, err := em.registry.GetSchemaAttributeCacheByName(schemaName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schema: %w", err)
+	}
+	condition, err = em.transformer.ToStorageCondition(schemaID, condition)
+	if err != nil {
+		return nil, fmt.Errorf("invalid condition: %w", err)
+	}
+
+	tables := em.storageTables()
+	if opts.DryRun {
+		return em.countWhere(ctx, tables, schemaID, condition)
+	}
+
+	if em.relations != nil {
+		patch = em.relations.StripComputedFields(schemaName, patch)
+	}
+
+	// Patches touching write-protected fields go row by row so each row is checked against its stored values.
+	if isScalarPatch(patch) && !em.touchesImmutableField(schemaName, patch) {
+		record, err := em.transformer.ToPersistentRecord(ctx, schemaID, uuid.Nil, patch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to transform patch: %w", err)
+		}
+		if len(record.OtherAttributes) == 0 {
+			// An empty stored document checks the patch under the update settings.
+			if err := em.checkReferences(ctx, schemaName, patch, map[string]any{}); err != nil {
+				return nil, fmt.Errorf("failed to validate references: %w", err)
+			}
+			affected, err := em.repository.UpdatePersistentRecordsWhere(ctx, tables, schemaID, condition, record)
+			if err != nil {
+				return nil, fmt.Errorf("failed to update by condition: %w", err)
+			}
+			zap.S().Infow("updated by condition", "schemaName", schemaName, "affected", affected, "setBased", true)
+			return &forma.WhereResult{Affected: affected}, nil
+		}
+	}
+
+	var affected int64
+	err = em.runInTx(ctx, func(txCtx context.Context) error {
+		rowIDs, err := em.matchingRowIDs(txCtx, tables, schemaID, condition)
+		if err != nil {
+			return err
+		}
+		for _, rowID := range rowIDs {
+			if _, err := em.Update(txCtx, &forma.EntityOperation{
+				EntityIdentifier: forma.EntityIdentifier{SchemaName: schemaName, RowID: rowID},
+				Type:             forma.OperationUpdate,
+				Updates:          patch,
+			}); err != nil {
+				return fmt.Errorf("row %s: %w", rowID, err)
+			}
+			affected++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update by condition: %w", err)
+	}
+
+	zap.S().Infow("updated by condition", "schemaName", schemaName, "affected", affected, "setBased", false)
+	return &forma.WhereResult{Affected: affected}, nil
+}
+
+// DeleteWhere deletes every live entity of schemaName matching condition with a single set-based
+// statement, honoring the schema's soft delete setting. Schemas with cascade rules are deleted row
+// by row so the rules apply.
+func (em *entityManager) DeleteWhere(ctx context.Context, schemaName string, condition forma.Condition, opts forma.WhereOptions) (*forma.WhereResult, error) {
+	if schemaName == "" {
+		return nil, fmt.Errorf("schema name is required")
+	}
+	if condition == nil {
+		return nil, fmt.Errorf("condition is required")
+	}
+
+	schemaID, _, err := em.registry.GetSchemaAttributeCacheByName(schemaName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schema: %w", err)
+	}
+	condition, err = em.transformer.ToStorageCondition(schemaID, condition)
+	if err != nil {
+		return nil, fmt.Errorf("invalid condition: %w", err)
+	}
+
+	tables := em.storageTables()
+	if opts.DryRun {
+		return em.countWhere(ctx, tables, schemaID, condition)
+	}
+
+	if len(em.cascadeRules(schemaName)) > 0 {
+		return em.cascadeDeleteWhere(ctx, tables, schemaName, schemaID, condition)
+	}
+
+	affected, err := em.repository.DeletePersistentRecordsWhere(ctx, tables, schemaID, condition, em.config.Entity.SoftDeleteEnabled(schemaName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete by condition: %w", err)
+	}
+
+	zap.S().Infow("deleted by condition", "schemaName", schemaName, "affected", affected)
+	return &forma.WhereResult{Affected: affected}, nil
+}
+
+// cascadeDeleteWhere deletes the matching entities of a schema with cascade rules one by one inside a
+// single transaction, so the rules run for each of them.
+func (em *entityManager) cascadeDeleteWhere(ctx context.Context, tables StorageTables, schemaName string, schemaID int16, condition forma.Condition) (*forma.WhereResult, error) {
+	var affected int64
+	err := em.runInTx(ctx, func(txCtx context.Context) error {
+		rowIDs, err := em.matchingRowIDs(txCtx, tables, schemaID, condition)
+		if err != nil {
+			return err
+		}
+		visited := make(map[cascadeKey]bool)
+		for _, rowID := range rowIDs {
+			if visited[cascadeKey{schemaID: schemaID, rowID: rowID}] {
+				continue
+			}
+			if err := em.cascadeDelete(txCtx, tables, schemaName, schemaID, rowID, 0, visited); err != nil {
+				return fmt.Errorf("row %s: %w", rowID, err)
+			}
+			affected++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete by condition: %w", err)
+	}
+
+	zap.S().Infow("deleted by condition", "schemaName", schemaName, "affected", affected, "cascade", true)
+	return &forma.WhereResult{Affected: affected}, nil
+}
+
+func (em *entityManager) countWhere(ctx context.Context, tables StorageTables, schemaID int16, condition forma.Condition) (*forma.WhereResult, error) {
+	count, err := em.repository.CountPersistentRecordsWhere(ctx, tables, schemaID, condition)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count matching entities: %w", err)
+	}
+	return &forma.WhereResult{Affected: count, DryRun: true}, nil
+}
+
+// matchingRowIDs collects the row IDs of all live entities matching condition before any of them is
+// modified, so that updates cannot shift the pages being read.
+func (em *entityManager) matchingRowIDs(ctx context.Context, tables StorageTables, schemaID int16, condition forma.Condition) ([]uuid.UUID, error) {
+	var rowIDs []uuid.UUID
+	for offset := 0; ; offset += whereScanPageSize {
+		page, err := em.repository.QueryPersistentRecords(ctx, &PersistentRecordQuery{
+			Tables:    tables,
+			SchemaID:  schemaID,
+			Condition: condition,
+			Limit:     whereScanPageSize,
+			Offset:    offset,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to query matching entities: %w", err)
+		}
+		for _, record := range page.Records {
+			rowIDs = append(rowIDs, record.RowID)
+		}
+		if len(page.Records) < whereScanPageSize {
+			return rowIDs, nil
+		}
+	}
+}
+
+// isScalarPatch reports whether patch only sets scalar values, possibly inside nested objects.
+// Arrays and nulls replace or clear existing EAV rows and are applied row by row instead.
+func isScalarPatch(patch map[string]any) bool {
+	for _, value := range patch {
+		switch v := value.(type) {
+		case nil, []any:
+			return false
+		case map[string]any:
+			if len(v) == 0 || !isScalarPatch(v) {
+				return false
+			}
+		}
+	}
+	return true
+}
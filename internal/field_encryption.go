@@ -0,0 +1,324 @@
+package internal
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lychee-technology/forma"
+)
+
+// Encrypted values are stored in value_text as
+//
+//	enc:v1:r:<keyID>:<wrapped data key>:<ciphertext>   (randomized)
+//	enc:v1:d:<keyID>:<ciphertext>                      (deterministic)
+//
+// with base64 (raw, standard alphabet) payloads. Every ciphertext is AES-256-GCM with the nonce
+// prepended and the schema and attribute IDs as additional data, so a value cannot be replayed
+// into another attribute. Randomized values use a fresh data key wrapped by the provider key.
+// Deterministic values use a data key derived from the provider key per attribute and a nonce
+// derived from the plaintext, so equal plaintexts encrypt to equal strings under the same key.
+const encryptedValuePrefix = "enc:v1:"
+
+const (
+	encryptedModeRandomized    = "r"
+	encryptedModeDeterministic = "d"
+
+	// The first byte of a plaintext records which EAV value column it came from.
+	plaintextKindText    = 't'
+	plaintextKindNumeric = 'n'
+)
+
+var encryptedValueEncoding = base64.RawStdEncoding
+
+// fieldEncryptor encrypts and decrypts the EAV values of x-encrypted attributes.
+type fieldEncryptor struct {
+	keys forma.KeyProvider
+}
+
+func newFieldEncryptor(keys forma.KeyProvider) *fieldEncryptor {
+	return &fieldEncryptor{keys: keys}
+}
+
+// encryptRecord replaces the value of record with its ciphertext in ValueText.
+func (e *fieldEncryptor) encryptRecord(meta forma.AttributeMetadata, schemaID int16, record *EAVRecord) error {
+	plaintext, ok := eavPlaintext(*record)
+	if !ok {
+		return nil
+	}
+	ciphertext, err := e.encrypt(meta, schemaID, plaintext)
+	if err != nil {
+		return err
+	}
+	record.ValueText = &ciphertext
+	record.ValueNumeric = nil
+	return nil
+}
+
+// decryptRecord restores the value of record in place. Values stored before the attribute was
+// marked x-encrypted are plaintext and are returned unchanged.
+func (e *fieldEncryptor) decryptRecord(meta forma.AttributeMetadata, schemaID int16, record *EAVRecord) error {
+	if record.ValueText == nil || !strings.HasPrefix(*record.ValueText, encryptedValuePrefix) {
+		return nil
+	}
+	plaintext, err := e.decrypt(schemaID, meta.AttributeID, *record.ValueText)
+	if err != nil {
+		return fmt.Errorf("decrypt attribute %s: %w", meta.AttributeName, err)
+	}
+	if len(plaintext) == 0 {
+		return fmt.Errorf("decrypt attribute %s: empty plaintext", meta.AttributeName)
+	}
+
+	value := string(plaintext[1:])
+	switch plaintext[0] {
+	case plaintextKindText:
+		record.ValueText = &value
+		record.ValueNumeric = nil
+	case plaintextKindNumeric:
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("decrypt attribute %s: %w", meta.AttributeName, err)
+		}
+		record.ValueText = nil
+		record.ValueNumeric = &number
+	default:
+		return fmt.Errorf("decrypt attribute %s: unknown plaintext kind %q", meta.AttributeName, plaintext[0])
+	}
+	return nil
+}
+
+// encryptFilterValues returns the stored forms of a filter value for a deterministic attribute,
+// one per key that can still decrypt, so rows not yet re-encrypted after a rotation still match.
+func (e *fieldEncryptor) encryptFilterValues(meta forma.AttributeMetadata, schemaID int16, record EAVRecord) ([]string, error) {
+	plaintext, ok := eavPlaintext(record)
+	if !ok {
+		return nil, fmt.Errorf("empty filter value for encrypted attribute %s", meta.AttributeName)
+	}
+	if e == nil || e.keys == nil {
+		return nil, fmt.Errorf("attribute %s is encrypted but no key provider is configured", meta.AttributeName)
+	}
+
+	currentKeyID := e.keys.CurrentKeyID()
+	keyIDs := []string{currentKeyID}
+	for _, keyID := range e.keys.KeyIDs() {
+		if keyID != currentKeyID {
+			keyIDs = append(keyIDs, keyID)
+		}
+	}
+	ciphertexts := make([]string, 0, len(keyIDs))
+	for _, keyID := range keyIDs {
+		ciphertext, err := e.encryptWithKey(meta, schemaID, keyID, plaintext)
+		if err != nil {
+			return nil, err
+		}
+		ciphertexts = append(ciphertexts, ciphertext)
+	}
+	return ciphertexts, nil
+}
+
+func (e *fieldEncryptor) encrypt(meta forma.AttributeMetadata, schemaID int16, plaintext []byte) (string, error) {
+	if e == nil || e.keys == nil {
+		return "", fmt.Errorf("attribute %s is encrypted but no key provider is configured", meta.AttributeName)
+	}
+	return e.encryptWithKey(meta, schemaID, e.keys.CurrentKeyID(), plaintext)
+}
+
+func (e *fieldEncryptor) encryptWithKey(meta forma.AttributeMetadata, schemaID int16, keyID string, plaintext []byte) (string, error) {
+	if keyID == "" || strings.Contains(keyID, ":") {
+		return "", fmt.Errorf("invalid key ID %q", keyID)
+	}
+	kek, err := e.keys.Key(keyID)
+	if err != nil {
+		return "", fmt.Errorf("load key %s: %w", keyID, err)
+	}
+	aad := encryptionAAD(schemaID, meta.AttributeID)
+
+	if meta.Encryption == forma.EncryptionModeDeterministic {
+		dataKey := deriveDeterministicKey(kek, aad)
+		nonce := hmacSHA256(dataKey, plaintext)[:12]
+		ciphertext, err := sealAESGCM(dataKey, nonce, plaintext, aad)
+		if err != nil {
+			return "", err
+		}
+		return encryptedValuePrefix + encryptedModeDeterministic + ":" + keyID + ":" + encryptedValueEncoding.EncodeToString(ciphertext), nil
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", fmt.Errorf("generate data key: %w", err)
+	}
+	wrappedKey, err := sealAESGCM(kek, nil, dataKey, aad)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := sealAESGCM(dataKey, nil, plaintext, aad)
+	if err != nil {
+		return "", err
+	}
+	return encryptedValuePrefix + encryptedModeRandomized + ":" + keyID + ":" +
+		encryptedValueEncoding.EncodeToString(wrappedKey) + ":" + encryptedValueEncoding.EncodeToString(ciphertext), nil
+}
+
+func (e *fieldEncryptor) decrypt(schemaID, attrID int16, value string) ([]byte, error) {
+	if e == nil || e.keys == nil {
+		return nil, fmt.Errorf("no key provider is configured")
+	}
+	parts := strings.Split(strings.TrimPrefix(value, encryptedValuePrefix), ":")
+	if len(parts) < 3 {
+		return nil, fmt.Errorf("malformed encrypted value")
+	}
+	mode, keyID := parts[0], parts[1]
+	kek, err := e.keys.Key(keyID)
+	if err != nil {
+		return nil, fmt.Errorf("load key %s: %w", keyID, err)
+	}
+	aad := encryptionAAD(schemaID, attrID)
+
+	switch {
+	case mode == encryptedModeDeterministic && len(parts) == 3:
+		ciphertext, err := encryptedValueEncoding.DecodeString(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("decode ciphertext: %w", err)
+		}
+		return openAESGCM(deriveDeterministicKey(kek, aad), ciphertext, aad)
+	case mode == encryptedModeRandomized && len(parts) == 4:
+		wrappedKey, err := encryptedValueEncoding.DecodeString(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("decode data key: %w", err)
+		}
+		ciphertext, err := encryptedValueEncoding.DecodeString(parts[3])
+		if err != nil {
+			return nil, fmt.Errorf("decode ciphertext: %w", err)
+		}
+		dataKey, err := openAESGCM(kek, wrappedKey, aad)
+		if err != nil {
+			return nil, fmt.Errorf("unwrap data key: %w", err)
+		}
+		return openAESGCM(dataKey, ciphertext, aad)
+	default:
+		return nil, fmt.Errorf("malformed encrypted value")
+	}
+}
+
+// eavPlaintext serializes the value of record; ok is false for null values.
+func eavPlaintext(record EAVRecord) ([]byte, bool) {
+	switch {
+	case record.ValueText != nil:
+		return append([]byte{plaintextKindText}, *record.ValueText...), true
+	case record.ValueNumeric != nil:
+		return append([]byte{plaintextKindNumeric}, strconv.FormatFloat(*record.ValueNumeric, 'g', -1, 64)...), true
+	default:
+		return nil, false
+	}
+}
+
+func encryptionAAD(schemaID, attrID int16) []byte {
+	return []byte(fmt.Sprintf("forma/%d/%d", schemaID, attrID))
+}
+
+func deriveDeterministicKey(kek, aad []byte) []byte {
+	return hmacSHA256(kek, append([]byte("deterministic-data-key/"), aad...))
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// sealAESGCM encrypts plaintext and prepends the nonce; a nil nonce is generated randomly.
+func sealAESGCM(key, nonce, plaintext, aad []byte) ([]byte, error) {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if nonce == nil {
+		nonce = make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, fmt.Errorf("generate nonce: %w", err)
+		}
+	}
+	return aead.Seal(append([]byte(nil), nonce...), nonce, plaintext, aad), nil
+}
+
+func openAESGCM(key, sealed, aad []byte) ([]byte, error) {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, aad)
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption keys must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// filterValueRecord converts a filter value into the EAV value it would be stored as, so it can
+// be encrypted and compared with stored deterministic ciphertexts.
+func filterValueRecord(meta forma.AttributeMetadata, valStr string) (EAVRecord, error) {
+	record := EAVRecord{AttrID: meta.AttributeID}
+	switch meta.ValueType {
+	case forma.ValueTypeText:
+		record.ValueText = &valStr
+	case forma.ValueTypeUUID:
+		parsed, err := uuid.Parse(valStr)
+		if err != nil {
+			return record, fmt.Errorf("invalid uuid value for '%s': %s", meta.AttributeName, valStr)
+		}
+		text := parsed.String()
+		record.ValueText = &text
+	case forma.ValueTypeNumeric, forma.ValueTypeInteger, forma.ValueTypeBigInt, forma.ValueTypeSmallInt:
+		var number float64
+		switch v := tryParseNumber(valStr).(type) {
+		case int64:
+			number = float64(v)
+		case float64:
+			number = v
+		default:
+			return record, fmt.Errorf("invalid numeric value for '%s': %s", meta.AttributeName, valStr)
+		}
+		record.ValueNumeric = &number
+	case forma.ValueTypeDate, forma.ValueTypeDateTime:
+		parsed, err := parseDateValue(valStr, meta)
+		if err != nil {
+			return record, fmt.Errorf("invalid date value for '%s': %w", meta.AttributeName, err)
+		}
+		millis, ok := parsed.(int64)
+		if !ok {
+			return record, fmt.Errorf("invalid date value for '%s': %s", meta.AttributeName, valStr)
+		}
+		number := float64(millis)
+		record.ValueNumeric = &number
+	case forma.ValueTypeBool:
+		truth, err := strconv.ParseBool(valStr)
+		if err != nil {
+			return record, fmt.Errorf("invalid boolean value for '%s': %s", meta.AttributeName, valStr)
+		}
+		number := 0.0
+		if truth {
+			number = 1
+		}
+		record.ValueNumeric = &number
+	default:
+		return record, fmt.Errorf("unsupported value_type '%s' for attribute '%s'", meta.ValueType, meta.AttributeName)
+	}
+	return record, nil
+}
@@ -0,0 +1,320 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/lychee-technology/forma"
+)
+
+// staticKeyProvider serves fixed test keys.
+type staticKeyProvider struct {
+	current string
+	keys    map[string][]byte
+}
+
+func newTestKeyProvider() *staticKeyProvider {
+	return &staticKeyProvider{
+		current: "k1",
+		keys: map[string][]byte{
+			"k1": bytes.Repeat([]byte{1}, 32),
+			"k2": bytes.Repeat([]byte{2}, 32),
+		},
+	}
+}
+
+func (p *staticKeyProvider) CurrentKeyID() string { return p.current }
+
+func (p *staticKeyProvider) Key(keyID string) ([]byte, error) {
+	key, ok := p.keys[keyID]
+	if !ok {
+		return nil, errors.New("unknown key")
+	}
+	return key, nil
+}
+
+func (p *staticKeyProvider) KeyIDs() []string {
+	keyIDs := make([]string, 0, len(p.keys))
+	for keyID := range p.keys {
+		keyIDs = append(keyIDs, keyID)
+	}
+	return keyIDs
+}
+
+func TestFieldEncryptorRoundTrip(t *testing.T) {
+	keys := newTestKeyProvider()
+	encryptor := newFieldEncryptor(keys)
+	randomized := forma.AttributeMetadata{AttributeName: "contact.annualIncome", AttributeID: 3, ValueType: forma.ValueTypeNumeric, Encryption: forma.EncryptionModeRandomized}
+	deterministic := forma.AttributeMetadata{AttributeName: "contact.primaryPhone", AttributeID: 22, ValueType: forma.ValueTypeText, Encryption: forma.EncryptionModeDeterministic}
+
+	income := 8500000.5
+	record := EAVRecord{AttrID: 3, ValueNumeric: &income}
+	if err := encryptor.encryptRecord(randomized, 7, &record); err != nil {
+		t.Fatalf("encrypt failed: %v", err)
+	}
+	if record.ValueNumeric != nil || record.ValueText == nil || !strings.HasPrefix(*record.ValueText, "enc:v1:r:k1:") {
+		t.Fatalf("expected randomized ciphertext in value_text, got %+v", record)
+	}
+	again := EAVRecord{AttrID: 3, ValueNumeric: &income}
+	if err := encryptor.encryptRecord(randomized, 7, &again); err != nil {
+		t.Fatalf("encrypt failed: %v", err)
+	}
+	if *again.ValueText == *record.ValueText {
+		t.Fatalf("randomized encryption must not repeat ciphertexts")
+	}
+
+	keys.current = "k2"
+	if err := encryptor.decryptRecord(randomized, 7, &record); err != nil {
+		t.Fatalf("decrypt after rotation failed: %v", err)
+	}
+	if record.ValueText != nil || record.ValueNumeric == nil || *record.ValueNumeric != income {
+		t.Fatalf("expected numeric value restored, got %+v", record)
+	}
+	keys.current = "k1"
+
+	phone := "090-1234-5678"
+	first := EAVRecord{AttrID: 22, ValueText: &phone}
+	second := EAVRecord{AttrID: 22, ValueText: &phone}
+	if err := encryptor.encryptRecord(deterministic, 7, &first); err != nil {
+		t.Fatalf("encrypt failed: %v", err)
+	}
+	if err := encryptor.encryptRecord(deterministic, 7, &second); err != nil {
+		t.Fatalf("encrypt failed: %v", err)
+	}
+	if *first.ValueText != *second.ValueText {
+		t.Fatalf("deterministic encryption must repeat ciphertexts")
+	}
+
+	moved := first
+	moved.AttrID = 23
+	if err := encryptor.decryptRecord(forma.AttributeMetadata{AttributeName: "contact.wechatId", AttributeID: 23}, 7, &moved); err == nil {
+		t.Fatalf("expected ciphertext bound to its attribute")
+	}
+
+	legacy := "plain"
+	plain := EAVRecord{AttrID: 22, ValueText: &legacy}
+	if err := encryptor.decryptRecord(deterministic, 7, &plain); err != nil || *plain.ValueText != "plain" {
+		t.Fatalf("expected plaintext written before encryption to pass through, got %v", err)
+	}
+
+	if err := newFieldEncryptor(nil).encryptRecord(deterministic, 7, &EAVRecord{AttrID: 22, ValueText: &phone}); err == nil {
+		t.Fatalf("expected missing key provider to fail closed")
+	}
+}
+
+func TestPersistentRecordTransformer_EncryptedAttributes(t *testing.T) {
+	ctx := context.Background()
+	registry, err := newFileSchemaRegistryFromDir("../cmd/server/schemas")
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+	schemaID, cache, err := registry.GetSchemaAttributeCacheByName("lead")
+	if err != nil {
+		t.Fatalf("failed to get schema: %v", err)
+	}
+	transformer := NewPersistentRecordTransformerWithOptions(registry, TransformerOptions{KeyProvider: newTestKeyProvider()})
+
+	data := leadPayload(uuid.New().String())
+	data["contact"] = map[string]any{
+		"name":         "Encrypted Lead",
+		"primaryPhone": "090-1234-5678",
+		"phones":       []any{"090-1234-5678", "03-1234-5678"},
+		"annualIncome": 8500000.0,
+		"birthday":     "1990-04-01",
+	}
+	record, err := transformer.ToPersistentRecord(ctx, schemaID, uuid.New(), data)
+	if err != nil {
+		t.Fatalf("ToPersistentRecord failed: %v", err)
+	}
+
+	encrypted := 0
+	for _, attr := range record.OtherAttributes {
+		if attr.AttrID == cache["contact.name"].AttributeID {
+			if attr.ValueText == nil || *attr.ValueText != "Encrypted Lead" {
+				t.Fatalf("unencrypted attribute must stay plaintext, got %v", attr.ValueText)
+			}
+			continue
+		}
+		for _, name := range []string{"contact.primaryPhone", "contact.phones", "contact.annualIncome", "contact.birthday"} {
+			if attr.AttrID != cache[name].AttributeID {
+				continue
+			}
+			encrypted++
+			if attr.ValueNumeric != nil || attr.ValueText == nil || !strings.HasPrefix(*attr.ValueText, encryptedValuePrefix) {
+				t.Fatalf("expected %s to be stored encrypted, got %+v", name, attr)
+			}
+			if strings.Contains(*attr.ValueText, "1234") {
+				t.Fatalf("ciphertext of %s leaks plaintext: %s", name, *attr.ValueText)
+			}
+		}
+	}
+	if encrypted != 5 {
+		t.Fatalf("expected 5 encrypted EAV rows, got %d", encrypted)
+	}
+
+	restored, err := transformer.FromPersistentRecord(ctx, record)
+	if err != nil {
+		t.Fatalf("FromPersistentRecord failed: %v", err)
+	}
+	contact := restored["contact"].(map[string]any)
+	if contact["primaryPhone"] != "090-1234-5678" || contact["annualIncome"] != 8500000.0 {
+		t.Fatalf("expected decrypted contact, got %v", contact)
+	}
+	if phones, _ := contact["phones"].([]any); len(phones) != 2 || phones[1] != "03-1234-5678" {
+		t.Fatalf("expected decrypted phones, got %v", contact["phones"])
+	}
+
+	if _, err := NewPersistentRecordTransformer(registry).ToPersistentRecord(ctx, schemaID, uuid.New(), data); err == nil {
+		t.Fatalf("expected writing encrypted attributes without a key provider to fail")
+	}
+}
+
+func TestPersistentRecordTransformer_ToStorageCondition(t *testing.T) {
+	registry, err := newFileSchemaRegistryFromDir("../cmd/server/schemas")
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+	schemaID, cache, err := registry.GetSchemaAttributeCacheByName("lead")
+	if err != nil {
+		t.Fatalf("failed to get schema: %v", err)
+	}
+	keys := &staticKeyProvider{current: "k1", keys: map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}}
+	transformer := NewPersistentRecordTransformerWithOptions(registry, TransformerOptions{KeyProvider: keys})
+
+	plain := &forma.CompositeCondition{Logic: forma.LogicAnd, Conditions: []forma.Condition{
+		&forma.KvCondition{Attr: "status", Value: "equals:open"},
+	}}
+	got, err := transformer.ToStorageCondition(schemaID, plain)
+	if err != nil || got != plain {
+		t.Fatalf("expected conditions without encrypted attributes to pass through, got %v, %v", got, err)
+	}
+
+	phoneFilter := &forma.KvCondition{Attr: "contact.primaryPhone", Value: "090-1234-5678"}
+	mixed := &forma.CompositeCondition{Logic: forma.LogicAnd, Conditions: []forma.Condition{plain.Conditions[0], phoneFilter}}
+	got, err = transformer.ToStorageCondition(schemaID, mixed)
+	if err != nil {
+		t.Fatalf("ToStorageCondition failed: %v", err)
+	}
+	rewritten := got.(*forma.CompositeCondition)
+	if rewritten == mixed || rewritten.Conditions[0] != plain.Conditions[0] {
+		t.Fatalf("expected a copy that keeps plaintext conditions")
+	}
+	data := leadPayload(uuid.New().String())
+	data["contact"] = map[string]any{"name": "Filtered Lead", "primaryPhone": "090-1234-5678"}
+	record, err := transformer.ToPersistentRecord(context.Background(), schemaID, uuid.New(), data)
+	if err != nil {
+		t.Fatalf("ToPersistentRecord failed: %v", err)
+	}
+	var stored string
+	for _, attr := range record.OtherAttributes {
+		if attr.AttrID == cache["contact.primaryPhone"].AttributeID {
+			stored = *attr.ValueText
+		}
+	}
+	if value := rewritten.Conditions[1].(*forma.KvCondition).Value; value != "equals:"+stored {
+		t.Fatalf("expected filter to match stored ciphertext, got %s want equals:%s", value, stored)
+	}
+	if phoneFilter.Value != "090-1234-5678" {
+		t.Fatalf("caller condition must not be modified")
+	}
+
+	for _, cond := range []*forma.KvCondition{
+		{Attr: "contact.primaryPhone", Value: "starts_with:090"},
+		{Attr: "contact.annualIncome", Value: "equals:100"},
+		{Attr: "contact.phones", Value: "gt:0"},
+	} {
+		if _, err := transformer.ToStorageCondition(schemaID, cond); !errors.Is(err, forma.ErrUnsupportedFilter) {
+			t.Fatalf("expected ErrUnsupportedFilter for %s %s, got %v", cond.Attr, cond.Value, err)
+		}
+	}
+}
+
+func TestPersistentRecordTransformer_ToStorageConditionAfterRotation(t *testing.T) {
+	registry, err := newFileSchemaRegistryFromDir("../cmd/server/schemas")
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+	schemaID, cache, err := registry.GetSchemaAttributeCacheByName("lead")
+	if err != nil {
+		t.Fatalf("failed to get schema: %v", err)
+	}
+	keys := newTestKeyProvider()
+	transformer := NewPersistentRecordTransformerWithOptions(registry, TransformerOptions{KeyProvider: keys})
+
+	data := leadPayload(uuid.New().String())
+	data["contact"] = map[string]any{"name": "Rotated Lead", "primaryPhone": "090-1234-5678"}
+	record, err := transformer.ToPersistentRecord(context.Background(), schemaID, uuid.New(), data)
+	if err != nil {
+		t.Fatalf("ToPersistentRecord failed: %v", err)
+	}
+	var stored string
+	for _, attr := range record.OtherAttributes {
+		if attr.AttrID == cache["contact.primaryPhone"].AttributeID {
+			stored = *attr.ValueText
+		}
+	}
+	if !strings.HasPrefix(stored, "enc:v1:d:k1:") {
+		t.Fatalf("expected the value to be stored under k1, got %s", stored)
+	}
+
+	// After rotating to k2 the filter must still match rows encrypted under k1.
+	keys.current = "k2"
+	for _, tt := range []struct {
+		op    string
+		logic forma.Logic
+	}{
+		{"equals", forma.LogicOr},
+		{"not_equals", forma.LogicAnd},
+	} {
+		got, err := transformer.ToStorageCondition(schemaID, &forma.KvCondition{Attr: "contact.primaryPhone", Value: tt.op + ":090-1234-5678"})
+		if err != nil {
+			t.Fatalf("ToStorageCondition failed: %v", err)
+		}
+		composite, ok := got.(*forma.CompositeCondition)
+		if !ok || composite.Logic != tt.logic || len(composite.Conditions) != 2 {
+			t.Fatalf("expected %s over both keys for %s, got %+v", tt.logic, tt.op, got)
+		}
+		if value := composite.Conditions[0].(*forma.KvCondition).Value; !strings.HasPrefix(value, tt.op+":enc:v1:d:k2:") {
+			t.Fatalf("expected the current key first, got %s", value)
+		}
+		if value := composite.Conditions[1].(*forma.KvCondition).Value; value != tt.op+":"+stored {
+			t.Fatalf("expected the retired key to match the stored ciphertext, got %s want %s:%s", value, tt.op, stored)
+		}
+	}
+}
+
+func TestNewFileKeyProvider(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "keys.json")
+	key := "AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE="
+	if err := os.WriteFile(path, []byte(`{"currentKeyId":"2026-10","keys":{"2026-10":"`+key+`"}}`), 0o600); err != nil {
+		t.Fatalf("write key file: %v", err)
+	}
+
+	provider, err := NewFileKeyProvider(path)
+	if err != nil {
+		t.Fatalf("NewFileKeyProvider failed: %v", err)
+	}
+	if provider.CurrentKeyID() != "2026-10" {
+		t.Fatalf("unexpected current key %q", provider.CurrentKeyID())
+	}
+	if got, err := provider.Key("2026-10"); err != nil || !bytes.Equal(got, bytes.Repeat([]byte{1}, 32)) {
+		t.Fatalf("unexpected key %v, %v", got, err)
+	}
+	if _, err := provider.Key("missing"); err == nil {
+		t.Fatalf("expected unknown key error")
+	}
+
+	if err := os.WriteFile(path, []byte(`{"currentKeyId":"other","keys":{"2026-10":"`+key+`"}}`), 0o600); err != nil {
+		t.Fatalf("write key file: %v", err)
+	}
+	if _, err := NewFileKeyProvider(path); err == nil {
+		t.Fatalf("expected missing current key to be rejected")
+	}
+}
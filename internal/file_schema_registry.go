@@ -6,8 +6,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"sort"
 	"sync"
+	"weak"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/lychee-technology/forma"
@@ -26,6 +29,14 @@ type fileSchemaRegistry struct {
 	idToName              map[int16]string
 	schemaAttributeCaches map[int16]forma.SchemaAttributeCache
 	schemas               map[int16]forma.JSONSchema
+	reloadCallbacks       []reloadCallback
+	nextReloadCallback    uint64
+}
+
+// reloadCallback is a func registered with OnReload, identified so that it can be unregistered.
+type reloadCallback struct {
+	id uint64
+	fn func()
 }
 
 // NewFileSchemaRegistry creates a new schema registry that reads schema mappings
@@ -153,9 +164,15 @@ func parseJSONSchemaFile(data []byte, schemaID int16, schemaName string) (forma.
 		ID:         schemaID,
 		Name:       schemaName,
 		Schema:     string(data),
+		Version:    1,
 		Properties: make(map[string]*forma.PropertySchema),
 	}
 
+	// Schema files declare their revision with an optional top-level "x-version"
+	if version, ok := rawSchema["x-version"].(float64); ok && version >= 1 {
+		jsonSchema.Version = int(version)
+	}
+
 	// Parse required fields
 	if required, ok := rawSchema["required"].([]any); ok {
 		for _, r := range required {
@@ -184,18 +201,34 @@ func parseJSONSchemaFile(data []byte, schemaID int16, schemaName string) (forma.
 
 // parsePropertySchema parses a single property from JSON Schema
 func parsePropertySchema(name string, prop map[string]any, defs map[string]any, requiredFields []string) *forma.PropertySchema {
+	// Write-protection markers and x-relation may sit next to a $ref, so read them before resolving it
+	readOnly, _ := prop["readOnly"].(bool)
+	immutable, _ := prop["x-immutable"].(bool)
+	relation, hasRelation := prop["x-relation"].(map[string]any)
+
+	schema := &forma.PropertySchema{
+		Name: name,
+	}
+
 	// Handle $ref
 	if ref, ok := prop["$ref"].(string); ok {
-		// Resolve $ref (e.g., "#/$defs/id")
+		// Resolve $ref (e.g., "#/$defs/id"); references into other schema files are kept as is
 		resolved := resolveRef(ref, defs)
 		if resolved != nil {
 			prop = resolved
+		} else {
+			schema.Ref = ref
 		}
 	}
 
-	schema := &forma.PropertySchema{
-		Name: name,
+	if v, ok := prop["readOnly"].(bool); ok && v {
+		readOnly = true
+	}
+	if v, ok := prop["x-immutable"].(bool); ok && v {
+		immutable = true
 	}
+	schema.ReadOnly = readOnly
+	schema.Immutable = immutable
 
 	// Check if this field is required
 	for _, r := range requiredFields {
@@ -249,7 +282,10 @@ func parsePropertySchema(name string, prop map[string]any, defs map[string]any,
 	}
 
 	// Parse x-relation
-	if relation, ok := prop["x-relation"].(map[string]any); ok {
+	if !hasRelation {
+		relation, hasRelation = prop["x-relation"].(map[string]any)
+	}
+	if hasRelation {
 		schema.Relation = &forma.RelationSchema{}
 		if target, ok := relation["target"].(string); ok {
 			schema.Relation.Target = target
@@ -398,6 +434,72 @@ func (r *fileSchemaRegistry) GetSchemaByID(id int16) (string, forma.JSONSchema,
 	return name, schema, nil
 }
 
+// Reload re-reads the schemas from the schema table or directory, replaces the current ones and
+// then calls the OnReload callbacks. On error the current schemas are kept.
+func (r *fileSchemaRegistry) Reload() error {
+	fresh := &fileSchemaRegistry{
+		pool:                  r.pool,
+		schemaTable:           r.schemaTable,
+		schemaDir:             r.schemaDir,
+		nameToID:              make(map[string]int16),
+		idToName:              make(map[int16]string),
+		schemaAttributeCaches: make(map[int16]forma.SchemaAttributeCache),
+		schemas:               make(map[int16]forma.JSONSchema),
+	}
+	load := fresh.loadSchemasFromDirectory
+	if r.pool != nil {
+		load = fresh.loadSchemasFromDB
+	}
+	if err := load(); err != nil {
+		return fmt.Errorf("failed to reload schemas: %w", err)
+	}
+
+	r.mu.Lock()
+	r.nameToID = fresh.nameToID
+	r.idToName = fresh.idToName
+	r.schemaAttributeCaches = fresh.schemaAttributeCaches
+	r.schemas = fresh.schemas
+	callbacks := append([]reloadCallback{}, r.reloadCallbacks...)
+	r.mu.Unlock()
+
+	for _, callback := range callbacks {
+		callback.fn()
+	}
+	return nil
+}
+
+// OnReload registers fn to be called after every successful Reload and returns a func that
+// removes it.
+func (r *fileSchemaRegistry) OnReload(fn func()) func() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextReloadCallback++
+	id := r.nextReloadCallback
+	r.reloadCallbacks = append(r.reloadCallbacks, reloadCallback{id: id, fn: fn})
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.reloadCallbacks = slices.DeleteFunc(r.reloadCallbacks, func(c reloadCallback) bool { return c.id == id })
+	}
+}
+
+// onReloadWhileReachable calls fn with target after every reload of registry, as long as target is
+// reachable. The registry holds target only weakly, so state derived from a long-lived registry is
+// released, and its callback unregistered, once its owner is collected.
+func onReloadWhileReachable[T any](registry forma.SchemaRegistry, target *T, fn func(*T)) {
+	reloadable, ok := registry.(forma.ReloadableSchemaRegistry)
+	if !ok {
+		return
+	}
+	ref := weak.Make(target)
+	unregister := reloadable.OnReload(func() {
+		if t := ref.Value(); t != nil {
+			fn(t)
+		}
+	})
+	runtime.AddCleanup(target, func(unregister func()) { unregister() }, unregister)
+}
+
 func hasSuffix(name, suffix string) bool {
 	suffixLen := len(suffix)
 	return len(name) > suffixLen && name[len(name)-suffixLen:] == suffix
@@ -447,6 +549,12 @@ func parseFileAttributeMetadata(attrName string, attrData map[string]any, source
 		meta.ColumnBinding = binding
 	}
 
+	encryption, err := parseEncryptionMode(attrName, attrData, meta.ColumnBinding, source)
+	if err != nil {
+		return forma.AttributeMetadata{}, err
+	}
+	meta.Encryption = encryption
+
 	return meta, nil
 }
 
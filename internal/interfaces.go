@@ -22,6 +22,7 @@ type PersistentRecord struct {
 	CreatedAt       int64
 	UpdatedAt       int64
 	DeletedAt       *int64
+	Revision        int64
 	OtherAttributes []EAVRecord // EAV attributes not in hot table
 }
 
@@ -41,12 +42,23 @@ type Transformer interface {
 type PersistentRecordTransformer interface {
 	ToPersistentRecord(ctx context.Context, schemaID int16, rowID uuid.UUID, jsonData any) (*PersistentRecord, error)
 	FromPersistentRecord(ctx context.Context, record *PersistentRecord) (map[string]any, error)
+	// ToStorageCondition rewrites filter values on encrypted attributes into their stored form.
+	ToStorageCondition(schemaID int16, condition forma.Condition) (forma.Condition, error)
 }
 
 type StorageTables struct {
-	EntityMain string
-	EAVData    string
-	ChangeLog  string
+	EntityMain      string
+	EAVData         string
+	ChangeLog       string
+	IdempotencyKeys string
+	History         string
+	NotifyChannel   string
+	// WebhookDeliveries is the webhook delivery log and queue.
+	WebhookDeliveries string
+	// ChangeCursors stores the change log position of consumers that read it without flushing.
+	ChangeCursors string
+	// Outbox receives a row per affected entity in the transaction of every write.
+	Outbox string
 }
 
 type PersistentRecordQuery struct {
@@ -56,6 +68,10 @@ type PersistentRecordQuery struct {
 	AttributeOrders []AttributeOrder
 	Limit           int
 	Offset          int
+	IncludeDeleted  bool
+	// AsOf (unix milliseconds) evaluates the query against the entity states recorded in
+	// Tables.History at that time instead of the current rows.
+	AsOf *int64
 }
 
 type PersistentRecordPage struct {
@@ -69,6 +85,55 @@ type PersistentRecordRepository interface {
 	InsertPersistentRecord(ctx context.Context, tables StorageTables, record *PersistentRecord) error
 	UpdatePersistentRecord(ctx context.Context, tables StorageTables, record *PersistentRecord) error
 	DeletePersistentRecord(ctx context.Context, tables StorageTables, schemaID int16, rowID uuid.UUID) error
+	SoftDeletePersistentRecord(ctx context.Context, tables StorageTables, schemaID int16, rowID uuid.UUID) error
+	RestorePersistentRecord(ctx context.Context, tables StorageTables, schemaID int16, rowID uuid.UUID) error
+	PurgePersistentRecords(ctx context.Context, tables StorageTables, schemaID int16, deletedBefore int64) (int64, error)
 	GetPersistentRecord(ctx context.Context, tables StorageTables, schemaID int16, rowID uuid.UUID) (*PersistentRecord, error)
+	GetPersistentRecordAsOf(ctx context.Context, tables StorageTables, schemaID int16, rowID uuid.UUID, asOf int64) (*PersistentRecord, error)
 	QueryPersistentRecords(ctx context.Context, query *PersistentRecordQuery) (*PersistentRecordPage, error)
+	RunInTx(ctx context.Context, fn func(ctx context.Context) error) error
+	RunInTxWithOptions(ctx context.Context, opts TxOptions, fn func(ctx context.Context) error) error
+	BulkInsertPersistentRecords(ctx context.Context, tables StorageTables, records []*PersistentRecord) error
+	CountPersistentRecordsWhere(ctx context.Context, tables StorageTables, schemaID int16, condition forma.Condition) (int64, error)
+	UpdatePersistentRecordsWhere(ctx context.Context, tables StorageTables, schemaID int16, condition forma.Condition, patch *PersistentRecord) (int64, error)
+	DeletePersistentRecordsWhere(ctx context.Context, tables StorageTables, schemaID int16, condition forma.Condition, soft bool) (int64, error)
+	GetIdempotencyRecord(ctx context.Context, tables StorageTables, schemaID int16, key string) (*IdempotencyRecord, error)
+	SaveIdempotencyRecord(ctx context.Context, tables StorageTables, record *IdempotencyRecord) (bool, error)
+	ListHistory(ctx context.Context, tables StorageTables, schemaID int16, rowID uuid.UUID) ([]*HistoryRecord, error)
+	LeaseChanges(ctx context.Context, tables StorageTables, schemaID int16, limit int) ([]*ChangeLogEntry, error)
+	MarkChangesFlushed(ctx context.Context, tables StorageTables, entries []*ChangeLogEntry) (int64, error)
+	ListChangesSince(ctx context.Context, tables StorageTables, schemaID int16, since int64, afterRowID uuid.UUID) ([]*ChangeLogEntry, error)
+	LockChangeCursor(ctx context.Context, tables StorageTables, consumer string) (*ChangeCursor, error)
+	SaveChangeCursor(ctx context.Context, tables StorageTables, consumer string, cursor *ChangeCursor) error
+	ListChangesAfter(ctx context.Context, tables StorageTables, cursor *ChangeCursor, limit int) ([]*ChangeLogEntry, error)
+	SubscribeChanges(ctx context.Context, tables StorageTables) (ChangeSubscription, error)
+	PersistentRecordMatches(ctx context.Context, tables StorageTables, schemaID int16, rowID uuid.UUID, condition forma.Condition) (bool, error)
+	InsertWebhookDeliveries(ctx context.Context, tables StorageTables, deliveries []*WebhookDeliveryRecord) error
+	LeaseWebhookDeliveries(ctx context.Context, tables StorageTables, limit int, leaseUntil int64) ([]*WebhookDeliveryRecord, error)
+	UpdateWebhookDelivery(ctx context.Context, tables StorageTables, delivery *WebhookDeliveryRecord) error
+	ListWebhookDeliveries(ctx context.Context, tables StorageTables, filter WebhookDeliveryQuery) ([]*WebhookDeliveryRecord, error)
+	LeaseOutbox(ctx context.Context, tables StorageTables, limit int) ([]*OutboxRecord, error)
+	MarkOutboxDispatched(ctx context.Context, tables StorageTables, ids []int64) (int64, error)
+}
+
+// ChangeSubscription delivers the change notifications sent after it was opened.
+type ChangeSubscription interface {
+	Next(ctx context.Context) (*ChangeNotification, error)
+	Close()
+}
+
+// TxOptions configures a transaction started by RunInTxWithOptions.
+type TxOptions struct {
+	// IsolationLevel uses the TransactionConfig.IsolationLevel spelling, e.g. "READ_COMMITTED".
+	// Empty uses the database default.
+	IsolationLevel string
+}
+
+// IdempotencyRecord is the stored outcome of a create made with an idempotency key.
+type IdempotencyRecord struct {
+	SchemaID    int16
+	Key         string
+	RequestHash string
+	Response    []byte
+	ExpiresAt   int64
 }
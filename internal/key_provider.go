@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/lychee-technology/forma"
+)
+
+// fileKeyProvider serves key-encryption keys loaded from a local JSON key file.
+type fileKeyProvider struct {
+	currentKeyID string
+	keys         map[string][]byte
+}
+
+// keyFile is the on-disk format read by NewFileKeyProvider:
+//
+//	{"currentKeyId": "2026-10", "keys": {"2026-10": "<base64 of 32 random bytes>"}}
+//
+// Retired keys stay in "keys" so values encrypted under them can still be read.
+type keyFile struct {
+	CurrentKeyID string            `json:"currentKeyId"`
+	Keys         map[string]string `json:"keys"`
+}
+
+// NewFileKeyProvider loads a KeyProvider from a local key file.
+func NewFileKeyProvider(path string) (forma.KeyProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read key file: %w", err)
+	}
+
+	var file keyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse key file %s: %w", path, err)
+	}
+
+	provider := &fileKeyProvider{
+		currentKeyID: file.CurrentKeyID,
+		keys:         make(map[string][]byte, len(file.Keys)),
+	}
+	for keyID, encoded := range file.Keys {
+		if keyID == "" || strings.Contains(keyID, ":") {
+			return nil, fmt.Errorf("invalid key ID %q in %s", keyID, path)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("decode key %s in %s: %w", keyID, path, err)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key %s in %s must be 32 bytes, got %d", keyID, path, len(key))
+		}
+		provider.keys[keyID] = key
+	}
+	if _, ok := provider.keys[provider.currentKeyID]; !ok {
+		return nil, fmt.Errorf("current key %q is not defined in %s", provider.currentKeyID, path)
+	}
+
+	return provider, nil
+}
+
+func (p *fileKeyProvider) CurrentKeyID() string {
+	return p.currentKeyID
+}
+
+func (p *fileKeyProvider) Key(keyID string) ([]byte, error) {
+	key, ok := p.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", keyID)
+	}
+	return key, nil
+}
+
+func (p *fileKeyProvider) KeyIDs() []string {
+	keyIDs := make([]string, 0, len(p.keys))
+	for keyID := range p.keys {
+		keyIDs = append(keyIDs, keyID)
+	}
+	sort.Strings(keyIDs)
+	return keyIDs
+}
@@ -39,9 +39,34 @@ func parseAttributeMetadata(attrName string, attrData map[string]any, source str
 
 	meta.ColumnBinding = binding
 
+	encryption, err := parseEncryptionMode(attrName, attrData, binding, source)
+	if err != nil {
+		return forma.AttributeMetadata{}, err
+	}
+	meta.Encryption = encryption
+
 	return meta, nil
 }
 
+// parseEncryptionMode reads the optional "encryption" entry written for x-encrypted attributes.
+// Encrypted values are ciphertext strings, so they can only live in the EAV value_text column.
+func parseEncryptionMode(attrName string, attrData map[string]any, binding *forma.MainColumnBinding, source string) (forma.EncryptionMode, error) {
+	raw, ok := attrData["encryption"]
+	if !ok {
+		return "", nil
+	}
+	mode, _ := raw.(string)
+	switch forma.EncryptionMode(mode) {
+	case forma.EncryptionModeRandomized, forma.EncryptionModeDeterministic:
+	default:
+		return "", fmt.Errorf("invalid encryption mode %v for attribute %s in %s", raw, attrName, source)
+	}
+	if binding != nil {
+		return "", fmt.Errorf("encrypted attribute %s cannot use a column_binding in %s", attrName, source)
+	}
+	return forma.EncryptionMode(mode), nil
+}
+
 func extractMainColumnBinding(attrName string, attrData map[string]any, source string) (*forma.MainColumnBinding, error) {
 	if raw, ok := attrData["column_binding"].(map[string]any); ok {
 		return parseBindingObject(attrName, raw, source)
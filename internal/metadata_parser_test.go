@@ -100,6 +100,42 @@ func TestParseAttributeMetadata(t *testing.T) {
 			},
 			expectErr: "columnName",
 		},
+		{
+			name:     "success with encryption mode",
+			attrName: "contact.primaryPhone",
+			attrData: map[string]any{
+				"attributeID": 6.0,
+				"valueType":   "text",
+				"encryption":  "deterministic",
+			},
+			expect: func(t *testing.T, meta forma.AttributeMetadata) {
+				assert.Equal(t, forma.EncryptionModeDeterministic, meta.Encryption)
+				assert.True(t, meta.IsEncrypted())
+			},
+		},
+		{
+			name:     "error unknown encryption mode",
+			attrName: "badEncryption",
+			attrData: map[string]any{
+				"attributeID": 7.0,
+				"valueType":   "text",
+				"encryption":  "rot13",
+			},
+			expectErr: "encryption mode",
+		},
+		{
+			name:     "error encrypted attribute with binding",
+			attrName: "boundEncryption",
+			attrData: map[string]any{
+				"attributeID": 8.0,
+				"valueType":   "text",
+				"encryption":  "randomized",
+				"column_binding": map[string]any{
+					"col_name": "text_01",
+				},
+			},
+			expectErr: "column_binding",
+		},
 	}
 
 	for _, tt := range tests {
@@ -3,6 +3,7 @@ package internal
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -12,14 +13,31 @@ import (
 type persistentRecordTransformer struct {
 	registry        forma.SchemaRegistry
 	jsonTransformer Transformer
+	limits          DocumentLimits
+	encryptor       *fieldEncryptor
 	*schemaMetadataCache
 }
 
+// TransformerOptions configures optional behavior of a PersistentRecordTransformer.
+type TransformerOptions struct {
+	// Limits rejects oversized documents with a *forma.LimitError.
+	Limits DocumentLimits
+	// KeyProvider encrypts x-encrypted attributes. Without it, writing such attributes fails.
+	KeyProvider forma.KeyProvider
+}
+
 // NewPersistentRecordTransformer creates a new PersistentRecordTransformer instance
 func NewPersistentRecordTransformer(registry forma.SchemaRegistry) PersistentRecordTransformer {
+	return NewPersistentRecordTransformerWithOptions(registry, TransformerOptions{})
+}
+
+// NewPersistentRecordTransformerWithOptions creates a PersistentRecordTransformer configured by opts.
+func NewPersistentRecordTransformerWithOptions(registry forma.SchemaRegistry, opts TransformerOptions) PersistentRecordTransformer {
 	return &persistentRecordTransformer{
 		registry:            registry,
 		jsonTransformer:     NewTransformer(registry),
+		limits:              opts.Limits,
+		encryptor:           newFieldEncryptor(opts.KeyProvider),
 		schemaMetadataCache: newSchemaMetadataCache(registry),
 	}
 }
@@ -29,6 +47,12 @@ func (t *persistentRecordTransformer) ToPersistentRecord(ctx context.Context, sc
 		return nil, fmt.Errorf("jsonData cannot be nil")
 	}
 
+	if t.limits.enabled() {
+		if err := t.limits.checkDocument(jsonData); err != nil {
+			return nil, err
+		}
+	}
+
 	// First convert to EntityAttributes using existing transformer logic
 	entityAttributes, err := t.jsonTransformer.ToAttributes(ctx, schemaID, rowID, jsonData)
 	if err != nil {
@@ -88,10 +112,19 @@ func (t *persistentRecordTransformer) ToPersistentRecord(ctx context.Context, sc
 				return nil, fmt.Errorf("failed to store attribute %s in main column: %w", attrName, err)
 			}
 		} else {
+			if meta.IsEncrypted() {
+				if err := t.encryptor.encryptRecord(meta, schemaID, &eavRecord); err != nil {
+					return nil, fmt.Errorf("failed to encrypt attribute %s: %w", attrName, err)
+				}
+			}
 			record.OtherAttributes = append(record.OtherAttributes, eavRecord)
 		}
 	}
 
+	if err := t.limits.checkEAVRows(len(record.OtherAttributes)); err != nil {
+		return nil, err
+	}
+
 	return record, nil
 }
 
@@ -101,7 +134,7 @@ func (t *persistentRecordTransformer) FromPersistentRecord(ctx context.Context,
 	}
 
 	// Get schema metadata
-	cache, _, err := t.getSchemaMetadata(record.SchemaID)
+	cache, idToName, err := t.getSchemaMetadata(record.SchemaID)
 	if err != nil {
 		return nil, err
 	}
@@ -124,8 +157,15 @@ func (t *persistentRecordTransformer) FromPersistentRecord(ctx context.Context,
 		}
 	}
 
-	// Add EAV attributes
-	attributes = append(attributes, record.OtherAttributes...)
+	// Add EAV attributes, decrypting copies of encrypted values
+	for _, eavRecord := range record.OtherAttributes {
+		if attrName, ok := idToName[eavRecord.AttrID]; ok && cache[attrName].IsEncrypted() {
+			if err := t.encryptor.decryptRecord(cache[attrName], record.SchemaID, &eavRecord); err != nil {
+				return nil, err
+			}
+		}
+		attributes = append(attributes, eavRecord)
+	}
 
 	// Convert EAVRecords to EntityAttributes
 	converter := NewAttributeConverter(t.registry)
@@ -143,11 +183,89 @@ func (t *persistentRecordTransformer) FromPersistentRecord(ctx context.Context,
 	return result, nil
 }
 
+func (t *persistentRecordTransformer) ToStorageCondition(schemaID int16, condition forma.Condition) (forma.Condition, error) {
+	if condition == nil {
+		return nil, nil
+	}
+	cache, _, err := t.getSchemaMetadata(schemaID)
+	if err != nil {
+		return nil, err
+	}
+	return t.storageCondition(schemaID, cache, condition)
+}
+
+// storageCondition replaces values compared with encrypted attributes by their deterministic
+// ciphertext under every decryptable key. Only equals and not_equals can be evaluated on ciphertext. Conditions without
+// encrypted attributes are returned as is; the caller's condition is never modified.
+func (t *persistentRecordTransformer) storageCondition(schemaID int16, cache forma.SchemaAttributeCache, condition forma.Condition) (forma.Condition, error) {
+	switch cond := condition.(type) {
+	case *forma.CompositeCondition:
+		var rewritten []forma.Condition
+		for i, child := range cond.Conditions {
+			storageChild, err := t.storageCondition(schemaID, cache, child)
+			if err != nil {
+				return nil, err
+			}
+			if storageChild != child && rewritten == nil {
+				rewritten = append(make([]forma.Condition, 0, len(cond.Conditions)), cond.Conditions[:i]...)
+			}
+			if rewritten != nil {
+				rewritten = append(rewritten, storageChild)
+			}
+		}
+		if rewritten == nil {
+			return cond, nil
+		}
+		return &forma.CompositeCondition{Logic: cond.Logic, Conditions: rewritten}, nil
+	case *forma.KvCondition:
+		meta, ok := cache[cond.Attr]
+		if !ok || !meta.IsEncrypted() {
+			return cond, nil
+		}
+		if meta.Encryption != forma.EncryptionModeDeterministic {
+			return nil, fmt.Errorf("%w: attribute '%s' uses randomized encryption and cannot be filtered", forma.ErrUnsupportedFilter, cond.Attr)
+		}
+
+		opStr, valStr := "equals", cond.Value
+		if parts := strings.SplitN(cond.Value, ":", 2); len(parts) == 2 {
+			opStr, valStr = parts[0], parts[1]
+		}
+		if opStr != "equals" && opStr != "not_equals" {
+			return nil, fmt.Errorf("%w: operator '%s' is not supported for encrypted attribute '%s'", forma.ErrUnsupportedFilter, opStr, cond.Attr)
+		}
+
+		value, err := filterValueRecord(meta, valStr)
+		if err != nil {
+			return nil, err
+		}
+		ciphertexts, err := t.encryptor.encryptFilterValues(meta, schemaID, value)
+		if err != nil {
+			return nil, err
+		}
+		if len(ciphertexts) == 1 {
+			return &forma.KvCondition{Attr: cond.Attr, Value: opStr + ":" + ciphertexts[0]}, nil
+		}
+		// A value matches under any key and differs only if it differs under every key.
+		logic := forma.LogicOr
+		if opStr == "not_equals" {
+			logic = forma.LogicAnd
+		}
+		keyed := make([]forma.Condition, 0, len(ciphertexts))
+		for _, ciphertext := range ciphertexts {
+			keyed = append(keyed, &forma.KvCondition{Attr: cond.Attr, Value: opStr + ":" + ciphertext})
+		}
+		return &forma.CompositeCondition{Logic: logic, Conditions: keyed}, nil
+	default:
+		return condition, nil
+	}
+}
+
 func (t *persistentRecordTransformer) storeInMainColumn(record *PersistentRecord, attr EAVRecord, binding *forma.MainColumnBinding) error {
 	// Ignore system column bindings - system columns can only be set internally by code
 	switch binding.ColumnName {
 	case forma.MainColumnRowID, forma.MainColumnSchemaID,
-		forma.MainColumnCreatedAt, forma.MainColumnUpdatedAt, forma.MainColumnDeletedAt:
+		forma.MainColumnCreatedAt, forma.MainColumnUpdatedAt, forma.MainColumnDeletedAt,
+		forma.MainColumnRevision:
 		return nil
 	}
 
@@ -300,6 +418,11 @@ func (t *persistentRecordTransformer) readFromSystemColumn(record *PersistentRec
 		deletedAtFloat := float64(*record.DeletedAt)
 		baseAttr.ValueNumeric = &deletedAtFloat
 		return &baseAttr
+
+	case forma.MainColumnRevision:
+		revisionFloat := float64(record.Revision)
+		baseAttr.ValueNumeric = &revisionFloat
+		return &baseAttr
 	}
 
 	return nil
@@ -331,3 +331,72 @@ func TestPersistentRecordTransformer_InjectsBaseTimestamps(t *testing.T) {
 	require.True(t, ok)
 	assert.Equal(t, updated, updatedAt.UnixMilli())
 }
+
+func TestPersistentRecordTransformer_DocumentLimits(t *testing.T) {
+	ctx := context.Background()
+	registry := newPersistentTransformerRegistry()
+	schemaID, _, err := registry.GetSchemaAttributeCacheByName("persistent_test")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		limits DocumentLimits
+		data   map[string]any
+		code   string
+		path   string
+	}{
+		{
+			name:   "entity too large",
+			limits: DocumentLimits{MaxEntitySize: 32},
+			data:   map[string]any{"notes": "this note is well beyond thirty-two bytes"},
+			code:   forma.LimitCodeEntityTooLarge,
+		},
+		{
+			name:   "array too long",
+			limits: DocumentLimits{MaxArrayLength: 2},
+			data:   map[string]any{"tags": []any{"a", "b", "c"}},
+			code:   forma.LimitCodeArrayTooLong,
+			path:   "tags",
+		},
+		{
+			name:   "nesting too deep",
+			limits: DocumentLimits{MaxNestingDepth: 2},
+			data:   map[string]any{"jobs": []any{map[string]any{"title": "dev"}}},
+			code:   forma.LimitCodeNestingTooDeep,
+			path:   "jobs[0]",
+		},
+		{
+			name:   "too many EAV rows",
+			limits: DocumentLimits{MaxEAVRows: 2},
+			data:   map[string]any{"name": "Ada", "tags": []any{"a", "b", "c"}},
+			code:   forma.LimitCodeTooManyAttributes,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transformer := NewPersistentRecordTransformerWithOptions(registry, TransformerOptions{Limits: tt.limits})
+			_, err := transformer.ToPersistentRecord(ctx, schemaID, uuid.Must(uuid.NewV7()), tt.data)
+			require.ErrorIs(t, err, forma.ErrLimitExceeded)
+
+			var limitErr *forma.LimitError
+			require.ErrorAs(t, err, &limitErr)
+			assert.Equal(t, tt.code, limitErr.Code)
+			assert.Equal(t, tt.path, limitErr.Path)
+		})
+	}
+
+	transformer := NewPersistentRecordTransformerWithOptions(registry, TransformerOptions{Limits: DocumentLimits{
+		MaxEntitySize:   1024,
+		MaxEAVRows:      4,
+		MaxArrayLength:  3,
+		MaxNestingDepth: 3,
+	}})
+	record, err := transformer.ToPersistentRecord(ctx, schemaID, uuid.Must(uuid.NewV7()), map[string]any{
+		"name": "Ada",
+		"tags": []any{"a", "b", "c"},
+		"jobs": []any{map[string]any{"title": "dev"}},
+	})
+	require.NoError(t, err)
+	assert.Len(t, record.OtherAttributes, 4)
+}
@@ -3,6 +3,7 @@ package internal
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -31,6 +32,97 @@ func NewPostgresPersistentRecordRepository(pool persistentRecordPool, metadataCa
 	}
 }
 
+type txContextKey struct{}
+
+// withTx returns a context carrying tx so repository calls made with it join the transaction.
+func withTx(ctx context.Context, tx pgx.Tx) context.Context {
+	return context.WithValue(ctx, txContextKey{}, tx)
+}
+
+// txFromContext returns the transaction started by RunInTx, if any.
+func txFromContext(ctx context.Context) (pgx.Tx, bool) {
+	tx, ok := ctx.Value(txContextKey{}).(pgx.Tx)
+	return tx, ok && tx != nil
+}
+
+// rowQuerier is the read subset shared by the pool and pgx.Tx.
+type rowQuerier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// querier returns the transaction carried by ctx, falling back to the pool.
+func (r *PostgresPersistentRecordRepository) querier(ctx context.Context) rowQuerier {
+	if tx, ok := txFromContext(ctx); ok {
+		return tx
+	}
+	return r.pool
+}
+
+// beginTx starts a transaction for a single write. When ctx carries an outer transaction the
+// write runs in a savepoint, so its commit only becomes durable when the outer transaction commits.
+func (r *PostgresPersistentRecordRepository) beginTx(ctx context.Context) (pgx.Tx, error) {
+	if tx, ok := txFromContext(ctx); ok {
+		return tx.Begin(ctx)
+	}
+	return r.pool.BeginTx(ctx, pgx.TxOptions{})
+}
+
+// RunInTx runs fn inside a single database transaction. Repository calls made with the context
+// passed to fn join that transaction; it is committed when fn returns nil and rolled back otherwise.
+// Nested calls reuse the outer transaction.
+func (r *PostgresPersistentRecordRepository) RunInTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return r.RunInTxWithOptions(ctx, TxOptions{}, fn)
+}
+
+// RunInTxWithOptions is RunInTx with an explicit isolation level. Nested calls join the outer
+// transaction and keep its isolation level.
+func (r *PostgresPersistentRecordRepository) RunInTxWithOptions(ctx context.Context, opts TxOptions, fn func(ctx context.Context) error) error {
+	if _, ok := txFromContext(ctx); ok {
+		return fn(ctx)
+	}
+
+	txOptions, err := pgxTxOptions(opts)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.pool.BeginTx(ctx, txOptions)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(withTx(ctx, tx)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// pgxTxOptions maps TxOptions onto pgx, accepting "READ_COMMITTED" and "read committed" alike.
+func pgxTxOptions(opts TxOptions) (pgx.TxOptions, error) {
+	level := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(opts.IsolationLevel), "_", " "))
+	switch level {
+	case "":
+		return pgx.TxOptions{}, nil
+	case "serializable":
+		return pgx.TxOptions{IsoLevel: pgx.Serializable}, nil
+	case "repeatable read":
+		return pgx.TxOptions{IsoLevel: pgx.RepeatableRead}, nil
+	case "read committed":
+		return pgx.TxOptions{IsoLevel: pgx.ReadCommitted}, nil
+	case "read uncommitted":
+		return pgx.TxOptions{IsoLevel: pgx.ReadUncommitted}, nil
+	default:
+		return pgx.TxOptions{}, fmt.Errorf("unsupported isolation level %q", opts.IsolationLevel)
+	}
+}
+
 func (r *PostgresPersistentRecordRepository) withClock(now func() time.Time) {
 	if now == nil {
 		return
@@ -68,7 +160,7 @@ func (r *PostgresPersistentRecordRepository) insertChangeLog(ctx context.Context
 		`INSERT INTO %s (schema_id, row_id, flushed_at, changed_at, deleted_at)
 		VALUES ($1, $2, $3, $4, $5)
 		ON CONFLICT (schema_id, row_id, flushed_at)
-		DO UPDATE SET changed_at = EXCLUDED.changed_at, deleted_at = EXCLUDED.deleted_at`,
+		DO UPDATE SET changed_at = EXCLUDED.changed_at, deleted_at = EXCLUDED.deleted_at, tx_id = EXCLUDED.tx_id`,
 		sanitizeIdentifier(table),
 	)
 	var deleted any
@@ -92,8 +184,9 @@ func (r *PostgresPersistentRecordRepository) InsertPersistentRecord(ctx context.
 	now := r.nowMillis()
 	record.CreatedAt = now
 	record.UpdatedAt = now
+	record.Revision = 1
 
-	tx, err := r.pool.BeginTx(ctx, pgx.TxOptions{})
+	tx, err := r.beginTx(ctx)
 	if err != nil {
 		return fmt.Errorf("begin transaction: %w", err)
 	}
@@ -112,6 +205,21 @@ func (r *PostgresPersistentRecordRepository) InsertPersistentRecord(ctx context.
 			return err
 		}
 	}
+	if tables.History != "" {
+		if err := r.insertHistory(ctx, tx, tables, forma.HistoryOperationCreate, false, record.SchemaID, record.RowID, record.CreatedAt); err != nil {
+			return err
+		}
+	}
+	if tables.Outbox != "" {
+		if err := r.insertOutbox(ctx, tx, tables, forma.ChangeOperationCreated, false, record.SchemaID, record.RowID, record.CreatedAt); err != nil {
+			return err
+		}
+	}
+	if tables.NotifyChannel != "" {
+		if err := r.notifyChange(ctx, tx, tables, forma.ChangeOperationCreated, record.SchemaID, record.RowID, record.CreatedAt); err != nil {
+			return err
+		}
+	}
 
 	if err := tx.Commit(ctx); err != nil {
 		return fmt.Errorf("commit transaction: %w", err)
@@ -130,7 +238,7 @@ func (r *PostgresPersistentRecordRepository) UpdatePersistentRecord(ctx context.
 
 	record.UpdatedAt = r.nowMillis()
 
-	tx, err := r.pool.BeginTx(ctx, pgx.TxOptions{})
+	tx, err := r.beginTx(ctx)
 	if err != nil {
 		return fmt.Errorf("begin transaction: %w", err)
 	}
@@ -148,10 +256,26 @@ func (r *PostgresPersistentRecordRepository) UpdatePersistentRecord(ctx context.
 			return err
 		}
 	}
+	if tables.History != "" {
+		if err := r.insertHistory(ctx, tx, tables, forma.HistoryOperationUpdate, false, record.SchemaID, record.RowID, record.UpdatedAt); err != nil {
+			return err
+		}
+	}
+	if tables.Outbox != "" {
+		if err := r.insertOutbox(ctx, tx, tables, forma.ChangeOperationUpdated, false, record.SchemaID, record.RowID, record.UpdatedAt); err != nil {
+			return err
+		}
+	}
+	if tables.NotifyChannel != "" {
+		if err := r.notifyChange(ctx, tx, tables, forma.ChangeOperationUpdated, record.SchemaID, record.RowID, record.UpdatedAt); err != nil {
+			return err
+		}
+	}
 
 	if err := tx.Commit(ctx); err != nil {
 		return fmt.Errorf("commit transaction: %w", err)
 	}
+	record.Revision++
 
 	return nil
 }
@@ -161,12 +285,24 @@ func (r *PostgresPersistentRecordRepository) DeletePersistentRecord(ctx context.
 		return err
 	}
 
-	tx, err := r.pool.BeginTx(ctx, pgx.TxOptions{})
+	tx, err := r.beginTx(ctx)
 	if err != nil {
 		return fmt.Errorf("begin transaction: %w", err)
 	}
 	defer tx.Rollback(ctx)
 
+	now := r.nowMillis()
+	if tables.History != "" {
+		if err := r.insertHistory(ctx, tx, tables, forma.HistoryOperationDelete, true, schemaID, rowID, now); err != nil {
+			return err
+		}
+	}
+	if tables.Outbox != "" {
+		if err := r.insertOutbox(ctx, tx, tables, forma.ChangeOperationDeleted, true, schemaID, rowID, now); err != nil {
+			return err
+		}
+	}
+
 	deleteMain := fmt.Sprintf("DELETE FROM %s WHERE ltbase_schema_id = $1 AND ltbase_row_id = $2", sanitizeIdentifier(tables.EntityMain))
 	if _, err := tx.Exec(ctx, deleteMain, schemaID, rowID); err != nil {
 		return fmt.Errorf("delete entity_main row: %w", err)
@@ -177,13 +313,72 @@ func (r *PostgresPersistentRecordRepository) DeletePersistentRecord(ctx context.
 		return fmt.Errorf("delete eav attributes: %w", err)
 	}
 
+	deletedAt := now
+	if tables.ChangeLog != "" {
+		if err := r.insertChangeLog(ctx, tx, tables.ChangeLog, schemaID, rowID, now, &deletedAt); err != nil {
+			return err
+		}
+	}
+	if tables.NotifyChannel != "" {
+		if err := r.notifyChange(ctx, tx, tables, forma.ChangeOperationDeleted, schemaID, rowID, now); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// SoftDeletePersistentRecord tombstones a row by setting ltbase_deleted_at. EAV rows are kept so the
+// record can be restored later.
+func (r *PostgresPersistentRecordRepository) SoftDeletePersistentRecord(ctx context.Context, tables StorageTables, schemaID int16, rowID uuid.UUID) error {
+	if err := validateWriteTables(tables); err != nil {
+		return err
+	}
+
+	tx, err := r.beginTx(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
 	now := r.nowMillis()
+	softDelete := fmt.Sprintf(
+		"UPDATE %s SET ltbase_deleted_at = $1, ltbase_updated_at = $1, ltbase_revision = ltbase_revision + 1 WHERE ltbase_schema_id = $2 AND ltbase_row_id = $3 AND ltbase_deleted_at IS NULL",
+		sanitizeIdentifier(tables.EntityMain),
+	)
+	tag, err := tx.Exec(ctx, softDelete, now, schemaID, rowID)
+	if err != nil {
+		return fmt.Errorf("soft delete entity_main row: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("record not found or already deleted: %d/%s", schemaID, rowID)
+	}
+
 	deletedAt := now
 	if tables.ChangeLog != "" {
 		if err := r.insertChangeLog(ctx, tx, tables.ChangeLog, schemaID, rowID, now, &deletedAt); err != nil {
 			return err
 		}
 	}
+	if tables.History != "" {
+		if err := r.insertHistory(ctx, tx, tables, forma.HistoryOperationDelete, false, schemaID, rowID, now); err != nil {
+			return err
+		}
+	}
+	if tables.Outbox != "" {
+		if err := r.insertOutbox(ctx, tx, tables, forma.ChangeOperationDeleted, false, schemaID, rowID, now); err != nil {
+			return err
+		}
+	}
+	if tables.NotifyChannel != "" {
+		if err := r.notifyChange(ctx, tx, tables, forma.ChangeOperationDeleted, schemaID, rowID, now); err != nil {
+			return err
+		}
+	}
 
 	if err := tx.Commit(ctx); err != nil {
 		return fmt.Errorf("commit transaction: %w", err)
@@ -192,6 +387,114 @@ func (r *PostgresPersistentRecordRepository) DeletePersistentRecord(ctx context.
 	return nil
 }
 
+// RestorePersistentRecord clears the tombstone of a soft-deleted row.
+func (r *PostgresPersistentRecordRepository) RestorePersistentRecord(ctx context.Context, tables StorageTables, schemaID int16, rowID uuid.UUID) error {
+	if err := validateWriteTables(tables); err != nil {
+		return err
+	}
+
+	tx, err := r.beginTx(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	now := r.nowMillis()
+	restore := fmt.Sprintf(
+		"UPDATE %s SET ltbase_deleted_at = NULL, ltbase_updated_at = $1, ltbase_revision = ltbase_revision + 1 WHERE ltbase_schema_id = $2 AND ltbase_row_id = $3 AND ltbase_deleted_at IS NOT NULL",
+		sanitizeIdentifier(tables.EntityMain),
+	)
+	tag, err := tx.Exec(ctx, restore, now, schemaID, rowID)
+	if err != nil {
+		return fmt.Errorf("restore entity_main row: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: no deleted record %d/%s", forma.ErrNotFound, schemaID, rowID)
+	}
+
+	if tables.ChangeLog != "" {
+		if err := r.insertChangeLog(ctx, tx, tables.ChangeLog, schemaID, rowID, now, nil); err != nil {
+			return err
+		}
+	}
+	if tables.History != "" {
+		if err := r.insertHistory(ctx, tx, tables, forma.HistoryOperationRestore, false, schemaID, rowID, now); err != nil {
+			return err
+		}
+	}
+	if tables.Outbox != "" {
+		if err := r.insertOutbox(ctx, tx, tables, forma.ChangeOperationUpdated, false, schemaID, rowID, now); err != nil {
+			return err
+		}
+	}
+	if tables.NotifyChannel != "" {
+		if err := r.notifyChange(ctx, tx, tables, forma.ChangeOperationUpdated, schemaID, rowID, now); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// PurgePersistentRecords hard deletes rows of a schema that were soft-deleted before deletedBefore
+// (unix milliseconds) and returns the number of purged rows.
+func (r *PostgresPersistentRecordRepository) PurgePersistentRecords(ctx context.Context, tables StorageTables, schemaID int16, deletedBefore int64) (int64, error) {
+	if err := validateWriteTables(tables); err != nil {
+		return 0, err
+	}
+
+	tx, err := r.beginTx(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if tables.History != "" {
+		purgeHistory := historySelectSQL(tables, sanitizeIdentifier(tables.EntityMain), forma.HistoryOperationPurge, true, "$3", "$4") +
+			" WHERE m.ltbase_schema_id = $1 AND m.ltbase_deleted_at IS NOT NULL AND m.ltbase_deleted_at < $2"
+		if _, err := tx.Exec(ctx, purgeHistory, schemaID, deletedBefore, r.nowMillis(), nullableActor(ctx)); err != nil {
+			return 0, fmt.Errorf("insert purge history: %w", err)
+		}
+	}
+	if tables.Outbox != "" {
+		purgeOutbox := outboxSelectSQL(tables, sanitizeIdentifier(tables.EntityMain), forma.ChangeOperationDeleted, true, "$3") +
+			" WHERE m.ltbase_schema_id = $1 AND m.ltbase_deleted_at IS NOT NULL AND m.ltbase_deleted_at < $2"
+		if _, err := tx.Exec(ctx, purgeOutbox, schemaID, deletedBefore, r.nowMillis()); err != nil {
+			return 0, fmt.Errorf("insert purge outbox: %w", err)
+		}
+	}
+
+	purgeEAV := fmt.Sprintf(
+		`DELETE FROM %s e USING %s m
+		WHERE e.schema_id = m.ltbase_schema_id AND e.row_id = m.ltbase_row_id
+		AND m.ltbase_schema_id = $1 AND m.ltbase_deleted_at IS NOT NULL AND m.ltbase_deleted_at < $2`,
+		sanitizeIdentifier(tables.EAVData),
+		sanitizeIdentifier(tables.EntityMain),
+	)
+	if _, err := tx.Exec(ctx, purgeEAV, schemaID, deletedBefore); err != nil {
+		return 0, fmt.Errorf("purge eav attributes: %w", err)
+	}
+
+	purgeMain := fmt.Sprintf(
+		"DELETE FROM %s WHERE ltbase_schema_id = $1 AND ltbase_deleted_at IS NOT NULL AND ltbase_deleted_at < $2",
+		sanitizeIdentifier(tables.EntityMain),
+	)
+	tag, err := tx.Exec(ctx, purgeMain, schemaID, deletedBefore)
+	if err != nil {
+		return 0, fmt.Errorf("purge entity_main rows: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
 func (r *PostgresPersistentRecordRepository) GetPersistentRecord(ctx context.Context, tables StorageTables, schemaID int16, rowID uuid.UUID) (*PersistentRecord, error) {
 	if err := validateTables(tables); err != nil {
 		return nil, err
@@ -252,9 +555,18 @@ func (r *PostgresPersistentRecordRepository) QueryPersistentRecords(ctx context.
 
 	useMainTableAsAnchor := hasMainTableCondition(query.Condition, cache)
 
+	// Point-in-time queries read history snapshots through CTEs shaped like the live tables.
+	eavTable, mainTable := query.Tables.EAVData, query.Tables.EntityMain
+	if query.AsOf != nil {
+		if query.Tables.History == "" {
+			return nil, fmt.Errorf("history table name cannot be empty")
+		}
+		eavTable, mainTable = asOfEAVCTE, asOfMainCTE
+	}
+
 	conditions, args, err := r.buildHybridConditions(
-		sanitizeIdentifier(query.Tables.EAVData),
-		sanitizeIdentifier(query.Tables.EntityMain),
+		sanitizeIdentifier(eavTable),
+		sanitizeIdentifier(mainTable),
 		attrQuery,
 		1,
 		useMainTableAsAnchor,
@@ -274,6 +586,8 @@ func (r *PostgresPersistentRecordRepository) QueryPersistentRecords(ctx context.
 		offset,
 		query.AttributeOrders,
 		useMainTableAsAnchor,
+		query.IncludeDeleted,
+		query.AsOf,
 	)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,203 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/lychee-technology/forma"
+)
+
+// bulkMainColumns lists the entity_main columns written by COPY, in row order.
+func bulkMainColumns() []string {
+	columns := make([]string, len(entityMainColumnDescriptors))
+	for i, desc := range entityMainColumnDescriptors {
+		columns[i] = desc.name
+	}
+	return columns
+}
+
+// bulkMainRow flattens record into the column order of bulkMainColumns. Hot columns that the
+// record does not use are written as NULL.
+func bulkMainRow(record *PersistentRecord) ([]any, error) {
+	if err := validateHotColumns(record); err != nil {
+		return nil, err
+	}
+
+	row := make([]any, 0, len(entityMainColumnDescriptors))
+	for _, desc := range entityMainColumnDescriptors {
+		switch desc.name {
+		case "ltbase_schema_id":
+			row = append(row, record.SchemaID)
+		case "ltbase_row_id":
+			row = append(row, record.RowID)
+		case "ltbase_created_at":
+			row = append(row, record.CreatedAt)
+		case "ltbase_updated_at":
+			row = append(row, record.UpdatedAt)
+		case "ltbase_deleted_at":
+			if record.DeletedAt != nil {
+				row = append(row, *record.DeletedAt)
+			} else {
+				row = append(row, nil)
+			}
+		case "ltbase_revision":
+			row = append(row, max(record.Revision, 1))
+		default:
+			row = append(row, bulkHotValue(record, desc))
+		}
+	}
+
+	return row, nil
+}
+
+func bulkHotValue(record *PersistentRecord, desc columnDescriptor) any {
+	switch desc.kind {
+	case columnKindText:
+		if v, ok := record.TextItems[desc.name]; ok {
+			return v
+		}
+	case columnKindSmallint:
+		if v, ok := record.Int16Items[desc.name]; ok {
+			return v
+		}
+	case columnKindInteger:
+		if v, ok := record.Int32Items[desc.name]; ok {
+			return v
+		}
+	case columnKindBigint:
+		if v, ok := record.Int64Items[desc.name]; ok {
+			return v
+		}
+	case columnKindDouble:
+		if v, ok := record.Float64Items[desc.name]; ok {
+			return v
+		}
+	case columnKindUUID:
+		if v, ok := record.UUIDItems[desc.name]; ok {
+			return v
+		}
+	}
+	return nil
+}
+
+// validateHotColumns rejects hot-column keys that entity_main does not have.
+func validateHotColumns(record *PersistentRecord) error {
+	if _, err := sortedColumnKeys(record.TextItems, allowedTextColumns); err != nil {
+		return err
+	}
+	if _, err := sortedColumnKeys(record.Int16Items, allowedSmallintColumns); err != nil {
+		return err
+	}
+	if _, err := sortedColumnKeys(record.Int32Items, allowedIntegerColumns); err != nil {
+		return err
+	}
+	if _, err := sortedColumnKeys(record.Int64Items, allowedBigintColumns); err != nil {
+		return err
+	}
+	if _, err := sortedColumnKeys(record.Float64Items, allowedDoubleColumns); err != nil {
+		return err
+	}
+	if _, err := sortedColumnKeys(record.UUIDItems, allowedUUIDColumns); err != nil {
+		return err
+	}
+	return nil
+}
+
+// BulkInsertPersistentRecords inserts new records with COPY: one stream for entity_main, one for the
+// EAV table and one for the change log. All three run in a single transaction (or savepoint when
+// ctx carries a transaction), so a failed COPY leaves nothing behind.
+func (r *PostgresPersistentRecordRepository) BulkInsertPersistentRecords(ctx context.Context, tables StorageTables, records []*PersistentRecord) error {
+	if err := validateWriteTables(tables); err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	now := r.nowMillis()
+	mainRows := make([][]any, 0, len(records))
+	eavRows := make([][]any, 0, len(records))
+	changeLogRows := make([][]any, 0, len(records))
+	for _, record := range records {
+		if record == nil {
+			return fmt.Errorf("record cannot be nil")
+		}
+		record.CreatedAt = now
+		record.UpdatedAt = now
+
+		row, err := bulkMainRow(record)
+		if err != nil {
+			return fmt.Errorf("record %s: %w", record.RowID, err)
+		}
+		mainRows = append(mainRows, row)
+
+		for _, attr := range record.OtherAttributes {
+			eavRows = append(eavRows, []any{
+				attr.SchemaID,
+				attr.RowID,
+				attr.AttrID,
+				attr.ArrayIndices,
+				attr.ValueText,
+				attr.ValueNumeric,
+			})
+		}
+
+		changeLogRows = append(changeLogRows, []any{record.SchemaID, record.RowID, int64(0), now, nil})
+	}
+
+	tx, err := r.beginTx(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.CopyFrom(ctx, splitIdentifier(tables.EntityMain), bulkMainColumns(), pgx.CopyFromRows(mainRows)); err != nil {
+		return fmt.Errorf("copy entity_main rows: %w", err)
+	}
+
+	if len(eavRows) > 0 {
+		eavColumns := []string{"schema_id", "row_id", "attr_id", "array_indices", "value_text", "value_numeric"}
+		if _, err := tx.CopyFrom(ctx, splitIdentifier(tables.EAVData), eavColumns, pgx.CopyFromRows(eavRows)); err != nil {
+			return fmt.Errorf("copy eav attributes: %w", err)
+		}
+	}
+
+	if tables.ChangeLog != "" {
+		changeLogColumns := []string{"schema_id", "row_id", "flushed_at", "changed_at", "deleted_at"}
+		if _, err := tx.CopyFrom(ctx, splitIdentifier(tables.ChangeLog), changeLogColumns, pgx.CopyFromRows(changeLogRows)); err != nil {
+			return fmt.Errorf("copy change log: %w", err)
+		}
+	}
+
+	rowIDs := make([]uuid.UUID, len(records))
+	for i, record := range records {
+		rowIDs[i] = record.RowID
+	}
+	if tables.History != "" {
+		query := historySelectSQL(tables, sanitizeIdentifier(tables.EntityMain), forma.HistoryOperationCreate, false, "$3", "$4") +
+			" WHERE m.ltbase_schema_id = $1 AND m.ltbase_row_id = ANY($2)"
+		if _, err := tx.Exec(ctx, query, records[0].SchemaID, rowIDs, now, nullableActor(ctx)); err != nil {
+			return fmt.Errorf("insert history: %w", err)
+		}
+	}
+	if tables.Outbox != "" {
+		query := outboxSelectSQL(tables, sanitizeIdentifier(tables.EntityMain), forma.ChangeOperationCreated, false, "$3") +
+			" WHERE m.ltbase_schema_id = $1 AND m.ltbase_row_id = ANY($2)"
+		if _, err := tx.Exec(ctx, query, records[0].SchemaID, rowIDs, now); err != nil {
+			return fmt.Errorf("insert outbox: %w", err)
+		}
+	}
+	if tables.NotifyChannel != "" {
+		if _, err := tx.Exec(ctx, notifyRowsSQL(forma.ChangeOperationCreated), records[0].SchemaID, rowIDs, tables.NotifyChannel, now); err != nil {
+			return fmt.Errorf("notify changes: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return nil
+}
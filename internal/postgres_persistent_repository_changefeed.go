@@ -0,0 +1,255 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// ChangeLogEntry is a pending row of the change log. Writes to the same entity are coalesced
+// into one pending entry until it is flushed.
+type ChangeLogEntry struct {
+	SchemaID  int16
+	RowID     uuid.UUID
+	ChangedAt int64
+	DeletedAt *int64
+	// TxID is the ID of the transaction that wrote the entry. Only ListChangesAfter sets it.
+	TxID int64
+}
+
+// LeaseChanges locks up to limit pending change log entries, oldest change first, and returns them.
+// Entries locked by another transaction are skipped, so concurrent consumers never lease the same
+// entry. schemaID 0 leases entries of every schema. The locks are held until the transaction carried
+// by ctx ends, which is required.
+func (r *PostgresPersistentRecordRepository) LeaseChanges(ctx context.Context, tables StorageTables, schemaID int16, limit int) ([]*ChangeLogEntry, error) {
+	if tables.ChangeLog == "" {
+		return nil, fmt.Errorf("change log table name cannot be empty")
+	}
+	tx, ok := txFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("leasing changes requires a transaction")
+	}
+	if limit <= 0 {
+		return nil, fmt.Errorf("limit must be positive")
+	}
+
+	args := []any{limit}
+	schemaFilter := ""
+	if schemaID != 0 {
+		args = append(args, schemaID)
+		schemaFilter = " AND schema_id = $2"
+	}
+	query := fmt.Sprintf(
+		`SELECT schema_id, row_id, changed_at, deleted_at FROM %s
+		WHERE flushed_at = 0%s
+		ORDER BY changed_at, schema_id, row_id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED`,
+		sanitizeIdentifier(tables.ChangeLog), schemaFilter,
+	)
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("lease changes: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*ChangeLogEntry
+	for rows.Next() {
+		var entry ChangeLogEntry
+		if err := rows.Scan(&entry.SchemaID, &entry.RowID, &entry.ChangedAt, &entry.DeletedAt); err != nil {
+			return nil, fmt.Errorf("scan change: %w", err)
+		}
+		entries = append(entries, &entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate changes: %w", err)
+	}
+	return entries, nil
+}
+
+// MarkChangesFlushed stamps the pending change log entries of entries as flushed now, so they are
+// no longer leased. It must run in the transaction that leased them. A later write to the same
+// entity starts a new pending entry. flushed_at is part of the change log key, so an entity flushed
+// again within the same millisecond is stamped one past its latest flush instead.
+func (r *PostgresPersistentRecordRepository) MarkChangesFlushed(ctx context.Context, tables StorageTables, entries []*ChangeLogEntry) (int64, error) {
+	if tables.ChangeLog == "" {
+		return 0, fmt.Errorf("change log table name cannot be empty")
+	}
+	tx, ok := txFromContext(ctx)
+	if !ok {
+		return 0, fmt.Errorf("flushing changes requires a transaction")
+	}
+	if len(entries) == 0 {
+		return 0, nil
+	}
+
+	schemaIDs := make([]int16, len(entries))
+	rowIDs := make([]uuid.UUID, len(entries))
+	for i, entry := range entries {
+		schemaIDs[i] = entry.SchemaID
+		rowIDs[i] = entry.RowID
+	}
+	query := fmt.Sprintf(
+		`UPDATE %[1]s AS c SET flushed_at = GREATEST($1, (
+			SELECT MAX(p.flushed_at) + 1 FROM %[1]s AS p
+			WHERE p.schema_id = c.schema_id AND p.row_id = c.row_id
+		))
+		FROM unnest($2::smallint[], $3::uuid[]) AS f(schema_id, row_id)
+		WHERE c.schema_id = f.schema_id AND c.row_id = f.row_id AND c.flushed_at = 0`,
+		sanitizeIdentifier(tables.ChangeLog),
+	)
+	tag, err := tx.Exec(ctx, query, r.nowMillis(), schemaIDs, rowIDs)
+	if err != nil {
+		return 0, fmt.Errorf("mark changes flushed: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// ListChangesSince returns the latest change log entry of every entity of schemaID changed at or
+// after since (unix milliseconds), flushed or not, in (changed_at, row_id) order. A non-nil
+// afterRowID starts strictly after the entry of that entity at since instead.
+func (r *PostgresPersistentRecordRepository) ListChangesSince(ctx context.Context, tables StorageTables, schemaID int16, since int64, afterRowID uuid.UUID) ([]*ChangeLogEntry, error) {
+	if tables.ChangeLog == "" {
+		return nil, fmt.Errorf("change log table name cannot be empty")
+	}
+
+	args := []any{schemaID, since}
+	boundary := "changed_at >= $2"
+	if afterRowID != uuid.Nil {
+		args = append(args, afterRowID)
+		boundary = "(changed_at, row_id) > ($2, $3)"
+	}
+	query := fmt.Sprintf(
+		`SELECT schema_id, row_id, changed_at, deleted_at FROM (
+			SELECT DISTINCT ON (row_id) schema_id, row_id, changed_at, deleted_at FROM %s
+			WHERE schema_id = $1 AND %s
+			ORDER BY row_id, changed_at DESC
+		) latest
+		ORDER BY changed_at, row_id`,
+		sanitizeIdentifier(tables.ChangeLog), boundary,
+	)
+	rows, err := r.querier(ctx).Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list changes: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*ChangeLogEntry
+	for rows.Next() {
+		var entry ChangeLogEntry
+		if err := rows.Scan(&entry.SchemaID, &entry.RowID, &entry.ChangedAt, &entry.DeletedAt); err != nil {
+			return nil, fmt.Errorf("scan change: %w", err)
+		}
+		entries = append(entries, &entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate changes: %w", err)
+	}
+	return entries, nil
+}
+
+// ChangeCursor is the change log position a consumer has read up to, in (tx_id, schema_id, row_id)
+// order, where tx_id is the ID of the transaction that wrote an entry. Cursor consumers read the
+// change log without flushing it, so they neither take changes from nor give changes to
+// ConsumeChanges.
+type ChangeCursor struct {
+	TxID     int64
+	SchemaID int16
+	RowID    uuid.UUID
+}
+
+// LockChangeCursor returns the cursor of consumer, creating it at the start of the change log, and
+// locks it until the transaction carried by ctx ends, which is required. Concurrent readers of the
+// same cursor therefore run one after another.
+func (r *PostgresPersistentRecordRepository) LockChangeCursor(ctx context.Context, tables StorageTables, consumer string) (*ChangeCursor, error) {
+	if tables.ChangeCursors == "" {
+		return nil, fmt.Errorf("change cursor table name cannot be empty")
+	}
+	tx, ok := txFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("locking a change cursor requires a transaction")
+	}
+
+	table := sanitizeIdentifier(tables.ChangeCursors)
+	insert := fmt.Sprintf(
+		`INSERT INTO %s (consumer, tx_id, schema_id, row_id, updated_at)
+		VALUES ($1, 0, 0, $2, $3)
+		ON CONFLICT (consumer) DO NOTHING`,
+		table,
+	)
+	if _, err := tx.Exec(ctx, insert, consumer, uuid.Nil, r.nowMillis()); err != nil {
+		return nil, fmt.Errorf("create change cursor: %w", err)
+	}
+
+	query := fmt.Sprintf(`SELECT tx_id, schema_id, row_id FROM %s WHERE consumer = $1 FOR UPDATE`, table)
+	var cursor ChangeCursor
+	if err := tx.QueryRow(ctx, query, consumer).Scan(&cursor.TxID, &cursor.SchemaID, &cursor.RowID); err != nil {
+		return nil, fmt.Errorf("lock change cursor: %w", err)
+	}
+	return &cursor, nil
+}
+
+// SaveChangeCursor moves the cursor of consumer to cursor in the transaction that locked it.
+func (r *PostgresPersistentRecordRepository) SaveChangeCursor(ctx context.Context, tables StorageTables, consumer string, cursor *ChangeCursor) error {
+	if tables.ChangeCursors == "" {
+		return fmt.Errorf("change cursor table name cannot be empty")
+	}
+	tx, ok := txFromContext(ctx)
+	if !ok {
+		return fmt.Errorf("saving a change cursor requires a transaction")
+	}
+
+	query := fmt.Sprintf(
+		`UPDATE %s SET tx_id = $2, schema_id = $3, row_id = $4, updated_at = $5 WHERE consumer = $1`,
+		sanitizeIdentifier(tables.ChangeCursors),
+	)
+	if _, err := tx.Exec(ctx, query, consumer, cursor.TxID, cursor.SchemaID, cursor.RowID, r.nowMillis()); err != nil {
+		return fmt.Errorf("save change cursor: %w", err)
+	}
+	return nil
+}
+
+// ListChangesAfter returns up to limit entities of every schema changed after cursor, flushed or not,
+// with the latest such change of each, in cursor order. Only entries written by transactions older
+// than the snapshot xmin are read: every transaction below it has finished, and any transaction
+// still to commit gets a higher ID, so no entry can later appear behind an entry returned here. A
+// long-running transaction holds the xmin back and delays, but never drops, later changes.
+func (r *PostgresPersistentRecordRepository) ListChangesAfter(ctx context.Context, tables StorageTables, cursor *ChangeCursor, limit int) ([]*ChangeLogEntry, error) {
+	if tables.ChangeLog == "" {
+		return nil, fmt.Errorf("change log table name cannot be empty")
+	}
+	if limit <= 0 {
+		return nil, fmt.Errorf("limit must be positive")
+	}
+
+	query := fmt.Sprintf(
+		`SELECT schema_id, row_id, changed_at, deleted_at, tx_id::text::bigint FROM (
+			SELECT DISTINCT ON (schema_id, row_id) schema_id, row_id, changed_at, deleted_at, tx_id FROM %s
+			WHERE (tx_id, schema_id, row_id) > ($1::bigint::text::xid8, $2, $3)
+			AND tx_id < pg_snapshot_xmin(pg_current_snapshot())
+			ORDER BY schema_id, row_id, tx_id DESC
+		) latest
+		ORDER BY tx_id, schema_id, row_id
+		LIMIT $4`,
+		sanitizeIdentifier(tables.ChangeLog),
+	)
+	rows, err := r.querier(ctx).Query(ctx, query, cursor.TxID, cursor.SchemaID, cursor.RowID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list changes: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*ChangeLogEntry
+	for rows.Next() {
+		var entry ChangeLogEntry
+		if err := rows.Scan(&entry.SchemaID, &entry.RowID, &entry.ChangedAt, &entry.DeletedAt, &entry.TxID); err != nil {
+			return nil, fmt.Errorf("scan change: %w", err)
+		}
+		entries = append(entries, &entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate changes: %w", err)
+	}
+	return entries, nil
+}
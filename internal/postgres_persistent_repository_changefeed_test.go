@@ -0,0 +1,123 @@
+package internal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeaseAndFlushChangesWithMockPool(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+	mock.MatchExpectationsInOrder(true)
+
+	repo := NewPostgresPersistentRecordRepository(mock, nil)
+	fixed := time.Date(2024, 6, 7, 8, 9, 10, 0, time.UTC)
+	repo.withClock(func() time.Time { return fixed })
+	tables := StorageTables{EntityMain: "entity_main", EAVData: "eav_table", ChangeLog: "change_log"}
+
+	liveID := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+	deletedID := uuid.MustParse("22222222-2222-2222-2222-222222222222")
+	deletedAt := int64(2000)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^SELECT schema_id, row_id, changed_at, deleted_at FROM "change_log"\s+WHERE flushed_at = 0 AND schema_id = \$2\s+ORDER BY changed_at, schema_id, row_id\s+LIMIT \$1\s+FOR UPDATE SKIP LOCKED$`).
+		WithArgs(10, int16(1)).
+		WillReturnRows(pgxmock.NewRows([]string{"schema_id", "row_id", "changed_at", "deleted_at"}).
+			AddRow(int16(1), liveID, int64(1000), nil).
+			AddRow(int16(1), deletedID, int64(2000), &deletedAt))
+	mock.ExpectExec(`^UPDATE "change_log" AS c SET flushed_at = GREATEST\(\$1, \(\s+SELECT MAX\(p\.flushed_at\) \+ 1 FROM "change_log" AS p\s+WHERE p\.schema_id = c\.schema_id AND p\.row_id = c\.row_id\s+\)\)\s+FROM unnest\(\$2::smallint\[\], \$3::uuid\[\]\) AS f\(schema_id, row_id\)\s+WHERE c\.schema_id = f\.schema_id AND c\.row_id = f\.row_id AND c\.flushed_at = 0$`).
+		WithArgs(fixed.UnixMilli(), []int16{1, 1}, []uuid.UUID{liveID, deletedID}).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 2))
+	mock.ExpectCommit()
+
+	var flushed int64
+	err = repo.RunInTx(ctx, func(txCtx context.Context) error {
+		entries, err := repo.LeaseChanges(txCtx, tables, 1, 10)
+		if err != nil {
+			return err
+		}
+		require.Len(t, entries, 2)
+		assert.Equal(t, liveID, entries[0].RowID)
+		assert.Nil(t, entries[0].DeletedAt)
+		require.NotNil(t, entries[1].DeletedAt)
+		assert.Equal(t, deletedAt, *entries[1].DeletedAt)
+
+		flushed, err = repo.MarkChangesFlushed(txCtx, tables, entries)
+		return err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), flushed)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLeaseChangesRequiresTransaction(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewPostgresPersistentRecordRepository(mock, nil)
+	_, err = repo.LeaseChanges(context.Background(), StorageTables{ChangeLog: "change_log"}, 0, 10)
+	assert.Error(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestChangeCursorWithMockPool(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+	mock.MatchExpectationsInOrder(true)
+
+	repo := NewPostgresPersistentRecordRepository(mock, nil)
+	fixed := time.Date(2024, 6, 7, 8, 9, 10, 0, time.UTC)
+	repo.withClock(func() time.Time { return fixed })
+	tables := StorageTables{ChangeLog: "change_log", ChangeCursors: "change_cursors"}
+
+	rowID := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^INSERT INTO "change_cursors" \(consumer, tx_id, schema_id, row_id, updated_at\)\s+VALUES \(\$1, 0, 0, \$2, \$3\)\s+ON CONFLICT \(consumer\) DO NOTHING$`).
+		WithArgs("webhooks", uuid.Nil, fixed.UnixMilli()).
+		WillReturnResult(pgxmock.NewResult("INSERT", 0))
+	mock.ExpectQuery(`^SELECT tx_id, schema_id, row_id FROM "change_cursors" WHERE consumer = \$1 FOR UPDATE$`).
+		WithArgs("webhooks").
+		WillReturnRows(pgxmock.NewRows([]string{"tx_id", "schema_id", "row_id"}).
+			AddRow(int64(700), int16(1), rowID))
+	mock.ExpectQuery(`WHERE \(tx_id, schema_id, row_id\) > \(\$1::bigint::text::xid8, \$2, \$3\)\s+AND tx_id < pg_snapshot_xmin\(pg_current_snapshot\(\)\)\s+ORDER BY schema_id, row_id, tx_id DESC\s+\) latest\s+ORDER BY tx_id, schema_id, row_id\s+LIMIT \$4$`).
+		WithArgs(int64(700), int16(1), rowID, 10).
+		WillReturnRows(pgxmock.NewRows([]string{"schema_id", "row_id", "changed_at", "deleted_at", "tx_id"}).
+			AddRow(int16(2), rowID, int64(2000), nil, int64(702)))
+	mock.ExpectExec(`^UPDATE "change_cursors" SET tx_id = \$2, schema_id = \$3, row_id = \$4, updated_at = \$5 WHERE consumer = \$1$`).
+		WithArgs("webhooks", int64(702), int16(2), rowID, fixed.UnixMilli()).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectCommit()
+
+	err = repo.RunInTx(ctx, func(txCtx context.Context) error {
+		cursor, err := repo.LockChangeCursor(txCtx, tables, "webhooks")
+		if err != nil {
+			return err
+		}
+		assert.Equal(t, ChangeCursor{TxID: 700, SchemaID: 1, RowID: rowID}, *cursor)
+
+		entries, err := repo.ListChangesAfter(txCtx, tables, cursor, 10)
+		if err != nil {
+			return err
+		}
+		require.Len(t, entries, 1)
+		last := entries[0]
+		return repo.SaveChangeCursor(txCtx, tables, "webhooks", &ChangeCursor{TxID: last.TxID, SchemaID: last.SchemaID, RowID: last.RowID})
+	})
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	_, err = repo.LockChangeCursor(ctx, tables, "webhooks")
+	assert.Error(t, err, "locking a cursor outside a transaction must fail")
+}
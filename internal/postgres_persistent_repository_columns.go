@@ -51,7 +51,7 @@ var entityMainColumnDescriptors = []columnDescriptor{}
 var entityMainProjection string
 
 func init() {
-	projection := make([]string, 0, 5+len(textColumns)+len(smallintColumns)+len(integerColumns)+len(bigintColumns)+len(doubleColumns)+len(uuidColumns))
+	projection := make([]string, 0, 6+len(textColumns)+len(smallintColumns)+len(integerColumns)+len(bigintColumns)+len(doubleColumns)+len(uuidColumns))
 
 	// Add system fields first
 	entityMainColumnDescriptors = append(entityMainColumnDescriptors, columnDescriptor{name: "ltbase_schema_id", kind: columnKindSmallint})
@@ -69,6 +69,9 @@ func init() {
 	entityMainColumnDescriptors = append(entityMainColumnDescriptors, columnDescriptor{name: "ltbase_deleted_at", kind: columnKindBigint})
 	projection = append(projection, "ltbase_deleted_at")
 
+	entityMainColumnDescriptors = append(entityMainColumnDescriptors, columnDescriptor{name: "ltbase_revision", kind: columnKindBigint})
+	projection = append(projection, "ltbase_revision")
+
 	// Add remaining text columns (skip text_01 as it's already added)
 	for _, col := range textColumns {
 		entityMainColumnDescriptors = append(entityMainColumnDescriptors, columnDescriptor{name: col, kind: columnKindText})
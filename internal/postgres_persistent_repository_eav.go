@@ -81,7 +81,7 @@ func (r *PostgresPersistentRecordRepository) fetchAttributes(ctx context.Context
 		"SELECT schema_id, row_id, attr_id, array_indices, value_text, value_numeric FROM %s WHERE schema_id = $1 AND row_id = $2",
 		sanitizeIdentifier(table),
 	)
-	rows, err := r.pool.Query(ctx, query, schemaID, rowID)
+	rows, err := r.querier(ctx).Query(ctx, query, schemaID, rowID)
 	if err != nil {
 		return nil, fmt.Errorf("query eav attributes: %w", err)
 	}
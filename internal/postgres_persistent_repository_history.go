@@ -0,0 +1,327 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/lychee-technology/forma"
+)
+
+// History rows keep a snapshot of the stored form of an entity: its entity_main row and its EAV
+// rows, exactly as persisted. Encrypted attributes therefore stay encrypted in the history table
+// and are decrypted by the transformer when history is read.
+//
+//	{"main": {"ltbase_row_id": "...", "text_01": "...", ...},
+//	 "eav":  [{"attr_id": 3, "array_indices": "", "value_text": "...", "value_numeric": null}, ...]}
+
+// historySnapshotSQL returns a jsonb expression building the snapshot of the entity_main row
+// aliased as alias together with its EAV rows.
+func historySnapshotSQL(eavTable, alias string) string {
+	return fmt.Sprintf(`jsonb_build_object(
+			'main', to_jsonb(%[2]s),
+			'eav', COALESCE((
+				SELECT jsonb_agg(jsonb_build_object(
+					'attr_id', e.attr_id, 'array_indices', e.array_indices,
+					'value_text', e.value_text, 'value_numeric', e.value_numeric))
+				FROM %[1]s e WHERE e.schema_id = %[2]s.ltbase_schema_id AND e.row_id = %[2]s.ltbase_row_id
+			), '[]'::jsonb))`, sanitizeIdentifier(eavTable), alias)
+}
+
+// historySelectSQL returns a history INSERT fed by a SELECT over source (aliased as m) that produces
+// one history row per source row. changedAt and actor are SQL expressions. When removed is set the
+// rows are about to be hard deleted: the snapshot is omitted and the revision is the one the removal
+// would have produced.
+func historySelectSQL(tables StorageTables, source string, operation forma.HistoryOperation, removed bool, changedAt, actor string) string {
+	revision, snapshot := "m.ltbase_revision", historySnapshotSQL(tables.EAVData, "m")
+	if removed {
+		revision, snapshot = "m.ltbase_revision + 1", "NULL"
+	}
+	return fmt.Sprintf(`INSERT INTO %s (schema_id, row_id, revision, operation, changed_at, actor, snapshot)
+			SELECT m.ltbase_schema_id, m.ltbase_row_id, %s, '%s', %s, %s, %s FROM %s m`,
+		sanitizeIdentifier(tables.History), revision, operation, changedAt, actor, snapshot, source)
+}
+
+// historyCTE returns a data-modifying CTE that writes a history row for every entity_main row
+// returned by source. Set-based statements must return whole rows (RETURNING m.*) for this.
+func historyCTE(tables StorageTables, source string, operation forma.HistoryOperation, removed bool, changedAt, actor string) string {
+	if tables.History == "" {
+		return ""
+	}
+	return fmt.Sprintf(`,
+		versioned AS (
+			%s
+		)`, historySelectSQL(tables, source, operation, removed, changedAt, actor))
+}
+
+// insertHistory records the state of rowID. It runs after writes that keep the row and, with
+// removed set, before hard deletes.
+func (r *PostgresPersistentRecordRepository) insertHistory(ctx context.Context, tx pgx.Tx, tables StorageTables, operation forma.HistoryOperation, removed bool, schemaID int16, rowID uuid.UUID, changedAt int64) error {
+	query := historySelectSQL(tables, sanitizeIdentifier(tables.EntityMain), operation, removed, "$3", "$4") +
+		" WHERE m.ltbase_schema_id = $1 AND m.ltbase_row_id = $2"
+	if _, err := tx.Exec(ctx, query, schemaID, rowID, changedAt, nullableActor(ctx)); err != nil {
+		return fmt.Errorf("insert history: %w", err)
+	}
+	return nil
+}
+
+// historyActorArg appends the actor of ctx to args when tables record history and returns its
+// placeholder.
+func historyActorArg(ctx context.Context, tables StorageTables, args *[]any) string {
+	if tables.History == "" {
+		return ""
+	}
+	*args = append(*args, nullableActor(ctx))
+	return fmt.Sprintf("$%d", len(*args))
+}
+
+func nullableActor(ctx context.Context) any {
+	if actor := forma.ActorFromContext(ctx); actor != "" {
+		return actor
+	}
+	return nil
+}
+
+// Names of the CTEs that stand in for entity_main and the EAV table in point-in-time queries.
+const (
+	asOfMainCTE = "asof_main"
+	asOfEAVCTE  = "asof_eav"
+)
+
+// asOfCTEs returns CTEs rebuilding the entity_main and EAV rows of a schema from the latest history
+// entry of every row recorded at or before asOf. Rows whose latest entry removed them are absent.
+// schemaID and asOf are SQL expressions.
+func asOfCTEs(tables StorageTables, schemaID, asOf string) string {
+	return fmt.Sprintf(`asof_versions AS (
+            SELECT DISTINCT ON (h.row_id) h.snapshot
+            FROM %[1]s h
+            WHERE h.schema_id = %[3]s AND h.changed_at <= %[4]s
+            ORDER BY h.row_id, h.history_id DESC
+        ),
+        %[5]s AS (
+            SELECT s.* FROM asof_versions v
+            CROSS JOIN LATERAL jsonb_populate_record(NULL::%[2]s, v.snapshot->'main') s
+            WHERE v.snapshot IS NOT NULL
+        ),
+        %[6]s AS (
+            SELECT (v.snapshot->'main'->>'ltbase_schema_id')::smallint AS schema_id,
+                (v.snapshot->'main'->>'ltbase_row_id')::uuid AS row_id,
+                e.attr_id, e.array_indices, e.value_text, e.value_numeric
+            FROM asof_versions v
+            CROSS JOIN LATERAL jsonb_to_recordset(v.snapshot->'eav')
+                AS e(attr_id smallint, array_indices text, value_text text, value_numeric numeric)
+            WHERE v.snapshot IS NOT NULL
+        )`,
+		sanitizeIdentifier(tables.History), sanitizeIdentifier(tables.EntityMain), schemaID, asOf, asOfMainCTE, asOfEAVCTE)
+}
+
+// GetPersistentRecordAsOf returns rowID as recorded by its latest history entry at or before asOf
+// (unix milliseconds), or nil when it did not exist then.
+func (r *PostgresPersistentRecordRepository) GetPersistentRecordAsOf(ctx context.Context, tables StorageTables, schemaID int16, rowID uuid.UUID, asOf int64) (*PersistentRecord, error) {
+	if tables.History == "" {
+		return nil, fmt.Errorf("history table name cannot be empty")
+	}
+
+	query := fmt.Sprintf(
+		"SELECT snapshot FROM %s WHERE schema_id = $1 AND row_id = $2 AND changed_at <= $3 ORDER BY history_id DESC LIMIT 1",
+		sanitizeIdentifier(tables.History),
+	)
+	var snapshot []byte
+	err := r.querier(ctx).QueryRow(ctx, query, schemaID, rowID, asOf).Scan(&snapshot)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && snapshot == nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load history snapshot: %w", err)
+	}
+
+	record, err := decodeHistorySnapshot(schemaID, rowID, snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("decode history snapshot: %w", err)
+	}
+	return record, nil
+}
+
+// HistoryRecord is one row of the history table. Snapshot is nil for entries that removed the row.
+type HistoryRecord struct {
+	Revision  int64
+	Operation forma.HistoryOperation
+	ChangedAt int64
+	Actor     string
+	Snapshot  *PersistentRecord
+}
+
+// ListHistory returns the history of rowID, oldest first.
+func (r *PostgresPersistentRecordRepository) ListHistory(ctx context.Context, tables StorageTables, schemaID int16, rowID uuid.UUID) ([]*HistoryRecord, error) {
+	if tables.History == "" {
+		return nil, fmt.Errorf("history table name cannot be empty")
+	}
+
+	query := fmt.Sprintf(
+		"SELECT revision, operation, changed_at, actor, snapshot FROM %s WHERE schema_id = $1 AND row_id = $2 ORDER BY history_id",
+		sanitizeIdentifier(tables.History),
+	)
+	rows, err := r.querier(ctx).Query(ctx, query, schemaID, rowID)
+	if err != nil {
+		return nil, fmt.Errorf("query history: %w", err)
+	}
+	defer rows.Close()
+
+	var history []*HistoryRecord
+	for rows.Next() {
+		var (
+			entry     HistoryRecord
+			operation string
+			actor     *string
+			snapshot  []byte
+		)
+		if err := rows.Scan(&entry.Revision, &operation, &entry.ChangedAt, &actor, &snapshot); err != nil {
+			return nil, fmt.Errorf("scan history: %w", err)
+		}
+		entry.Operation = forma.HistoryOperation(operation)
+		if actor != nil {
+			entry.Actor = *actor
+		}
+		if snapshot != nil {
+			record, err := decodeHistorySnapshot(schemaID, rowID, snapshot)
+			if err != nil {
+				return nil, fmt.Errorf("decode history revision %d: %w", entry.Revision, err)
+			}
+			entry.Snapshot = record
+		}
+		history = append(history, &entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate history: %w", err)
+	}
+
+	return history, nil
+}
+
+type historySnapshot struct {
+	Main map[string]any `json:"main"`
+	EAV  []struct {
+		AttrID       int16       `json:"attr_id"`
+		ArrayIndices string      `json:"array_indices"`
+		ValueText    *string     `json:"value_text"`
+		ValueNumeric json.Number `json:"value_numeric"`
+	} `json:"eav"`
+}
+
+// decodeHistorySnapshot rebuilds the persistent record stored in a history snapshot.
+func decodeHistorySnapshot(schemaID int16, rowID uuid.UUID, data []byte) (*PersistentRecord, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var snapshot historySnapshot
+	if err := decoder.Decode(&snapshot); err != nil {
+		return nil, err
+	}
+
+	record := &PersistentRecord{
+		SchemaID:     schemaID,
+		RowID:        rowID,
+		TextItems:    make(map[string]string),
+		Int16Items:   make(map[string]int16),
+		Int32Items:   make(map[string]int32),
+		Int64Items:   make(map[string]int64),
+		Float64Items: make(map[string]float64),
+		UUIDItems:    make(map[string]uuid.UUID),
+	}
+	for _, desc := range entityMainColumnDescriptors {
+		value, ok := snapshot.Main[desc.name]
+		if !ok || value == nil {
+			continue
+		}
+		if err := setSnapshotColumn(record, desc, value); err != nil {
+			return nil, fmt.Errorf("column %s: %w", desc.name, err)
+		}
+	}
+
+	for _, attr := range snapshot.EAV {
+		eav := EAVRecord{
+			SchemaID:     schemaID,
+			RowID:        rowID,
+			AttrID:       attr.AttrID,
+			ArrayIndices: attr.ArrayIndices,
+			ValueText:    attr.ValueText,
+		}
+		if attr.ValueNumeric != "" {
+			number, err := attr.ValueNumeric.Float64()
+			if err != nil {
+				return nil, fmt.Errorf("attribute %d: %w", attr.AttrID, err)
+			}
+			eav.ValueNumeric = &number
+		}
+		record.OtherAttributes = append(record.OtherAttributes, eav)
+	}
+
+	return record, nil
+}
+
+func setSnapshotColumn(record *PersistentRecord, desc columnDescriptor, value any) error {
+	switch desc.kind {
+	case columnKindText:
+		text, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("expected string, got %T", value)
+		}
+		record.TextItems[desc.name] = text
+	case columnKindUUID:
+		text, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("expected uuid string, got %T", value)
+		}
+		id, err := uuid.Parse(text)
+		if err != nil {
+			return err
+		}
+		if desc.name != "ltbase_row_id" {
+			record.UUIDItems[desc.name] = id
+		}
+	case columnKindDouble:
+		number, ok := value.(json.Number)
+		if !ok {
+			return fmt.Errorf("expected number, got %T", value)
+		}
+		f, err := number.Float64()
+		if err != nil {
+			return err
+		}
+		record.Float64Items[desc.name] = f
+	case columnKindSmallint, columnKindInteger, columnKindBigint:
+		number, ok := value.(json.Number)
+		if !ok {
+			return fmt.Errorf("expected number, got %T", value)
+		}
+		n, err := strconv.ParseInt(number.String(), 10, 64)
+		if err != nil {
+			return err
+		}
+		switch desc.name {
+		case "ltbase_schema_id":
+		case "ltbase_created_at":
+			record.CreatedAt = n
+		case "ltbase_updated_at":
+			record.UpdatedAt = n
+		case "ltbase_deleted_at":
+			record.DeletedAt = &n
+		case "ltbase_revision":
+			record.Revision = n
+		default:
+			switch desc.kind {
+			case columnKindSmallint:
+				record.Int16Items[desc.name] = int16(n)
+			case columnKindInteger:
+				record.Int32Items[desc.name] = int32(n)
+			default:
+				record.Int64Items[desc.name] = n
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package internal
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lychee-technology/forma"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInsertPersistentRecordWritesHistory(t *testing.T) {
+	ctx := forma.WithActor(context.Background(), "alice")
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+	mock.MatchExpectationsInOrder(true)
+
+	repo := NewPostgresPersistentRecordRepository(mock, nil)
+	fixed := time.Date(2024, 3, 4, 5, 6, 7, 0, time.UTC)
+	repo.withClock(func() time.Time { return fixed })
+	fixedMillis := fixed.UnixMilli()
+
+	rowID := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+	record := &PersistentRecord{SchemaID: 1, RowID: rowID, TextItems: map[string]string{"text_01": "hello"}}
+	tables := StorageTables{EntityMain: "entity_main", EAVData: "eav_table", History: "entity_history"}
+
+	expected := *record
+	expected.CreatedAt = fixedMillis
+	expected.UpdatedAt = fixedMillis
+	insertQuery, insertArgs, err := buildInsertMainStatement(tables.EntityMain, &expected)
+	require.NoError(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("^" + regexp.QuoteMeta(insertQuery) + "$").
+		WithArgs(insertArgs...).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec(`^INSERT INTO "entity_history" \(schema_id, row_id, revision, operation, changed_at, actor, snapshot\)(?s).*m\.ltbase_revision, 'create'(?s).*FROM "eav_table" e`).
+		WithArgs(int16(1), rowID, fixedMillis, "alice").
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
+	mock.ExpectRollback()
+
+	require.NoError(t, repo.InsertPersistentRecord(ctx, tables, record))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeletePersistentRecordWritesHistoryBeforeDelete(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+	mock.MatchExpectationsInOrder(true)
+
+	repo := NewPostgresPersistentRecordRepository(mock, nil)
+	fixed := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	repo.withClock(func() time.Time { return fixed })
+	fixedMillis := fixed.UnixMilli()
+
+	rowID := uuid.MustParse("33333333-3333-3333-3333-333333333333")
+	tables := StorageTables{EntityMain: "entity_main", EAVData: "eav_table", History: "entity_history"}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^INSERT INTO "entity_history"(?s).*m\.ltbase_revision \+ 1, 'delete', \$3, \$4, NULL FROM "entity_main" m`).
+		WithArgs(int16(1), rowID, fixedMillis, nil).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec(`^DELETE FROM "entity_main"`).
+		WithArgs(int16(1), rowID).
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	mock.ExpectExec(`^DELETE FROM "eav_table"`).
+		WithArgs(int16(1), rowID).
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	mock.ExpectCommit()
+	mock.ExpectRollback()
+
+	require.NoError(t, repo.DeletePersistentRecord(ctx, tables, 1, rowID))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeletePersistentRecordsWhereWritesHistory(t *testing.T) {
+	ctx := forma.WithActor(context.Background(), "bob")
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewPostgresPersistentRecordRepository(mock, nil)
+	fixed := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	repo.withClock(func() time.Time { return fixed })
+	tables := StorageTables{EntityMain: "entity_main", EAVData: "eav_table", History: "entity_history"}
+	condition := &forma.KvCondition{Attr: "text_04", Value: "equals:user-1"}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`RETURNING m\.\*(?s).*versioned AS \(\s*INSERT INTO "entity_history"(?s).*m\.ltbase_revision, 'delete', \$3, \$4,(?s).*FROM deleted m(?s).*SELECT COUNT\(\*\) FROM deleted`).
+		WithArgs(int16(1), "user-1", fixed.UnixMilli(), "bob").
+		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(int64(2)))
+	mock.ExpectCommit()
+	mock.ExpectRollback()
+
+	affected, err := repo.DeletePersistentRecordsWhere(ctx, tables, 1, condition, true)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), affected)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListHistoryWithMockPool(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewPostgresPersistentRecordRepository(mock, nil)
+	rowID := uuid.MustParse("44444444-4444-4444-4444-444444444444")
+	ownerID := uuid.MustParse("55555555-5555-5555-5555-555555555555")
+	tables := StorageTables{EntityMain: "entity_main", EAVData: "eav_table", History: "entity_history"}
+
+	snapshot := []byte(`{
+		"main": {"ltbase_schema_id": 1, "ltbase_row_id": "44444444-4444-4444-4444-444444444444",
+			"ltbase_created_at": 1000, "ltbase_updated_at": 2000, "ltbase_deleted_at": null, "ltbase_revision": 2,
+			"text_01": "hello", "smallint_01": 3, "bigint_01": 9007199254740993, "double_01": 1.5,
+			"uuid_01": "55555555-5555-5555-5555-555555555555"},
+		"eav": [
+			{"attr_id": 10, "array_indices": "0", "value_text": "x", "value_numeric": null},
+			{"attr_id": 11, "array_indices": "", "value_text": null, "value_numeric": 42.25}
+		]}`)
+	actor := "alice"
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT revision, operation, changed_at, actor, snapshot FROM "entity_history" WHERE schema_id = $1 AND row_id = $2 ORDER BY history_id`)).
+		WithArgs(int16(1), rowID).
+		WillReturnRows(pgxmock.NewRows([]string{"revision", "operation", "changed_at", "actor", "snapshot"}).
+			AddRow(int64(2), "update", int64(2000), &actor, snapshot).
+			AddRow(int64(3), "delete", int64(3000), nil, nil))
+
+	history, err := repo.ListHistory(ctx, tables, 1, rowID)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+
+	first := history[0]
+	assert.Equal(t, forma.HistoryOperationUpdate, first.Operation)
+	assert.Equal(t, "alice", first.Actor)
+	require.NotNil(t, first.Snapshot)
+	assert.Equal(t, rowID, first.Snapshot.RowID)
+	assert.Equal(t, int64(1000), first.Snapshot.CreatedAt)
+	assert.Equal(t, int64(2), first.Snapshot.Revision)
+	assert.Nil(t, first.Snapshot.DeletedAt)
+	assert.Equal(t, "hello", first.Snapshot.TextItems["text_01"])
+	assert.Equal(t, int16(3), first.Snapshot.Int16Items["smallint_01"])
+	assert.Equal(t, int64(9007199254740993), first.Snapshot.Int64Items["bigint_01"])
+	assert.Equal(t, 1.5, first.Snapshot.Float64Items["double_01"])
+	assert.Equal(t, ownerID, first.Snapshot.UUIDItems["uuid_01"])
+	require.Len(t, first.Snapshot.OtherAttributes, 2)
+	assert.Equal(t, "x", *first.Snapshot.OtherAttributes[0].ValueText)
+	assert.Nil(t, first.Snapshot.OtherAttributes[0].ValueNumeric)
+	assert.Equal(t, 42.25, *first.Snapshot.OtherAttributes[1].ValueNumeric)
+
+	second := history[1]
+	assert.Equal(t, forma.HistoryOperationDelete, second.Operation)
+	assert.Empty(t, second.Actor)
+	assert.Nil(t, second.Snapshot)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestQueryPersistentRecordsAsOfWithMockPool(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewPostgresPersistentRecordRepository(mock, nil)
+	asOf := int64(1709251200000)
+
+	mock.ExpectQuery(`WITH asof_versions AS \((?s).*FROM "entity_history" h\s+WHERE h\.schema_id = \$1 AND h\.changed_at <= \$4(?s).*jsonb_populate_record\(NULL::"entity_main"(?s).*anchor AS \(\s*SELECT m\.ltbase_row_id AS row_id\s+FROM "asof_main" m(?s).*INNER JOIN "asof_eav" e`).
+		WithArgs(int16(1), 10, 0, asOf).
+		WillReturnRows(pgxmock.NewRows([]string{"ltbase_schema_id"}))
+
+	page, err := repo.QueryPersistentRecords(ctx, &PersistentRecordQuery{
+		Tables:   StorageTables{EntityMain: "entity_main", EAVData: "eav_table", History: "entity_history"},
+		SchemaID: 1,
+		Limit:    10,
+		AsOf:     &asOf,
+	})
+	require.NoError(t, err)
+	assert.Empty(t, page.Records)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	_, err = repo.QueryPersistentRecords(ctx, &PersistentRecordQuery{
+		Tables:   StorageTables{EntityMain: "entity_main", EAVData: "eav_table"},
+		SchemaID: 1,
+		AsOf:     &asOf,
+	})
+	require.Error(t, err)
+}
+
+func TestGetPersistentRecordAsOfWithMockPool(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewPostgresPersistentRecordRepository(mock, nil)
+	rowID := uuid.MustParse("66666666-6666-6666-6666-666666666666")
+	tables := StorageTables{EntityMain: "entity_main", EAVData: "eav_table", History: "entity_history"}
+	query := regexp.QuoteMeta(`SELECT snapshot FROM "entity_history" WHERE schema_id = $1 AND row_id = $2 AND changed_at <= $3 ORDER BY history_id DESC LIMIT 1`)
+
+	mock.ExpectQuery(query).
+		WithArgs(int16(1), rowID, int64(5000)).
+		WillReturnRows(pgxmock.NewRows([]string{"snapshot"}).AddRow([]byte(`{"main": {"ltbase_revision": 3, "text_01": "offer"}, "eav": []}`)))
+	record, err := repo.GetPersistentRecordAsOf(ctx, tables, 1, rowID, 5000)
+	require.NoError(t, err)
+	require.NotNil(t, record)
+	assert.Equal(t, rowID, record.RowID)
+	assert.Equal(t, int64(3), record.Revision)
+	assert.Equal(t, "offer", record.TextItems["text_01"])
+
+	mock.ExpectQuery(query).
+		WithArgs(int16(1), rowID, int64(100)).
+		WillReturnRows(pgxmock.NewRows([]string{"snapshot"}))
+	record, err = repo.GetPersistentRecordAsOf(ctx, tables, 1, rowID, 100)
+	require.NoError(t, err)
+	assert.Nil(t, record)
+
+	mock.ExpectQuery(query).
+		WithArgs(int16(1), rowID, int64(9000)).
+		WillReturnRows(pgxmock.NewRows([]string{"snapshot"}).AddRow(nil))
+	record, err = repo.GetPersistentRecordAsOf(ctx, tables, 1, rowID, 9000)
+	require.NoError(t, err)
+	assert.Nil(t, record, "hard-deleted rows have no state")
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// uniqueViolationCode is the Postgres SQLSTATE for unique_violation.
+const uniqueViolationCode = "23505"
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode
+}
+
+// GetIdempotencyRecord returns the unexpired record stored for key, or nil when there is none.
+func (r *PostgresPersistentRecordRepository) GetIdempotencyRecord(ctx context.Context, tables StorageTables, schemaID int16, key string) (*IdempotencyRecord, error) {
+	if tables.IdempotencyKeys == "" {
+		return nil, fmt.Errorf("idempotency table name cannot be empty")
+	}
+
+	query := fmt.Sprintf(
+		"SELECT request_hash, response, expires_at FROM %s WHERE schema_id = $1 AND idem_key = $2 AND expires_at > $3",
+		sanitizeIdentifier(tables.IdempotencyKeys),
+	)
+
+	record := &IdempotencyRecord{SchemaID: schemaID, Key: key}
+	err := r.querier(ctx).QueryRow(ctx, query, schemaID, key, r.nowMillis()).Scan(&record.RequestHash, &record.Response, &record.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load idempotency record: %w", err)
+	}
+
+	return record, nil
+}
+
+// SaveIdempotencyRecord stores record unless an unexpired record already holds the same key, in which
+// case it returns false. Expired records are overwritten.
+func (r *PostgresPersistentRecordRepository) SaveIdempotencyRecord(ctx context.Context, tables StorageTables, record *IdempotencyRecord) (bool, error) {
+	if tables.IdempotencyKeys == "" {
+		return false, fmt.Errorf("idempotency table name cannot be empty")
+	}
+	if record == nil {
+		return false, fmt.Errorf("idempotency record cannot be nil")
+	}
+
+	tx, err := r.beginTx(ctx)
+	if err != nil {
+		return false, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	now := r.nowMillis()
+	query := fmt.Sprintf(
+		`INSERT INTO %s AS t (schema_id, idem_key, request_hash, response, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (schema_id, idem_key) DO UPDATE
+		SET request_hash = EXCLUDED.request_hash, response = EXCLUDED.response,
+			created_at = EXCLUDED.created_at, expires_at = EXCLUDED.expires_at
+		WHERE t.expires_at <= EXCLUDED.created_at`,
+		sanitizeIdentifier(tables.IdempotencyKeys),
+	)
+	tag, err := tx.Exec(ctx, query, record.SchemaID, record.Key, record.RequestHash, record.Response, now, record.ExpiresAt)
+	if err != nil {
+		return false, fmt.Errorf("save idempotency record: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
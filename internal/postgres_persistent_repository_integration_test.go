@@ -166,6 +166,8 @@ func TestRunOptimizedQueryIntegration(t *testing.T) {
 		0,
 		nil,
 		true,
+		false,
+		nil,
 	)
 	require.NoError(t, err)
 	require.Len(t, records, 1)
@@ -218,6 +220,7 @@ func createTempPersistentTables(t *testing.T, ctx context.Context, pool *pgxpool
 		"ltbase_created_at BIGINT NOT NULL",
 		"ltbase_updated_at BIGINT NOT NULL",
 		"ltbase_deleted_at BIGINT",
+		"ltbase_revision BIGINT NOT NULL DEFAULT 1",
 	}
 
 	for _, col := range textColumns {
@@ -257,7 +260,7 @@ func createTempPersistentTables(t *testing.T, ctx context.Context, pool *pgxpool
 	require.NoError(t, err)
 
 	changeLogDDL := fmt.Sprintf(
-		`CREATE TABLE %s (schema_id SMALLINT NOT NULL, row_id UUID NOT NULL, flushed_at BIGINT NOT NULL DEFAULT 0, changed_at BIGINT NOT NULL, deleted_at BIGINT, PRIMARY KEY (schema_id, row_id, flushed_at))`,
+		`CREATE TABLE %s (schema_id SMALLINT NOT NULL, row_id UUID NOT NULL, flushed_at BIGINT NOT NULL DEFAULT 0, changed_at BIGINT NOT NULL, deleted_at BIGINT, tx_id XID8 NOT NULL DEFAULT pg_current_xact_id(), PRIMARY KEY (schema_id, row_id, flushed_at))`,
 		sanitizeIdentifier(changeLogTable),
 	)
 
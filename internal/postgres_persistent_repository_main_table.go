@@ -10,6 +10,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/lychee-technology/forma"
 	"go.uber.org/zap"
 )
 
@@ -177,6 +178,7 @@ func buildUpdateMainStatement(table string, record *PersistentRecord) (string, [
 	if len(assignments) == 0 {
 		return "", nil, fmt.Errorf("no columns to update")
 	}
+	assignments = append(assignments, "ltbase_revision = ltbase_revision + 1")
 
 	args = append(args, record.SchemaID, record.RowID)
 	whereSchemaIdx := len(args) - 1
@@ -200,6 +202,9 @@ func (r *PostgresPersistentRecordRepository) insertMainRow(ctx context.Context,
 	}
 	zap.S().Debugw("insert main row", "query", query, "args", args)
 	if _, err := tx.Exec(ctx, query, args...); err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("insert entity_main: %w: %s", forma.ErrEntityExists, record.RowID)
+		}
 		return fmt.Errorf("insert entity_main: %w", err)
 	}
 	return nil
@@ -223,7 +228,7 @@ func (r *PostgresPersistentRecordRepository) loadMainRecord(ctx context.Context,
 		sanitizeIdentifier(table),
 	)
 
-	row := r.pool.QueryRow(ctx, query, schemaID, rowID)
+	row := r.querier(ctx).QueryRow(ctx, query, schemaID, rowID)
 
 	// Count columns by kind to allocate proper buffer sizes
 	textCount, smallCount, intCount, bigCount, doubleCount, uuidCount := 0, 0, 0, 0, 0, 0
@@ -333,6 +338,8 @@ func (r *PostgresPersistentRecordRepository) loadMainRecord(ctx context.Context,
 					record.UpdatedAt = val.Int64
 				case "ltbase_deleted_at":
 					record.DeletedAt = &val.Int64
+				case "ltbase_revision":
+					record.Revision = val.Int64
 				default:
 					record.Int64Items[desc.name] = val.Int64
 				}
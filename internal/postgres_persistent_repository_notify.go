@@ -0,0 +1,138 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/lychee-technology/forma"
+	"go.uber.org/zap"
+)
+
+// ChangeNotification is the NOTIFY payload sent on StorageTables.NotifyChannel for every write.
+// Notifications are issued inside the write transaction, so listeners only see committed writes.
+type ChangeNotification struct {
+	SchemaID  int16                 `json:"schema_id"`
+	RowID     uuid.UUID             `json:"row_id"`
+	Operation forma.ChangeOperation `json:"op"`
+	ChangedAt int64                 `json:"changed_at"`
+}
+
+// listenPool is implemented by pools that can hand out a dedicated connection for LISTEN.
+type listenPool interface {
+	Acquire(ctx context.Context) (*pgxpool.Conn, error)
+}
+
+func (r *PostgresPersistentRecordRepository) notifyChange(ctx context.Context, tx pgx.Tx, tables StorageTables, op forma.ChangeOperation, schemaID int16, rowID uuid.UUID, changedAt int64) error {
+	payload, err := json.Marshal(ChangeNotification{SchemaID: schemaID, RowID: rowID, Operation: op, ChangedAt: changedAt})
+	if err != nil {
+		return fmt.Errorf("encode change notification: %w", err)
+	}
+	if _, err := tx.Exec(ctx, "SELECT pg_notify($1, $2)", tables.NotifyChannel, string(payload)); err != nil {
+		return fmt.Errorf("notify change: %w", err)
+	}
+	return nil
+}
+
+// notifyRowsSQL returns a statement sending one notification per row ID in $2 of schema $1.
+func notifyRowsSQL(op forma.ChangeOperation) string {
+	return fmt.Sprintf(
+		`SELECT pg_notify($3, json_build_object('schema_id', $1::smallint, 'row_id', r.row_id, 'op', '%s', 'changed_at', $4::bigint)::text)
+		FROM unnest($2::uuid[]) AS r(row_id)`,
+		op,
+	)
+}
+
+// notifyChannelArg appends the notify channel to args and returns its placeholder, or "" when
+// notifications are disabled.
+func notifyChannelArg(tables StorageTables, args *[]any) string {
+	if tables.NotifyChannel == "" {
+		return ""
+	}
+	*args = append(*args, tables.NotifyChannel)
+	return fmt.Sprintf("$%d", len(*args))
+}
+
+// countNotifiedSQL counts the rows returned by source, sending a notification for each of them
+// on channel unless channel is "". pg_notify is volatile, so the subquery is never optimized away.
+func countNotifiedSQL(source, channel string, op forma.ChangeOperation, changedAt string) string {
+	if channel == "" {
+		return "SELECT COUNT(*) FROM " + source
+	}
+	return fmt.Sprintf(
+		`SELECT COUNT(*) FROM (
+			SELECT pg_notify(%s, json_build_object('schema_id', ltbase_schema_id, 'row_id', ltbase_row_id, 'op', '%s', 'changed_at', %s::bigint)::text)
+			FROM %s
+		) notified`,
+		channel, op, changedAt, source,
+	)
+}
+
+// pgChangeSubscription is a pooled connection held in LISTEN on the notify channel.
+type pgChangeSubscription struct {
+	conn    *pgxpool.Conn
+	channel string
+}
+
+// SubscribeChanges holds a pooled connection in LISTEN on tables.NotifyChannel. Notifications sent
+// after it returns are buffered until read with Next; Close hands the connection back to the pool.
+func (r *PostgresPersistentRecordRepository) SubscribeChanges(ctx context.Context, tables StorageTables) (ChangeSubscription, error) {
+	if tables.NotifyChannel == "" {
+		return nil, fmt.Errorf("notify channel cannot be empty")
+	}
+	pool, ok := r.pool.(listenPool)
+	if !ok {
+		return nil, fmt.Errorf("connection pool does not support LISTEN")
+	}
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("acquire listen connection: %w", err)
+	}
+	if _, err := conn.Exec(ctx, "LISTEN "+sanitizeIdentifier(tables.NotifyChannel)); err != nil {
+		conn.Release()
+		return nil, fmt.Errorf("listen: %w", err)
+	}
+	return &pgChangeSubscription{conn: conn, channel: tables.NotifyChannel}, nil
+}
+
+// Next blocks until the next notification arrives or ctx is done, which is reported as ctx.Err().
+// Malformed payloads are logged and skipped.
+func (s *pgChangeSubscription) Next(ctx context.Context) (*ChangeNotification, error) {
+	for {
+		notification, err := s.conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, fmt.Errorf("wait for notification: %w", err)
+		}
+
+		var change ChangeNotification
+		if err := json.Unmarshal([]byte(notification.Payload), &change); err != nil {
+			zap.S().Warnw("ignoring malformed change notification", "payload", notification.Payload, "error", err)
+			continue
+		}
+		return &change, nil
+	}
+}
+
+func (s *pgChangeSubscription) Close() {
+	defer s.conn.Release()
+	// Waiting may have been interrupted by closing the connection, which pgxpool then discards.
+	if s.conn.Conn().IsClosed() {
+		return
+	}
+	// The connection goes back to the pool, so it must stop receiving notifications first.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := s.conn.Exec(ctx, "UNLISTEN *"); err != nil {
+		// A closed connection is discarded by the pool instead of being reused.
+		zap.S().Warnw("failed to unlisten, closing connection", "channel", s.channel, "error", err)
+		s.conn.Conn().Close(ctx)
+	}
+}
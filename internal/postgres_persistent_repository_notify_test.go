@@ -0,0 +1,154 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lychee-technology/forma"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInsertPersistentRecordNotifiesChange(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+	mock.MatchExpectationsInOrder(true)
+
+	repo := NewPostgresPersistentRecordRepository(mock, nil)
+	fixed := time.Date(2024, 7, 8, 9, 10, 11, 0, time.UTC)
+	repo.withClock(func() time.Time { return fixed })
+	fixedMillis := fixed.UnixMilli()
+
+	rowID := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+	record := &PersistentRecord{SchemaID: 1, RowID: rowID, TextItems: map[string]string{"text_01": "hello"}}
+	tables := StorageTables{EntityMain: "entity_main", EAVData: "eav_table", NotifyChannel: "forma_changes"}
+
+	expected := *record
+	expected.CreatedAt = fixedMillis
+	expected.UpdatedAt = fixedMillis
+	insertQuery, insertArgs, err := buildInsertMainStatement(tables.EntityMain, &expected)
+	require.NoError(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("^" + regexp.QuoteMeta(insertQuery) + "$").
+		WithArgs(insertArgs...).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec(`^SELECT pg_notify\(\$1, \$2\)$`).
+		WithArgs("forma_changes", `{"schema_id":1,"row_id":"11111111-1111-1111-1111-111111111111","op":"created","changed_at":1720429811000}`).
+		WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	mock.ExpectCommit()
+	mock.ExpectRollback()
+
+	require.NoError(t, repo.InsertPersistentRecord(ctx, tables, record))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdatePersistentRecordsWhereNotifiesChanges(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewPostgresPersistentRecordRepository(mock, nil)
+	fixed := time.Date(2024, 7, 8, 9, 10, 11, 0, time.UTC)
+	repo.withClock(func() time.Time { return fixed })
+	tables := StorageTables{EntityMain: "entity_main", EAVData: "eav_table", NotifyChannel: "forma_changes"}
+	condition := &forma.KvCondition{Attr: "text_04", Value: "equals:user-1"}
+	patch := &PersistentRecord{TextItems: map[string]string{"text_01": "closed"}}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`RETURNING m\.\*(?s).*SELECT COUNT\(\*\) FROM \(\s*SELECT pg_notify\(\$5, json_build_object\('schema_id', ltbase_schema_id, 'row_id', ltbase_row_id, 'op', 'updated', 'changed_at', \$3::bigint\)::text\)\s*FROM updated\s*\) notified`).
+		WithArgs(int16(1), "user-1", fixed.UnixMilli(), "closed", "forma_changes").
+		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(int64(3)))
+	mock.ExpectCommit()
+	mock.ExpectRollback()
+
+	affected, err := repo.UpdatePersistentRecordsWhere(ctx, tables, 1, condition, patch)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), affected)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPersistentRecordMatchesWithMockPool(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewPostgresPersistentRecordRepository(mock, nil)
+	tables := StorageTables{EntityMain: "entity_main", EAVData: "eav_table"}
+	rowID := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+	condition := &forma.KvCondition{Attr: "text_04", Value: "equals:user-1"}
+
+	mock.ExpectQuery(`^SELECT EXISTS \(SELECT 1 FROM "entity_main" m WHERE m\.ltbase_schema_id = \$1 AND m\.ltbase_row_id = \$3 AND m\.ltbase_deleted_at IS NULL AND \((?s).*\)\)$`).
+		WithArgs(int16(1), "user-1", rowID).
+		WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(true))
+
+	matches, err := repo.PersistentRecordMatches(ctx, tables, 1, rowID, condition)
+	require.NoError(t, err)
+	assert.True(t, matches)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListChangesSinceWithMockPool(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewPostgresPersistentRecordRepository(mock, nil)
+	tables := StorageTables{ChangeLog: "change_log"}
+	rowID := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+	deletedAt := int64(1500)
+
+	mock.ExpectQuery(`SELECT DISTINCT ON \(row_id\) schema_id, row_id, changed_at, deleted_at FROM "change_log"\s+WHERE schema_id = \$1 AND changed_at >= \$2\s+ORDER BY row_id, changed_at DESC\s+\) latest\s+ORDER BY changed_at, row_id$`).
+		WithArgs(int16(1), int64(1000)).
+		WillReturnRows(pgxmock.NewRows([]string{"schema_id", "row_id", "changed_at", "deleted_at"}).
+			AddRow(int16(1), rowID, int64(1500), &deletedAt))
+
+	entries, err := repo.ListChangesSince(ctx, tables, 1, 1000, uuid.Nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, rowID, entries[0].RowID)
+	require.NotNil(t, entries[0].DeletedAt)
+
+	// Resuming after an event starts strictly after its (changed_at, row_id) position.
+	mock.ExpectQuery(`WHERE schema_id = \$1 AND \(changed_at, row_id\) > \(\$2, \$3\)\s+ORDER BY row_id, changed_at DESC`).
+		WithArgs(int16(1), int64(1500), rowID).
+		WillReturnRows(pgxmock.NewRows([]string{"schema_id", "row_id", "changed_at", "deleted_at"}))
+
+	entries, err = repo.ListChangesSince(ctx, tables, 1, 1500, rowID)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSubscribeChangesIntegration(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	pool := connectTestPostgres(t, ctx)
+	tables := createTempPersistentTables(t, ctx, pool)
+	tables.NotifyChannel = fmt.Sprintf("forma_changes_it_%d", time.Now().UnixNano())
+	repo := NewPostgresPersistentRecordRepository(pool, nil)
+
+	subscription, err := repo.SubscribeChanges(ctx, tables)
+	require.NoError(t, err)
+	defer subscription.Close()
+
+	rowID := uuid.New()
+	require.NoError(t, repo.InsertPersistentRecord(ctx, tables, &PersistentRecord{SchemaID: 1, RowID: rowID}))
+
+	notification, err := subscription.Next(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int16(1), notification.SchemaID)
+	assert.Equal(t, rowID, notification.RowID)
+	assert.Equal(t, forma.ChangeOperationCreated, notification.Operation)
+}
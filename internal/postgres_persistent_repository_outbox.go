@@ -0,0 +1,151 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/lychee-technology/forma"
+)
+
+// OutboxRecord is an undispatched row of the outbox table. Snapshot holds the entity exactly as
+// committed by the write, in the history snapshot format; it is nil for hard deletes.
+type OutboxRecord struct {
+	ID          int64
+	SchemaID    int16
+	RowID       uuid.UUID
+	Operation   forma.ChangeOperation
+	Revision    int64
+	CommittedAt int64
+	Snapshot    *PersistentRecord
+}
+
+// outboxSelectSQL returns an outbox INSERT fed by a SELECT over source (aliased as m) that produces
+// one outbox row per source row. committedAt is a SQL expression. When removed is set the rows are
+// about to be hard deleted: the snapshot is omitted and the revision is the one the removal would
+// have produced.
+func outboxSelectSQL(tables StorageTables, source string, operation forma.ChangeOperation, removed bool, committedAt string) string {
+	revision, snapshot := "m.ltbase_revision", historySnapshotSQL(tables.EAVData, "m")
+	if removed {
+		revision, snapshot = "m.ltbase_revision + 1", "NULL"
+	}
+	return fmt.Sprintf(`INSERT INTO %s (schema_id, row_id, operation, revision, committed_at, snapshot, dispatched_at)
+			SELECT m.ltbase_schema_id, m.ltbase_row_id, '%s', %s, %s, %s, 0 FROM %s m`,
+		sanitizeIdentifier(tables.Outbox), operation, revision, committedAt, snapshot, source)
+}
+
+// outboxCTE returns a data-modifying CTE that writes an outbox row for every entity_main row
+// returned by source. Set-based statements must return whole rows (RETURNING m.*) for this.
+func outboxCTE(tables StorageTables, source string, operation forma.ChangeOperation, removed bool, committedAt string) string {
+	if tables.Outbox == "" {
+		return ""
+	}
+	return fmt.Sprintf(`,
+		queued AS (
+			%s
+		)`, outboxSelectSQL(tables, source, operation, removed, committedAt))
+}
+
+// insertOutbox writes the outbox row of a single-row write in its transaction. Like insertHistory it
+// runs after writes that keep the row and, with removed set, before hard deletes, which lock the row
+// first. Writes to one entity therefore hold its entity_main row lock while they take an outbox ID, so
+// the IDs of an entity follow its commit order.
+func (r *PostgresPersistentRecordRepository) insertOutbox(ctx context.Context, tx pgx.Tx, tables StorageTables, operation forma.ChangeOperation, removed bool, schemaID int16, rowID uuid.UUID, committedAt int64) error {
+	query := outboxSelectSQL(tables, sanitizeIdentifier(tables.EntityMain), operation, removed, "$3") +
+		" WHERE m.ltbase_schema_id = $1 AND m.ltbase_row_id = $2"
+	if removed {
+		query += " FOR UPDATE OF m"
+	}
+	if _, err := tx.Exec(ctx, query, schemaID, rowID, committedAt); err != nil {
+		return fmt.Errorf("insert outbox: %w", err)
+	}
+	return nil
+}
+
+// LeaseOutbox returns up to limit undispatched outbox rows in outbox order. Only one dispatcher may
+// relay the outbox at a time, which keeps the events of every entity in order: the first call takes a
+// transaction-scoped advisory lock and concurrent callers get no rows. The transaction carried by ctx
+// is required.
+func (r *PostgresPersistentRecordRepository) LeaseOutbox(ctx context.Context, tables StorageTables, limit int) ([]*OutboxRecord, error) {
+	if tables.Outbox == "" {
+		return nil, fmt.Errorf("outbox table name cannot be empty")
+	}
+	tx, ok := txFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("leasing the outbox requires a transaction")
+	}
+	if limit <= 0 {
+		return nil, fmt.Errorf("limit must be positive")
+	}
+
+	var locked bool
+	if err := tx.QueryRow(ctx, "SELECT pg_try_advisory_xact_lock(hashtext($1))", tables.Outbox).Scan(&locked); err != nil {
+		return nil, fmt.Errorf("lock outbox: %w", err)
+	}
+	if !locked {
+		return nil, nil
+	}
+
+	query := fmt.Sprintf(
+		`SELECT outbox_id, schema_id, row_id, operation, revision, committed_at, snapshot FROM %s
+		WHERE dispatched_at = 0
+		ORDER BY outbox_id
+		LIMIT $1`,
+		sanitizeIdentifier(tables.Outbox),
+	)
+	rows, err := tx.Query(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("lease outbox: %w", err)
+	}
+	defer rows.Close()
+
+	var records []*OutboxRecord
+	for rows.Next() {
+		var (
+			record    OutboxRecord
+			operation string
+			snapshot  []byte
+		)
+		if err := rows.Scan(&record.ID, &record.SchemaID, &record.RowID, &operation, &record.Revision, &record.CommittedAt, &snapshot); err != nil {
+			return nil, fmt.Errorf("scan outbox: %w", err)
+		}
+		record.Operation = forma.ChangeOperation(operation)
+		if snapshot != nil {
+			record.Snapshot, err = decodeHistorySnapshot(record.SchemaID, record.RowID, snapshot)
+			if err != nil {
+				return nil, fmt.Errorf("decode outbox row %d: %w", record.ID, err)
+			}
+		}
+		records = append(records, &record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate outbox: %w", err)
+	}
+	return records, nil
+}
+
+// MarkOutboxDispatched stamps the outbox rows ids as dispatched now. It must run in the transaction
+// that leased them.
+func (r *PostgresPersistentRecordRepository) MarkOutboxDispatched(ctx context.Context, tables StorageTables, ids []int64) (int64, error) {
+	if tables.Outbox == "" {
+		return 0, fmt.Errorf("outbox table name cannot be empty")
+	}
+	tx, ok := txFromContext(ctx)
+	if !ok {
+		return 0, fmt.Errorf("dispatching the outbox requires a transaction")
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	query := fmt.Sprintf(
+		"UPDATE %s SET dispatched_at = $1 WHERE outbox_id = ANY($2) AND dispatched_at = 0",
+		sanitizeIdentifier(tables.Outbox),
+	)
+	tag, err := tx.Exec(ctx, query, r.nowMillis(), ids)
+	if err != nil {
+		return 0, fmt.Errorf("mark outbox dispatched: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
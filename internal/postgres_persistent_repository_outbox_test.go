@@ -0,0 +1,296 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/lychee-technology/forma"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdatePersistentRecordWritesOutbox(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+	mock.MatchExpectationsInOrder(true)
+
+	repo := NewPostgresPersistentRecordRepository(mock, nil)
+	fixed := time.Date(2024, 7, 8, 9, 10, 11, 0, time.UTC)
+	repo.withClock(func() time.Time { return fixed })
+	fixedMillis := fixed.UnixMilli()
+
+	rowID := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+	record := &PersistentRecord{SchemaID: 1, RowID: rowID, Revision: 1, TextItems: map[string]string{"text_01": "hello"}}
+	tables := StorageTables{EntityMain: "entity_main", EAVData: "eav_table", Outbox: "outbox"}
+
+	expected := *record
+	expected.UpdatedAt = fixedMillis
+	updateQuery, updateArgs, err := buildUpdateMainStatement(tables.EntityMain, &expected)
+	require.NoError(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("^" + regexp.QuoteMeta(updateQuery) + "$").
+		WithArgs(updateArgs...).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec(`^DELETE FROM "eav_table"`).
+		WithArgs(int16(1), rowID).
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+	mock.ExpectExec(`^INSERT INTO "outbox" \(schema_id, row_id, operation, revision, committed_at, snapshot, dispatched_at\)(?s).*'updated', m\.ltbase_revision, \$3,(?s).*FROM "eav_table" e(?s).*FROM "entity_main" m\s+WHERE m\.ltbase_schema_id = \$1 AND m\.ltbase_row_id = \$2$`).
+		WithArgs(int16(1), rowID, fixedMillis).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
+	mock.ExpectRollback()
+
+	require.NoError(t, repo.UpdatePersistentRecord(ctx, tables, record))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeletePersistentRecordWritesOutboxBeforeDelete(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+	mock.MatchExpectationsInOrder(true)
+
+	repo := NewPostgresPersistentRecordRepository(mock, nil)
+	fixed := time.Date(2024, 7, 8, 9, 10, 11, 0, time.UTC)
+	repo.withClock(func() time.Time { return fixed })
+
+	rowID := uuid.MustParse("22222222-2222-2222-2222-222222222222")
+	tables := StorageTables{EntityMain: "entity_main", EAVData: "eav_table", Outbox: "outbox"}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^INSERT INTO "outbox"(?s).*'deleted', m\.ltbase_revision \+ 1, \$3, NULL, 0 FROM "entity_main" m(?s).*FOR UPDATE OF m$`).
+		WithArgs(int16(1), rowID, fixed.UnixMilli()).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec(`^DELETE FROM "entity_main"`).
+		WithArgs(int16(1), rowID).
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	mock.ExpectExec(`^DELETE FROM "eav_table"`).
+		WithArgs(int16(1), rowID).
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	mock.ExpectCommit()
+	mock.ExpectRollback()
+
+	require.NoError(t, repo.DeletePersistentRecord(ctx, tables, 1, rowID))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLeaseAndMarkOutboxWithMockPool(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+	mock.MatchExpectationsInOrder(true)
+
+	repo := NewPostgresPersistentRecordRepository(mock, nil)
+	fixed := time.Date(2024, 7, 8, 9, 10, 11, 0, time.UTC)
+	repo.withClock(func() time.Time { return fixed })
+	tables := StorageTables{EntityMain: "entity_main", EAVData: "eav_table", Outbox: "outbox"}
+
+	rowID := uuid.MustParse("33333333-3333-3333-3333-333333333333")
+	snapshot := []byte(`{"main": {"ltbase_row_id": "33333333-3333-3333-3333-333333333333", "ltbase_revision": 2, "text_01": "hello"},
+		"eav": [{"attr_id": 3, "array_indices": "", "value_text": "x", "value_numeric": null}]}`)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^SELECT pg_try_advisory_xact_lock\(hashtext\(\$1\)\)$`).
+		WithArgs("outbox").
+		WillReturnRows(pgxmock.NewRows([]string{"locked"}).AddRow(true))
+	mock.ExpectQuery(`^SELECT outbox_id, schema_id, row_id, operation, revision, committed_at, snapshot FROM "outbox"\s+WHERE dispatched_at = 0\s+ORDER BY outbox_id\s+LIMIT \$1$`).
+		WithArgs(10).
+		WillReturnRows(pgxmock.NewRows([]string{"outbox_id", "schema_id", "row_id", "operation", "revision", "committed_at", "snapshot"}).
+			AddRow(int64(7), int16(1), rowID, "updated", int64(2), int64(1000), snapshot).
+			AddRow(int64(8), int16(1), rowID, "deleted", int64(3), int64(2000), nil))
+	mock.ExpectExec(`^UPDATE "outbox" SET dispatched_at = \$1 WHERE outbox_id = ANY\(\$2\) AND dispatched_at = 0$`).
+		WithArgs(fixed.UnixMilli(), []int64{7, 8}).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 2))
+	mock.ExpectCommit()
+
+	var dispatched int64
+	err = repo.RunInTx(ctx, func(txCtx context.Context) error {
+		records, err := repo.LeaseOutbox(txCtx, tables, 10)
+		if err != nil {
+			return err
+		}
+		require.Len(t, records, 2)
+		assert.Equal(t, forma.ChangeOperationUpdated, records[0].Operation)
+		require.NotNil(t, records[0].Snapshot)
+		assert.Equal(t, "hello", records[0].Snapshot.TextItems["text_01"])
+		assert.Len(t, records[0].Snapshot.OtherAttributes, 1)
+		assert.Nil(t, records[1].Snapshot)
+
+		dispatched, err = repo.MarkOutboxDispatched(txCtx, tables, []int64{records[0].ID, records[1].ID})
+		return err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), dispatched)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLeaseOutboxSkipsWhileAnotherDispatcherIsActive(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewPostgresPersistentRecordRepository(mock, nil)
+	tables := StorageTables{Outbox: "outbox"}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^SELECT pg_try_advisory_xact_lock`).
+		WithArgs("outbox").
+		WillReturnRows(pgxmock.NewRows([]string{"locked"}).AddRow(false))
+	mock.ExpectCommit()
+
+	err = repo.RunInTx(ctx, func(txCtx context.Context) error {
+		records, err := repo.LeaseOutbox(txCtx, tables, 10)
+		assert.Empty(t, records)
+		return err
+	})
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	_, err = repo.LeaseOutbox(ctx, tables, 10)
+	assert.Error(t, err, "leasing outside a transaction must fail")
+}
+
+func TestSetBasedWritesOutboxWithMockPool(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+	mock.MatchExpectationsInOrder(true)
+
+	repo := NewPostgresPersistentRecordRepository(mock, nil)
+	fixed := time.Date(2024, 7, 8, 9, 10, 11, 0, time.UTC)
+	repo.withClock(func() time.Time { return fixed })
+	tables := StorageTables{EntityMain: "entity_main", EAVData: "eav_table", Outbox: "outbox"}
+	condition := &forma.KvCondition{Attr: "text_04", Value: "equals:user-1"}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`RETURNING m\.\*(?s).*queued AS \(\s*INSERT INTO "outbox"(?s).*'updated', m\.ltbase_revision, \$3,(?s).*FROM updated m\s*\)`).
+		WithArgs(int16(1), "user-1", fixed.UnixMilli(), "closed").
+		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(int64(2)))
+	mock.ExpectCommit()
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`RETURNING m\.\*(?s).*queued AS \(\s*INSERT INTO "outbox"(?s).*'deleted', m\.ltbase_revision, \$3,(?s).*FROM deleted m\s*\)`).
+		WithArgs(int16(1), "user-1", fixed.UnixMilli()).
+		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(int64(2)))
+	mock.ExpectCommit()
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`deleted_eav AS(?s).*queued AS \(\s*INSERT INTO "outbox"(?s).*'deleted', m\.ltbase_revision \+ 1, \$3, NULL, 0 FROM deleted m\s*\)`).
+		WithArgs(int16(1), "user-1", fixed.UnixMilli()).
+		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(int64(1)))
+	mock.ExpectCommit()
+	mock.ExpectRollback()
+
+	patch := &PersistentRecord{TextItems: map[string]string{"text_01": "closed"}}
+	_, err = repo.UpdatePersistentRecordsWhere(ctx, tables, 1, condition, patch)
+	require.NoError(t, err)
+	_, err = repo.DeletePersistentRecordsWhere(ctx, tables, 1, condition, true)
+	require.NoError(t, err)
+	_, err = repo.DeletePersistentRecordsWhere(ctx, tables, 1, condition, false)
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBulkInsertAndPurgeWriteOutboxWithMockPool(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+	mock.MatchExpectationsInOrder(true)
+
+	repo := NewPostgresPersistentRecordRepository(mock, nil)
+	fixed := time.Date(2024, 7, 8, 9, 10, 11, 0, time.UTC)
+	repo.withClock(func() time.Time { return fixed })
+	tables := StorageTables{EntityMain: "entity_main", EAVData: "eav_table", Outbox: "outbox"}
+
+	first := uuid.MustParse("66666666-6666-6666-6666-666666666666")
+	second := uuid.MustParse("77777777-7777-7777-7777-777777777777")
+	records := []*PersistentRecord{{SchemaID: 1, RowID: first}, {SchemaID: 1, RowID: second}}
+
+	mock.ExpectBegin()
+	mock.ExpectCopyFrom(pgx.Identifier{"entity_main"}, bulkMainColumns()).WillReturnResult(2)
+	mock.ExpectExec(`^INSERT INTO "outbox"(?s).*'created', m\.ltbase_revision, \$3,(?s).*FROM "entity_main" m WHERE m\.ltbase_schema_id = \$1 AND m\.ltbase_row_id = ANY\(\$2\)$`).
+		WithArgs(int16(1), []uuid.UUID{first, second}, fixed.UnixMilli()).
+		WillReturnResult(pgxmock.NewResult("INSERT", 2))
+	mock.ExpectCommit()
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec(`^INSERT INTO "outbox"(?s).*'deleted', m\.ltbase_revision \+ 1, \$3, NULL, 0 FROM "entity_main" m WHERE m\.ltbase_schema_id = \$1 AND m\.ltbase_deleted_at IS NOT NULL AND m\.ltbase_deleted_at < \$2$`).
+		WithArgs(int16(1), int64(1000), fixed.UnixMilli()).
+		WillReturnResult(pgxmock.NewResult("INSERT", 2))
+	mock.ExpectExec(`^DELETE FROM "eav_table" e USING "entity_main" m`).
+		WithArgs(int16(1), int64(1000)).
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+	mock.ExpectExec(`^DELETE FROM "entity_main"`).
+		WithArgs(int16(1), int64(1000)).
+		WillReturnResult(pgxmock.NewResult("DELETE", 2))
+	mock.ExpectCommit()
+	mock.ExpectRollback()
+
+	require.NoError(t, repo.BulkInsertPersistentRecords(ctx, tables, records))
+	_, err = repo.PurgePersistentRecords(ctx, tables, 1, 1000)
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOutboxCoversEveryWritePathIntegration(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Second)
+	defer cancel()
+
+	pool := connectTestPostgres(t, ctx)
+	tables := createTempPersistentTables(t, ctx, pool)
+	tables.Outbox = fmt.Sprintf("outbox_it_%d", time.Now().UnixNano())
+	_, err := pool.Exec(ctx, fmt.Sprintf(`CREATE TABLE %s (
+		outbox_id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY, schema_id SMALLINT NOT NULL, row_id UUID NOT NULL,
+		operation TEXT NOT NULL, revision BIGINT NOT NULL, committed_at BIGINT NOT NULL, snapshot JSONB,
+		dispatched_at BIGINT NOT NULL DEFAULT 0)`, sanitizeIdentifier(tables.Outbox)))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, _ = pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %s", sanitizeIdentifier(tables.Outbox)))
+	})
+
+	repo := NewPostgresPersistentRecordRepository(pool, nil)
+	countOutbox := func(operation forma.ChangeOperation) int {
+		var count int
+		query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE operation = $1", sanitizeIdentifier(tables.Outbox))
+		require.NoError(t, pool.QueryRow(ctx, query, operation).Scan(&count))
+		return count
+	}
+
+	var records []*PersistentRecord
+	for _, owner := range []string{"a", "a", "b", "c"} {
+		records = append(records, &PersistentRecord{SchemaID: 1, RowID: uuid.New(), TextItems: map[string]string{"text_01": owner}})
+	}
+	require.NoError(t, repo.BulkInsertPersistentRecords(ctx, tables, records))
+	assert.Equal(t, 4, countOutbox(forma.ChangeOperationCreated))
+
+	updated, err := repo.UpdatePersistentRecordsWhere(ctx, tables, 1, &forma.KvCondition{Attr: "text_01", Value: "equals:a"},
+		&PersistentRecord{TextItems: map[string]string{"text_02": "closed"}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), updated)
+	assert.Equal(t, 2, countOutbox(forma.ChangeOperationUpdated))
+
+	_, err = repo.DeletePersistentRecordsWhere(ctx, tables, 1, &forma.KvCondition{Attr: "text_01", Value: "equals:a"}, true)
+	require.NoError(t, err)
+	_, err = repo.DeletePersistentRecordsWhere(ctx, tables, 1, &forma.KvCondition{Attr: "text_01", Value: "equals:b"}, false)
+	require.NoError(t, err)
+	assert.Equal(t, 3, countOutbox(forma.ChangeOperationDeleted))
+
+	purged, err := repo.PurgePersistentRecords(ctx, tables, 1, time.Now().Add(time.Hour).UnixMilli())
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), purged)
+	assert.Equal(t, 5, countOutbox(forma.ChangeOperationDeleted))
+}
@@ -33,6 +33,8 @@ func (r *PostgresPersistentRecordRepository) runOptimizedQuery(
 	limit, offset int,
 	attributeOrders []AttributeOrder,
 	useMainTableAsAnchor bool,
+	includeDeleted bool,
+	asOf *int64,
 ) ([]*PersistentRecord, int64, error) {
 	if clause == "" {
 		return nil, 0, fmt.Errorf("query condition cannot be empty")
@@ -53,6 +55,7 @@ func (r *PostgresPersistentRecordRepository) runOptimizedQuery(
 		"MainProjection":       entityMainProjection,
 		"SchemaID":             "$1",
 		"UseMainTableAsAnchor": useMainTableAsAnchor,
+		"IncludeDeleted":       includeDeleted,
 		"Anchor": map[string]any{
 			"Condition": clause,
 		},
@@ -62,19 +65,31 @@ func (r *PostgresPersistentRecordRepository) runOptimizedQuery(
 		"PageSize": fmt.Sprintf("$%d", len(args)+2),
 	}
 
+	if asOf != nil {
+		if tables.History == "" {
+			return nil, 0, fmt.Errorf("history table name cannot be empty")
+		}
+		sqlParams["AsOf"] = asOfCTEs(tables, "$1", fmt.Sprintf("$%d", len(args)+4))
+		sqlParams["EAVTable"] = sanitizeIdentifier(asOfEAVCTE)
+		sqlParams["MainTable"] = sanitizeIdentifier(asOfMainCTE)
+	}
+
 	query, err := renderTemplate(optimizedQuerySQLTemplate, sqlParams)
 	if err != nil {
 		return nil, 0, fmt.Errorf("build optimized query: %w", err)
 	}
 
-	queryArgs := make([]any, 0, len(args)+3)
+	queryArgs := make([]any, 0, len(args)+4)
 	queryArgs = append(queryArgs, schemaID)
 	queryArgs = append(queryArgs, args...)
 	queryArgs = append(queryArgs, limit, offset)
+	if asOf != nil {
+		queryArgs = append(queryArgs, *asOf)
+	}
 
 	zap.S().Debugw("optimized query", "query", query, "args", queryArgs)
 
-	rows, err := r.pool.Query(ctx, query, queryArgs...)
+	rows, err := r.querier(ctx).Query(ctx, query, queryArgs...)
 	if err != nil {
 		return nil, 0, fmt.Errorf("execute optimized query: %w", err)
 	}
@@ -228,6 +243,8 @@ func (r *PostgresPersistentRecordRepository) scanOptimizedRow(rows pgx.Rows) (*P
 					record.UpdatedAt = val.Int64
 				case "ltbase_deleted_at":
 					record.DeletedAt = &val.Int64
+				case "ltbase_revision":
+					record.Revision = val.Int64
 				default:
 					record.Int64Items[desc.name] = val.Int64
 				}
@@ -336,11 +353,9 @@ func hasMainTableCondition(cond forma.Condition, cache forma.SchemaAttributeCach
 			return true
 		}
 		// Check if it's an attribute with column_binding to main table
-		if cache != nil {
-			if meta, ok := cache[c.Attr]; ok {
-				if meta.Location() == forma.AttributeStorageLocationMain {
-					return true
-				}
+		if meta, ok := lookupAttribute(cache, c.Attr); ok {
+			if meta.Location() == forma.AttributeStorageLocationMain {
+				return true
 			}
 		}
 		return false
@@ -507,22 +522,18 @@ func (r *PostgresPersistentRecordRepository) buildHybridConditions(
 			if isMainTableColumn(cond.Attr) {
 				// Raw column name like text_01, text_02, etc.
 				colName = cond.Attr
-			} else if cache != nil {
+			} else if meta, ok := lookupAttribute(cache, cond.Attr); ok {
 				// Check if attribute has column_binding to main table
-				if meta, ok := cache[cond.Attr]; ok {
-					if meta.ColumnBinding != nil {
-						colName = string(meta.ColumnBinding.ColumnName)
-					}
+				if meta.ColumnBinding != nil {
+					colName = string(meta.ColumnBinding.ColumnName)
 				}
 			}
 
 			if colName != "" {
 				// Main table column query - pass metadata for date/time conversion
 				var attrMeta *forma.AttributeMetadata
-				if cache != nil {
-					if meta, ok := cache[cond.Attr]; ok {
-						attrMeta = &meta
-					}
+				if meta, ok := lookupAttribute(cache, cond.Attr); ok {
+					attrMeta = &meta
 				}
 				op, val, err := parseKvConditionForColumnWithMeta(cond, colName, attrMeta)
 				if err != nil {
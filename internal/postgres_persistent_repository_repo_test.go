@@ -2,11 +2,15 @@ package internal
 
 import (
 	"context"
+	"errors"
 	"regexp"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/lychee-technology/forma"
 	"github.com/pashagolub/pgxmock/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -161,6 +165,404 @@ func TestDeletePersistentRecordWithMockPool(t *testing.T) {
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestSoftDeleteRestorePersistentRecordWithMockPool(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+	mock.MatchExpectationsInOrder(true)
+
+	repo := NewPostgresPersistentRecordRepository(mock, nil)
+	fixed := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	repo.withClock(func() time.Time { return fixed })
+
+	rowID := uuid.MustParse("44444444-4444-4444-4444-444444444444")
+	tables := StorageTables{EntityMain: "entity_main", EAVData: "eav_table", ChangeLog: "change_log"}
+	fixedMillis := fixed.UnixMilli()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^UPDATE "entity_main" SET ltbase_deleted_at = \$1`).
+		WithArgs(fixedMillis, int16(1), rowID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec(`^INSERT INTO "change_log"`).
+		WithArgs(int16(1), rowID, int64(0), fixedMillis, fixedMillis).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
+	mock.ExpectRollback()
+
+	require.NoError(t, repo.SoftDeletePersistentRecord(ctx, tables, 1, rowID))
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^UPDATE "entity_main" SET ltbase_deleted_at = NULL`).
+		WithArgs(fixedMillis, int16(1), rowID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec(`^INSERT INTO "change_log"`).
+		WithArgs(int16(1), rowID, int64(0), fixedMillis, nil).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
+	mock.ExpectRollback()
+
+	require.NoError(t, repo.RestorePersistentRecord(ctx, tables, 1, rowID))
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^UPDATE "entity_main" SET ltbase_deleted_at = NULL`).
+		WithArgs(fixedMillis, int16(1), rowID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+	mock.ExpectRollback()
+
+	require.Error(t, repo.RestorePersistentRecord(ctx, tables, 1, rowID))
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPurgePersistentRecordsWithMockPool(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+	mock.MatchExpectationsInOrder(true)
+
+	repo := NewPostgresPersistentRecordRepository(mock, nil)
+	tables := StorageTables{EntityMain: "entity_main", EAVData: "eav_table", ChangeLog: "change_log"}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^DELETE FROM "eav_table" e USING "entity_main" m`).
+		WithArgs(int16(1), int64(1000)).
+		WillReturnResult(pgxmock.NewResult("DELETE", 6))
+	mock.ExpectExec(`^DELETE FROM "entity_main"`).
+		WithArgs(int16(1), int64(1000)).
+		WillReturnResult(pgxmock.NewResult("DELETE", 2))
+	mock.ExpectCommit()
+	mock.ExpectRollback()
+
+	purged, err := repo.PurgePersistentRecords(ctx, tables, 1, 1000)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), purged)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIdempotencyRecordsWithMockPool(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+	mock.MatchExpectationsInOrder(true)
+
+	repo := NewPostgresPersistentRecordRepository(mock, nil)
+	fixed := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	repo.withClock(func() time.Time { return fixed })
+	fixedMillis := fixed.UnixMilli()
+	tables := StorageTables{IdempotencyKeys: "idempotency_keys"}
+
+	mock.ExpectQuery(`^SELECT request_hash, response, expires_at FROM "idempotency_keys"`).
+		WithArgs(int16(1), "key-1", fixedMillis).
+		WillReturnRows(pgxmock.NewRows([]string{"request_hash", "response", "expires_at"}))
+	mock.ExpectBegin()
+	mock.ExpectExec(`^INSERT INTO "idempotency_keys" AS t`).
+		WithArgs(int16(1), "key-1", "hash", []byte(`{}`), fixedMillis, fixedMillis+1000).
+		WillReturnResult(pgxmock.NewResult("INSERT", 0))
+	mock.ExpectCommit()
+	mock.ExpectRollback()
+	mock.ExpectQuery(`^SELECT request_hash, response, expires_at FROM "idempotency_keys"`).
+		WithArgs(int16(1), "key-1", fixedMillis).
+		WillReturnRows(pgxmock.NewRows([]string{"request_hash", "response", "expires_at"}).
+			AddRow("hash", []byte(`{}`), fixedMillis+1000))
+
+	missing, err := repo.GetIdempotencyRecord(ctx, tables, 1, "key-1")
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	saved, err := repo.SaveIdempotencyRecord(ctx, tables, &IdempotencyRecord{
+		SchemaID:    1,
+		Key:         "key-1",
+		RequestHash: "hash",
+		Response:    []byte(`{}`),
+		ExpiresAt:   fixedMillis + 1000,
+	})
+	require.NoError(t, err)
+	assert.False(t, saved, "an unexpired key must not be overwritten")
+
+	stored, err := repo.GetIdempotencyRecord(ctx, tables, 1, "key-1")
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+	assert.Equal(t, "hash", stored.RequestHash)
+	assert.Equal(t, fixedMillis+1000, stored.ExpiresAt)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestInsertPersistentRecordDuplicateRowID(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewPostgresPersistentRecordRepository(mock, nil)
+	rowID := uuid.MustParse("66666666-6666-6666-6666-666666666666")
+	tables := StorageTables{EntityMain: "entity_main", EAVData: "eav_table"}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^INSERT INTO "entity_main"`).
+		WithArgs(int16(1), rowID, pgxmock.AnyArg(), pgxmock.AnyArg()).
+		WillReturnError(&pgconn.PgError{Code: "23505"})
+	mock.ExpectRollback()
+
+	err = repo.InsertPersistentRecord(ctx, tables, &PersistentRecord{SchemaID: 1, RowID: rowID})
+	require.ErrorIs(t, err, forma.ErrEntityExists)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdatePersistentRecordsWhereWithMockPool(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+	mock.MatchExpectationsInOrder(true)
+
+	repo := NewPostgresPersistentRecordRepository(mock, nil)
+	fixed := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	repo.withClock(func() time.Time { return fixed })
+	fixedMillis := fixed.UnixMilli()
+	tables := StorageTables{EntityMain: "entity_main", EAVData: "eav_table", ChangeLog: "change_log"}
+	condition := &forma.KvCondition{Attr: "text_04", Value: "equals:user-1"}
+
+	mock.ExpectQuery(`^SELECT COUNT\(\*\) FROM "entity_main" m WHERE m.ltbase_schema_id = \$1 AND m.ltbase_deleted_at IS NULL AND \(m."text_04" = \$2\)`).
+		WithArgs(int16(1), "user-1").
+		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(int64(3)))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE "entity_main" AS m SET ltbase_updated_at = \$3, text_04 = \$4(?s).*INSERT INTO "change_log"(?s).*SELECT COUNT\(\*\) FROM updated`).
+		WithArgs(int16(1), "user-1", fixedMillis, "user-2").
+		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(int64(3)))
+	mock.ExpectCommit()
+	mock.ExpectRollback()
+
+	count, err := repo.CountPersistentRecordsWhere(ctx, tables, 1, condition)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+
+	updated, err := repo.UpdatePersistentRecordsWhere(ctx, tables, 1, condition, &PersistentRecord{
+		TextItems: map[string]string{"text_04": "user-2"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), updated)
+
+	_, err = repo.UpdatePersistentRecordsWhere(ctx, tables, 1, condition, &PersistentRecord{
+		OtherAttributes: []EAVRecord{{AttrID: 7}},
+	})
+	assert.Error(t, err, "EAV attributes cannot be updated set-based")
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeletePersistentRecordsWhereWithMockPool(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+	mock.MatchExpectationsInOrder(true)
+
+	repo := NewPostgresPersistentRecordRepository(mock, nil)
+	fixed := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	repo.withClock(func() time.Time { return fixed })
+	fixedMillis := fixed.UnixMilli()
+	tables := StorageTables{EntityMain: "entity_main", EAVData: "eav_table"}
+	condition := &forma.KvCondition{Attr: "text_04", Value: "equals:user-1"}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE "entity_main" AS m SET ltbase_deleted_at = \$3, ltbase_updated_at = \$3(?s).*SELECT COUNT\(\*\) FROM deleted`).
+		WithArgs(int16(1), "user-1", fixedMillis).
+		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(int64(2)))
+	mock.ExpectCommit()
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`DELETE FROM "entity_main" AS m(?s).*DELETE FROM "eav_table" e USING deleted d(?s).*SELECT COUNT\(\*\) FROM deleted`).
+		WithArgs(int16(1), "user-1", fixedMillis).
+		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(int64(2)))
+	mock.ExpectCommit()
+	mock.ExpectRollback()
+
+	softDeleted, err := repo.DeletePersistentRecordsWhere(ctx, tables, 1, condition, true)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), softDeleted)
+
+	hardDeleted, err := repo.DeletePersistentRecordsWhere(ctx, tables, 1, condition, false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), hardDeleted)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRunInTxRollsBackNestedWrites(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+	mock.MatchExpectationsInOrder(true)
+
+	repo := NewPostgresPersistentRecordRepository(mock, nil)
+	fixed := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	repo.withClock(func() time.Time { return fixed })
+
+	rowID := uuid.MustParse("55555555-5555-5555-5555-555555555555")
+	tables := StorageTables{EntityMain: "entity_main", EAVData: "eav_table", ChangeLog: "change_log"}
+	fixedMillis := fixed.UnixMilli()
+
+	// Outer transaction, then a savepoint for the delete.
+	mock.ExpectBegin()
+	mock.ExpectBegin()
+	mock.ExpectExec(`^DELETE FROM "entity_main"`).
+		WithArgs(int16(1), rowID).
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	mock.ExpectExec(`^DELETE FROM "eav_table"`).
+		WithArgs(int16(1), rowID).
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	mock.ExpectExec(`^INSERT INTO "change_log"`).
+		WithArgs(int16(1), rowID, int64(0), fixedMillis, fixedMillis).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
+	mock.ExpectRollback()
+	mock.ExpectRollback()
+
+	failure := errors.New("second operation failed")
+	err = repo.RunInTx(ctx, func(txCtx context.Context) error {
+		require.NoError(t, repo.DeletePersistentRecord(txCtx, tables, 1, rowID))
+		return failure
+	})
+	require.ErrorIs(t, err, failure)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRunInTxCommits(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+	mock.MatchExpectationsInOrder(true)
+
+	repo := NewPostgresPersistentRecordRepository(mock, nil)
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	mock.ExpectRollback()
+
+	calls := 0
+	err = repo.RunInTx(ctx, func(txCtx context.Context) error {
+		calls++
+		_, ok := txFromContext(txCtx)
+		assert.True(t, ok)
+		// Nested calls join the outer transaction instead of opening a new one.
+		return repo.RunInTx(txCtx, func(context.Context) error {
+			calls++
+			return nil
+		})
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRunInTxWithOptionsIsolationLevel(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewPostgresPersistentRecordRepository(mock, nil)
+
+	mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
+	mock.ExpectCommit()
+	mock.ExpectRollback()
+
+	err = repo.RunInTxWithOptions(ctx, TxOptions{IsolationLevel: "REPEATABLE_READ"}, func(context.Context) error {
+		return nil
+	})
+	require.NoError(t, err)
+
+	err = repo.RunInTxWithOptions(ctx, TxOptions{IsolationLevel: "SNAPSHOT"}, func(context.Context) error {
+		t.Fatal("fn must not run for an unsupported isolation level")
+		return nil
+	})
+	require.ErrorContains(t, err, "unsupported isolation level")
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBulkInsertPersistentRecordsWithMockPool(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+	mock.MatchExpectationsInOrder(true)
+
+	repo := NewPostgresPersistentRecordRepository(mock, nil)
+	fixed := time.Date(2024, 7, 8, 9, 10, 11, 0, time.UTC)
+	repo.withClock(func() time.Time { return fixed })
+
+	text := "foo"
+	first := uuid.MustParse("66666666-6666-6666-6666-666666666666")
+	second := uuid.MustParse("77777777-7777-7777-7777-777777777777")
+	records := []*PersistentRecord{
+		{
+			SchemaID:  1,
+			RowID:     first,
+			TextItems: map[string]string{"text_01": "hello"},
+			OtherAttributes: []EAVRecord{
+				{SchemaID: 1, RowID: first, AttrID: 10, ValueText: &text},
+			},
+		},
+		{
+			SchemaID:   1,
+			RowID:      second,
+			Int64Items: map[string]int64{"bigint_01": 42},
+		},
+	}
+	tables := StorageTables{EntityMain: "public.entity_main", EAVData: "eav_table", ChangeLog: "change_log"}
+
+	mock.ExpectBegin()
+	mock.ExpectCopyFrom(pgx.Identifier{"public", "entity_main"}, bulkMainColumns()).WillReturnResult(2)
+	mock.ExpectCopyFrom(pgx.Identifier{"eav_table"}, []string{"schema_id", "row_id", "attr_id", "array_indices", "value_text", "value_numeric"}).WillReturnResult(1)
+	mock.ExpectCopyFrom(pgx.Identifier{"change_log"}, []string{"schema_id", "row_id", "flushed_at", "changed_at", "deleted_at"}).WillReturnResult(2)
+	mock.ExpectCommit()
+	mock.ExpectRollback()
+
+	require.NoError(t, repo.BulkInsertPersistentRecords(ctx, tables, records))
+	assert.Equal(t, fixed.UnixMilli(), records[0].CreatedAt)
+	assert.Equal(t, fixed.UnixMilli(), records[1].UpdatedAt)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBulkMainRow(t *testing.T) {
+	rowID := uuid.MustParse("88888888-8888-8888-8888-888888888888")
+	row, err := bulkMainRow(&PersistentRecord{
+		SchemaID:   2,
+		RowID:      rowID,
+		TextItems:  map[string]string{"text_02": "b"},
+		Int16Items: map[string]int16{"smallint_01": 7},
+	})
+	require.NoError(t, err)
+
+	columns := bulkMainColumns()
+	require.Len(t, row, len(columns))
+	values := make(map[string]any, len(columns))
+	for i, col := range columns {
+		values[col] = row[i]
+	}
+	assert.Equal(t, int16(2), values["ltbase_schema_id"])
+	assert.Equal(t, rowID, values["ltbase_row_id"])
+	assert.Equal(t, "b", values["text_02"])
+	assert.Equal(t, int16(7), values["smallint_01"])
+	assert.Nil(t, values["text_01"])
+	assert.Nil(t, values["ltbase_deleted_at"])
+
+	_, err = bulkMainRow(&PersistentRecord{TextItems: map[string]string{"text_99": "x"}})
+	require.Error(t, err)
+}
+
 func TestInsertUpdatePersistentRecordNilRecord(t *testing.T) {
 	repo := &PostgresPersistentRecordRepository{}
 
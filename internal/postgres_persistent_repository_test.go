@@ -173,7 +173,8 @@ func TestBuildUpdateMainStatement(t *testing.T) {
 	require.NoError(t, err)
 
 	expectedQuery := "UPDATE " + sanitizeIdentifier("entity_main") + " SET " +
-		"ltbase_updated_at = $1, ltbase_deleted_at = $2, text_01 = $3, text_02 = $4, smallint_01 = $5, double_02 = $6 " +
+		"ltbase_updated_at = $1, ltbase_deleted_at = $2, text_01 = $3, text_02 = $4, smallint_01 = $5, double_02 = $6, " +
+		"ltbase_revision = ltbase_revision + 1 " +
 		"WHERE ltbase_schema_id = $7 AND ltbase_row_id = $8"
 
 	assert.Equal(t, expectedQuery, query)
@@ -337,6 +338,27 @@ func TestBuildHybridConditionsMainColumn(t *testing.T) {
 	assert.Nil(t, args)
 }
 
+func TestBuildHybridConditionsSystemAttributes(t *testing.T) {
+	repo := &PostgresPersistentRecordRepository{}
+	updatedAfter := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	query := AttributeQuery{
+		SchemaID:  1,
+		Condition: &forma.KvCondition{Attr: forma.SystemAttrUpdatedAt, Value: "gte:" + updatedAfter.Format(time.RFC3339)},
+	}
+	assert.True(t, hasMainTableCondition(query.Condition, nil))
+
+	clause, args, err := repo.buildHybridConditions("eav_table", "main_table", query, 1, true)
+	require.NoError(t, err)
+	assert.Equal(t, "m.\"ltbase_updated_at\" >= $2", clause)
+	assert.Equal(t, []any{updatedAfter.UnixMilli()}, args)
+
+	query.Condition = &forma.KvCondition{Attr: forma.SystemAttrRevision, Value: "gt:3"}
+	clause, args, err = repo.buildHybridConditions("eav_table", "main_table", query, 1, true)
+	require.NoError(t, err)
+	assert.Equal(t, "m.\"ltbase_revision\" > $2", clause)
+	assert.Len(t, args, 1)
+}
+
 func TestRunOptimizedQueryValidation(t *testing.T) {
 	repo := &PostgresPersistentRecordRepository{}
 
@@ -350,6 +372,8 @@ func TestRunOptimizedQueryValidation(t *testing.T) {
 		0,
 		nil,
 		true,
+		false,
+		nil,
 	)
 	require.Error(t, err)
 
@@ -363,6 +387,8 @@ func TestRunOptimizedQueryValidation(t *testing.T) {
 		0,
 		nil,
 		true,
+		false,
+		nil,
 	)
 	require.Error(t, err)
 }
@@ -415,6 +441,8 @@ func TestRunOptimizedQueryWithMockPool(t *testing.T) {
 		0,
 		nil,
 		true,
+		false,
+		nil,
 	)
 	require.NoError(t, err)
 	require.Len(t, records, 1)
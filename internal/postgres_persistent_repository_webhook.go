@@ -0,0 +1,212 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/lychee-technology/forma"
+)
+
+// WebhookDeliveryRecord is a row of the webhook delivery table. Payload is the JSON body sent to the
+// subscriber; it is fixed when the delivery is enqueued so every retry sends the same document.
+type WebhookDeliveryRecord struct {
+	ID             int64
+	SubscriptionID string
+	SchemaID       int16
+	RowID          uuid.UUID
+	Operation      forma.ChangeOperation
+	Payload        []byte
+	Status         forma.WebhookDeliveryStatus
+	Attempts       int
+	NextAttemptAt  int64
+	LastStatusCode int
+	LastError      string
+	CreatedAt      int64
+	UpdatedAt      int64
+}
+
+// WebhookDeliveryQuery selects rows of the webhook delivery table. Zero fields match everything.
+type WebhookDeliveryQuery struct {
+	SubscriptionID string
+	Status         forma.WebhookDeliveryStatus
+	Limit          int
+}
+
+const webhookDeliveryColumns = `delivery_id, subscription_id, schema_id, row_id, operation, payload, status,
+		attempts, next_attempt_at, last_status_code, last_error, created_at, updated_at`
+
+// InsertWebhookDeliveries enqueues deliveries as pending and due now. Run it in the transaction that
+// consumes the changes they were built from, so a change is never flushed without its deliveries.
+func (r *PostgresPersistentRecordRepository) InsertWebhookDeliveries(ctx context.Context, tables StorageTables, deliveries []*WebhookDeliveryRecord) error {
+	if tables.WebhookDeliveries == "" {
+		return fmt.Errorf("webhook delivery table name cannot be empty")
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	subscriptionIDs := make([]string, len(deliveries))
+	schemaIDs := make([]int16, len(deliveries))
+	rowIDs := make([]uuid.UUID, len(deliveries))
+	operations := make([]string, len(deliveries))
+	payloads := make([]string, len(deliveries))
+	for i, delivery := range deliveries {
+		subscriptionIDs[i] = delivery.SubscriptionID
+		schemaIDs[i] = delivery.SchemaID
+		rowIDs[i] = delivery.RowID
+		operations[i] = string(delivery.Operation)
+		payloads[i] = string(delivery.Payload)
+	}
+
+	tx, err := r.beginTx(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := fmt.Sprintf(
+		`INSERT INTO %s (subscription_id, schema_id, row_id, operation, payload, status,
+			attempts, next_attempt_at, last_status_code, last_error, created_at, updated_at)
+		SELECT d.subscription_id, d.schema_id, d.row_id, d.operation, d.payload::jsonb, '%s', 0, $6, 0, '', $6, $6
+		FROM unnest($1::text[], $2::smallint[], $3::uuid[], $4::text[], $5::text[])
+			AS d(subscription_id, schema_id, row_id, operation, payload)`,
+		sanitizeIdentifier(tables.WebhookDeliveries), forma.WebhookDeliveryPending,
+	)
+	if _, err := tx.Exec(ctx, query, subscriptionIDs, schemaIDs, rowIDs, operations, payloads, r.nowMillis()); err != nil {
+		return fmt.Errorf("insert webhook deliveries: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+// LeaseWebhookDeliveries claims up to limit pending deliveries that are due, oldest first, by moving
+// their next attempt to leaseUntil (unix milliseconds). Deliveries claimed by a concurrent worker are
+// skipped. A worker that dies mid-delivery leaves its deliveries to be retried once the lease expires.
+func (r *PostgresPersistentRecordRepository) LeaseWebhookDeliveries(ctx context.Context, tables StorageTables, limit int, leaseUntil int64) ([]*WebhookDeliveryRecord, error) {
+	if tables.WebhookDeliveries == "" {
+		return nil, fmt.Errorf("webhook delivery table name cannot be empty")
+	}
+	if limit <= 0 {
+		return nil, fmt.Errorf("limit must be positive")
+	}
+
+	table := sanitizeIdentifier(tables.WebhookDeliveries)
+	query := fmt.Sprintf(
+		`UPDATE %[1]s SET next_attempt_at = $3
+		WHERE delivery_id IN (
+			SELECT delivery_id FROM %[1]s
+			WHERE status = '%[2]s' AND next_attempt_at <= $2
+			ORDER BY next_attempt_at, delivery_id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING %[3]s`,
+		table, forma.WebhookDeliveryPending, webhookDeliveryColumns,
+	)
+	rows, err := r.querier(ctx).Query(ctx, query, limit, r.nowMillis(), leaseUntil)
+	if err != nil {
+		return nil, fmt.Errorf("lease webhook deliveries: %w", err)
+	}
+	deliveries, err := scanWebhookDeliveries(rows)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID < deliveries[j].ID })
+	return deliveries, nil
+}
+
+// UpdateWebhookDelivery stores the outcome of a delivery attempt.
+func (r *PostgresPersistentRecordRepository) UpdateWebhookDelivery(ctx context.Context, tables StorageTables, delivery *WebhookDeliveryRecord) error {
+	if tables.WebhookDeliveries == "" {
+		return fmt.Errorf("webhook delivery table name cannot be empty")
+	}
+	if delivery == nil {
+		return fmt.Errorf("webhook delivery cannot be nil")
+	}
+
+	tx, err := r.beginTx(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := fmt.Sprintf(
+		`UPDATE %s SET status = $2, attempts = $3, next_attempt_at = $4,
+			last_status_code = $5, last_error = $6, updated_at = $7
+		WHERE delivery_id = $1`,
+		sanitizeIdentifier(tables.WebhookDeliveries),
+	)
+	if _, err := tx.Exec(ctx, query, delivery.ID, string(delivery.Status), delivery.Attempts, delivery.NextAttemptAt,
+		delivery.LastStatusCode, delivery.LastError, r.nowMillis()); err != nil {
+		return fmt.Errorf("update webhook delivery: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+// ListWebhookDeliveries returns the deliveries selected by filter, newest first.
+func (r *PostgresPersistentRecordRepository) ListWebhookDeliveries(ctx context.Context, tables StorageTables, filter WebhookDeliveryQuery) ([]*WebhookDeliveryRecord, error) {
+	if tables.WebhookDeliveries == "" {
+		return nil, fmt.Errorf("webhook delivery table name cannot be empty")
+	}
+	if filter.Limit <= 0 {
+		return nil, fmt.Errorf("limit must be positive")
+	}
+
+	args := []any{filter.Limit}
+	var predicates []string
+	if filter.SubscriptionID != "" {
+		args = append(args, filter.SubscriptionID)
+		predicates = append(predicates, fmt.Sprintf("subscription_id = $%d", len(args)))
+	}
+	if filter.Status != "" {
+		args = append(args, string(filter.Status))
+		predicates = append(predicates, fmt.Sprintf("status = $%d", len(args)))
+	}
+	where := ""
+	if len(predicates) > 0 {
+		where = " WHERE " + strings.Join(predicates, " AND ")
+	}
+
+	query := fmt.Sprintf(
+		"SELECT %s FROM %s%s ORDER BY delivery_id DESC LIMIT $1",
+		webhookDeliveryColumns, sanitizeIdentifier(tables.WebhookDeliveries), where,
+	)
+	rows, err := r.querier(ctx).Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list webhook deliveries: %w", err)
+	}
+	return scanWebhookDeliveries(rows)
+}
+
+func scanWebhookDeliveries(rows pgx.Rows) ([]*WebhookDeliveryRecord, error) {
+	defer rows.Close()
+
+	var deliveries []*WebhookDeliveryRecord
+	for rows.Next() {
+		var delivery WebhookDeliveryRecord
+		var operation, status string
+		if err := rows.Scan(&delivery.ID, &delivery.SubscriptionID, &delivery.SchemaID, &delivery.RowID, &operation,
+			&delivery.Payload, &status, &delivery.Attempts, &delivery.NextAttemptAt, &delivery.LastStatusCode,
+			&delivery.LastError, &delivery.CreatedAt, &delivery.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan webhook delivery: %w", err)
+		}
+		delivery.Operation = forma.ChangeOperation(operation)
+		delivery.Status = forma.WebhookDeliveryStatus(status)
+		deliveries = append(deliveries, &delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
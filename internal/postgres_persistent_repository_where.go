@@ -0,0 +1,245 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lychee-technology/forma"
+	"go.uber.org/zap"
+)
+
+// compileWhereCondition compiles condition into a predicate over entity_main aliased as m.
+// $1 is reserved for the schema ID; condition arguments start at $2.
+func (r *PostgresPersistentRecordRepository) compileWhereCondition(tables StorageTables, schemaID int16, condition forma.Condition) (string, []any, error) {
+	if condition == nil {
+		return "", nil, fmt.Errorf("condition cannot be nil")
+	}
+	if schemaID <= 0 {
+		return "", nil, fmt.Errorf("schema id must be positive")
+	}
+
+	clause, args, err := r.buildHybridConditions(
+		sanitizeIdentifier(tables.EAVData),
+		sanitizeIdentifier(tables.EntityMain),
+		AttributeQuery{SchemaID: schemaID, Condition: condition},
+		1,
+		true,
+	)
+	if err != nil {
+		return "", nil, fmt.Errorf("build hybrid conditions: %w", err)
+	}
+	if clause == "" {
+		clause = "1=1"
+	}
+	return clause, args, nil
+}
+
+// changeLogCTE returns a data-modifying CTE that writes a change log row for every row ID returned
+// by source. deletedAt is a SQL expression, e.g. a placeholder or NULL.
+func changeLogCTE(table, source, changedAt, deletedAt string) string {
+	if table == "" {
+		return ""
+	}
+	return fmt.Sprintf(`,
+		logged AS (
+			INSERT INTO %s (schema_id, row_id, flushed_at, changed_at, deleted_at)
+			SELECT $1, ltbase_row_id, 0, %s, %s FROM %s
+			ON CONFLICT (schema_id, row_id, flushed_at)
+			DO UPDATE SET changed_at = EXCLUDED.changed_at, deleted_at = EXCLUDED.deleted_at, tx_id = EXCLUDED.tx_id
+		)`, sanitizeIdentifier(table), changedAt, deletedAt, source)
+}
+
+// CountPersistentRecordsWhere counts the live rows of schemaID matching condition.
+func (r *PostgresPersistentRecordRepository) CountPersistentRecordsWhere(ctx context.Context, tables StorageTables, schemaID int16, condition forma.Condition) (int64, error) {
+	if err := validateTables(tables); err != nil {
+		return 0, err
+	}
+
+	clause, condArgs, err := r.compileWhereCondition(tables, schemaID, condition)
+	if err != nil {
+		return 0, err
+	}
+
+	query := fmt.Sprintf(
+		"SELECT COUNT(*) FROM %s m WHERE m.ltbase_schema_id = $1 AND m.ltbase_deleted_at IS NULL AND (%s)",
+		sanitizeIdentifier(tables.EntityMain),
+		clause,
+	)
+	args := append([]any{schemaID}, condArgs...)
+
+	var count int64
+	if err := r.querier(ctx).QueryRow(ctx, query, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("count matching rows: %w", err)
+	}
+	return count, nil
+}
+
+// PersistentRecordMatches reports whether the live row rowID of schemaID matches condition.
+func (r *PostgresPersistentRecordRepository) PersistentRecordMatches(ctx context.Context, tables StorageTables, schemaID int16, rowID uuid.UUID, condition forma.Condition) (bool, error) {
+	if err := validateTables(tables); err != nil {
+		return false, err
+	}
+
+	clause, condArgs, err := r.compileWhereCondition(tables, schemaID, condition)
+	if err != nil {
+		return false, err
+	}
+
+	args := append([]any{schemaID}, condArgs...)
+	args = append(args, rowID)
+	query := fmt.Sprintf(
+		"SELECT EXISTS (SELECT 1 FROM %s m WHERE m.ltbase_schema_id = $1 AND m.ltbase_row_id = $%d AND m.ltbase_deleted_at IS NULL AND (%s))",
+		sanitizeIdentifier(tables.EntityMain),
+		len(args),
+		clause,
+	)
+
+	var matches bool
+	if err := r.querier(ctx).QueryRow(ctx, query, args...).Scan(&matches); err != nil {
+		return false, fmt.Errorf("match row: %w", err)
+	}
+	return matches, nil
+}
+
+// UpdatePersistentRecordsWhere sets the hot columns carried by patch on every live row of schemaID
+// matching condition with a single UPDATE and returns the number of rows changed. EAV attributes of
+// patch are not supported here.
+func (r *PostgresPersistentRecordRepository) UpdatePersistentRecordsWhere(ctx context.Context, tables StorageTables, schemaID int16, condition forma.Condition, patch *PersistentRecord) (int64, error) {
+	if err := validateWriteTables(tables); err != nil {
+		return 0, err
+	}
+	if patch == nil {
+		return 0, fmt.Errorf("patch cannot be nil")
+	}
+	if len(patch.OtherAttributes) > 0 {
+		return 0, fmt.Errorf("patch contains %d EAV attributes; only hot columns can be updated by condition", len(patch.OtherAttributes))
+	}
+	if err := validateHotColumns(patch); err != nil {
+		return 0, err
+	}
+
+	clause, condArgs, err := r.compileWhereCondition(tables, schemaID, condition)
+	if err != nil {
+		return 0, err
+	}
+
+	args := append([]any{schemaID}, condArgs...)
+	args = append(args, r.nowMillis())
+	now := fmt.Sprintf("$%d", len(args))
+
+	assignments := []string{"ltbase_updated_at = " + now}
+	for _, desc := range entityMainColumnDescriptors {
+		if strings.HasPrefix(desc.name, "ltbase_") {
+			continue
+		}
+		if value := bulkHotValue(patch, desc); value != nil {
+			args = append(args, value)
+			assignments = append(assignments, fmt.Sprintf("%s = $%d", desc.name, len(args)))
+		}
+	}
+	if len(assignments) == 1 {
+		return 0, fmt.Errorf("patch does not set any hot column")
+	}
+	assignments = append(assignments, "ltbase_revision = ltbase_revision + 1")
+	actor := historyActorArg(ctx, tables, &args)
+	channel := notifyChannelArg(tables, &args)
+
+	query := fmt.Sprintf(`WITH updated AS (
+			UPDATE %s AS m SET %s
+			WHERE m.ltbase_schema_id = $1 AND m.ltbase_deleted_at IS NULL AND (%s)
+			RETURNING m.*
+		)%s%s%s
+		%s`,
+		sanitizeIdentifier(tables.EntityMain),
+		strings.Join(assignments, ", "),
+		clause,
+		changeLogCTE(tables.ChangeLog, "updated", now, "NULL"),
+		historyCTE(tables, "updated", forma.HistoryOperationUpdate, false, now, actor),
+		outboxCTE(tables, "updated", forma.ChangeOperationUpdated, false, now),
+		countNotifiedSQL("updated", channel, forma.ChangeOperationUpdated, now),
+	)
+
+	return r.execWhere(ctx, "update", query, args)
+}
+
+// DeletePersistentRecordsWhere deletes every live row of schemaID matching condition and returns the
+// number of rows deleted. Soft deletes tombstone the rows; hard deletes also remove their EAV rows.
+func (r *PostgresPersistentRecordRepository) DeletePersistentRecordsWhere(ctx context.Context, tables StorageTables, schemaID int16, condition forma.Condition, soft bool) (int64, error) {
+	if err := validateWriteTables(tables); err != nil {
+		return 0, err
+	}
+
+	clause, condArgs, err := r.compileWhereCondition(tables, schemaID, condition)
+	if err != nil {
+		return 0, err
+	}
+
+	args := append([]any{schemaID}, condArgs...)
+	args = append(args, r.nowMillis())
+	now := fmt.Sprintf("$%d", len(args))
+	actor := historyActorArg(ctx, tables, &args)
+	channel := notifyChannelArg(tables, &args)
+	count := countNotifiedSQL("deleted", channel, forma.ChangeOperationDeleted, now)
+
+	var query string
+	if soft {
+		query = fmt.Sprintf(`WITH deleted AS (
+				UPDATE %s AS m SET ltbase_deleted_at = %s, ltbase_updated_at = %s, ltbase_revision = ltbase_revision + 1
+				WHERE m.ltbase_schema_id = $1 AND m.ltbase_deleted_at IS NULL AND (%s)
+				RETURNING m.*
+			)%s%s%s
+			%s`,
+			sanitizeIdentifier(tables.EntityMain),
+			now, now,
+			clause,
+			changeLogCTE(tables.ChangeLog, "deleted", now, now),
+			historyCTE(tables, "deleted", forma.HistoryOperationDelete, false, now, actor),
+			outboxCTE(tables, "deleted", forma.ChangeOperationDeleted, false, now),
+			count,
+		)
+	} else {
+		query = fmt.Sprintf(`WITH deleted AS (
+				DELETE FROM %s AS m
+				WHERE m.ltbase_schema_id = $1 AND m.ltbase_deleted_at IS NULL AND (%s)
+				RETURNING m.*
+			),
+			deleted_eav AS (
+				DELETE FROM %s e USING deleted d
+				WHERE e.schema_id = $1 AND e.row_id = d.ltbase_row_id
+			)%s%s%s
+			%s`,
+			sanitizeIdentifier(tables.EntityMain),
+			clause,
+			sanitizeIdentifier(tables.EAVData),
+			changeLogCTE(tables.ChangeLog, "deleted", now, now),
+			historyCTE(tables, "deleted", forma.HistoryOperationDelete, true, now, actor),
+			outboxCTE(tables, "deleted", forma.ChangeOperationDeleted, true, now),
+			count,
+		)
+	}
+
+	return r.execWhere(ctx, "delete", query, args)
+}
+
+func (r *PostgresPersistentRecordRepository) execWhere(ctx context.Context, op, query string, args []any) (int64, error) {
+	zap.S().Debugw(op+" by condition", "query", query, "args", args)
+
+	tx, err := r.beginTx(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var affected int64
+	if err := tx.QueryRow(ctx, query, args...).Scan(&affected); err != nil {
+		return 0, fmt.Errorf("%s by condition: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return affected, nil
+}
@@ -1,14 +1,20 @@
 package internal
 
 import (
-	"encoding/json"
-	"fmt"
-	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
+
+	"github.com/lychee-technology/forma"
+	"go.uber.org/zap"
 )
 
-// RelationDescriptor captures how a child schema derives fields from a parent schema.
+// RelationDescriptor captures how a child schema derives fields from a parent schema. Type is
+// ReferenceTypeArray when ForeignKeyAttr holds an array of IDs and ReferenceTypeNested when it runs
+// through an array of objects, such as viewings.agentId; either way the child references every ID
+// found and ChildPath receives the list of parent fragments.
 type RelationDescriptor struct {
 	ChildSchema        string
 	ChildPath          string
@@ -17,121 +23,130 @@ type RelationDescriptor struct {
 	ForeignKeyAttr     string
 	ParentIDAttr       string
 	ForeignKeyRequired bool
+	Type               forma.ReferenceType
+}
+
+// multiple reports whether the child may reference several parents through rel.
+func (rel RelationDescriptor) multiple() bool {
+	return rel.Type == forma.ReferenceTypeArray || rel.Type == forma.ReferenceTypeNested
 }
 
-// RelationIndex stores parent-child relations keyed by child schema name.
+// RelationIndex stores parent-child relations keyed by child schema name. It is built from the
+// x-relation properties of the schemas of a forma.SchemaRegistry.
 type RelationIndex struct {
+	mu       sync.RWMutex
 	bySchema map[string][]RelationDescriptor
 }
 
-// LoadRelationIndex parses JSON schema files in schemaDir and builds a relation index.
-// If the directory is missing or no relations are found, it returns an empty index.
-func LoadRelationIndex(schemaDir string) (*RelationIndex, error) {
-	idx := &RelationIndex{bySchema: make(map[string][]RelationDescriptor)}
-	if schemaDir == "" {
-		return idx, nil
-	}
-
-	entries, err := os.ReadDir(schemaDir)
-	if err != nil {
-		return idx, fmt.Errorf("read schema dir: %w", err)
-	}
-
-	for _, entry := range entries {
-		name := entry.Name()
-		if entry.IsDir() || !strings.HasSuffix(name, ".json") || strings.HasSuffix(name, "_attributes.json") {
-			continue
-		}
-		schemaName := strings.TrimSuffix(name, ".json")
-		if err := idx.loadSchemaRelations(schemaDir, schemaName); err != nil {
-			return nil, err
-		}
-	}
-
-	return idx, nil
+// NewRelationIndex builds a relation index from the schemas of registry. When registry is a
+// forma.ReloadableSchemaRegistry, the index is rebuilt after every reload for as long as it is in
+// use.
+func NewRelationIndex(registry forma.SchemaRegistry) *RelationIndex {
+	idx := &RelationIndex{}
+	idx.rebuild(registry)
+	onReloadWhileReachable(registry, idx, func(idx *RelationIndex) { idx.rebuild(registry) })
+	return idx
 }
 
-func (idx *RelationIndex) loadSchemaRelations(schemaDir, schemaName string) error {
-	filePath := filepath.Join(schemaDir, schemaName+".json")
-	raw, err := os.ReadFile(filePath)
-	if err != nil {
-		return fmt.Errorf("read schema %s: %w", filePath, err)
-	}
-
-	var schema map[string]any
-	if err := json.Unmarshal(raw, &schema); err != nil {
-		return fmt.Errorf("parse schema %s: %w", filePath, err)
-	}
-
-	requiredSet := make(map[string]struct{})
-	if reqRaw, ok := schema["required"].([]any); ok {
-		for _, r := range reqRaw {
-			if s, ok := r.(string); ok {
-				requiredSet[s] = struct{}{}
+// rebuild replaces the relations with those declared by the current schemas of registry. Schemas
+// that cannot be read are skipped.
+func (idx *RelationIndex) rebuild(registry forma.SchemaRegistry) {
+	bySchema := make(map[string][]RelationDescriptor)
+	if registry != nil {
+		for _, schemaName := range registry.ListSchemas() {
+			_, schema, err := registry.GetSchemaByName(schemaName)
+			if err != nil {
+				zap.S().Warnw("failed to load schema relations", "schema", schemaName, "error", err)
+				continue
+			}
+			if relations := schemaRelations(schemaName, schema); len(relations) > 0 {
+				bySchema[schemaName] = relations
 			}
 		}
 	}
 
-	props, ok := schema["properties"].(map[string]any)
-	if !ok {
-		return nil
+	idx.mu.Lock()
+	idx.bySchema = bySchema
+	idx.mu.Unlock()
+}
+
+// schemaRelations returns the relations declared by the x-relation properties of schema, ordered
+// by property name.
+func schemaRelations(schemaName string, schema forma.JSONSchema) []RelationDescriptor {
+	names := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
 	var relations []RelationDescriptor
-	for childProp, rawProp := range props {
-		propMap, ok := rawProp.(map[string]any)
-		if !ok {
+	for _, childProp := range names {
+		prop := schema.Properties[childProp]
+		if prop == nil || prop.Relation == nil {
 			continue
 		}
 
-		refStr, _ := propMap["$ref"].(string)
-		if refStr == "" || !strings.Contains(refStr, ".json") {
-			continue
+		ref := prop.Ref
+		if ref == "" && prop.Items != nil {
+			ref = prop.Items.Ref
 		}
-
-		var fkPointer string
-		if relMap, ok := propMap["x-relation"].(map[string]any); ok {
-			fkPointer = firstNonEmpty(
-				stringValue(relMap["key_property"]),
-			)
+		parentSchema, parentPath := parseRef(ref)
+		if prop.Relation.Target != "" {
+			parentSchema = prop.Relation.Target
 		}
-		// Backward compatibility: support legacy marker if present.
-		if fkPointer == "" {
-			continue
-		}
-
-		parentSchema, parentPath := parseRef(refStr)
 		if parentSchema == "" {
 			continue
 		}
 
-		fkAttr := pointerToAttrName(fkPointer)
+		fkAttr := pointerToAttrName(prop.Relation.KeyProperty)
 		if fkAttr == "" {
 			continue
 		}
 
-		parentIDAttr := "id"
-		if tail := pointerToAttrName(extractFragment(refStr)); tail == "id" {
-			parentIDAttr = tail
-		}
-
-		_, fkRequired := requiredSet[fkAttr]
-
 		relations = append(relations, RelationDescriptor{
 			ChildSchema:        schemaName,
 			ChildPath:          childProp,
 			ParentSchema:       parentSchema,
 			ParentPath:         parentPath,
 			ForeignKeyAttr:     fkAttr,
-			ParentIDAttr:       parentIDAttr,
-			ForeignKeyRequired: fkRequired,
+			ParentIDAttr:       "id",
+			ForeignKeyRequired: slices.Contains(schema.Required, fkAttr),
+			Type:               referenceType(schema.Properties, fkAttr),
 		})
 	}
+	return relations
+}
 
-	if len(relations) > 0 {
-		idx.bySchema[schemaName] = append(idx.bySchema[schemaName], relations...)
+// referenceType classifies the foreign key at the dotted path attr by the arrays found along the
+// path.
+func referenceType(props map[string]*forma.PropertySchema, attr string) forma.ReferenceType {
+	refType := forma.ReferenceTypeSingle
+	segments := strings.Split(attr, ".")
+	for i, segment := range segments {
+		prop := props[segment]
+		if prop == nil {
+			break
+		}
+		if prop.Type == "array" {
+			if i == len(segments)-1 && refType == forma.ReferenceTypeSingle {
+				return forma.ReferenceTypeArray
+			}
+			refType = forma.ReferenceTypeNested
+			if prop = prop.Items; prop == nil {
+				break
+			}
+		}
+		props = prop.Properties
 	}
-	return nil
+	return refType
+}
+
+// schemaRelationMap returns the current relations; a rebuild replaces the map rather than
+// modifying it.
+func (idx *RelationIndex) schemaRelationMap() map[string][]RelationDescriptor {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.bySchema
 }
 
 // Relations returns descriptors for a child schema.
@@ -139,22 +154,75 @@ func (idx *RelationIndex) Relations(schema string) []RelationDescriptor {
 	if idx == nil {
 		return nil
 	}
-	return idx.bySchema[schema]
+	return idx.schemaRelationMap()[schema]
+}
+
+// ForeignKeys returns one relation per distinct foreign key of a child schema, ordered by foreign key
+// attribute. Several computed fields may be derived through the same foreign key.
+func (idx *RelationIndex) ForeignKeys(schema string) []RelationDescriptor {
+	if idx == nil {
+		return nil
+	}
+	return foreignKeys(idx.schemaRelationMap()[schema])
+}
+
+func foreignKeys(rels []RelationDescriptor) []RelationDescriptor {
+	seen := make(map[string]bool)
+	var keys []RelationDescriptor
+	for _, rel := range rels {
+		key := rel.ForeignKeyAttr + "\x00" + rel.ParentSchema + "\x00" + rel.ParentIDAttr
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		keys = append(keys, rel)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].ForeignKeyAttr != keys[j].ForeignKeyAttr {
+			return keys[i].ForeignKeyAttr < keys[j].ForeignKeyAttr
+		}
+		return keys[i].ParentSchema < keys[j].ParentSchema
+	})
+	return keys
+}
+
+// Children returns one relation per distinct foreign key that points at a parent schema, ordered by
+// child schema and foreign key attribute.
+func (idx *RelationIndex) Children(parent string) []RelationDescriptor {
+	if idx == nil {
+		return nil
+	}
+	bySchema := idx.schemaRelationMap()
+	schemas := make([]string, 0, len(bySchema))
+	for schema := range bySchema {
+		schemas = append(schemas, schema)
+	}
+	sort.Strings(schemas)
+
+	var children []RelationDescriptor
+	for _, schema := range schemas {
+		for _, rel := range foreignKeys(bySchema[schema]) {
+			if rel.ParentSchema == parent {
+				children = append(children, rel)
+			}
+		}
+	}
+	return children
 }
 
 // StripComputedFields removes relation-backed attributes from the payload before persistence.
 func (idx *RelationIndex) StripComputedFields(schema string, data map[string]any) map[string]any {
-	if idx == nil || len(idx.bySchema) == 0 || data == nil {
+	if idx == nil || data == nil {
 		return data
 	}
-	rels := idx.bySchema[schema]
+	rels := idx.schemaRelationMap()[schema]
 	if len(rels) == 0 {
 		return data
 	}
 
 	result := make(map[string]any, len(data))
 	for k, v := range data {
-		if idx.isRelationRoot(schema, k) {
+		if isRelationRoot(rels, k) {
 			continue
 		}
 		result[k] = v
@@ -162,8 +230,8 @@ func (idx *RelationIndex) StripComputedFields(schema string, data map[string]any
 	return result
 }
 
-func (idx *RelationIndex) isRelationRoot(schema, key string) bool {
-	for _, rel := range idx.bySchema[schema] {
+func isRelationRoot(rels []RelationDescriptor, key string) bool {
+	for _, rel := range rels {
 		if rel.ChildPath == key {
 			return true
 		}
@@ -171,27 +239,6 @@ func (idx *RelationIndex) isRelationRoot(schema, key string) bool {
 	return false
 }
 
-func stringValue(v any) string {
-	if s, ok := v.(string); ok {
-		return s
-	}
-	if m, ok := v.(map[string]any); ok {
-		if ref, ok := m["$ref"].(string); ok {
-			return ref
-		}
-	}
-	return ""
-}
-
-func firstNonEmpty(values ...string) string {
-	for _, v := range values {
-		if strings.TrimSpace(v) != "" {
-			return v
-		}
-	}
-	return ""
-}
-
 func parseRef(refStr string) (string, string) {
 	parts := strings.Split(refStr, "#")
 	base := parts[0]
@@ -203,19 +250,12 @@ func parseRef(refStr string) (string, string) {
 	return parentSchema, parentPath
 }
 
-func extractFragment(refStr string) string {
-	idx := strings.Index(refStr, "#")
-	if idx == -1 {
-		return ""
-	}
-	return refStr[idx:]
-}
-
 // pointerToAttrName converts a JSON pointer to a dot-separated attribute path.
 // Examples:
 //
 //	"#/properties/leadId" -> "leadId"
 //	"#/$defs/contact" -> "contact"
+//	"#/properties/viewings/items/properties/agentId" -> "viewings.agentId"
 func pointerToAttrName(ptr string) string {
 	if ptr == "" {
 		return ""
@@ -225,10 +265,14 @@ func pointerToAttrName(ptr string) string {
 	filtered := make([]string, 0, len(parts))
 	for i := 0; i < len(parts); i++ {
 		p := parts[i]
-		if p == "properties" || p == "$defs" {
-			continue
-		}
-		if p != "" {
+		switch {
+		case p == "properties" || p == "$defs":
+			if i+1 < len(parts) && parts[i+1] != "" {
+				filtered = append(filtered, parts[i+1])
+			}
+			i++
+		case p == "items":
+		case p != "":
 			filtered = append(filtered, p)
 		}
 	}
@@ -0,0 +1,188 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lychee-technology/forma"
+)
+
+// memorySchemaRegistry serves JSON schemas built in code, without attribute metadata.
+type memorySchemaRegistry struct {
+	schemas map[string]forma.JSONSchema
+}
+
+func (r *memorySchemaRegistry) GetSchemaAttributeCacheByName(name string) (int16, forma.SchemaAttributeCache, error) {
+	return 0, nil, fmt.Errorf("schema not found: %s", name)
+}
+
+func (r *memorySchemaRegistry) GetSchemaAttributeCacheByID(id int16) (string, forma.SchemaAttributeCache, error) {
+	return "", nil, fmt.Errorf("schema not found for ID: %d", id)
+}
+
+func (r *memorySchemaRegistry) GetSchemaByName(name string) (int16, forma.JSONSchema, error) {
+	schema, ok := r.schemas[name]
+	if !ok {
+		return 0, forma.JSONSchema{}, fmt.Errorf("schema not found: %s", name)
+	}
+	return schema.ID, schema, nil
+}
+
+func (r *memorySchemaRegistry) GetSchemaByID(id int16) (string, forma.JSONSchema, error) {
+	for name, schema := range r.schemas {
+		if schema.ID == id {
+			return name, schema, nil
+		}
+	}
+	return "", forma.JSONSchema{}, fmt.Errorf("schema not found for ID: %d", id)
+}
+
+func (r *memorySchemaRegistry) ListSchemas() []string {
+	names := make([]string, 0, len(r.schemas))
+	for name := range r.schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestNewRelationIndex_FromRegistry(t *testing.T) {
+	registry := &memorySchemaRegistry{schemas: map[string]forma.JSONSchema{
+		"customer": {ID: 1, Name: "customer", Properties: map[string]*forma.PropertySchema{
+			"id":   {Name: "id", Type: "string"},
+			"name": {Name: "name", Type: "string"},
+		}},
+		"order": {ID: 2, Name: "order", Required: []string{"customerId"}, Properties: map[string]*forma.PropertySchema{
+			"customerId": {Name: "customerId", Type: "string", Required: true},
+			"customerName": {
+				Name:     "customerName",
+				Ref:      "#/properties/name",
+				Relation: &forma.RelationSchema{Target: "customer", KeyProperty: "customerId"},
+			},
+		}},
+	}}
+
+	rels := NewRelationIndex(registry).Relations("order")
+	if len(rels) != 1 {
+		t.Fatalf("expected one relation, got %+v", rels)
+	}
+	want := RelationDescriptor{
+		ChildSchema:        "order",
+		ChildPath:          "customerName",
+		ParentSchema:       "customer",
+		ParentPath:         "name",
+		ForeignKeyAttr:     "customerId",
+		ParentIDAttr:       "id",
+		ForeignKeyRequired: true,
+		Type:               forma.ReferenceTypeSingle,
+	}
+	if rels[0] != want {
+		t.Fatalf("unexpected relation %+v", rels[0])
+	}
+}
+
+func TestNewRelationIndex_RebuildsOnReload(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	for name, content := range referenceTypeSchemas {
+		write(name, content)
+	}
+	registry, err := NewFileSchemaRegistryFromDirectory(dir)
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+
+	idx := NewRelationIndex(registry)
+	if got := len(idx.ForeignKeys("deal")); got != 2 {
+		t.Fatalf("expected 2 foreign keys before reload, got %d", got)
+	}
+
+	// Drop the viewingAgents relation from deal.json.
+	deal := referenceTypeSchemas["deal.json"]
+	cut := strings.Index(deal, `,
+		"viewingAgents"`)
+	write("deal.json", deal[:cut]+"}}")
+	reloadable, ok := registry.(forma.ReloadableSchemaRegistry)
+	if !ok {
+		t.Fatal("expected the file schema registry to be reloadable")
+	}
+	if err := reloadable.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+
+	keys := idx.ForeignKeys("deal")
+	if len(keys) != 1 || keys[0].ForeignKeyAttr != "ownerIds" {
+		t.Fatalf("expected only ownerIds after reload, got %+v", keys)
+	}
+}
+
+func TestNewRelationIndex_ReleasedIndexesLeaveReloadCallbacks(t *testing.T) {
+	registry, err := NewFileSchemaRegistryFromDirectory("../cmd/server/schemas")
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+	fileRegistry := registry.(*fileSchemaRegistry)
+	callbackCount := func() int {
+		fileRegistry.mu.RLock()
+		defer fileRegistry.mu.RUnlock()
+		return len(fileRegistry.reloadCallbacks)
+	}
+
+	kept := NewRelationIndex(registry)
+	for range 10 {
+		NewRelationIndex(registry)
+	}
+	if got := callbackCount(); got != 11 {
+		t.Fatalf("expected 11 reload callbacks, got %d", got)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for callbackCount() > 1 && time.Now().Before(deadline) {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := callbackCount(); got != 1 {
+		t.Fatalf("expected only the callback of the live index to remain, got %d", got)
+	}
+
+	if err := fileRegistry.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if len(kept.ForeignKeys("visit")) == 0 {
+		t.Fatal("expected the live index to be rebuilt after reload")
+	}
+	runtime.KeepAlive(kept)
+}
+
+func TestFileSchemaRegistry_OnReloadUnregister(t *testing.T) {
+	registry, err := NewFileSchemaRegistryFromDirectory("../cmd/server/schemas")
+	if err != nil {
+		t.Fatalf("failed to create schema registry: %v", err)
+	}
+	reloadable := registry.(forma.ReloadableSchemaRegistry)
+
+	var first, second int
+	unregister := reloadable.OnReload(func() { first++ })
+	reloadable.OnReload(func() { second++ })
+	if err := reloadable.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	unregister()
+	unregister()
+	if err := reloadable.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if first != 1 || second != 2 {
+		t.Fatalf("expected the unregistered callback to stop, got first=%d second=%d", first, second)
+	}
+}
@@ -16,12 +16,25 @@ type schemaMetadataCache struct {
 	idNameCache map[int16]map[int16]string
 }
 
+// newSchemaMetadataCache returns an empty cache over registry. When registry is a
+// forma.ReloadableSchemaRegistry, the cache is cleared after every reload for as long as it is in
+// use.
 func newSchemaMetadataCache(registry forma.SchemaRegistry) *schemaMetadataCache {
-	return &schemaMetadataCache{
+	c := &schemaMetadataCache{
 		registry:    registry,
 		attrCache:   make(map[int16]forma.SchemaAttributeCache),
 		idNameCache: make(map[int16]map[int16]string),
 	}
+	onReloadWhileReachable(registry, c, (*schemaMetadataCache).reset)
+	return c
+}
+
+// reset drops the cached metadata so the next lookup reads the registry again.
+func (c *schemaMetadataCache) reset() {
+	c.cacheMu.Lock()
+	c.attrCache = make(map[int16]forma.SchemaAttributeCache)
+	c.idNameCache = make(map[int16]map[int16]string)
+	c.cacheMu.Unlock()
 }
 
 func (c *schemaMetadataCache) getSchemaMetadata(schemaID int16) (forma.SchemaAttributeCache, map[int16]string, error) {
@@ -158,6 +158,14 @@ func (g *SQLGenerator) buildKv(
 	var valueColumn string
 	var parsedValue any
 
+	// Encrypted values are ciphertext in value_text; the transformer has already encrypted valStr.
+	if meta.IsEncrypted() {
+		if opStr != "equals" && opStr != "not_equals" {
+			return "", nil, fmt.Errorf("%w: operator '%s' is not supported for encrypted attribute '%s'", forma.ErrUnsupportedFilter, opStr, kv.Attr)
+		}
+		meta.ValueType = forma.ValueTypeText
+	}
+
 	switch meta.ValueType {
 	case forma.ValueTypeText, forma.ValueTypeUUID:
 		valueColumn = "value_text"
@@ -2,6 +2,7 @@ package internal
 
 import (
 	"encoding/json"
+	"errors"
 	"reflect"
 	"testing"
 
@@ -86,3 +87,32 @@ func TestSQLGenerator_ToSqlClauses(t *testing.T) {
 		t.Fatalf("unexpected param counter, expected 7 got %d", paramCounter)
 	}
 }
+
+func TestSQLGenerator_EncryptedAttribute(t *testing.T) {
+	cache := forma.SchemaAttributeCache{
+		"income": forma.AttributeMetadata{
+			AttributeID: 3,
+			ValueType:   forma.ValueTypeNumeric,
+			Encryption:  forma.EncryptionModeDeterministic,
+		},
+	}
+	gen := NewSQLGenerator()
+
+	paramIndex := 0
+	sql, args, err := gen.ToSqlClauses(&forma.KvCondition{Attr: "income", Value: "equals:enc:v1:d:k1:abc"}, "eav_data", 1, cache, &paramIndex)
+	if err != nil {
+		t.Fatalf("ToSqlClauses failed: %v", err)
+	}
+	expected := "EXISTS (SELECT 1 FROM eav_data x WHERE x.schema_id = e.schema_id AND x.row_id = e.row_id AND x.attr_id = $1 AND x.value_text = $2)"
+	if sql != expected {
+		t.Fatalf("unexpected SQL:\n%s", sql)
+	}
+	if !reflect.DeepEqual(args, []any{int16(3), "enc:v1:d:k1:abc"}) {
+		t.Fatalf("unexpected args: %#v", args)
+	}
+
+	paramIndex = 0
+	if _, _, err := gen.ToSqlClauses(&forma.KvCondition{Attr: "income", Value: "gt:100"}, "eav_data", 1, cache, &paramIndex); !errors.Is(err, forma.ErrUnsupportedFilter) {
+		t.Fatalf("expected ErrUnsupportedFilter for range filter, got %v", err)
+	}
+}
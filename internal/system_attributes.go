@@ -0,0 +1,29 @@
+package internal
+
+import "github.com/lychee-technology/forma"
+
+// systemAttributes maps the reserved forma.SystemAttr* names onto entity_main system columns, so
+// they can be filtered and sorted like hot attributes of any schema.
+var systemAttributes = map[string]forma.AttributeMetadata{
+	forma.SystemAttrCreatedAt: systemAttribute(forma.SystemAttrCreatedAt, forma.ValueTypeDateTime, forma.MainColumnCreatedAt, forma.MainColumnEncodingUnixMs),
+	forma.SystemAttrUpdatedAt: systemAttribute(forma.SystemAttrUpdatedAt, forma.ValueTypeDateTime, forma.MainColumnUpdatedAt, forma.MainColumnEncodingUnixMs),
+	forma.SystemAttrDeletedAt: systemAttribute(forma.SystemAttrDeletedAt, forma.ValueTypeDateTime, forma.MainColumnDeletedAt, forma.MainColumnEncodingUnixMs),
+	forma.SystemAttrRevision:  systemAttribute(forma.SystemAttrRevision, forma.ValueTypeBigInt, forma.MainColumnRevision, forma.MainColumnEncodingDefault),
+}
+
+func systemAttribute(name string, valueType forma.ValueType, column forma.MainColumn, encoding forma.MainColumnEncoding) forma.AttributeMetadata {
+	return forma.AttributeMetadata{
+		AttributeName: name,
+		ValueType:     valueType,
+		ColumnBinding: &forma.MainColumnBinding{ColumnName: column, Encoding: encoding},
+	}
+}
+
+// lookupAttribute resolves name in cache, falling back to the reserved system attributes.
+func lookupAttribute(cache forma.SchemaAttributeCache, name string) (forma.AttributeMetadata, bool) {
+	if meta, ok := cache[name]; ok {
+		return meta, true
+	}
+	meta, ok := systemAttributes[name]
+	return meta, ok
+}
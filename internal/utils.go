@@ -22,6 +22,11 @@ func sanitizeIdentifier(name string) string {
 	if name == "" {
 		return ""
 	}
+	return splitIdentifier(name).Sanitize()
+}
+
+// splitIdentifier splits a possibly schema-qualified table name into its unquoted parts.
+func splitIdentifier(name string) pgx.Identifier {
 	parts := strings.Split(name, ".")
 	clean := make([]string, 0, len(parts))
 	for _, part := range parts {
@@ -34,7 +39,7 @@ func sanitizeIdentifier(name string) string {
 	if len(clean) == 0 {
 		clean = []string{name}
 	}
-	return pgx.Identifier(clean).Sanitize()
+	return pgx.Identifier(clean)
 }
 
 func toUUID(obj any) (uuid.UUID, bool) {
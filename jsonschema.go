@@ -1,5 +1,7 @@
 package forma
 
+import "sort"
+
 // JSONSchema represents a schema definition.
 type JSONSchema struct {
 	ID         int16                      `json:"id"`
@@ -26,14 +28,124 @@ type PropertySchema struct {
 	MinLength  *int                       `json:"minLength,omitempty"`
 	MaxLength  *int                       `json:"maxLength,omitempty"`
 	Pattern    string                     `json:"pattern,omitempty"`
+	Ref        string                     `json:"$ref,omitempty"` // a $ref left unresolved, such as "lead.json#/$defs/contact"
 	Relation   *RelationSchema            `json:"x-relation,omitempty"`
 	LTBaseType string                     `json:"x-ltbase-type,omitempty"`      // "virtual" for virtual fields that are populated dynamically
 	LTBaseNote string                     `json:"x-ltbase-note-prop,omitempty"` // Reference to note field: "${note_id}", "${owner_id}", "${note_data}"
+	ReadOnly   bool                       `json:"readOnly,omitempty"`
+	Immutable  bool                       `json:"x-immutable,omitempty"` // write-once: settable on create, never changed afterwards
+}
+
+// IsImmutable reports whether the property may not change once it has a value.
+func (p *PropertySchema) IsImmutable() bool {
+	return p != nil && (p.ReadOnly || p.Immutable)
 }
 
-// RelationSchema defines reference relationships between objects.
+// RelationSchema defines reference relationships between objects. The property carrying it is
+// filled from the parent schema named by Target, or else by the schema file of the property's Ref,
+// at the fragment of Ref.
 type RelationSchema struct {
 	Target      string `json:"target"`       // Target schema name
 	Type        string `json:"type"`         // "reference" for foreign key relationships
 	KeyProperty string `json:"key_property"` // child-side foreign key attribute
 }
+
+// ApplyDefaults returns a copy of data with the schema's default values filled in for absent
+// properties. Defaults are also applied inside nested objects and array items that are present;
+// an absent object is only created when it declares a default of its own.
+func (s JSONSchema) ApplyDefaults(data map[string]any) map[string]any {
+	if data == nil {
+		return nil
+	}
+	return applyPropertyDefaults(s.Properties, data)
+}
+
+// ImmutablePaths returns the dotted paths of readOnly and x-immutable properties, sorted.
+// Properties inside arrays are not tracked individually; mark the array itself instead.
+func (s JSONSchema) ImmutablePaths() []string {
+	var paths []string
+	collectImmutablePaths(s.Properties, "", &paths)
+	sort.Strings(paths)
+	return paths
+}
+
+func collectImmutablePaths(properties map[string]*PropertySchema, prefix string, paths *[]string) {
+	for name, prop := range properties {
+		if prop == nil {
+			continue
+		}
+		path := prefix + name
+		if prop.IsImmutable() {
+			*paths = append(*paths, path)
+			continue
+		}
+		if len(prop.Properties) > 0 {
+			collectImmutablePaths(prop.Properties, path+".", paths)
+		}
+	}
+}
+
+func applyPropertyDefaults(properties map[string]*PropertySchema, data map[string]any) map[string]any {
+	result := make(map[string]any, len(data))
+	for key, value := range data {
+		result[key] = value
+	}
+
+	for name, prop := range properties {
+		if prop == nil || prop.LTBaseType == "virtual" {
+			continue
+		}
+		value, exists := result[name]
+		if !exists {
+			if prop.Default == nil {
+				continue
+			}
+			value = cloneDefault(prop.Default)
+		}
+		result[name] = applyValueDefaults(prop, value)
+	}
+
+	return result
+}
+
+func applyValueDefaults(prop *PropertySchema, value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		if len(prop.Properties) > 0 {
+			return applyPropertyDefaults(prop.Properties, v)
+		}
+	case []any:
+		if prop.Items == nil {
+			return v
+		}
+		items := make([]any, len(v))
+		for i, item := range v {
+			if item == nil && prop.Items.Default != nil {
+				item = cloneDefault(prop.Items.Default)
+			}
+			items[i] = applyValueDefaults(prop.Items, item)
+		}
+		return items
+	}
+	return value
+}
+
+// cloneDefault copies object and array defaults so records never share the schema's values.
+func cloneDefault(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		clone := make(map[string]any, len(v))
+		for key, item := range v {
+			clone[key] = cloneDefault(item)
+		}
+		return clone
+	case []any:
+		clone := make([]any, len(v))
+		for i, item := range v {
+			clone[i] = cloneDefault(item)
+		}
+		return clone
+	default:
+		return value
+	}
+}
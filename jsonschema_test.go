@@ -0,0 +1,92 @@
+package forma
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONSchema_ApplyDefaults(t *testing.T) {
+	schema := JSONSchema{
+		Properties: map[string]*PropertySchema{
+			"status": {Type: "string", Default: "scheduled"},
+			"name":   {Type: "string"},
+			"budget": {
+				Type: "object",
+				Properties: map[string]*PropertySchema{
+					"currency": {Type: "string", Default: "JPY"},
+				},
+			},
+			"size": {
+				Type: "object",
+				Properties: map[string]*PropertySchema{
+					"unit": {Type: "string", Default: "sqm"},
+				},
+			},
+			"tags": {
+				Type:    "array",
+				Default: []any{"new"},
+				Items:   &PropertySchema{Type: "string", Default: "untagged"},
+			},
+			"contacts": {
+				Type: "array",
+				Items: &PropertySchema{
+					Type: "object",
+					Properties: map[string]*PropertySchema{
+						"primary": {Type: "boolean", Default: false},
+					},
+				},
+			},
+		},
+	}
+
+	data := map[string]any{
+		"name":     "Alice",
+		"budget":   map[string]any{"min": 10.0},
+		"contacts": []any{map[string]any{"phone": "123"}, map[string]any{"primary": true}},
+	}
+
+	result := schema.ApplyDefaults(data)
+
+	assert.Equal(t, "scheduled", result["status"])
+	assert.Equal(t, "Alice", result["name"])
+	assert.Equal(t, map[string]any{"min": 10.0, "currency": "JPY"}, result["budget"])
+	assert.NotContains(t, result, "size", "absent objects without a default are not created")
+	assert.Equal(t, []any{"new"}, result["tags"])
+	assert.Equal(t, []any{
+		map[string]any{"phone": "123", "primary": false},
+		map[string]any{"primary": true},
+	}, result["contacts"])
+
+	// The input and the schema default are left untouched.
+	assert.NotContains(t, data, "status")
+	assert.Equal(t, map[string]any{"min": 10.0}, data["budget"])
+	result["tags"].([]any)[0] = "changed"
+	assert.Equal(t, []any{"new"}, schema.Properties["tags"].Default)
+
+	nullItems := schema.ApplyDefaults(map[string]any{"tags": []any{"a", nil}})
+	assert.Equal(t, []any{"a", "untagged"}, nullItems["tags"])
+}
+
+func TestJSONSchema_ImmutablePaths(t *testing.T) {
+	schema := JSONSchema{
+		Properties: map[string]*PropertySchema{
+			"id":        {Type: "string", Immutable: true},
+			"createdAt": {Type: "string", ReadOnly: true},
+			"status":    {Type: "string"},
+			"contact": {
+				Type: "object",
+				Properties: map[string]*PropertySchema{
+					"externalId": {Type: "string", Immutable: true},
+					"name":       {Type: "string"},
+				},
+			},
+			"tags": {
+				Type:  "array",
+				Items: &PropertySchema{Type: "string", Immutable: true},
+			},
+		},
+	}
+
+	assert.Equal(t, []string{"contact.externalId", "createdAt", "id"}, schema.ImmutablePaths())
+}
@@ -0,0 +1,32 @@
+package forma
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// ErrOutboxDisabled is returned by DispatchOutbox when no outbox table is configured.
+var ErrOutboxDisabled = errors.New("outbox is disabled")
+
+// OutboxEvent is a committed write relayed from the outbox. Record holds the entity exactly as the
+// write committed it, unlike ChangeEvent which carries the entity as it is when delivered.
+type OutboxEvent struct {
+	// ID grows with every outbox row. Within one entity it follows commit order, so sinks and
+	// consumers can use it to drop duplicates and detect reordering.
+	ID          int64           `json:"id"`
+	SchemaName  string          `json:"schema_name"`
+	RowID       uuid.UUID       `json:"row_id"`
+	Operation   ChangeOperation `json:"operation"`
+	Revision    int64           `json:"revision"`
+	CommittedAt int64           `json:"committed_at"`     // unix milliseconds
+	Record      *DataRecord     `json:"record,omitempty"` // nil for deletes
+}
+
+// EventSink publishes outbox events to a message bus or other consumer. Events arrive in outbox
+// order, which keeps the events of every entity in commit order. A batch is marked dispatched only
+// when Publish returns nil; otherwise it is published again, so sinks see events at least once.
+type EventSink interface {
+	Publish(ctx context.Context, events []*OutboxEvent) error
+}
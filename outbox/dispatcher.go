@@ -0,0 +1,63 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/lychee-technology/forma"
+	"go.uber.org/zap"
+)
+
+// Relay is the part of forma.EntityManager a Dispatcher needs.
+type Relay interface {
+	DispatchOutbox(ctx context.Context, sink forma.EventSink, batchSize int) (int, error)
+}
+
+// DispatcherOptions configures a Dispatcher. Zero fields use the defaults.
+type DispatcherOptions struct {
+	// BatchSize caps the events published per batch. Defaults to forma.DefaultChangeBatchSize.
+	BatchSize int
+	// PollInterval is the wait after the outbox was found empty or a batch failed. Defaults to one second.
+	PollInterval time.Duration
+}
+
+// Dispatcher relays the outbox to a sink in the background.
+type Dispatcher struct {
+	relay Relay
+	sink  forma.EventSink
+	opts  DispatcherOptions
+}
+
+// NewDispatcher returns a dispatcher publishing the outbox of relay to sink.
+func NewDispatcher(relay Relay, sink forma.EventSink, opts DispatcherOptions) *Dispatcher {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = forma.DefaultChangeBatchSize
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	return &Dispatcher{relay: relay, sink: sink, opts: opts}
+}
+
+// Run dispatches batches until ctx is done and then returns ctx.Err(). Full batches are followed by
+// the next one straight away; failed batches are retried after PollInterval.
+func (d *Dispatcher) Run(ctx context.Context) error {
+	for {
+		dispatched, err := d.relay.DispatchOutbox(ctx, d.sink, d.opts.BatchSize)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			zap.S().Warnw("outbox dispatch failed", "error", err)
+		}
+		if err == nil && dispatched >= d.opts.BatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(d.opts.PollInterval):
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lychee-technology/forma"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeRelay struct {
+	results []int
+	calls   int
+	cancel  context.CancelFunc
+}
+
+func (r *fakeRelay) DispatchOutbox(ctx context.Context, sink forma.EventSink, batchSize int) (int, error) {
+	r.calls++
+	if r.calls > len(r.results) {
+		r.cancel()
+		return 0, ctx.Err()
+	}
+	if r.results[r.calls-1] < 0 {
+		return 0, errors.New("sink unavailable")
+	}
+	return r.results[r.calls-1], nil
+}
+
+func TestDispatcher_DrainsFullBatchesAndRetriesFailures(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Two full batches, a failure, then a partial batch.
+	relay := &fakeRelay{results: []int{2, 2, -1, 1}, cancel: cancel}
+	dispatcher := NewDispatcher(relay, NewWriterSink(nil), DispatcherOptions{BatchSize: 2, PollInterval: time.Millisecond})
+
+	err := dispatcher.Run(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 5, relay.calls)
+}
@@ -0,0 +1,144 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lychee-technology/forma"
+)
+
+// WriterSink writes every event as one line of JSON (NDJSON) to an io.Writer.
+type WriterSink struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+// NewWriterSink returns a sink writing NDJSON to w.
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+// NewStdoutSink returns a sink writing NDJSON to standard output.
+func NewStdoutSink() *WriterSink {
+	return NewWriterSink(os.Stdout)
+}
+
+// NewFileSink returns a sink appending NDJSON to the file at path, creating it when missing.
+// Every batch is synced to disk before Publish returns.
+func NewFileSink(path string) (*WriterSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open outbox file: %w", err)
+	}
+	return &WriterSink{w: file, closer: file}, nil
+}
+
+// Publish writes events as NDJSON lines. A batch is encoded in full before it is written, so a
+// failed encoding leaves no partial batch behind.
+func (s *WriterSink) Publish(ctx context.Context, events []*forma.OutboxEvent) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return fmt.Errorf("encode event %d: %w", event.ID, err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("write events: %w", err)
+	}
+	if file, ok := s.closer.(*os.File); ok {
+		if err := file.Sync(); err != nil {
+			return fmt.Errorf("sync events: %w", err)
+		}
+	}
+	return nil
+}
+
+// Close closes the file of a sink created by NewFileSink. It is a no-op for other sinks.
+func (s *WriterSink) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
+
+// HTTPSink POSTs every batch as {"events": [...]} to a URL. Any response outside 2xx fails the
+// batch, which is then published again.
+type HTTPSink struct {
+	url     string
+	client  *http.Client
+	headers http.Header
+}
+
+// NewHTTPSink returns a sink posting to url with a request timeout. headers, which may be nil, are
+// added to every request, e.g. for authorization.
+func NewHTTPSink(url string, timeout time.Duration, headers http.Header) *HTTPSink {
+	return &HTTPSink{
+		url:     url,
+		client:  &http.Client{Timeout: timeout},
+		headers: headers,
+	}
+}
+
+// Publish sends events in one request, keeping their order.
+func (s *HTTPSink) Publish(ctx context.Context, events []*forma.OutboxEvent) error {
+	body, err := json.Marshal(struct {
+		Events []*forma.OutboxEvent `json:"events"`
+	}{Events: events})
+	if err != nil {
+		return fmt.Errorf("encode events: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	for key, values := range s.headers {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("post events: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("event endpoint responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// ParseSink builds a sink from a spec: "stdout", "file:<path>" or an http(s) URL.
+func ParseSink(spec string) (forma.EventSink, error) {
+	switch {
+	case spec == "stdout":
+		return NewStdoutSink(), nil
+	case strings.HasPrefix(spec, "file:"):
+		path := strings.TrimPrefix(spec, "file:")
+		if path == "" {
+			return nil, fmt.Errorf("file sink requires a path")
+		}
+		return NewFileSink(path)
+	case strings.HasPrefix(spec, "http://"), strings.HasPrefix(spec, "https://"):
+		return NewHTTPSink(spec, 10*time.Second, nil), nil
+	default:
+		return nil, fmt.Errorf("unknown event sink %q", spec)
+	}
+}
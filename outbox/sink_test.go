@@ -0,0 +1,101 @@
+package outbox
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lychee-technology/forma"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testEvents() []*forma.OutboxEvent {
+	rowID := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+	return []*forma.OutboxEvent{
+		{ID: 1, SchemaName: "lead", RowID: rowID, Operation: forma.ChangeOperationCreated, Revision: 1, CommittedAt: 1000},
+		{ID: 2, SchemaName: "lead", RowID: rowID, Operation: forma.ChangeOperationDeleted, Revision: 2, CommittedAt: 2000},
+	}
+}
+
+func TestWriterSink_WritesNDJSON(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewWriterSink(&buf)
+	require.NoError(t, sink.Publish(context.Background(), testEvents()))
+
+	scanner := bufio.NewScanner(&buf)
+	var ids []int64
+	for scanner.Scan() {
+		var event forma.OutboxEvent
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		ids = append(ids, event.ID)
+	}
+	assert.Equal(t, []int64{1, 2}, ids)
+}
+
+func TestFileSink_Appends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	for i := 0; i < 2; i++ {
+		sink, err := NewFileSink(path)
+		require.NoError(t, err)
+		require.NoError(t, sink.Publish(context.Background(), testEvents()))
+		require.NoError(t, sink.Close())
+	}
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 4, bytes.Count(data, []byte("\n")))
+}
+
+func TestHTTPSink_PostsBatchInOrder(t *testing.T) {
+	var received struct {
+		Events []*forma.OutboxEvent `json:"events"`
+	}
+	var authorization string
+	status := http.StatusAccepted
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &received)
+		authorization = r.Header.Get("Authorization")
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sink := NewHTTPSink(server.URL, time.Second, http.Header{"Authorization": []string{"Bearer token"}})
+	require.NoError(t, sink.Publish(context.Background(), testEvents()))
+	require.Len(t, received.Events, 2)
+	assert.Equal(t, int64(1), received.Events[0].ID)
+	assert.Equal(t, int64(2), received.Events[1].ID)
+	assert.Equal(t, "Bearer token", authorization)
+
+	status = http.StatusBadGateway
+	assert.Error(t, sink.Publish(context.Background(), testEvents()))
+}
+
+func TestParseSink(t *testing.T) {
+	sink, err := ParseSink("stdout")
+	require.NoError(t, err)
+	assert.IsType(t, &WriterSink{}, sink)
+
+	sink, err = ParseSink("https://bus.example.com/events")
+	require.NoError(t, err)
+	assert.IsType(t, &HTTPSink{}, sink)
+
+	sink, err = ParseSink("file:" + filepath.Join(t.TempDir(), "events.ndjson"))
+	require.NoError(t, err)
+	require.NoError(t, sink.(*WriterSink).Close())
+
+	_, err = ParseSink("kafka://broker")
+	assert.Error(t, err)
+	_, err = ParseSink("file:")
+	assert.Error(t, err)
+}
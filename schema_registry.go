@@ -53,6 +53,7 @@ const (
 	MainColumnCreatedAt  MainColumn = "ltbase_created_at"
 	MainColumnUpdatedAt  MainColumn = "ltbase_updated_at"
 	MainColumnDeletedAt  MainColumn = "ltbase_deleted_at"
+	MainColumnRevision   MainColumn = "ltbase_revision"
 	MainColumnSchemaID   MainColumn = "ltbase_schema_id"
 	MainColumnRowID      MainColumn = "ltbase_row_id"
 )
@@ -102,7 +103,7 @@ func (m *MainColumnBinding) ColumnType() MainColumnType {
 		return MainColumnTypeDouble
 	case strings.HasPrefix(name, "uuid"):
 		return MainColumnTypeUUID
-	case (m.ColumnName == MainColumnCreatedAt || m.ColumnName == MainColumnUpdatedAt || m.ColumnName == MainColumnDeletedAt):
+	case (m.ColumnName == MainColumnCreatedAt || m.ColumnName == MainColumnUpdatedAt || m.ColumnName == MainColumnDeletedAt || m.ColumnName == MainColumnRevision):
 		return MainColumnTypeBigint
 	case m.ColumnName == MainColumnSchemaID:
 		return MainColumnTypeSmallint
@@ -120,6 +121,23 @@ type AttributeMetadata struct {
 	ValueType     ValueType          `json:"value_type"` // 'text', 'numeric', 'date', 'bool'
 	Required      bool               `json:"required,omitempty"`
 	ColumnBinding *MainColumnBinding `json:"column_binding,omitempty"`
+	Encryption    EncryptionMode     `json:"encryption,omitempty"` // set for x-encrypted attributes
+}
+
+// EncryptionMode selects how an x-encrypted attribute is encrypted at rest.
+type EncryptionMode string
+
+const (
+	// EncryptionModeRandomized encrypts every value under a fresh data key. Values cannot be filtered.
+	EncryptionModeRandomized EncryptionMode = "randomized"
+	// EncryptionModeDeterministic encrypts equal values to equal ciphertexts under the same key,
+	// which allows equals and not_equals filters.
+	EncryptionModeDeterministic EncryptionMode = "deterministic"
+)
+
+// IsEncrypted reports whether values of the attribute are encrypted at rest.
+func (m AttributeMetadata) IsEncrypted() bool {
+	return m.Encryption != ""
 }
 
 // AttributeStorageLocation enumerates where the attribute physically resides.
@@ -163,3 +181,14 @@ type SchemaRegistry interface {
 	GetSchemaByID(id int16) (string, JSONSchema, error)
 	ListSchemas() []string
 }
+
+// ReloadableSchemaRegistry is a SchemaRegistry whose schemas can change at runtime. State derived
+// from the schemas, such as the x-relation index of the entity manager, is rebuilt after a reload.
+type ReloadableSchemaRegistry interface {
+	SchemaRegistry
+	// Reload re-reads the schemas from their source and then calls the OnReload callbacks.
+	Reload() error
+	// OnReload registers fn to be called after every successful reload. Calling the returned func
+	// removes fn again.
+	OnReload(fn func()) (unregister func())
+}
@@ -17,6 +17,7 @@ func TestMainColumnBindingColumnType(t *testing.T) {
 		{"created at special", MainColumnCreatedAt, MainColumnTypeBigint},
 		{"updated at special", MainColumnUpdatedAt, MainColumnTypeBigint},
 		{"deleted at special", MainColumnDeletedAt, MainColumnTypeBigint},
+		{"revision special", MainColumnRevision, MainColumnTypeBigint},
 		{"schema id special", MainColumnSchemaID, MainColumnTypeSmallint},
 		{"row id special", MainColumnRowID, MainColumnTypeUUID},
 		{"case-insensitive text", MainColumn("TEXT_CUSTOM"), MainColumnTypeText},
@@ -2,6 +2,9 @@ package forma
 
 import (
 	"context"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 // EntityManager provides comprehensive entity and query operations
@@ -11,6 +14,8 @@ type EntityManager interface {
 	Get(ctx context.Context, req *QueryRequest) (*DataRecord, error)
 	Update(ctx context.Context, req *EntityOperation) (*DataRecord, error)
 	Delete(ctx context.Context, req *EntityOperation) error
+	Restore(ctx context.Context, req *EntityOperation) (*DataRecord, error)
+	Purge(ctx context.Context, schemaName string, olderThan time.Duration) (int64, error)
 
 	// Query operations
 	Query(ctx context.Context, req *QueryRequest) (*QueryResult, error)
@@ -20,4 +25,49 @@ type EntityManager interface {
 	BatchCreate(ctx context.Context, req *BatchOperation) (*BatchResult, error)
 	BatchUpdate(ctx context.Context, req *BatchOperation) (*BatchResult, error)
 	BatchDelete(ctx context.Context, req *BatchOperation) (*BatchResult, error)
+	// ExecuteBatch runs operations of mixed types and schemas in order, honoring Atomic.
+	ExecuteBatch(ctx context.Context, req *BatchOperation) (*BatchResult, error)
+	// BulkLoad streams new entities of one schema into storage using COPY. On cancellation or an
+	// iterator failure it returns the partial result together with the error.
+	BulkLoad(ctx context.Context, schemaName string, iterator EntityIterator) (*BulkLoadResult, error)
+
+	// Conditional operations
+	// UpdateWhere merges patch into every live entity of schemaName matching condition.
+	UpdateWhere(ctx context.Context, schemaName string, condition Condition, patch map[string]any, opts WhereOptions) (*WhereResult, error)
+	// DeleteWhere deletes every live entity of schemaName matching condition.
+	DeleteWhere(ctx context.Context, schemaName string, condition Condition, opts WhereOptions) (*WhereResult, error)
+
+	// History
+	// GetHistory returns every stored version of an entity, oldest first.
+	GetHistory(ctx context.Context, schemaName string, rowID uuid.UUID) ([]*HistoryEntry, error)
+	// Revert writes the document stored at revision back as a new revision of the entity.
+	Revert(ctx context.Context, schemaName string, rowID uuid.UUID, revision int64) (*DataRecord, error)
+
+	// Change feed
+	// ConsumeChanges leases pending change log entries in change order, skipping entries leased
+	// by concurrent consumers, passes them to fn and marks them flushed when fn returns nil.
+	// It returns the number of flushed entries; zero means nothing was pending.
+	ConsumeChanges(ctx context.Context, opts ChangeFeedOptions, fn ChangeHandler) (int, error)
+	// WatchChanges streams the changes of one schema to fn as they are committed, until ctx is done
+	// or fn fails. It requires DatabaseConfig.NotifyChannel.
+	WatchChanges(ctx context.Context, opts WatchOptions, fn ChangeListener) error
+
+	// Webhooks
+	// ProcessWebhooks runs one webhook pass: it turns a batch of the change feed into deliveries for
+	// the matching WebhookConfig.Subscriptions, then attempts the deliveries that are due. Call it
+	// periodically; failed deliveries are retried with exponential backoff until they run out of attempts.
+	ProcessWebhooks(ctx context.Context) (*WebhookResult, error)
+	// ListWebhookDeliveries returns entries of the webhook delivery log, newest first.
+	ListWebhookDeliveries(ctx context.Context, filter WebhookDeliveryFilter) ([]*WebhookDelivery, error)
+
+	// Outbox
+	// DispatchOutbox publishes up to batchSize undispatched outbox events to sink in outbox order and
+	// marks them dispatched when sink succeeds. It returns the number of dispatched events; zero means
+	// nothing was pending or another dispatcher is active. It requires TableNames.Outbox.
+	DispatchOutbox(ctx context.Context, sink EventSink, batchSize int) (int, error)
+
+	// Transactions
+	// WithTx runs fn as one unit of work using TransactionConfig.IsolationLevel. Calls made
+	// through tx commit together when fn returns nil and roll back otherwise.
+	WithTx(ctx context.Context, fn func(tx EntityManager) error) error
 }
@@ -2,6 +2,7 @@ package forma
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -12,8 +13,29 @@ type DataRecord struct {
 	SchemaName string         `json:"schema_name"`
 	RowID      uuid.UUID      `json:"row_id"`
 	Attributes map[string]any `json:"attributes"`
+	Meta       *RecordMeta    `json:"meta,omitempty"`
+	// Expanded holds the entities loaded for QueryRequest.Expand, keyed by relation name. A parent is
+	// a one-element list; nested expansions are found in the Expanded of the loaded entities.
+	Expanded map[string][]*DataRecord `json:"expanded,omitempty"`
 }
 
+// RecordMeta carries the system metadata of a stored entity. Timestamps are unix milliseconds.
+type RecordMeta struct {
+	CreatedAt     int64  `json:"created_at"`
+	UpdatedAt     int64  `json:"updated_at"`
+	DeletedAt     *int64 `json:"deleted_at,omitempty"`
+	SchemaVersion int    `json:"schema_version"`
+	Revision      int64  `json:"revision"` // starts at 1 and grows with every write
+}
+
+// Reserved attribute names that filter and sort on RecordMeta fields.
+const (
+	SystemAttrCreatedAt = "$created_at"
+	SystemAttrUpdatedAt = "$updated_at"
+	SystemAttrDeletedAt = "$deleted_at"
+	SystemAttrRevision  = "$revision"
+)
+
 // FilterType defines supported filter operations
 type FilterType string
 
@@ -49,6 +71,17 @@ type TableNames struct {
 	EntityMain     string `json:"entityMain"`
 	EAVData        string `json:"eavData"`
 	ChangeLog      string `json:"changeLog"`
+	// IdempotencyKeys stores replayable create results keyed by Idempotency-Key.
+	IdempotencyKeys string `json:"idempotencyKeys,omitempty"`
+	// History stores a snapshot of every write when Entity.EnableVersioning is on.
+	History string `json:"history,omitempty"`
+	// WebhookDeliveries stores the webhook delivery log and queue.
+	WebhookDeliveries string `json:"webhookDeliveries,omitempty"`
+	// ChangeCursors stores how far webhook delivery has read the change log.
+	ChangeCursors string `json:"changeCursors,omitempty"`
+	// Outbox receives an event row per affected entity in the transaction of every write, including
+	// set-based, bulk and purge writes.
+	Outbox string `json:"outbox,omitempty"`
 }
 
 type FilterField string
@@ -70,6 +103,7 @@ const (
 	OperationUpdate OperationType = "update"
 	OperationDelete OperationType = "delete"
 	OperationQuery  OperationType = "query"
+	OperationUpsert OperationType = "upsert"
 )
 
 // EntityIdentifier identifies an entity for operations
@@ -84,6 +118,14 @@ type EntityOperation struct {
 	Type    OperationType  `json:"type"`
 	Data    map[string]any `json:"data,omitempty"`
 	Updates map[string]any `json:"updates,omitempty"`
+	// RowRef resolves RowID from an earlier operation of the same batch, e.g. "$ref:0".
+	RowRef string `json:"rowRef,omitempty"`
+	// Refs sets dotted attribute paths of Data, or of Updates for an update, to the row IDs of
+	// earlier operations of the same batch, e.g. {"leadId": "$ref:0"}. Values in Data and Updates
+	// are stored as given.
+	Refs map[string]string `json:"refs,omitempty"`
+	// IdempotencyKey makes a create replayable: repeating it returns the original result.
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
 }
 
 // BatchOperation represents batch entity operations
@@ -100,6 +142,172 @@ type BatchResult struct {
 	Duration   int64            `json:"duration"` // microseconds
 }
 
+// EntityIterator streams entity data for BulkLoad, following the Next/Err pattern of pgx.CopyFromSource.
+type EntityIterator interface {
+	// Next advances to the next entity and reports whether one is available.
+	Next() bool
+	// Data returns the attributes of the current entity.
+	Data() map[string]any
+	// Err returns the error that stopped iteration, if any.
+	Err() error
+}
+
+// BulkLoadResult represents results from a bulk load
+type BulkLoadResult struct {
+	TotalCount int             `json:"totalCount"`
+	Loaded     int             `json:"loaded"`
+	Failed     []BulkLoadError `json:"failed"`
+	Duration   int64           `json:"duration"` // microseconds
+}
+
+// BulkLoadError reports an entity that could not be loaded
+type BulkLoadError struct {
+	Index int    `json:"index"` // zero-based position in the iterator
+	Error string `json:"error"`
+	Code  string `json:"code,omitempty"`
+}
+
+// sliceEntityIterator iterates over an in-memory slice of entities
+type sliceEntityIterator struct {
+	items []map[string]any
+	pos   int
+}
+
+// NewSliceEntityIterator returns an EntityIterator over items.
+func NewSliceEntityIterator(items []map[string]any) EntityIterator {
+	return &sliceEntityIterator{items: items, pos: -1}
+}
+
+func (it *sliceEntityIterator) Next() bool {
+	it.pos++
+	return it.pos < len(it.items)
+}
+
+func (it *sliceEntityIterator) Data() map[string]any {
+	return it.items[it.pos]
+}
+
+func (it *sliceEntityIterator) Err() error {
+	return nil
+}
+
+// ErrNotFound is returned when an operation targets an entity that does not exist or is soft-deleted.
+var ErrNotFound = errors.New("entity not found")
+
+// ErrEntityExists is returned when a create targets a row ID that is already taken.
+var ErrEntityExists = errors.New("entity already exists")
+
+// ErrIdempotencyKeyReused is returned when an idempotency key is replayed with a different request.
+var ErrIdempotencyKeyReused = errors.New("idempotency key reused with a different request")
+
+// ErrTxClosed is returned when a transactional EntityManager is used after its WithTx callback returned.
+var ErrTxClosed = errors.New("transaction already finished")
+
+// ErrUnsupportedFilter is returned when a filter cannot be evaluated against an attribute,
+// such as a range or LIKE filter on an encrypted attribute.
+var ErrUnsupportedFilter = errors.New("unsupported filter")
+
+// ErrHistoryDisabled is returned by GetHistory when versioning is off or no history table is configured.
+var ErrHistoryDisabled = errors.New("entity history is disabled")
+
+// ErrNotificationsDisabled is returned by WatchChanges when no notify channel is configured.
+var ErrNotificationsDisabled = errors.New("change notifications are disabled")
+
+// ErrRevisionNotFound is returned by Revert when the entity has no stored document at the requested revision.
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// ErrImmutableField is wrapped by every ImmutableFieldError.
+var ErrImmutableField = errors.New("immutable field cannot be changed")
+
+// ImmutableFieldError reports an update that changes a readOnly or x-immutable field.
+type ImmutableFieldError struct {
+	Path string `json:"path"`
+}
+
+func (e *ImmutableFieldError) Error() string {
+	return fmt.Sprintf("field %s is immutable and cannot be changed", e.Path)
+}
+
+func (e *ImmutableFieldError) Unwrap() error {
+	return ErrImmutableField
+}
+
+// ErrLimitExceeded is wrapped by every LimitError.
+var ErrLimitExceeded = errors.New("document limit exceeded")
+
+// Document limit codes reported by LimitError.Code.
+const (
+	LimitCodeEntityTooLarge    = "ENTITY_TOO_LARGE"
+	LimitCodeTooManyAttributes = "TOO_MANY_ATTRIBUTES"
+	LimitCodeArrayTooLong      = "ARRAY_TOO_LONG"
+	LimitCodeNestingTooDeep    = "NESTING_TOO_DEEP"
+)
+
+// LimitError reports a document rejected by one of the EntityConfig size or shape limits.
+type LimitError struct {
+	Code   string `json:"code"`
+	Path   string `json:"path,omitempty"`
+	Limit  int    `json:"limit"`
+	Actual int    `json:"actual"`
+}
+
+func (e *LimitError) Error() string {
+	if e.Path != "" {
+		return fmt.Sprintf("%s: %s is %d, limit is %d", e.Code, e.Path, e.Actual, e.Limit)
+	}
+	return fmt.Sprintf("%s: %d exceeds limit of %d", e.Code, e.Actual, e.Limit)
+}
+
+func (e *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// ErrDanglingReference is wrapped by every ReferenceError.
+var ErrDanglingReference = errors.New("dangling reference")
+
+// ReferenceCodeDangling is the BulkLoadError.Code of entities rejected with a ReferenceError.
+const ReferenceCodeDangling = "DANGLING_REFERENCE"
+
+// ReferenceError reports a foreign key that does not identify a live entity of its target schema.
+type ReferenceError struct {
+	Path         string `json:"path"`
+	TargetSchema string `json:"targetSchema"`
+	Value        string `json:"value"`
+}
+
+func (e *ReferenceError) Error() string {
+	return fmt.Sprintf("%s references missing %s %q", e.Path, e.TargetSchema, e.Value)
+}
+
+func (e *ReferenceError) Unwrap() error {
+	return ErrDanglingReference
+}
+
+// ErrDeleteRestricted is wrapped by every RestrictError.
+var ErrDeleteRestricted = errors.New("delete restricted by related entities")
+
+// ErrCascadeDepthExceeded is returned when a cascading delete would recurse deeper than
+// ReferenceConfig.MaxCascadeDepth.
+var ErrCascadeDepthExceeded = errors.New("cascade depth exceeded")
+
+// RestrictError reports a delete blocked by a restrict cascade rule: Count entities of ChildSchema
+// still reference the entity through Path.
+type RestrictError struct {
+	SchemaName  string    `json:"schemaName"`
+	RowID       uuid.UUID `json:"rowId"`
+	ChildSchema string    `json:"childSchema"`
+	Path        string    `json:"path"`
+	Count       int       `json:"count"`
+}
+
+func (e *RestrictError) Error() string {
+	return fmt.Sprintf("%s %s is referenced by %d %s through %s", e.SchemaName, e.RowID, e.Count, e.ChildSchema, e.Path)
+}
+
+func (e *RestrictError) Unwrap() error {
+	return ErrDeleteRestricted
+}
+
 // OperationError represents an error for a specific operation
 type OperationError struct {
 	Operation EntityOperation `json:"operation"`
@@ -108,6 +316,18 @@ type OperationError struct {
 	Details   map[string]any  `json:"details,omitempty"`
 }
 
+// OperationError codes reported for failures that map to a sentinel error.
+const (
+	// OperationCodeAlreadyExists marks create operations whose row ID is already taken.
+	OperationCodeAlreadyExists = "ALREADY_EXISTS"
+	// OperationCodeIdempotencyKeyReused marks creates that replayed an idempotency key with a different request.
+	OperationCodeIdempotencyKeyReused = "IDEMPOTENCY_KEY_REUSED"
+	// OperationCodeImmutableField marks updates that tried to change a readOnly or x-immutable field.
+	OperationCodeImmutableField = "IMMUTABLE_FIELD"
+	// OperationCodeDeleteRestricted marks deletes blocked by a restrict cascade rule.
+	OperationCodeDeleteRestricted = "DELETE_RESTRICTED"
+)
+
 // EntityUpdate represents an update operation
 type EntityUpdate struct {
 	EntityIdentifier
@@ -135,14 +355,17 @@ const (
 
 // QueryRequest represents a pagination query request.
 type QueryRequest struct {
-	SchemaName   string     `json:"schema_name" validate:"required"`
-	Page         int        `json:"page" validate:"min=1"`
-	ItemsPerPage int        `json:"items_per_page" validate:"min=1,max=100"`
-	Condition    Condition  `json:"-"` // Custom unmarshal, can be CompositeCondition or KvCondition
-	SortBy       []string   `json:"sort_by,omitempty"`
-	SortOrder    SortOrder  `json:"sort_order,omitempty"`
-	RowID        *uuid.UUID `json:"row_id,omitempty"` // For entity-specific operations
-	Attrs        []string   `json:"attrs,omitempty"`  // Attributes to return (field projection)
+	SchemaName     string       `json:"schema_name" validate:"required"`
+	Page           int          `json:"page" validate:"min=1"`
+	ItemsPerPage   int          `json:"items_per_page" validate:"min=1,max=100"`
+	Condition      Condition    `json:"-"` // Custom unmarshal, can be CompositeCondition or KvCondition
+	SortBy         []string     `json:"sort_by,omitempty"`
+	SortOrder      SortOrder    `json:"sort_order,omitempty"`
+	RowID          *uuid.UUID   `json:"row_id,omitempty"`          // For entity-specific operations
+	Attrs          []string     `json:"attrs,omitempty"`           // Attributes to return (field projection)
+	IncludeDeleted bool         `json:"include_deleted,omitempty"` // Include soft-deleted (tombstoned) rows
+	AsOf           *time.Time   `json:"as_of,omitempty"`           // Read entity state as recorded in the history at this time
+	Expand         []ExpandSpec `json:"expand,omitempty"`          // Related entities to load through x-relations
 }
 
 // UnmarshalJSON implements custom JSON unmarshaling for QueryRequest.
@@ -241,6 +464,51 @@ func (r CrossSchemaRequest) MarshalJSON() ([]byte, error) {
 	return json.Marshal(aux)
 }
 
+// WhereOptions controls UpdateWhere and DeleteWhere.
+type WhereOptions struct {
+	// DryRun reports how many entities match without changing anything.
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// WhereResult reports the outcome of UpdateWhere and DeleteWhere.
+type WhereResult struct {
+	Affected int64 `json:"affected"`
+	DryRun   bool  `json:"dry_run"`
+}
+
+// WhereRequest is the request body of update-by-condition and delete-by-condition calls.
+type WhereRequest struct {
+	SchemaName string         `json:"schema_name" validate:"required"`
+	Condition  Condition      `json:"-"` // Custom unmarshal, can be CompositeCondition or KvCondition
+	Patch      map[string]any `json:"patch,omitempty"`
+	WhereOptions
+}
+
+// UnmarshalJSON implements custom JSON unmarshaling for WhereRequest.
+func (r *WhereRequest) UnmarshalJSON(data []byte) error {
+	type Alias WhereRequest
+	aux := &struct {
+		Condition json.RawMessage `json:"condition,omitempty"`
+		*Alias
+	}{
+		Alias: (*Alias)(r),
+	}
+
+	if err := json.Unmarshal(data, aux); err != nil {
+		return err
+	}
+
+	if len(aux.Condition) > 0 && string(aux.Condition) != "null" {
+		cond, err := unmarshalCondition(aux.Condition)
+		if err != nil {
+			return err
+		}
+		r.Condition = cond
+	}
+
+	return nil
+}
+
 // QueryResult represents paginated query results.
 type QueryResult struct {
 	Data          []*DataRecord `json:"data"`
@@ -356,6 +624,11 @@ func (kv *KvCondition) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// ParseCondition decodes a JSON condition tree, e.g. one passed as a query string parameter.
+func ParseCondition(data []byte) (Condition, error) {
+	return unmarshalCondition(data)
+}
+
 // unmarshalCondition inspects the incoming JSON payload and instantiates the
 // correct Condition implementation (composite vs kv). This allows us to unmarshal
 // nested condition trees directly from JSON inputs.
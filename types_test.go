@@ -408,6 +408,22 @@ func TestQueryRequest_MarshalJSON(t *testing.T) {
 // CrossSchemaRequest JSON Tests
 // =============================================================================
 
+func TestWhereRequest_UnmarshalJSON(t *testing.T) {
+	var req WhereRequest
+	err := json.Unmarshal([]byte(`{"schema_name":"lead","condition":{"a":"ownerUserId","v":"agent-1"},"patch":{"ownerUserId":"agent-2"},"dry_run":true}`), &req)
+	require.NoError(t, err)
+
+	assert.Equal(t, "lead", req.SchemaName)
+	assert.True(t, req.DryRun)
+	assert.Equal(t, map[string]any{"ownerUserId": "agent-2"}, req.Patch)
+	kv, ok := req.Condition.(*KvCondition)
+	require.True(t, ok, "expected KvCondition, got %T", req.Condition)
+	assert.Equal(t, "ownerUserId", kv.Attr)
+
+	err = json.Unmarshal([]byte(`{"schema_name":"lead","condition":{"x":1}}`), &req)
+	assert.Error(t, err)
+}
+
 func TestCrossSchemaRequest_UnmarshalJSON(t *testing.T) {
 	tests := []struct {
 		name            string
@@ -0,0 +1,189 @@
+package forma
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Headers sent with every webhook request.
+const (
+	// WebhookSignatureHeader carries "t=<unix seconds>,v1=<hex HMAC-SHA256>" where the HMAC is keyed
+	// with the subscription secret and computed over "<t>.<body>".
+	WebhookSignatureHeader = "X-Forma-Signature"
+	// WebhookDeliveryHeader carries the delivery ID, which stays the same across retries so
+	// receivers can drop duplicates.
+	WebhookDeliveryHeader = "X-Forma-Delivery"
+	// WebhookEventHeader carries the ChangeOperation of the event.
+	WebhookEventHeader = "X-Forma-Event"
+)
+
+// ErrWebhooksDisabled is returned by the webhook API when no webhook delivery table is configured.
+var ErrWebhooksDisabled = errors.New("webhooks are disabled")
+
+// ErrInvalidWebhookSignature is returned by VerifyWebhookSignature when a signature does not match.
+var ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+
+// WebhookSubscription registers a URL for the changes of one schema.
+type WebhookSubscription struct {
+	// ID identifies the subscription in deliveries and payloads. It must be unique and stable,
+	// because pending deliveries are matched back to their subscription by it.
+	ID         string `json:"id" validate:"required"`
+	SchemaName string `json:"schema_name" validate:"required"`
+	// Operations limits the subscription to these operations. Empty subscribes to all of them.
+	Operations []ChangeOperation `json:"operations,omitempty"`
+	// Condition limits created and updated events to entities matching it. Deleted events are
+	// always delivered because a removed entity can no longer be matched. Like the payload, it is
+	// evaluated against the entity as it is when ProcessWebhooks reads the change, not as each write
+	// left it: writes between two passes arrive as one event, and an entity that entered a matching
+	// state and left it again before the pass is not delivered.
+	Condition Condition `json:"-"` // Custom unmarshal, can be CompositeCondition or KvCondition
+	URL       string    `json:"url" validate:"required"`
+	// Secret keys the HMAC signature of every request.
+	Secret string `json:"secret"`
+}
+
+// UnmarshalJSON implements custom JSON unmarshaling for WebhookSubscription.
+func (s *WebhookSubscription) UnmarshalJSON(data []byte) error {
+	type Alias WebhookSubscription
+	aux := &struct {
+		Condition json.RawMessage `json:"condition,omitempty"`
+		*Alias
+	}{
+		Alias: (*Alias)(s),
+	}
+
+	if err := json.Unmarshal(data, aux); err != nil {
+		return err
+	}
+
+	if len(aux.Condition) > 0 && string(aux.Condition) != "null" {
+		cond, err := unmarshalCondition(aux.Condition)
+		if err != nil {
+			return err
+		}
+		s.Condition = cond
+	}
+
+	return nil
+}
+
+// Accepts reports whether the subscription wants events of operation. It does not evaluate Condition.
+func (s *WebhookSubscription) Accepts(operation ChangeOperation) bool {
+	if len(s.Operations) == 0 {
+		return true
+	}
+	for _, op := range s.Operations {
+		if op == operation {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDeliveryStatus is the state of a webhook delivery.
+type WebhookDeliveryStatus string
+
+const (
+	// WebhookDeliveryPending deliveries are waiting for their first or next attempt.
+	WebhookDeliveryPending WebhookDeliveryStatus = "pending"
+	// WebhookDeliveryDelivered deliveries were acknowledged with a 2xx response.
+	WebhookDeliveryDelivered WebhookDeliveryStatus = "delivered"
+	// WebhookDeliveryDead deliveries ran out of attempts and are no longer retried.
+	WebhookDeliveryDead WebhookDeliveryStatus = "dead"
+)
+
+// WebhookPayload is the JSON body POSTed to subscribers.
+type WebhookPayload struct {
+	SubscriptionID string       `json:"subscription_id"`
+	Event          *ChangeEvent `json:"event"`
+}
+
+// WebhookDelivery is one entry of the webhook delivery log.
+type WebhookDelivery struct {
+	ID             int64                 `json:"id"`
+	SubscriptionID string                `json:"subscription_id"`
+	SchemaName     string                `json:"schema_name"`
+	RowID          uuid.UUID             `json:"row_id"`
+	Operation      ChangeOperation       `json:"operation"`
+	Status         WebhookDeliveryStatus `json:"status"`
+	Attempts       int                   `json:"attempts"`
+	NextAttemptAt  int64                 `json:"next_attempt_at"` // unix milliseconds
+	LastStatusCode int                   `json:"last_status_code,omitempty"`
+	LastError      string                `json:"last_error,omitempty"`
+	CreatedAt      int64                 `json:"created_at"` // unix milliseconds
+	UpdatedAt      int64                 `json:"updated_at"` // unix milliseconds
+	Payload        json.RawMessage       `json:"payload"`
+}
+
+// WebhookDeliveryFilter selects entries of the webhook delivery log. Zero fields match everything.
+type WebhookDeliveryFilter struct {
+	SubscriptionID string                `json:"subscription_id,omitempty"`
+	Status         WebhookDeliveryStatus `json:"status,omitempty"`
+	// Limit caps the number of entries returned, newest first. Zero uses Query.DefaultPageSize.
+	Limit int `json:"limit,omitempty"`
+}
+
+// WebhookResult summarizes one ProcessWebhooks pass.
+type WebhookResult struct {
+	// Enqueued is the number of deliveries created from the change feed.
+	Enqueued int `json:"enqueued"`
+	// Delivered, Retried and Dead count the attempts made by their outcome.
+	Delivered int `json:"delivered"`
+	Retried   int `json:"retried"`
+	Dead      int `json:"dead"`
+}
+
+// SignWebhookPayload returns the WebhookSignatureHeader value for body sent at timestamp (unix seconds).
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, webhookHMAC(secret, timestamp, body))
+}
+
+// VerifyWebhookSignature checks a WebhookSignatureHeader value against body and returns its
+// timestamp. Receivers should also reject timestamps too far in the past to stop replays.
+func VerifyWebhookSignature(secret, header string, body []byte) (int64, error) {
+	var timestamp int64
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			ts, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("%w: malformed timestamp", ErrInvalidWebhookSignature)
+			}
+			timestamp = ts
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if timestamp == 0 || len(signatures) == 0 {
+		return 0, fmt.Errorf("%w: missing timestamp or signature", ErrInvalidWebhookSignature)
+	}
+
+	expected := []byte(webhookHMAC(secret, timestamp, body))
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(signature), expected) {
+			return timestamp, nil
+		}
+	}
+	return 0, ErrInvalidWebhookSignature
+}
+
+func webhookHMAC(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
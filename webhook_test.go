@@ -0,0 +1,49 @@
+package forma
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookSignature_RoundTrip(t *testing.T) {
+	body := []byte(`{"subscription_id":"crm"}`)
+	header := SignWebhookPayload("secret", 1700000000, body)
+
+	ts, err := VerifyWebhookSignature("secret", header, body)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1700000000), ts)
+
+	_, err = VerifyWebhookSignature("other", header, body)
+	assert.True(t, errors.Is(err, ErrInvalidWebhookSignature))
+
+	_, err = VerifyWebhookSignature("secret", header, []byte(`{"subscription_id":"audit"}`))
+	assert.True(t, errors.Is(err, ErrInvalidWebhookSignature))
+
+	_, err = VerifyWebhookSignature("secret", "v1=abc", body)
+	assert.True(t, errors.Is(err, ErrInvalidWebhookSignature))
+}
+
+func TestWebhookSubscription_UnmarshalJSON(t *testing.T) {
+	var sub WebhookSubscription
+	err := json.Unmarshal([]byte(`{
+		"id": "crm",
+		"schema_name": "lead",
+		"operations": ["created", "updated"],
+		"condition": {"a": "stage", "v": "equals:contract"},
+		"url": "https://example.com/hook",
+		"secret": "s"
+	}`), &sub)
+	require.NoError(t, err)
+
+	assert.Equal(t, "crm", sub.ID)
+	assert.Equal(t, "https://example.com/hook", sub.URL)
+	kv, ok := sub.Condition.(*KvCondition)
+	require.True(t, ok)
+	assert.Equal(t, "stage", kv.Attr)
+	assert.True(t, sub.Accepts(ChangeOperationUpdated))
+	assert.False(t, sub.Accepts(ChangeOperationDeleted))
+}